@@ -0,0 +1,232 @@
+package actor
+
+import (
+	"errors"
+	"runtime/debug"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrActorNotFound = errors.New("actor: not found")
+	ErrActorExists   = errors.New("actor: already exists")
+	ErrMailboxFull   = errors.New("actor: mailbox full")
+	ErrSystemStopped = errors.New("actor: system stopped")
+)
+
+// DefaultMailboxSize 未指定时每个actor邮箱的长度
+const DefaultMailboxSize = 1024
+
+/*
+	Actor 玩家、房间等需要串行处理的逻辑单元，同一个actor的Receive只会在其邮箱goroutine中依次调用，
+	访问自身状态无需加锁。传入的iface.Request在处理完成后会被回收，投递前需调用Copy
+*/
+type Actor interface {
+	Receive(msg interface{})
+}
+
+// ActorFunc 函数形式的Actor
+type ActorFunc func(msg interface{})
+
+// Receive 处理消息
+func (f ActorFunc) Receive(msg interface{}) {
+	f(msg)
+}
+
+// Started actor启动后收到的第一条消息
+type Started struct{}
+
+// Stopped actor停止前收到的最后一条消息
+type Stopped struct{}
+
+// envelope 邮箱中的消息，fn不为空时在actor goroutine中执行fn
+type envelope struct {
+	msg interface{}
+	fn  func()
+}
+
+// mailbox actor邮箱
+type mailbox struct {
+	id    string
+	actor Actor
+	ch    chan envelope
+}
+
+// System actor系统，管理全部actor的邮箱goroutine
+type System struct {
+	actors      map[string]*mailbox
+	factory     func(id string) Actor
+	mailboxSize int
+	stopped     bool
+	wg          sync.WaitGroup
+	lock        sync.RWMutex
+}
+
+// NewSystem 创建actor系统，mailboxSize<=0时使用DefaultMailboxSize
+func NewSystem(mailboxSize int) *System {
+	if mailboxSize <= 0 {
+		mailboxSize = DefaultMailboxSize
+	}
+	return &System{
+		actors:      make(map[string]*mailbox),
+		mailboxSize: mailboxSize,
+	}
+}
+
+// SetFactory 设置actor工厂，Tell不存在的actor时自动创建
+func (s *System) SetFactory(factory func(id string) Actor) {
+	s.lock.Lock()
+	s.factory = factory
+	s.lock.Unlock()
+}
+
+// Spawn 创建并启动actor
+func (s *System) Spawn(id string, actor Actor) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.stopped {
+		return ErrSystemStopped
+	}
+	if _, ok := s.actors[id]; ok {
+		return ErrActorExists
+	}
+	s.spawn(id, actor)
+	return nil
+}
+
+// spawn 启动邮箱goroutine，调用方需持有锁
+func (s *System) spawn(id string, actor Actor) *mailbox {
+	mb := &mailbox{
+		id:    id,
+		actor: actor,
+		ch:    make(chan envelope, s.mailboxSize),
+	}
+	s.actors[id] = mb
+	s.wg.Add(1)
+	go s.run(mb)
+	return mb
+}
+
+// run actor邮箱goroutine，逐条处理消息
+func (s *System) run(mb *mailbox) {
+	defer s.wg.Done()
+	s.receive(mb, envelope{msg: Started{}})
+	for env := range mb.ch {
+		s.receive(mb, env)
+	}
+	s.receive(mb, envelope{msg: Stopped{}})
+}
+
+// receive 处理一条消息，panic不会终止actor
+func (s *System) receive(mb *mailbox, env envelope) {
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Errorw("actor panic",
+				"actor", mb.id,
+				"err", err,
+				"stack", string(debug.Stack()),
+			)
+		}
+	}()
+	if env.fn != nil {
+		env.fn()
+		return
+	}
+	mb.actor.Receive(env.msg)
+}
+
+// mailbox 获取actor邮箱，不存在且设置了工厂时自动创建；工厂在锁外调用，
+// 可在工厂中加载数据或访问System，并发创建同一actor时只保留先插入的一个，其余未启动即丢弃
+func (s *System) mailbox(id string) (*mailbox, error) {
+	s.lock.RLock()
+	mb, ok := s.actors[id]
+	stopped, factory := s.stopped, s.factory
+	s.lock.RUnlock()
+	if ok {
+		return mb, nil
+	}
+	if stopped {
+		return nil, ErrSystemStopped
+	}
+	if factory == nil {
+		return nil, ErrActorNotFound
+	}
+	actor := factory(id)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if mb, ok := s.actors[id]; ok {
+		return mb, nil
+	}
+	if s.stopped {
+		return nil, ErrSystemStopped
+	}
+	return s.spawn(id, actor), nil
+}
+
+// post 向邮箱投递，邮箱已满时返回ErrMailboxFull
+func (s *System) post(id string, env envelope) error {
+	// 持读锁投递，避免与Stop关闭邮箱并发
+	mb, err := s.mailbox(id)
+	if err != nil {
+		return err
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.actors[id] != mb {
+		return ErrActorNotFound
+	}
+	select {
+	case mb.ch <- env:
+		return nil
+	default:
+		return ErrMailboxFull
+	}
+}
+
+// Tell 向actor投递消息
+func (s *System) Tell(id string, msg interface{}) error {
+	return s.post(id, envelope{msg: msg})
+}
+
+// Do 在actor goroutine中执行fn，可安全访问actor状态
+func (s *System) Do(id string, fn func()) error {
+	return s.post(id, envelope{fn: fn})
+}
+
+// Has actor是否存在
+func (s *System) Has(id string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, ok := s.actors[id]
+	return ok
+}
+
+// Len actor数量
+func (s *System) Len() int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.actors)
+}
+
+// Stop 停止actor，邮箱中已有的消息处理完后退出，可在actor自身的Receive中调用
+func (s *System) Stop(id string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if mb, ok := s.actors[id]; ok {
+		delete(s.actors, id)
+		close(mb.ch)
+	}
+}
+
+// Shutdown 停止全部actor并等待退出
+func (s *System) Shutdown() {
+	s.lock.Lock()
+	s.stopped = true
+	for id, mb := range s.actors {
+		delete(s.actors, id)
+		close(mb.ch)
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
@@ -0,0 +1,204 @@
+package admin
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/protodoc"
+)
+
+// connInfo 连接信息
+type connInfo struct {
+	ConnID        int64           `json:"conn_id"`
+	UID           string          `json:"uid"`
+	RemoteAddr    string          `json:"remote_addr"`
+	StartTime     time.Time       `json:"start_time"`
+	Uptime        string          `json:"uptime"`
+	LastHeartbeat time.Time       `json:"last_heartbeat"`
+	Stats         iface.ConnStats `json:"stats"`
+}
+
+// broadcastReq 广播请求
+type broadcastReq struct {
+	MsgID   uint32 `json:"msg_id"`
+	Message string `json:"message"`
+}
+
+// acceptReq 开关新连接请求
+type acceptReq struct {
+	Enabled bool `json:"enabled"`
+}
+
+// registerAPI 注册管理接口
+func (a *Server) registerAPI() {
+	g := a.engine.Group("/admin")
+	g.GET("/conns", a.listConns)
+	g.POST("/conns/:id/kick", a.kickConn)
+	g.GET("/conns/:id/chaos", a.getChaos)
+	g.PUT("/conns/:id/chaos", a.setChaos)
+	g.DELETE("/conns/:id/chaos", a.clearChaos)
+	g.POST("/broadcast", a.broadcast)
+	g.GET("/accept", a.getAccept)
+	g.PUT("/accept", a.setAccept)
+	g.GET("/workers", a.workers)
+	g.GET("/stats", a.stats)
+	g.GET("/drops", a.drops)
+	g.GET("/protocol", a.protocol)
+}
+
+// listConns 列出在线连接
+func (a *Server) listConns(c *gin.Context) {
+	now := time.Now()
+	conns := make([]connInfo, 0, a.server.GetConnMgr().Len())
+	a.server.GetConnMgr().Search(func(conn iface.Connection) {
+		conns = append(conns, connInfo{
+			ConnID:        conn.GetConnID(),
+			UID:           conn.GetUID(),
+			RemoteAddr:    conn.RemoteAddr().String(),
+			StartTime:     conn.GetStartTime(),
+			Uptime:        now.Sub(conn.GetStartTime()).Truncate(time.Second).String(),
+			LastHeartbeat: conn.GetHeartbeatTime(),
+			Stats:         conn.Stats(),
+		})
+	})
+	sort.Slice(conns, func(i, j int) bool { return conns[i].ConnID < conns[j].ConnID })
+	c.JSON(http.StatusOK, gin.H{"total": len(conns), "conns": conns})
+}
+
+// kickConn 踢掉连接，可通过reason与msg_id参数指定下发的踢出原因
+func (a *Server) kickConn(c *gin.Context) {
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conn id"})
+		return
+	}
+	msgID, _ := strconv.ParseUint(c.Query("msg_id"), 10, 32)
+	if err := a.server.GetConnMgr().Kick(connID, c.Query("reason"), uint32(msgID)); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"conn_id": connID})
+}
+
+// findConn 按路径参数id查找连接，找不到时回复错误
+func (a *Server) findConn(c *gin.Context) (iface.Connection, bool) {
+	connID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conn id"})
+		return nil, false
+	}
+	conn, err := a.server.GetConnMgr().Get(connID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return nil, false
+	}
+	return conn, true
+}
+
+// getChaos 查询连接的网络故障注入
+func (a *Server) getChaos(c *gin.Context) {
+	conn, ok := a.findConn(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, conn.GetChaos())
+}
+
+// setChaos 对连接注入延迟、抖动、重排与丢包，用于测试弱网下的游戏逻辑
+func (a *Server) setChaos(c *gin.Context) {
+	conn, ok := a.findConn(c)
+	if !ok {
+		return
+	}
+	var chaos iface.Chaos
+	if err := c.ShouldBindJSON(&chaos); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := chaos.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	conn.SetChaos(chaos)
+	c.JSON(http.StatusOK, chaos)
+}
+
+// clearChaos 关闭连接的网络故障注入
+func (a *Server) clearChaos(c *gin.Context) {
+	conn, ok := a.findConn(c)
+	if !ok {
+		return
+	}
+	conn.SetChaos(iface.Chaos{})
+	c.JSON(http.StatusOK, gin.H{"conn_id": conn.GetConnID()})
+}
+
+// broadcast 向全部在线连接广播维护公告
+func (a *Server) broadcast(c *gin.Context) {
+	var req broadcastReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	sent := a.server.Broadcast(req.MsgID, []byte(req.Message))
+	c.JSON(http.StatusOK, gin.H{"sent": sent})
+}
+
+// getAccept 查询是否接受新连接
+func (a *Server) getAccept(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"enabled": a.server.IsAccepting()})
+}
+
+// setAccept 开关新连接
+func (a *Server) setAccept(c *gin.Context) {
+	var req acceptReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	a.server.SetAccepting(req.Enabled)
+	c.JSON(http.StatusOK, gin.H{"enabled": req.Enabled})
+}
+
+// workers 工作池统计信息
+func (a *Server) workers(c *gin.Context) {
+	stats := a.server.GetMsgHandler().Stats()
+	c.JSON(http.StatusOK, gin.H{
+		"workers":     stats.Workers,
+		"min_workers": stats.MinWorkers,
+		"max_workers": stats.MaxWorkers,
+		"queue_depth": stats.QueueDepth,
+		"handled":     stats.Handled,
+		"avg_wait":    stats.AvgWait.String(),
+		"avg_handle":  stats.AvgHandle.String(),
+		"panics":      a.server.GetMsgHandler().PanicCount(),
+	})
+}
+
+// stats 全部在线连接的收发统计汇总
+func (a *Server) stats(c *gin.Context) {
+	c.JSON(http.StatusOK, a.server.GetConnMgr().Stats())
+}
+
+// drops 服务启动以来各原因丢失的消息总数
+func (a *Server) drops(c *gin.Context) {
+	c.JSON(http.StatusOK, a.server.DropStats())
+}
+
+// protocol 已注册路由的协议描述，format=proto时输出MsgID枚举的.proto文件，package参数为proto包名
+func (a *Server) protocol(c *gin.Context) {
+	p := a.server.Protocol()
+	if c.Query("format") != "proto" {
+		c.JSON(http.StatusOK, p)
+		return
+	}
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := protodoc.WriteProto(c.Writer, p, c.Query("package")); err != nil {
+		_ = c.Error(err)
+	}
+}
@@ -0,0 +1,74 @@
+package admin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"runtime/debug"
+	rpprof "runtime/pprof"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerDebug 注册pprof与运行时调试接口
+func (a *Server) registerDebug() {
+	g := a.engine.Group("/debug")
+	g.GET("/pprof/", gin.WrapF(pprof.Index))
+	g.GET("/pprof/cmdline", gin.WrapF(pprof.Cmdline))
+	g.GET("/pprof/profile", gin.WrapF(pprof.Profile))
+	g.GET("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.POST("/pprof/symbol", gin.WrapF(pprof.Symbol))
+	g.GET("/pprof/trace", gin.WrapF(pprof.Trace))
+	g.GET("/pprof/:name", func(c *gin.Context) {
+		pprof.Handler(c.Param("name")).ServeHTTP(c.Writer, c.Request)
+	})
+	g.GET("/goroutines", a.goroutines)
+	g.GET("/memstats", a.memStats)
+}
+
+// goroutines 连接读写goroutine的堆栈，可通过conn_id参数过滤单个连接
+func (a *Server) goroutines(c *gin.Context) {
+	var buf bytes.Buffer
+	if err := rpprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	filter := `"conn_id":"`
+	if connID := c.Query("conn_id"); connID != "" {
+		filter += connID + `"`
+	}
+	// debug=1 的输出中每组堆栈以空行分隔，标签位于 "# labels:" 行
+	var out strings.Builder
+	for _, block := range strings.Split(buf.String(), "\n\n") {
+		if strings.Contains(block, "# labels:") && strings.Contains(block, filter) {
+			out.WriteString(block)
+			out.WriteString("\n\n")
+		}
+	}
+	c.String(http.StatusOK, out.String())
+}
+
+// memStats 内存与GC快照
+func (a *Server) memStats(c *gin.Context) {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	var gc debug.GCStats
+	debug.ReadGCStats(&gc)
+	c.JSON(http.StatusOK, gin.H{
+		"goroutines":     runtime.NumGoroutine(),
+		"connections":    a.server.GetConnMgr().Len(),
+		"alloc":          ms.Alloc,
+		"total_alloc":    ms.TotalAlloc,
+		"sys":            ms.Sys,
+		"heap_alloc":     ms.HeapAlloc,
+		"heap_inuse":     ms.HeapInuse,
+		"heap_objects":   ms.HeapObjects,
+		"stack_inuse":    ms.StackInuse,
+		"num_gc":         ms.NumGC,
+		"pause_total_ns": ms.PauseTotalNs,
+		"last_gc":        gc.LastGC,
+		"gc_pause":       gc.Pause,
+	})
+}
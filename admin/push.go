@@ -0,0 +1,127 @@
+package admin
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// 推送结果
+const (
+	PushDelivered    = "delivered"     // 已投递
+	PushNotConnected = "not_connected" // 目标不在线
+	PushInvalid      = "invalid"       // 请求参数错误
+)
+
+// pushReq 推送请求，uid与conn_id二选一
+type pushReq struct {
+	UID     string `json:"uid"`
+	ConnID  int64  `json:"conn_id"`
+	MsgID   uint32 `json:"msg_id"`
+	Payload string `json:"payload"`
+	Base64  bool   `json:"base64"` // payload是否为base64编码的二进制内容
+}
+
+// pushBatchReq 批量推送请求
+type pushBatchReq struct {
+	Items []pushReq `json:"items"`
+}
+
+// pushResult 推送结果
+type pushResult struct {
+	UID       string `json:"uid,omitempty"`
+	ConnID    int64  `json:"conn_id,omitempty"`
+	Status    string `json:"status"`
+	Delivered int    `json:"delivered"` // 成功投递的连接数量
+	Error     string `json:"error,omitempty"`
+}
+
+// registerPush 注册推送接口，供运维脚本与Web后端向在线玩家推送消息；
+// 推送可向任意玩家下发任意消息，未配置token时不注册
+func (a *Server) registerPush() {
+	if a.token == "" {
+		zap.S().Warn("admin token is empty, push api disabled")
+		return
+	}
+	a.engine.POST("/push", a.push)
+	a.engine.POST("/push/batch", a.pushBatch)
+}
+
+// push 向uid或连接推送消息
+func (a *Server) push(c *gin.Context) {
+	var req pushReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	result := a.pushOne(req)
+	if result.Status == PushInvalid {
+		c.JSON(http.StatusBadRequest, result)
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// pushBatch 批量推送，逐条返回推送结果
+func (a *Server) pushBatch(c *gin.Context) {
+	var req pushBatchReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	results := make([]pushResult, 0, len(req.Items))
+	delivered := 0
+	for _, item := range req.Items {
+		result := a.pushOne(item)
+		if result.Status == PushDelivered {
+			delivered++
+		}
+		results = append(results, result)
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(results), "delivered": delivered, "results": results})
+}
+
+// pushOne 执行单条推送
+func (a *Server) pushOne(req pushReq) pushResult {
+	result := pushResult{UID: req.UID, ConnID: req.ConnID}
+	if (req.UID == "") == (req.ConnID == 0) {
+		result.Status = PushInvalid
+		result.Error = "one of uid and conn_id is required"
+		return result
+	}
+	data := []byte(req.Payload)
+	if req.Base64 {
+		var err error
+		if data, err = base64.StdEncoding.DecodeString(req.Payload); err != nil {
+			result.Status = PushInvalid
+			result.Error = err.Error()
+			return result
+		}
+	}
+	var conns []iface.Connection
+	if req.ConnID != 0 {
+		if conn, err := a.server.GetConnMgr().Get(req.ConnID); err == nil {
+			conns = append(conns, conn)
+		}
+	} else {
+		a.server.GetConnMgr().Search(func(conn iface.Connection) {
+			if conn.GetUID() == req.UID {
+				conns = append(conns, conn)
+			}
+		})
+	}
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(req.MsgID, data); err == nil {
+			result.Delivered++
+		}
+	}
+	result.Status = PushDelivered
+	if result.Delivered == 0 {
+		result.Status = PushNotConnected
+	}
+	return result
+}
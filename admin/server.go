@@ -0,0 +1,89 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// TokenHeader 管理后台token请求头
+const TokenHeader = "X-Admin-Token"
+
+// Server 管理后台，独立端口监听，提供pprof、运行时调试与运维管理接口
+type Server struct {
+	server iface.Server
+	token  string
+	engine *gin.Engine
+	http   *http.Server
+}
+
+// NewServer 创建管理后台，token为空时不校验并且只监听本机回环地址
+func NewServer(s iface.Server, addr string, token string) *Server {
+	a := &Server{
+		server: s,
+		token:  token,
+		engine: gin.New(),
+	}
+	a.engine.Use(gin.Recovery(), a.auth)
+	a.http = &http.Server{Addr: listenAddr(addr, token), Handler: a.engine}
+	a.registerDebug()
+	a.registerAPI()
+	a.registerPush()
+	return a
+}
+
+// Engine 获取管理后台路由，可用于注册自定义管理接口
+func (a *Server) Engine() *gin.Engine {
+	return a.engine
+}
+
+// Start 启动管理后台监听
+func (a *Server) Start() {
+	go func() {
+		zap.S().Info("[START] admin server listen ", a.http.Addr)
+		if err := a.http.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.S().Error("admin server error ", err)
+		}
+	}()
+}
+
+// Stop 停止管理后台
+func (a *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = a.http.Shutdown(ctx)
+}
+
+// listenAddr 未配置token时将监听地址改为本机回环地址，避免无鉴权的管理接口暴露到外网
+func listenAddr(addr, token string) string {
+	if token != "" {
+		return addr
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		return addr
+	}
+	zap.S().Warn("admin token is empty, listen on loopback only, addr = ", addr)
+	return net.JoinHostPort("127.0.0.1", port)
+}
+
+// auth 校验管理后台token，token只能通过请求头传递，URL参数会被记录到访问日志与代理日志中
+func (a *Server) auth(c *gin.Context) {
+	if a.token == "" {
+		return
+	}
+	token := c.GetHeader(TokenHeader)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid admin token"})
+	}
+}
@@ -0,0 +1,203 @@
+package analytics
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+// 事件类型
+const (
+	EventConnect    = "connect"
+	EventDisconnect = "disconnect"
+	EventAuth       = "auth"
+	EventKick       = "kick"
+	EventCheat      = "cheat" // anticheat校验未通过
+)
+
+// Event 结构化的分析事件
+type Event struct {
+	Type       string                 `json:"type"`
+	Time       time.Time              `json:"time"`
+	ConnID     int64                  `json:"conn_id"`
+	UID        string                 `json:"uid,omitempty"`
+	RemoteAddr string                 `json:"remote_addr,omitempty"`
+	Listener   string                 `json:"listener,omitempty"`
+	OK         bool                   `json:"ok,omitempty"`          // 鉴权是否成功
+	Reason     string                 `json:"reason,omitempty"`      // 断开原因或鉴权失败原因
+	DurationMs int64                  `json:"duration_ms,omitempty"` // 断开时的连接时长(毫秒)
+	Stats      *iface.ConnStats       `json:"stats,omitempty"`       // 断开时的收发统计
+	Props      map[string]interface{} `json:"props,omitempty"`       // 业务自定义字段
+}
+
+// Sink 事件的批量写入目标，如文件、HTTP、Kafka，Write在Tracker的发送goroutine中串行调用
+type Sink interface {
+	Write(events []Event) error
+}
+
+// SinkFunc 函数形式的Sink
+type SinkFunc func(events []Event) error
+
+func (f SinkFunc) Write(events []Event) error {
+	return f(events)
+}
+
+// Options 批量发送参数
+type Options struct {
+	BatchSize     int           // 单批最多事件数，默认100
+	FlushInterval time.Duration // 未凑满一批时的最长等待时间，默认1s
+	QueueSize     int           // 等待发送的事件队列长度，已满时丢弃新事件，默认10000
+}
+
+// Tracker 非阻塞的事件采集器，事件先进入队列，由后台goroutine按批写入Sink
+type Tracker struct {
+	sink    Sink
+	opts    Options
+	queue   chan Event
+	dropped uint64
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New 创建事件采集器并启动后台发送
+func New(sink Sink, opts Options) *Tracker {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = time.Second
+	}
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	t := &Tracker{
+		sink:  sink,
+		opts:  opts,
+		queue: make(chan Event, opts.QueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Track 提交事件，队列已满或已关闭时丢弃并返回false，不会阻塞调用方
+func (t *Tracker) Track(e Event) bool {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	select {
+	case <-t.quit:
+		atomic.AddUint64(&t.dropped, 1)
+		return false
+	default:
+	}
+	select {
+	case t.queue <- e:
+		return true
+	default:
+		atomic.AddUint64(&t.dropped, 1)
+		return false
+	}
+}
+
+// Dropped 因队列已满或已关闭丢弃的事件数
+func (t *Tracker) Dropped() uint64 {
+	return atomic.LoadUint64(&t.dropped)
+}
+
+// Close 停止采集，写出队列中剩余的事件后返回
+func (t *Tracker) Close() {
+	t.once.Do(func() { close(t.quit) })
+	<-t.done
+}
+
+// Attach 采集Server的连接、断开、鉴权与踢出事件，需在Server停止之后调用Close，以写出断开全部连接时的事件
+func (t *Tracker) Attach(s iface.Server) {
+	s.AddOnAccept(func(conn iface.Connection) {
+		t.Track(NewEvent(EventConnect, conn))
+	})
+	s.AddOnAuth(func(conn iface.Connection, uid string, err error) {
+		e := NewEvent(EventAuth, conn)
+		e.UID = uid
+		e.OK = err == nil
+		if err != nil {
+			e.Reason = err.Error()
+		}
+		t.Track(e)
+	})
+	s.AddOnClose(func(conn iface.Connection, reason error) {
+		if errors.Is(reason, netw.ErrKicked) {
+			t.Track(NewEvent(EventKick, conn))
+		}
+		e := NewEvent(EventDisconnect, conn)
+		e.Reason = reason.Error()
+		e.DurationMs = time.Since(conn.GetStartTime()).Milliseconds()
+		stats := conn.Stats()
+		e.Stats = &stats
+		t.Track(e)
+	})
+}
+
+// newEvent 以连接信息创建事件
+func NewEvent(typ string, conn iface.Connection) Event {
+	e := Event{
+		Type:     typ,
+		Time:     time.Now(),
+		ConnID:   conn.GetConnID(),
+		UID:      conn.GetUID(),
+		Listener: conn.GetListenerTag(),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	return e
+}
+
+// run 按批写出事件，关闭时写出队列中剩余的事件
+func (t *Tracker) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Event, 0, t.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.sink.Write(batch); err != nil {
+			zap.S().Warn("analytics sink write error ", err, " events = ", len(batch))
+		}
+		batch = make([]Event, 0, t.opts.BatchSize)
+	}
+	for {
+		select {
+		case e := <-t.queue:
+			batch = append(batch, e)
+			if len(batch) >= t.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.quit:
+			for {
+				select {
+				case e := <-t.queue:
+					batch = append(batch, e)
+					if len(batch) >= t.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
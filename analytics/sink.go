@@ -0,0 +1,102 @@
+package analytics
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// WriterSink 以JSON Lines格式写入io.Writer
+type WriterSink struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+// NewWriterSink 创建写入w的Sink
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w}
+}
+
+func (s *WriterSink) Write(events []Event) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	bw := bufio.NewWriter(s.w)
+	enc := json.NewEncoder(bw)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// FileSink 以JSON Lines格式追加写入文件
+type FileSink struct {
+	*WriterSink
+	file *os.File
+}
+
+// NewFileSink 打开或创建文件，事件追加到文件末尾
+func NewFileSink(path string) (*FileSink, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSink{WriterSink: NewWriterSink(f), file: f}, nil
+}
+
+// Close 关闭文件，需在Tracker.Close之后调用
+func (s *FileSink) Close() error {
+	return s.file.Close()
+}
+
+// HTTPSink 以JSON数组POST到HTTP接口
+type HTTPSink struct {
+	url    string
+	client *http.Client
+	header http.Header
+}
+
+// NewHTTPSink 创建POST到url的Sink，client为nil时使用5秒超时的默认客户端
+func NewHTTPSink(url string, client *http.Client) *HTTPSink {
+	if client == nil {
+		client = &http.Client{Timeout: 5 * time.Second}
+	}
+	return &HTTPSink{url: url, client: client, header: http.Header{}}
+}
+
+// Header 请求头，可用于设置鉴权信息，需在开始发送前设置
+func (s *HTTPSink) Header() http.Header {
+	return s.header
+}
+
+func (s *HTTPSink) Write(events []Event) error {
+	body, err := json.Marshal(events)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("analytics: http sink status %d", resp.StatusCode)
+	}
+	return nil
+}
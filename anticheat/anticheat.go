@@ -0,0 +1,202 @@
+package anticheat
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/xiaomingping/game/analytics"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+)
+
+// Verdict 校验结果，每个未通过的结果分别处理
+type Verdict int
+
+const (
+	Pass       Verdict = iota // 通过
+	Shadow                    // 只记录日志，不上报不处理，用于观察新规则的误判
+	Flag                      // 上报分析事件后继续处理消息
+	Disconnect                // 上报分析事件后丢弃消息并断开连接
+)
+
+func (v Verdict) String() string {
+	switch v {
+	case Pass:
+		return "pass"
+	case Shadow:
+		return "shadow"
+	case Flag:
+		return "flag"
+	case Disconnect:
+		return "disconnect"
+	}
+	return fmt.Sprintf("verdict(%d)", int(v))
+}
+
+// Result 校验器的返回值
+type Result struct {
+	Verdict Verdict
+	Reason  string
+}
+
+// OK 通过校验
+var OK = Result{}
+
+// Validator 校验器，可读取请求内容与连接收发统计
+type Validator func(request iface.Request, stats iface.ConnStats) Result
+
+// validator 已注册的校验器
+type validator struct {
+	name   string
+	fn     Validator
+	msgIDs map[uint32]struct{} // 为nil时校验全部消息
+	shadow bool
+}
+
+// Pipeline 反作弊校验流水线，以中间件的方式在业务处理之前依次调用校验器
+type Pipeline struct {
+	lock       sync.RWMutex
+	validators []*validator
+	tracker    *analytics.Tracker
+	onVerdict  func(request iface.Request, name string, result Result)
+}
+
+// New 创建校验流水线，tracker不为nil时Flag与Disconnect的结果以EventCheat事件上报
+func New(tracker *analytics.Tracker) *Pipeline {
+	return &Pipeline{tracker: tracker}
+}
+
+// Register 注册校验器，msgIDs为空时校验全部消息，同名的校验器会被替换
+func (p *Pipeline) Register(name string, fn Validator, msgIDs ...uint32) {
+	v := &validator{name: name, fn: fn}
+	if len(msgIDs) > 0 {
+		v.msgIDs = make(map[uint32]struct{}, len(msgIDs))
+		for _, msgID := range msgIDs {
+			v.msgIDs[msgID] = struct{}{}
+		}
+	}
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	// 写时复制，Check在锁外遍历
+	validators := make([]*validator, 0, len(p.validators)+1)
+	replaced := false
+	for _, old := range p.validators {
+		if old.name == name {
+			v.shadow = old.shadow
+			validators = append(validators, v)
+			replaced = true
+			continue
+		}
+		validators = append(validators, old)
+	}
+	if !replaced {
+		validators = append(validators, v)
+	}
+	p.validators = validators
+}
+
+// Remove 移除校验器
+func (p *Pipeline) Remove(name string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	validators := make([]*validator, 0, len(p.validators))
+	for _, v := range p.validators {
+		if v.name != name {
+			validators = append(validators, v)
+		}
+	}
+	p.validators = validators
+}
+
+// SetShadow 设置校验器是否为影子模式，影子模式下未通过的结果都降级为Shadow
+func (p *Pipeline) SetShadow(name string, shadow bool) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	validators := make([]*validator, len(p.validators))
+	for i, v := range p.validators {
+		if v.name == name {
+			copied := *v
+			copied.shadow = shadow
+			v = &copied
+		}
+		validators[i] = v
+	}
+	p.validators = validators
+}
+
+// SetOnVerdict 设置校验未通过时的Hook函数，在上报与处理之前调用
+func (p *Pipeline) SetOnVerdict(hookFunc func(request iface.Request, name string, result Result)) {
+	p.onVerdict = hookFunc
+}
+
+// Attach 将校验流水线挂载到Server
+func (p *Pipeline) Attach(s iface.Server) {
+	s.Use(p.Middleware())
+}
+
+// Middleware 校验中间件，结果为Disconnect时不再调用后续的校验器与处理方法
+func (p *Pipeline) Middleware() iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			if p.Check(request) {
+				next(request)
+			}
+		}
+	}
+}
+
+// Check 依次调用匹配的校验器并处理结果，返回消息是否继续处理
+func (p *Pipeline) Check(request iface.Request) bool {
+	p.lock.RLock()
+	validators := p.validators
+	p.lock.RUnlock()
+	msgID := request.GetMsgID()
+	stats := request.GetConnection().Stats()
+	for _, v := range validators {
+		if v.msgIDs != nil {
+			if _, ok := v.msgIDs[msgID]; !ok {
+				continue
+			}
+		}
+		result := v.fn(request, stats)
+		if result.Verdict == Pass {
+			continue
+		}
+		if v.shadow {
+			result.Verdict = Shadow
+		}
+		if !p.handle(request, v.name, result) {
+			return false
+		}
+	}
+	return true
+}
+
+// handle 处理未通过的校验结果，返回消息是否继续处理
+func (p *Pipeline) handle(request iface.Request, name string, result Result) bool {
+	if p.onVerdict != nil {
+		p.onVerdict(request, name, result)
+	}
+	logger := request.Logger().With("validator", name, "msgID", request.GetMsgID(), "verdict", result.Verdict.String())
+	if result.Verdict == Shadow {
+		logger.Info("anticheat shadow ", result.Reason)
+		return true
+	}
+	logger.Warn("anticheat ", result.Reason)
+	conn := request.GetConnection()
+	if p.tracker != nil {
+		e := analytics.NewEvent(analytics.EventCheat, conn)
+		e.Reason = result.Reason
+		e.Props = map[string]interface{}{
+			"validator": name,
+			"msg_id":    request.GetMsgID(),
+			"verdict":   result.Verdict.String(),
+		}
+		p.tracker.Track(e)
+	}
+	if result.Verdict >= Disconnect {
+		netw.CloseConn(conn, fmt.Errorf("anticheat: %s: %s", name, result.Reason))
+		return false
+	}
+	return true
+}
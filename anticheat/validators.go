@@ -0,0 +1,93 @@
+package anticheat
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+var (
+	requestType = reflect.TypeOf((*iface.Request)(nil)).Elem()
+	statsType   = reflect.TypeOf(iface.ConnStats{})
+	resultType  = reflect.TypeOf(Result{})
+)
+
+// Typed 解码请求内容后校验，fn形如 func(iface.Request, *MoveReq) anticheat.Result
+// 或 func(iface.Request, *MoveReq, iface.ConnStats) anticheat.Result，签名不合法时panic；
+// 解码失败的消息视为通过，由业务处理方法回复错误
+func Typed(fn interface{}) Validator {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || (t.NumIn() != 2 && t.NumIn() != 3) || t.In(0) != requestType || t.In(1).Kind() != reflect.Ptr ||
+		(t.NumIn() == 3 && t.In(2) != statsType) || t.NumOut() != 1 || t.Out(0) != resultType {
+		panic(fmt.Sprintf("typed validator must be func(iface.Request, *Req[, iface.ConnStats]) anticheat.Result, got %s", t))
+	}
+	inType := t.In(1).Elem()
+	withStats := t.NumIn() == 3
+	return func(request iface.Request, stats iface.ConnStats) Result {
+		in := reflect.New(inType)
+		if err := request.Bind(in.Interface()); err != nil {
+			return OK
+		}
+		args := []reflect.Value{reflect.ValueOf(request), in}
+		if withStats {
+			args = append(args, reflect.ValueOf(stats))
+		}
+		return v.Call(args)[0].Interface().(Result)
+	}
+}
+
+// frequencyProperty 连接属性中保存消息频率计数的Key前缀
+const frequencyProperty = "anticheat.freq."
+
+// frequency 固定窗口的消息计数
+type frequency struct {
+	lock  sync.Mutex
+	start time.Time
+	count int
+}
+
+// MaxFrequency 同一连接在window内校验的消息超过limit条时返回verdict，
+// 计数保存在连接属性中，name用于区分不同的频率校验器
+func MaxFrequency(name string, limit int, window time.Duration, verdict Verdict) Validator {
+	key := frequencyProperty + name
+	return func(request iface.Request, stats iface.ConnStats) Result {
+		conn := request.GetConnection()
+		value, err := conn.GetProperty(key)
+		f, ok := value.(*frequency)
+		if err != nil || !ok {
+			f = &frequency{start: time.Now()}
+			conn.SetProperty(key, f)
+		}
+		f.lock.Lock()
+		defer f.lock.Unlock()
+		now := time.Now()
+		if now.Sub(f.start) >= window {
+			f.start = now
+			f.count = 0
+		}
+		f.count++
+		if f.count > limit {
+			return Result{Verdict: verdict, Reason: fmt.Sprintf("%d msgs in %s exceeds %d", f.count, window, limit)}
+		}
+		return OK
+	}
+}
+
+// MaxAverageRate 连接建立grace之后，按收发统计计算的平均每秒消息数超过rate时返回verdict
+func MaxAverageRate(rate float64, grace time.Duration, verdict Verdict) Validator {
+	return func(request iface.Request, stats iface.ConnStats) Result {
+		elapsed := time.Since(stats.CreatedAt)
+		if elapsed < grace || elapsed <= 0 {
+			return OK
+		}
+		avg := float64(stats.MsgsIn) / elapsed.Seconds()
+		if avg > rate {
+			return Result{Verdict: verdict, Reason: fmt.Sprintf("average %.1f msgs/s exceeds %.1f", avg, rate)}
+		}
+		return OK
+	}
+}
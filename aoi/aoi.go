@@ -0,0 +1,244 @@
+package aoi
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+var (
+	ErrEntityExists   = errors.New("aoi: entity already exists")
+	ErrEntityNotFound = errors.New("aoi: entity not found")
+)
+
+/*
+	九宫格AOI：地图按CellSize划分为格子，实体能看到所在格子及周围8个格子内的其它实体，
+	视野是对称的，A进入B的视野时B也进入A的视野
+*/
+
+// entity 地图中的实体
+type entity struct {
+	id   uint64
+	x, y float64
+	cell int
+	conn iface.Connection // 实体对应的玩家连接，NPC等为nil
+}
+
+// Grid 九宫格AOI管理器
+type Grid struct {
+	minX, minY float64
+	cellSize   float64
+	cols, rows int
+	cells      []map[uint64]*entity
+	entities   map[uint64]*entity
+	lock       sync.RWMutex
+}
+
+// NewGrid 创建覆盖 [minX, maxX) x [minY, maxY) 区域的九宫格，cellSize一般取视野半径
+func NewGrid(minX, minY, maxX, maxY, cellSize float64) *Grid {
+	cols := int((maxX-minX)/cellSize) + 1
+	rows := int((maxY-minY)/cellSize) + 1
+	g := &Grid{
+		minX:     minX,
+		minY:     minY,
+		cellSize: cellSize,
+		cols:     cols,
+		rows:     rows,
+		cells:    make([]map[uint64]*entity, cols*rows),
+		entities: make(map[uint64]*entity),
+	}
+	for i := range g.cells {
+		g.cells[i] = make(map[uint64]*entity)
+	}
+	return g
+}
+
+// Add 实体进入地图，返回能看到它的实体(即进入它视野的实体)
+func (g *Grid) Add(id uint64, x, y float64, conn iface.Connection) ([]uint64, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.entities[id]; ok {
+		return nil, ErrEntityExists
+	}
+	e := &entity{id: id, x: x, y: y, cell: g.cellOf(x, y), conn: conn}
+	g.entities[id] = e
+	g.cells[e.cell][id] = e
+	return g.around(e.cell, id), nil
+}
+
+// Remove 实体离开地图，返回原本能看到它的实体
+func (g *Grid) Remove(id uint64) ([]uint64, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	e, ok := g.entities[id]
+	if !ok {
+		return nil, ErrEntityNotFound
+	}
+	delete(g.entities, id)
+	delete(g.cells[e.cell], id)
+	return g.around(e.cell, id), nil
+}
+
+// Move 移动实体，返回进入与离开其视野的实体，跨格子时才会有变化
+func (g *Grid) Move(id uint64, x, y float64) (enter, leave []uint64, err error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	e, ok := g.entities[id]
+	if !ok {
+		return nil, nil, ErrEntityNotFound
+	}
+	e.x, e.y = x, y
+	cell := g.cellOf(x, y)
+	if cell == e.cell {
+		return nil, nil, nil
+	}
+	oldCells := g.neighborCells(e.cell)
+	newCells := g.neighborCells(cell)
+	delete(g.cells[e.cell], id)
+	g.cells[cell][id] = e
+	e.cell = cell
+	for c := range newCells {
+		if _, ok := oldCells[c]; !ok {
+			enter = g.collect(enter, c, id)
+		}
+	}
+	for c := range oldCells {
+		if _, ok := newCells[c]; !ok {
+			leave = g.collect(leave, c, id)
+		}
+	}
+	return enter, leave, nil
+}
+
+// Position 实体当前坐标
+func (g *Grid) Position(id uint64) (x, y float64, ok bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	e, ok := g.entities[id]
+	if !ok {
+		return 0, 0, false
+	}
+	return e.x, e.y, true
+}
+
+// Observers 能看到该实体的其它实体
+func (g *Grid) Observers(id uint64) []uint64 {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	e, ok := g.entities[id]
+	if !ok {
+		return nil
+	}
+	return g.around(e.cell, id)
+}
+
+// Len 地图中的实体数量
+func (g *Grid) Len() int {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return len(g.entities)
+}
+
+// Broadcast 向能看到该实体的玩家连接发送消息，includeSelf为true时同时发给实体自己，返回发送成功的连接数量
+func (g *Grid) Broadcast(id uint64, msgID uint32, data []byte, includeSelf bool) int {
+	g.lock.RLock()
+	e, ok := g.entities[id]
+	if !ok {
+		g.lock.RUnlock()
+		return 0
+	}
+	var conns []iface.Connection
+	if includeSelf && e.conn != nil {
+		conns = append(conns, e.conn)
+	}
+	for c := range g.neighborCells(e.cell) {
+		for oid, o := range g.cells[c] {
+			if oid != id && o.conn != nil {
+				conns = append(conns, o.conn)
+			}
+		}
+	}
+	g.lock.RUnlock()
+
+	sent := 0
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// SendTo 向指定实体对应的玩家连接发送消息，一般配合Move返回的enter/leave使用
+func (g *Grid) SendTo(ids []uint64, msgID uint32, data []byte) int {
+	g.lock.RLock()
+	conns := make([]iface.Connection, 0, len(ids))
+	for _, id := range ids {
+		if e, ok := g.entities[id]; ok && e.conn != nil {
+			conns = append(conns, e.conn)
+		}
+	}
+	g.lock.RUnlock()
+
+	sent := 0
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// cellOf 坐标所在的格子，超出地图范围时归入边缘格子
+func (g *Grid) cellOf(x, y float64) int {
+	col := int((x - g.minX) / g.cellSize)
+	row := int((y - g.minY) / g.cellSize)
+	if col < 0 {
+		col = 0
+	} else if col >= g.cols {
+		col = g.cols - 1
+	}
+	if row < 0 {
+		row = 0
+	} else if row >= g.rows {
+		row = g.rows - 1
+	}
+	return row*g.cols + col
+}
+
+// neighborCells 格子及其周围8个格子
+func (g *Grid) neighborCells(cell int) map[int]struct{} {
+	col, row := cell%g.cols, cell/g.cols
+	cells := make(map[int]struct{}, 9)
+	for r := row - 1; r <= row+1; r++ {
+		if r < 0 || r >= g.rows {
+			continue
+		}
+		for c := col - 1; c <= col+1; c++ {
+			if c < 0 || c >= g.cols {
+				continue
+			}
+			cells[r*g.cols+c] = struct{}{}
+		}
+	}
+	return cells
+}
+
+// around 九宫格内除自己以外的实体
+func (g *Grid) around(cell int, self uint64) []uint64 {
+	var ids []uint64
+	for c := range g.neighborCells(cell) {
+		ids = g.collect(ids, c, self)
+	}
+	return ids
+}
+
+func (g *Grid) collect(ids []uint64, cell int, self uint64) []uint64 {
+	for id := range g.cells[cell] {
+		if id != self {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,121 @@
+package aoi
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// sorted 排序后比较，nil与空切片视为相同
+func sorted(ids []uint64) []uint64 {
+	if len(ids) == 0 {
+		return nil
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func expectIDs(t *testing.T, what string, got []uint64, want ...uint64) {
+	t.Helper()
+	if len(want) == 0 {
+		want = nil
+	}
+	if got = sorted(got); !reflect.DeepEqual(got, want) {
+		t.Fatalf("%s = %v, want %v", what, got, want)
+	}
+}
+
+// newTestGrid 100x100的地图，格子边长10
+func newTestGrid(t *testing.T) *Grid {
+	g := NewGrid(0, 0, 100, 100, 10)
+	for _, e := range []struct {
+		id   uint64
+		x, y float64
+		seen []uint64
+	}{
+		{1, 5, 5, nil},
+		{2, 15, 15, []uint64{1}},
+		{3, 35, 5, nil},
+		{4, 95, 95, nil},
+	} {
+		seen, err := g.Add(e.id, e.x, e.y, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectIDs(t, "Add observers", seen, e.seen...)
+	}
+	return g
+}
+
+func TestGridEnterLeave(t *testing.T) {
+	g := newTestGrid(t)
+	if _, err := g.Add(1, 50, 50, nil); err != ErrEntityExists {
+		t.Fatalf("duplicate Add err = %v", err)
+	}
+	// 视野对称
+	expectIDs(t, "Observers(1)", g.Observers(1), 2)
+	expectIDs(t, "Observers(2)", g.Observers(2), 1)
+	expectIDs(t, "Observers(3)", g.Observers(3))
+
+	leave, err := g.Remove(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "Remove observers", leave, 1)
+	expectIDs(t, "Observers(1)", g.Observers(1))
+	if _, err := g.Remove(2); err != ErrEntityNotFound {
+		t.Fatalf("second Remove err = %v", err)
+	}
+	if g.Len() != 3 {
+		t.Fatalf("Len = %d, want 3", g.Len())
+	}
+	if g.Observers(2) != nil {
+		t.Fatal("removed entity still has observers")
+	}
+}
+
+func TestGridMove(t *testing.T) {
+	g := newTestGrid(t)
+	// 从(0,0)格移到(2,0)格：3进入视野，2仍在视野内
+	enter, leave, err := g.Move(1, 25, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "enter", enter, 3)
+	expectIDs(t, "leave", leave)
+	expectIDs(t, "Observers(1)", g.Observers(1), 2, 3)
+	expectIDs(t, "Observers(3)", g.Observers(3), 1)
+
+	// 格子内移动视野不变，坐标更新
+	enter, leave, err = g.Move(1, 28, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if enter != nil || leave != nil {
+		t.Fatalf("move within cell: enter %v, leave %v", enter, leave)
+	}
+	if x, y, ok := g.Position(1); !ok || x != 28 || y != 8 {
+		t.Fatalf("Position = %v, %v, %v", x, y, ok)
+	}
+
+	// 超出地图范围归入边缘格子
+	enter, leave, err = g.Move(1, -50, -50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "enter", enter)
+	expectIDs(t, "leave", leave, 3)
+	expectIDs(t, "Observers(3)", g.Observers(3))
+
+	// 跨越多个格子时旧视野全部离开、新视野全部进入
+	enter, leave, err = g.Move(1, 150, 150)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectIDs(t, "enter", enter, 4)
+	expectIDs(t, "leave", leave, 2)
+
+	if _, _, err := g.Move(9, 0, 0); err != ErrEntityNotFound {
+		t.Fatalf("Move unknown err = %v", err)
+	}
+}
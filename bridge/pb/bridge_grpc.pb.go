@@ -0,0 +1,217 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// GatewayClient is the client API for Gateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type GatewayClient interface {
+	// PushToConn 向指定连接推送消息
+	PushToConn(ctx context.Context, in *PushToConnRequest, opts ...grpc.CallOption) (*PushReply, error)
+	// PushToUID 向指定用户的全部连接推送消息
+	PushToUID(ctx context.Context, in *PushToUIDRequest, opts ...grpc.CallOption) (*PushReply, error)
+	// KickUID 踢掉指定用户的全部连接
+	KickUID(ctx context.Context, in *KickUIDRequest, opts ...grpc.CallOption) (*KickReply, error)
+	// BroadcastGroup 向分组内的全部连接广播消息，group为空时广播给全部连接
+	BroadcastGroup(ctx context.Context, in *BroadcastGroupRequest, opts ...grpc.CallOption) (*PushReply, error)
+}
+
+type gatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewGatewayClient(cc grpc.ClientConnInterface) GatewayClient {
+	return &gatewayClient{cc}
+}
+
+func (c *gatewayClient) PushToConn(ctx context.Context, in *PushToConnRequest, opts ...grpc.CallOption) (*PushReply, error) {
+	out := new(PushReply)
+	err := c.cc.Invoke(ctx, "/bridge.Gateway/PushToConn", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) PushToUID(ctx context.Context, in *PushToUIDRequest, opts ...grpc.CallOption) (*PushReply, error) {
+	out := new(PushReply)
+	err := c.cc.Invoke(ctx, "/bridge.Gateway/PushToUID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) KickUID(ctx context.Context, in *KickUIDRequest, opts ...grpc.CallOption) (*KickReply, error) {
+	out := new(KickReply)
+	err := c.cc.Invoke(ctx, "/bridge.Gateway/KickUID", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *gatewayClient) BroadcastGroup(ctx context.Context, in *BroadcastGroupRequest, opts ...grpc.CallOption) (*PushReply, error) {
+	out := new(PushReply)
+	err := c.cc.Invoke(ctx, "/bridge.Gateway/BroadcastGroup", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// GatewayServer is the server API for Gateway service.
+// All implementations must embed UnimplementedGatewayServer
+// for forward compatibility
+type GatewayServer interface {
+	// PushToConn 向指定连接推送消息
+	PushToConn(context.Context, *PushToConnRequest) (*PushReply, error)
+	// PushToUID 向指定用户的全部连接推送消息
+	PushToUID(context.Context, *PushToUIDRequest) (*PushReply, error)
+	// KickUID 踢掉指定用户的全部连接
+	KickUID(context.Context, *KickUIDRequest) (*KickReply, error)
+	// BroadcastGroup 向分组内的全部连接广播消息，group为空时广播给全部连接
+	BroadcastGroup(context.Context, *BroadcastGroupRequest) (*PushReply, error)
+	mustEmbedUnimplementedGatewayServer()
+}
+
+// UnimplementedGatewayServer must be embedded to have forward compatible implementations.
+type UnimplementedGatewayServer struct {
+}
+
+func (UnimplementedGatewayServer) PushToConn(context.Context, *PushToConnRequest) (*PushReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PushToConn not implemented")
+}
+func (UnimplementedGatewayServer) PushToUID(context.Context, *PushToUIDRequest) (*PushReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PushToUID not implemented")
+}
+func (UnimplementedGatewayServer) KickUID(context.Context, *KickUIDRequest) (*KickReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method KickUID not implemented")
+}
+func (UnimplementedGatewayServer) BroadcastGroup(context.Context, *BroadcastGroupRequest) (*PushReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method BroadcastGroup not implemented")
+}
+func (UnimplementedGatewayServer) mustEmbedUnimplementedGatewayServer() {}
+
+// UnsafeGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to GatewayServer will
+// result in compilation errors.
+type UnsafeGatewayServer interface {
+	mustEmbedUnimplementedGatewayServer()
+}
+
+func RegisterGatewayServer(s grpc.ServiceRegistrar, srv GatewayServer) {
+	s.RegisterService(&Gateway_ServiceDesc, srv)
+}
+
+func _Gateway_PushToConn_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushToConnRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).PushToConn(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bridge.Gateway/PushToConn",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).PushToConn(ctx, req.(*PushToConnRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_PushToUID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PushToUIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).PushToUID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bridge.Gateway/PushToUID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).PushToUID(ctx, req.(*PushToUIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_KickUID_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KickUIDRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).KickUID(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bridge.Gateway/KickUID",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).KickUID(ctx, req.(*KickUIDRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Gateway_BroadcastGroup_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BroadcastGroupRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(GatewayServer).BroadcastGroup(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/bridge.Gateway/BroadcastGroup",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(GatewayServer).BroadcastGroup(ctx, req.(*BroadcastGroupRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Gateway_ServiceDesc is the grpc.ServiceDesc for Gateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Gateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "bridge.Gateway",
+	HandlerType: (*GatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "PushToConn",
+			Handler:    _Gateway_PushToConn_Handler,
+		},
+		{
+			MethodName: "PushToUID",
+			Handler:    _Gateway_PushToUID_Handler,
+		},
+		{
+			MethodName: "KickUID",
+			Handler:    _Gateway_KickUID_Handler,
+		},
+		{
+			MethodName: "BroadcastGroup",
+			Handler:    _Gateway_BroadcastGroup_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "bridge.proto",
+}
@@ -0,0 +1,208 @@
+package bridge
+
+import (
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"io/ioutil"
+	"net"
+
+	"github.com/xiaomingping/game/bridge/pb"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative pb/bridge.proto
+
+var (
+	// TokenMetadataKey 推送服务token所在的gRPC metadata键
+	TokenMetadataKey = "x-bridge-token"
+	// GroupProperty 连接属性中保存广播分组名的Key，值为string
+	GroupProperty = "bridge.group"
+
+	// ErrInsecure 未配置token与TLS时拒绝启动，明文gRPC上的推送接口不能无鉴权开放
+	ErrInsecure = errors.New("bridge: token or tls required")
+)
+
+// Server gRPC推送服务，后端服务可通过它向在线玩家推送消息而无需接入WebSocket协议
+type Server struct {
+	pb.UnimplementedGatewayServer
+	server iface.Server
+	addr   string
+	token  string
+	tls    *tls.Config
+	grpc   *grpc.Server
+}
+
+// Option 推送服务选项
+type Option func(*Server)
+
+// WithTLS 使用TLS监听，cfg设置ClientCAs与ClientAuth时校验客户端证书(mTLS)
+func WithTLS(cfg *tls.Config) Option {
+	return func(b *Server) {
+		b.tls = cfg
+	}
+}
+
+// NewServer 创建gRPC推送服务，token为空时不校验token，此时必须通过WithTLS开启TLS，否则Start拒绝启动
+func NewServer(s iface.Server, addr string, token string, opts ...Option) *Server {
+	b := &Server{
+		server: s,
+		addr:   addr,
+		token:  token,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	serverOpts := []grpc.ServerOption{grpc.UnaryInterceptor(b.auth)}
+	if b.tls != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(b.tls)))
+	}
+	b.grpc = grpc.NewServer(serverOpts...)
+	pb.RegisterGatewayServer(b.grpc, b)
+	return b
+}
+
+// LoadTLS 加载服务端证书，caFile不为空时要求并校验由该CA签发的客户端证书
+func LoadTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return cfg, nil
+	}
+	ca, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, errors.New("bridge: invalid client ca file")
+	}
+	cfg.ClientCAs = pool
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	return cfg, nil
+}
+
+// GRPC 获取底层gRPC服务，可用于注册自定义服务
+func (b *Server) GRPC() *grpc.Server {
+	return b.grpc
+}
+
+// Start 启动gRPC推送服务监听，未配置token与TLS时拒绝启动
+func (b *Server) Start() {
+	if b.token == "" && b.tls == nil {
+		zap.S().Error("bridge server not started ", ErrInsecure)
+		return
+	}
+	go func() {
+		lis, err := net.Listen("tcp", b.addr)
+		if err != nil {
+			zap.S().Error("bridge server listen error ", err)
+			return
+		}
+		zap.S().Info("[START] bridge server listen ", b.addr)
+		if err := b.grpc.Serve(lis); err != nil {
+			zap.S().Error("bridge server error ", err)
+		}
+	}()
+}
+
+// Stop 停止gRPC推送服务
+func (b *Server) Stop() {
+	b.grpc.GracefulStop()
+}
+
+// auth 校验推送服务token
+func (b *Server) auth(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if b.token != "" {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if tokens := md.Get(TokenMetadataKey); len(tokens) == 0 || subtle.ConstantTimeCompare([]byte(tokens[0]), []byte(b.token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid bridge token")
+		}
+	}
+	return handler(ctx, req)
+}
+
+// PushToConn 向指定连接推送消息
+func (b *Server) PushToConn(ctx context.Context, req *pb.PushToConnRequest) (*pb.PushReply, error) {
+	conn, err := b.server.GetConnMgr().Get(req.ConnId)
+	if err != nil {
+		return &pb.PushReply{}, nil
+	}
+	if err := conn.SendBuffMsg(req.MsgId, req.Data); err != nil {
+		return &pb.PushReply{}, nil
+	}
+	return &pb.PushReply{Delivered: 1}, nil
+}
+
+// PushToUID 向指定用户的全部连接推送消息
+func (b *Server) PushToUID(ctx context.Context, req *pb.PushToUIDRequest) (*pb.PushReply, error) {
+	if req.Uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty uid")
+	}
+	delivered := b.send(b.match(func(conn iface.Connection) bool {
+		return conn.GetUID() == req.Uid
+	}), req.MsgId, req.Data)
+	return &pb.PushReply{Delivered: delivered}, nil
+}
+
+// KickUID 踢掉指定用户的全部连接
+func (b *Server) KickUID(ctx context.Context, req *pb.KickUIDRequest) (*pb.KickReply, error) {
+	if req.Uid == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty uid")
+	}
+	var kicked int32
+	for _, conn := range b.match(func(conn iface.Connection) bool {
+		return conn.GetUID() == req.Uid
+	}) {
+		if err := b.server.GetConnMgr().Kick(conn.GetConnID(), req.Reason, req.MsgId); err == nil {
+			kicked++
+		}
+	}
+	return &pb.KickReply{Kicked: kicked}, nil
+}
+
+// BroadcastGroup 向分组内的全部连接广播消息，分组通过连接属性GroupProperty指定
+func (b *Server) BroadcastGroup(ctx context.Context, req *pb.BroadcastGroupRequest) (*pb.PushReply, error) {
+	if req.Group == "" {
+		return &pb.PushReply{Delivered: int32(b.server.Broadcast(req.MsgId, req.Data))}, nil
+	}
+	delivered := b.send(b.match(func(conn iface.Connection) bool {
+		group, _ := conn.GetProperty(GroupProperty)
+		return group == req.Group
+	}), req.MsgId, req.Data)
+	return &pb.PushReply{Delivered: delivered}, nil
+}
+
+// match 查找满足条件的在线连接
+func (b *Server) match(fn func(iface.Connection) bool) []iface.Connection {
+	var conns []iface.Connection
+	b.server.GetConnMgr().Search(func(conn iface.Connection) {
+		if fn(conn) {
+			conns = append(conns, conn)
+		}
+	})
+	return conns
+}
+
+// send 向连接发送消息，返回发送成功的连接数量
+func (b *Server) send(conns []iface.Connection, msgID uint32, data []byte) int32 {
+	var delivered int32
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			delivered++
+		}
+	}
+	return delivered
+}
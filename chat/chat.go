@@ -0,0 +1,282 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/room"
+)
+
+// ErrCode 聊天请求失败时ReplyError回复的错误码
+const ErrCode int32 = 1000
+
+var (
+	ErrNotLoggedIn  = errors.New("chat: not logged in")
+	ErrUnknownKind  = errors.New("chat: unknown channel kind")
+	ErrEmptyText    = errors.New("chat: empty text")
+	ErrTextTooLong  = errors.New("chat: text too long")
+	ErrRateLimited  = errors.New("chat: rate limited")
+	ErrNotInRoom    = errors.New("chat: not in room")
+	ErrNoRecipient  = errors.New("chat: no recipient")
+	ErrRoomDisabled = errors.New("chat: room channel disabled")
+)
+
+// Kind 频道类型
+type Kind uint8
+
+const (
+	KindWorld   Kind = iota // 世界频道，当前Server的全部在线连接
+	KindRoom                // 房间频道，发送者所在房间的成员
+	KindPrivate             // 私聊，收发双方的全部连接
+)
+
+// Message 聊天消息，以JSON下发
+type Message struct {
+	ID      uint64 `json:"id"`
+	Kind    Kind   `json:"kind"`
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	To      string `json:"to,omitempty"`
+	Text    string `json:"text"`
+	Time    int64  `json:"time"` // 毫秒时间戳
+}
+
+// sendReq 客户端发送聊天消息的请求，To为私聊对象uid
+type sendReq struct {
+	Kind Kind   `json:"kind"`
+	To   string `json:"to"`
+	Text string `json:"text"`
+}
+
+// historyReq 客户端查询聊天历史的请求
+type historyReq struct {
+	Kind   Kind   `json:"kind"`
+	To     string `json:"to"`
+	Before uint64 `json:"before"`
+	Limit  int    `json:"limit"`
+}
+
+// Filter 敏感词过滤，返回替换后的文本，返回错误时拒绝发送
+type Filter func(conn iface.Connection, text string) (string, error)
+
+// Options 聊天配置，请求与响应内容均为JSON
+type Options struct {
+	SendMsgID    uint32              // 客户端发送聊天消息的MsgID，内容为 {kind, to, text}
+	PushMsgID    uint32              // 推送聊天消息的MsgID，内容为Message
+	HistoryMsgID uint32              // 查询聊天历史的MsgID，内容为 {kind, to, before, limit}，以ResponseMsgID回复Message数组，0为不开启
+	Rooms        *room.Manager       // 房间频道所用的房间管理，为nil时不支持房间频道
+	Filter       Filter              // 敏感词过滤，为nil时不过滤
+	RateLimits   map[Kind]iface.Rate // 每个连接在各类频道的发言限流
+	History      History             // 聊天历史，为nil时使用保留100条的MemoryHistory
+	MaxTextLen   int                 // 单条消息最大字符数，0为不限制
+	HistoryLimit int                 // 单次查询历史的最大条数，默认50
+}
+
+// Chat 聊天服务
+type Chat struct {
+	server iface.Server
+	opts   Options
+	seq    uint64
+	// 连接在各类频道的发言令牌桶
+	limits map[int64]map[Kind]*netw.TokenBucket
+	lock   sync.Mutex
+}
+
+// NewChat 创建聊天服务并注册发送与查询历史的路由
+func NewChat(s iface.Server, opts Options) *Chat {
+	if opts.History == nil {
+		opts.History = NewMemoryHistory(100)
+	}
+	if opts.HistoryLimit <= 0 {
+		opts.HistoryLimit = 50
+	}
+	c := &Chat{
+		server: s,
+		opts:   opts,
+		limits: make(map[int64]map[Kind]*netw.TokenBucket),
+	}
+	s.AddRouter(opts.SendMsgID, &sendRouter{chat: c})
+	if opts.HistoryMsgID != 0 {
+		s.AddRouter(opts.HistoryMsgID, &historyRouter{chat: c})
+	}
+	s.AddOnConnStop(func(conn iface.Connection) {
+		c.lock.Lock()
+		delete(c.limits, conn.GetConnID())
+		c.lock.Unlock()
+	})
+	return c
+}
+
+// Send 以conn绑定的uid在频道内发言，to为私聊对象uid
+func (c *Chat) Send(conn iface.Connection, kind Kind, to string, text string) (Message, error) {
+	from := conn.GetUID()
+	if from == "" {
+		return Message{}, ErrNotLoggedIn
+	}
+	if text == "" {
+		return Message{}, ErrEmptyText
+	}
+	if c.opts.MaxTextLen > 0 && utf8.RuneCountInString(text) > c.opts.MaxTextLen {
+		return Message{}, ErrTextTooLong
+	}
+	channel, err := c.channel(conn, kind, to)
+	if err != nil {
+		return Message{}, err
+	}
+	if !c.allow(conn, kind) {
+		return Message{}, ErrRateLimited
+	}
+	if c.opts.Filter != nil {
+		if text, err = c.opts.Filter(conn, text); err != nil {
+			return Message{}, err
+		}
+	}
+	msg := Message{
+		ID:      atomic.AddUint64(&c.seq, 1),
+		Kind:    kind,
+		Channel: channel,
+		From:    from,
+		To:      to,
+		Text:    text,
+		Time:    time.Now().UnixNano() / int64(time.Millisecond),
+	}
+	c.opts.History.Append(channel, msg)
+	c.deliver(conn, msg)
+	return msg, nil
+}
+
+// History 查询conn可见的频道历史
+func (c *Chat) History(conn iface.Connection, kind Kind, to string, beforeID uint64, limit int) ([]Message, error) {
+	channel, err := c.channel(conn, kind, to)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > c.opts.HistoryLimit {
+		limit = c.opts.HistoryLimit
+	}
+	return c.opts.History.Query(channel, beforeID, limit), nil
+}
+
+// channel 得到conn在频道类型下的频道名
+func (c *Chat) channel(conn iface.Connection, kind Kind, to string) (string, error) {
+	switch kind {
+	case KindWorld:
+		return "world", nil
+	case KindRoom:
+		if c.opts.Rooms == nil {
+			return "", ErrRoomDisabled
+		}
+		r, ok := c.opts.Rooms.RoomOf(conn)
+		if !ok {
+			return "", ErrNotInRoom
+		}
+		return "room:" + r.ID(), nil
+	case KindPrivate:
+		from := conn.GetUID()
+		if from == "" {
+			return "", ErrNotLoggedIn
+		}
+		if to == "" || to == from {
+			return "", ErrNoRecipient
+		}
+		// 双方共用一个频道，名称与发送方向无关
+		if from > to {
+			from, to = to, from
+		}
+		return "private:" + from + ":" + to, nil
+	}
+	return "", ErrUnknownKind
+}
+
+// allow 检查连接在频道类型下的发言限流
+func (c *Chat) allow(conn iface.Connection, kind Kind) bool {
+	rate, ok := c.opts.RateLimits[kind]
+	if !ok || rate.Rate <= 0 {
+		return true
+	}
+	c.lock.Lock()
+	buckets := c.limits[conn.GetConnID()]
+	if buckets == nil {
+		buckets = make(map[Kind]*netw.TokenBucket)
+		c.limits[conn.GetConnID()] = buckets
+	}
+	bucket := buckets[kind]
+	if bucket == nil {
+		bucket = netw.NewTokenBucket(rate.Rate, rate.Burst)
+		buckets[kind] = bucket
+	}
+	c.lock.Unlock()
+	return bucket.Allow()
+}
+
+// deliver 向频道成员推送消息
+func (c *Chat) deliver(conn iface.Connection, msg Message) {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return
+	}
+	switch msg.Kind {
+	case KindWorld:
+		c.server.Broadcast(c.opts.PushMsgID, data)
+	case KindRoom:
+		if r, ok := c.opts.Rooms.RoomOf(conn); ok {
+			r.Broadcast(c.opts.PushMsgID, data)
+		}
+	case KindPrivate:
+		connMgr := c.server.GetConnMgr()
+		// 发送者的其它设备也需要收到
+		for _, uid := range []string{msg.From, msg.To} {
+			for _, target := range connMgr.GetByUID(uid) {
+				_ = target.SendBuffMsg(c.opts.PushMsgID, data)
+			}
+		}
+	}
+}
+
+// sendRouter 发送聊天消息的路由
+type sendRouter struct {
+	netw.BaseRouter
+	chat *Chat
+}
+
+func (r *sendRouter) Handle(request iface.Request) {
+	var req sendReq
+	if err := json.Unmarshal(request.GetData(), &req); err != nil {
+		_ = request.ReplyError(netw.ErrCodeBadRequest, err.Error())
+		return
+	}
+	if _, err := r.chat.Send(request.GetConnection(), req.Kind, req.To, req.Text); err != nil {
+		_ = request.ReplyError(ErrCode, err.Error())
+	}
+}
+
+// historyRouter 查询聊天历史的路由
+type historyRouter struct {
+	netw.BaseRouter
+	chat *Chat
+}
+
+func (r *historyRouter) Handle(request iface.Request) {
+	var req historyReq
+	if err := json.Unmarshal(request.GetData(), &req); err != nil {
+		_ = request.ReplyError(netw.ErrCodeBadRequest, err.Error())
+		return
+	}
+	msgs, err := r.chat.History(request.GetConnection(), req.Kind, req.To, req.Before, req.Limit)
+	if err != nil {
+		_ = request.ReplyError(ErrCode, err.Error())
+		return
+	}
+	data, err := json.Marshal(msgs)
+	if err != nil {
+		_ = request.ReplyError(ErrCode, err.Error())
+		return
+	}
+	_ = request.Reply(netw.ResponseMsgID(request.GetMsgID()), data)
+}
@@ -0,0 +1,55 @@
+package chat
+
+import "sync"
+
+/*
+	聊天历史存储，可替换为Redis、数据库等外部存储实现
+*/
+type History interface {
+	Append(channel string, msg Message)                         // 追加一条消息
+	Query(channel string, beforeID uint64, limit int) []Message // 查询ID小于beforeID的最近limit条消息，beforeID为0时从最新开始，按时间正序返回
+}
+
+// MemoryHistory 内存聊天历史，每个频道保留最近size条
+type MemoryHistory struct {
+	size     int
+	channels map[string][]Message
+	lock     sync.RWMutex
+}
+
+// NewMemoryHistory 创建内存聊天历史
+func NewMemoryHistory(size int) *MemoryHistory {
+	return &MemoryHistory{
+		size:     size,
+		channels: make(map[string][]Message),
+	}
+}
+
+// Append 追加一条消息，超出容量时丢弃最旧的消息
+func (h *MemoryHistory) Append(channel string, msg Message) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	msgs := append(h.channels[channel], msg)
+	if h.size > 0 && len(msgs) > h.size {
+		msgs = append(msgs[:0:0], msgs[len(msgs)-h.size:]...)
+	}
+	h.channels[channel] = msgs
+}
+
+// Query 查询ID小于beforeID的最近limit条消息
+func (h *MemoryHistory) Query(channel string, beforeID uint64, limit int) []Message {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	msgs := h.channels[channel]
+	end := len(msgs)
+	if beforeID > 0 {
+		for end > 0 && msgs[end-1].ID >= beforeID {
+			end--
+		}
+	}
+	start := 0
+	if limit > 0 && end-limit > 0 {
+		start = end - limit
+	}
+	return append([]Message(nil), msgs[start:end]...)
+}
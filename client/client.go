@@ -0,0 +1,485 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/codec"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNotConnected = errors.New("client: not connected")
+	ErrClosed       = errors.New("client: closed")
+	ErrDisconnected = errors.New("client: disconnected before response")
+	ErrBadBatch     = errors.New("client: malformed batch frame")
+)
+
+// ServerError 服务端以ErrorMsgID回复的错误
+type ServerError struct {
+	MsgID   uint32 // 出错的请求MsgID
+	Code    int32
+	ReqID   uint64 // 出错的请求ID
+	Message string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("client: server error msgID = %d code = %d %s", e.MsgID, e.Code, e.Message)
+}
+
+// HandlerFunc 消息处理方法，在单独的处理goroutine中按到达顺序依次调用，其中可调用Request等待回复，msg的内容可以被持有
+type HandlerFunc func(c *Client, msg iface.Message)
+
+// Client 游戏客户端，与服务端使用相同的封包格式，可用于机器人、压测与服务间连接
+type Client struct {
+	url               string
+	header            http.Header
+	packet            iface.Packet
+	codec             iface.Codec
+	messageType       int
+	heartbeatMsgID    uint32
+	heartbeatInterval time.Duration
+	rttMsgID          uint32
+	reconnect         bool
+	backoffMin        time.Duration
+	backoffMax        time.Duration
+	maxRetries        int
+	batchMsgID        uint32
+	errorMsgID        uint32
+	onConnect         func(c *Client)
+	onDisconnect      func(c *Client, err error)
+
+	conn      *websocket.Conn
+	connLock  sync.RWMutex
+	writeLock sync.Mutex
+
+	handlers    map[uint32]HandlerFunc
+	handlerLock sync.RWMutex
+	// 等待处理方法处理的消息，处理方法在单独的goroutine中按到达顺序执行，其中可调用Request等待回复
+	inbox       []iface.Message
+	inboxLock   sync.Mutex
+	inboxSignal chan struct{}
+
+	reqSeq      uint64
+	pending     map[uint64]chan iface.Message
+	pendingLock sync.Mutex
+
+	closed int32
+	quit   chan struct{}
+}
+
+// Dial 连接服务端，首次连接失败时直接返回错误，之后断线按WithReconnect自动重连
+func Dial(url string, opts ...Option) (*Client, error) {
+	c := &Client{
+		url:         url,
+		packet:      netw.NewDataPack(),
+		codec:       codec.NewProtoCodec(),
+		messageType: websocket.BinaryMessage,
+		backoffMin:  time.Second,
+		backoffMax:  30 * time.Second,
+		handlers:    make(map[uint32]HandlerFunc),
+		pending:     make(map[uint64]chan iface.Message),
+		inboxSignal: make(chan struct{}, 1),
+		quit:        make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	c.setConn(conn)
+	go c.handleLoop()
+	go c.run(conn)
+	return c, nil
+}
+
+// Codec 消息内容编解码器
+func (c *Client) Codec() iface.Codec {
+	return c.codec
+}
+
+// IsConnected 当前是否已连接
+func (c *Client) IsConnected() bool {
+	return c.getConn() != nil
+}
+
+// HandleFunc 注册消息处理方法
+func (c *Client) HandleFunc(msgID uint32, fn HandlerFunc) {
+	c.handlerLock.Lock()
+	c.handlers[msgID] = fn
+	c.handlerLock.Unlock()
+}
+
+// Handle 注册类型化处理方法，形如 func(*Push) 或 func(*Req) (*Resp, error)；
+// 后者用于响应服务端的Call，以 netw.ResponseMsgID 回复，返回错误时不回复；签名不合法时panic
+func (c *Client) Handle(msgID uint32, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 1 || t.In(0).Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("msgID = %d client handler must be func(*Msg) or func(*Req) (*Resp, error), got %s", msgID, t))
+	}
+	if t.NumOut() != 0 && (t.NumOut() != 2 || t.Out(1) != reflect.TypeOf((*error)(nil)).Elem()) {
+		panic(fmt.Sprintf("msgID = %d client handler must return nothing or (*Resp, error), got %s", msgID, t))
+	}
+	inType := t.In(0).Elem()
+	c.HandleFunc(msgID, func(c *Client, msg iface.Message) {
+		in := reflect.New(inType)
+		if err := c.codec.Unmarshal(msg.GetData(), in.Interface()); err != nil {
+			zap.S().Warn("client unmarshal msgID = ", msgID, " error ", err)
+			return
+		}
+		out := v.Call([]reflect.Value{in})
+		if len(out) == 0 || msg.GetReqID() == 0 {
+			return
+		}
+		if errV := out[1]; !errV.IsNil() {
+			zap.S().Warn("client handler msgID = ", msgID, " error ", errV.Interface())
+			return
+		}
+		data, err := c.codec.Marshal(out[0].Interface())
+		if err != nil {
+			zap.S().Warn("client marshal msgID = ", msgID, " error ", err)
+			return
+		}
+		if err := c.send(msg.GetReqID(), netw.ResponseMsgID(msgID), data); err != nil {
+			zap.S().Warn("client reply msgID = ", msgID, " error ", err)
+		}
+	})
+}
+
+// SendMsg 发送消息
+func (c *Client) SendMsg(msgID uint32, data []byte) error {
+	return c.send(0, msgID, data)
+}
+
+// SendChannelMsg 以逻辑通道发送消息，服务端在同一通道内按顺序处理并回复
+func (c *Client) SendChannelMsg(channel uint8, msgID uint32, data []byte) error {
+	return c.sendChannel(channel, 0, msgID, data)
+}
+
+// SendObj 编码后发送消息
+func (c *Client) SendObj(msgID uint32, v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.send(0, msgID, data)
+}
+
+// Request 发送带请求ID的请求并等待服务端回复，resp为nil时忽略响应内容，
+// 服务端以ErrorMsgID回复时返回*ServerError
+func (c *Client) Request(ctx context.Context, msgID uint32, req interface{}, resp interface{}) error {
+	data, err := c.codec.Marshal(req)
+	if err != nil {
+		return err
+	}
+	msg, err := c.RequestRaw(ctx, msgID, data)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	return c.codec.Unmarshal(msg.GetData(), resp)
+}
+
+// RequestRaw 发送带请求ID的原始请求并返回服务端回复的消息
+func (c *Client) RequestRaw(ctx context.Context, msgID uint32, data []byte) (iface.Message, error) {
+	// 最高位留给服务端发起的Call
+	reqID := atomic.AddUint64(&c.reqSeq, 1) &^ netw.CallReqIDFlag
+	ch := make(chan iface.Message, 1)
+	c.pendingLock.Lock()
+	c.pending[reqID] = ch
+	c.pendingLock.Unlock()
+	defer func() {
+		c.pendingLock.Lock()
+		delete(c.pending, reqID)
+		c.pendingLock.Unlock()
+	}()
+	if err := c.send(reqID, msgID, data); err != nil {
+		return nil, err
+	}
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			return nil, ErrDisconnected
+		}
+		if c.errorMsgID != 0 && msg.GetMsgID() == c.errorMsgID {
+			return nil, parseError(msg.GetData())
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.quit:
+		return nil, ErrClosed
+	}
+}
+
+// Close 关闭客户端，不再重连
+func (c *Client) Close() error {
+	if !atomic.CompareAndSwapInt32(&c.closed, 0, 1) {
+		return nil
+	}
+	close(c.quit)
+	conn := c.getConn()
+	if conn == nil {
+		return nil
+	}
+	c.writeLock.Lock()
+	_ = conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""), time.Now().Add(time.Second))
+	c.writeLock.Unlock()
+	return conn.Close()
+}
+
+func (c *Client) send(reqID uint64, msgID uint32, data []byte) error {
+	return c.sendChannel(0, reqID, msgID, data)
+}
+
+func (c *Client) sendChannel(channel uint8, reqID uint64, msgID uint32, data []byte) error {
+	conn := c.getConn()
+	if conn == nil {
+		if atomic.LoadInt32(&c.closed) == 1 {
+			return ErrClosed
+		}
+		return ErrNotConnected
+	}
+	msg := netw.NewMsgPackage(msgID, data)
+	msg.SetReqID(reqID)
+	msg.SetChannel(channel)
+	buf, err := c.packet.Pack(msg)
+	if err != nil {
+		return err
+	}
+	c.writeLock.Lock()
+	err = conn.WriteMessage(c.messageType, buf)
+	c.writeLock.Unlock()
+	netw.PutBuffer(buf)
+	return err
+}
+
+func (c *Client) dial() (*websocket.Conn, error) {
+	conn, _, err := websocket.DefaultDialer.Dial(c.url, c.header)
+	return conn, err
+}
+
+func (c *Client) getConn() *websocket.Conn {
+	c.connLock.RLock()
+	defer c.connLock.RUnlock()
+	return c.conn
+}
+
+func (c *Client) setConn(conn *websocket.Conn) {
+	c.connLock.Lock()
+	c.conn = conn
+	c.connLock.Unlock()
+}
+
+// run 处理连接的整个生命周期，断线后按退避间隔重连
+func (c *Client) run(conn *websocket.Conn) {
+	for {
+		if c.onConnect != nil {
+			c.onConnect(c)
+		}
+		err := c.serve(conn)
+		c.setConn(nil)
+		_ = conn.Close()
+		c.failPending()
+		if c.onDisconnect != nil {
+			c.onDisconnect(c, err)
+		}
+		if atomic.LoadInt32(&c.closed) == 1 || !c.reconnect {
+			return
+		}
+		if conn = c.redial(); conn == nil {
+			return
+		}
+		c.setConn(conn)
+	}
+}
+
+// serve 读取并分发消息直到连接断开
+func (c *Client) serve(conn *websocket.Conn) error {
+	done := make(chan struct{})
+	defer close(done)
+	if c.heartbeatMsgID != 0 && c.heartbeatInterval > 0 {
+		go c.heartbeat(done)
+	}
+	for {
+		t, data, err := conn.ReadMessage()
+		if err != nil {
+			return err
+		}
+		if t != c.messageType {
+			continue
+		}
+		msg, err := c.packet.Unpack(data)
+		if err != nil {
+			return err
+		}
+		if err := c.dispatch(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// dispatch 分发消息，合并帧拆分后依次分发
+func (c *Client) dispatch(msg iface.Message) error {
+	if c.batchMsgID != 0 && msg.GetMsgID() == c.batchMsgID {
+		data := msg.GetData()
+		for len(data) > 0 {
+			if len(data) < 4 {
+				return ErrBadBatch
+			}
+			size := int(binary.LittleEndian.Uint32(data))
+			if size > len(data)-4 {
+				return ErrBadBatch
+			}
+			sub, err := c.packet.Unpack(data[4 : 4+size])
+			if err != nil {
+				return err
+			}
+			c.route(sub)
+			data = data[4+size:]
+		}
+		return nil
+	}
+	c.route(msg)
+	return nil
+}
+
+// route 在读goroutine中处理Request的回复与延迟探测，其余消息交给处理goroutine
+func (c *Client) route(msg iface.Message) {
+	// 服务端对Request的回复
+	if reqID := msg.GetReqID(); reqID != 0 && reqID&netw.CallReqIDFlag == 0 {
+		c.pendingLock.Lock()
+		ch, ok := c.pending[reqID]
+		delete(c.pending, reqID)
+		c.pendingLock.Unlock()
+		if ok {
+			ch <- msg
+		}
+		return
+	}
+	// 服务端的往返延迟探测，原样回复
+	if c.rttMsgID != 0 && msg.GetMsgID() == c.rttMsgID {
+		if err := c.SendMsg(c.rttMsgID, msg.GetData()); err != nil {
+			zap.S().Debug("client reply rtt probe error ", err)
+		}
+		return
+	}
+	c.inboxLock.Lock()
+	c.inbox = append(c.inbox, msg)
+	c.inboxLock.Unlock()
+	select {
+	case c.inboxSignal <- struct{}{}:
+	default:
+	}
+}
+
+// handleLoop 按到达顺序依次执行处理方法，直到Close
+func (c *Client) handleLoop() {
+	for {
+		select {
+		case <-c.inboxSignal:
+		case <-c.quit:
+			return
+		}
+		for {
+			c.inboxLock.Lock()
+			if len(c.inbox) == 0 {
+				c.inboxLock.Unlock()
+				break
+			}
+			msg := c.inbox[0]
+			c.inbox[0] = nil
+			c.inbox = c.inbox[1:]
+			c.inboxLock.Unlock()
+			c.handle(msg)
+		}
+	}
+}
+
+// handle 执行消息的处理方法
+func (c *Client) handle(msg iface.Message) {
+	c.handlerLock.RLock()
+	fn, ok := c.handlers[msg.GetMsgID()]
+	c.handlerLock.RUnlock()
+	if !ok {
+		zap.S().Debug("client no handler msgID = ", msg.GetMsgID())
+		return
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			zap.S().Error("client handler msgID = ", msg.GetMsgID(), " panic ", r)
+		}
+	}()
+	fn(c, msg)
+}
+
+// failPending 断线时结束全部等待中的Request
+func (c *Client) failPending() {
+	c.pendingLock.Lock()
+	pending := c.pending
+	c.pending = make(map[uint64]chan iface.Message)
+	c.pendingLock.Unlock()
+	for _, ch := range pending {
+		close(ch)
+	}
+}
+
+func (c *Client) heartbeat(done chan struct{}) {
+	ticker := time.NewTicker(c.heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := c.SendMsg(c.heartbeatMsgID, nil); err != nil {
+				zap.S().Debug("client heartbeat error ", err)
+			}
+		}
+	}
+}
+
+// redial 按指数退避重连，客户端关闭或超过最大重试次数时返回nil
+func (c *Client) redial() *websocket.Conn {
+	backoff := c.backoffMin
+	for attempt := 1; c.maxRetries == 0 || attempt <= c.maxRetries; attempt++ {
+		select {
+		case <-time.After(backoff):
+		case <-c.quit:
+			return nil
+		}
+		conn, err := c.dial()
+		if err == nil {
+			zap.S().Info("client reconnected ", c.url, " attempt = ", attempt)
+			return conn
+		}
+		zap.S().Warn("client reconnect error ", err, " attempt = ", attempt)
+		if backoff *= 2; backoff > c.backoffMax {
+			backoff = c.backoffMax
+		}
+	}
+	return nil
+}
+
+// parseError 解析服务端的标准错误响应netw.ErrorFrame
+func parseError(data []byte) error {
+	f := netw.DecodeErrorFrame(data)
+	return &ServerError{MsgID: f.MsgID, Code: f.Code, ReqID: f.ReqID, Message: f.Message}
+}
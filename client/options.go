@@ -0,0 +1,91 @@
+package client
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+type Option func(c *Client)
+
+// 设置握手请求头，如鉴权token
+func WithHeader(header http.Header) Option {
+	return func(c *Client) {
+		c.header = header
+	}
+}
+
+// 设置封包拆包格式，需与服务端一致，默认 netw.NewDataPack()
+func WithPacket(pack iface.Packet) Option {
+	return func(c *Client) {
+		c.packet = pack
+	}
+}
+
+// 设置消息内容编解码器，需与服务端一致，默认 codec.NewProtoCodec()
+func WithCodec(cc iface.Codec) Option {
+	return func(c *Client) {
+		c.codec = cc
+	}
+}
+
+// 设置websocket消息类型，需与服务端MessageType一致，默认 websocket.BinaryMessage
+func WithMessageType(t int) Option {
+	return func(c *Client) {
+		c.messageType = t
+	}
+}
+
+// 每隔interval发送一次msgID为msgID的心跳消息，msgID为0时不发送
+func WithHeartbeat(msgID uint32, interval time.Duration) Option {
+	return func(c *Client) {
+		c.heartbeatMsgID = msgID
+		c.heartbeatInterval = interval
+	}
+}
+
+// 设置服务端测量往返延迟的RTTMsgID，需与服务端配置一致，收到后原样回复
+func WithRTTMsgID(msgID uint32) Option {
+	return func(c *Client) {
+		c.rttMsgID = msgID
+	}
+}
+
+// 断线自动重连，重连间隔从min开始翻倍直到max，maxRetries为0时不限次数
+func WithReconnect(min, max time.Duration, maxRetries int) Option {
+	return func(c *Client) {
+		c.reconnect = true
+		c.backoffMin = min
+		c.backoffMax = max
+		c.maxRetries = maxRetries
+	}
+}
+
+// 设置服务端写合并的BatchMsgID，需与服务端配置一致，收到后自动拆分
+func WithBatchMsgID(msgID uint32) Option {
+	return func(c *Client) {
+		c.batchMsgID = msgID
+	}
+}
+
+// 设置服务端回复错误的ErrorMsgID，需与服务端配置一致，Request收到后返回*ServerError
+func WithErrorMsgID(msgID uint32) Option {
+	return func(c *Client) {
+		c.errorMsgID = msgID
+	}
+}
+
+// 设置连接建立(含重连成功)时的回调
+func WithOnConnect(fn func(c *Client)) Option {
+	return func(c *Client) {
+		c.onConnect = fn
+	}
+}
+
+// 设置连接断开时的回调，服务端发送关闭帧时err为*websocket.CloseError，包含关闭码与原因
+func WithOnDisconnect(fn func(c *Client, err error)) Option {
+	return func(c *Client) {
+		c.onDisconnect = fn
+	}
+}
@@ -0,0 +1,201 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake 手动推进的时钟，只有Advance与Set会改变时间，到期的定时器按到期时间依次触发；
+// AfterFunc的回调在Advance的goroutine中同步执行，Timer与Ticker的tick写入带缓冲的C()
+type Fake struct {
+	now     time.Time
+	waiters []*fakeTimer // 按到期时间排序的定时器
+	lock    sync.Mutex
+	cond    *sync.Cond // 定时器数量变化时通知BlockUntil
+}
+
+// NewFake 创建从start开始的时钟，start为零值时从2000-01-01 00:00:00 UTC开始
+func NewFake(start time.Time) *Fake {
+	if start.IsZero() {
+		start = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	f := &Fake{now: start}
+	f.cond = sync.NewCond(&f.lock)
+	return f
+}
+
+func (f *Fake) Now() time.Time {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return f.now
+}
+
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Sleep 阻塞到时钟被推进d之后
+func (f *Fake) Sleep(d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	<-f.NewTimer(d).C()
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1)}
+	f.schedule(t, d)
+	return t
+}
+
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{clock: f, c: make(chan time.Time, 1), period: d}
+	f.schedule(t, d)
+	return fakeTicker{t}
+}
+
+func (f *Fake) AfterFunc(d time.Duration, fn func()) Timer {
+	t := &fakeTimer{clock: f, fn: fn}
+	f.schedule(t, d)
+	return t
+}
+
+// Advance 将时间推进d，依次触发期间到期的定时器，回调中新增的到期定时器同样会被触发
+func (f *Fake) Advance(d time.Duration) {
+	f.lock.Lock()
+	target := f.now.Add(d)
+	f.lock.Unlock()
+	for {
+		f.lock.Lock()
+		if len(f.waiters) == 0 || f.waiters[0].at.After(target) {
+			f.now = target
+			f.lock.Unlock()
+			return
+		}
+		t := f.waiters[0]
+		f.waiters = f.waiters[1:]
+		if t.at.After(f.now) {
+			f.now = t.at
+		}
+		now := f.now
+		if t.period > 0 {
+			t.at = t.at.Add(t.period)
+			f.insert(t)
+		} else {
+			t.active = false
+		}
+		f.cond.Broadcast()
+		f.lock.Unlock()
+		t.fire(now)
+	}
+}
+
+// Set 将时间推进到t，t早于当前时间时不变
+func (f *Fake) Set(t time.Time) {
+	if d := t.Sub(f.Now()); d > 0 {
+		f.Advance(d)
+	}
+}
+
+// Waiters 等待触发的定时器数量，包括Sleep
+func (f *Fake) Waiters() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil 阻塞到等待触发的定时器数量至少为n，用于在Advance之前等待其它goroutine开始计时
+func (f *Fake) BlockUntil(n int) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// schedule 设置定时器在d之后到期
+func (f *Fake) schedule(t *fakeTimer, d time.Duration) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	t.at = f.now.Add(d)
+	t.active = true
+	f.insert(t)
+	f.cond.Broadcast()
+}
+
+// insert 按到期时间插入定时器，相同到期时间的按插入顺序触发，调用方需持有锁
+func (f *Fake) insert(t *fakeTimer) {
+	i := sort.Search(len(f.waiters), func(i int) bool { return f.waiters[i].at.After(t.at) })
+	f.waiters = append(f.waiters, nil)
+	copy(f.waiters[i+1:], f.waiters[i:])
+	f.waiters[i] = t
+}
+
+// remove 移除定时器，返回定时器是否在等待触发，调用方需持有锁
+func (f *Fake) remove(t *fakeTimer) bool {
+	if !t.active {
+		return false
+	}
+	for i, w := range f.waiters {
+		if w == t {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			break
+		}
+	}
+	t.active = false
+	f.cond.Broadcast()
+	return true
+}
+
+// fakeTimer Fake的Timer与Ticker
+type fakeTimer struct {
+	clock  *Fake
+	at     time.Time
+	period time.Duration // Ticker的周期，Timer为0
+	c      chan time.Time
+	fn     func()
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.lock.Lock()
+	defer t.clock.lock.Unlock()
+	return t.clock.remove(t)
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.lock.Lock()
+	active := t.clock.remove(t)
+	t.clock.lock.Unlock()
+	t.clock.schedule(t, d)
+	return active
+}
+
+// fakeTicker Fake的Ticker
+type fakeTicker struct {
+	*fakeTimer
+}
+
+func (t fakeTicker) Stop() {
+	t.fakeTimer.Stop()
+}
+
+// fire 触发定时器，C()未被取走时丢弃本次tick
+func (t *fakeTimer) fire(now time.Time) {
+	if t.fn != nil {
+		t.fn()
+		return
+	}
+	select {
+	case t.c <- now:
+	default:
+	}
+}
@@ -0,0 +1,339 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// KeyPrefix 集群在Redis中的Key与消息总线主题的前缀
+	KeyPrefix = "game:"
+	// NodeTTL 节点注册信息的过期时间，节点每隔NodeTTL/3续期一次
+	NodeTTL = 30 * time.Second
+
+	ErrUIDOffline = errors.New("cluster: uid offline")
+	ErrStopped    = errors.New("cluster: stopped")
+)
+
+// unbindScript 仅当uid仍归属于当前节点时才删除，避免覆盖其它节点的新登录
+var unbindScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// message 节点间转发的消息
+type message struct {
+	UID   string `json:"uid,omitempty"` // 为空时表示广播
+	MsgID uint32 `json:"msg_id"`
+	Data  []byte `json:"data"`
+}
+
+// NodeMeta 节点对外公布的信息，供网关选择服务使用
+type NodeMeta struct {
+	Region   string `json:"region,omitempty"`   // 节点所在区域，如 ap-east
+	Endpoint string `json:"endpoint,omitempty"` // 客户端连接的网关地址，如 wss://hk1.example.com/ws
+	Capacity int    `json:"capacity,omitempty"` // 节点允许的最大连接数，0为不限制
+}
+
+// NodeInfo 节点注册信息，节点续期时更新连接数
+type NodeInfo struct {
+	ID string `json:"id"`
+	NodeMeta
+	Conns     int   `json:"conns"`      // 当前连接数
+	UpdatedAt int64 `json:"updated_at"` // 最后续期时间(Unix秒)
+}
+
+// Cluster 集群网关，节点与uid登记在Redis中，通过消息总线将消息路由到玩家连接所在节点
+type Cluster struct {
+	nodeID string
+	server iface.Server
+	bus    iface.MessageBus
+	rdb    redis.UniversalClient // 节点注册表，为nil时不登记uid，单播退化为全节点投递
+	meta   NodeMeta
+	quit   chan struct{}
+	once   sync.Once
+}
+
+// NewCluster 创建集群网关，nodeID在集群内需唯一；rdb为nil时仅依赖消息总线
+func NewCluster(s iface.Server, bus iface.MessageBus, rdb redis.UniversalClient, nodeID string) *Cluster {
+	return &Cluster{
+		nodeID: nodeID,
+		server: s,
+		bus:    bus,
+		rdb:    rdb,
+		quit:   make(chan struct{}),
+	}
+}
+
+// NodeID 当前节点ID
+func (c *Cluster) NodeID() string {
+	return c.nodeID
+}
+
+// SetMeta 设置节点对外公布的信息，需在Start之前调用
+func (c *Cluster) SetMeta(meta NodeMeta) {
+	c.meta = meta
+}
+
+// Start 注册当前节点并开始接收其它节点转发的消息，同时将节点注册表与消息总线的连通性注册为Server的就绪检查cluster
+func (c *Cluster) Start() error {
+	if c.rdb != nil {
+		if err := c.register(context.Background()); err != nil {
+			return err
+		}
+	}
+	if err := c.bus.Subscribe(c.nodeChannel(c.nodeID), c.receive); err != nil {
+		return err
+	}
+	if err := c.bus.Subscribe(c.uidChannel(), c.receive); err != nil {
+		_ = c.bus.Close()
+		return err
+	}
+	if err := c.bus.Subscribe(c.broadcastChannel(), c.receiveBroadcast); err != nil {
+		_ = c.bus.Close()
+		return err
+	}
+	c.server.AddHealthCheck("cluster", iface.HealthReadiness, c.checkHealth)
+	zap.S().Info("[START] cluster node ", c.nodeID)
+	if c.rdb != nil {
+		go c.keepAlive()
+	}
+	return nil
+}
+
+// Stop 注销当前节点
+func (c *Cluster) Stop() {
+	c.once.Do(func() {
+		close(c.quit)
+		_ = c.bus.Close()
+		if c.rdb != nil {
+			_ = c.rdb.Del(context.Background(), c.nodeKey(c.nodeID)).Err()
+		}
+	})
+}
+
+// checkHealth 节点注册表与消息总线是否连通，Stop后检查失败
+func (c *Cluster) checkHealth(ctx context.Context) error {
+	select {
+	case <-c.quit:
+		return ErrStopped
+	default:
+	}
+	if c.rdb != nil {
+		if err := c.rdb.Ping(ctx).Err(); err != nil {
+			return fmt.Errorf("registry: %w", err)
+		}
+	}
+	if p, ok := c.bus.(iface.Pinger); ok {
+		if err := p.Ping(ctx); err != nil {
+			return fmt.Errorf("bus: %w", err)
+		}
+	}
+	return nil
+}
+
+// Online 登记uid所在节点，一般在鉴权成功后调用
+func (c *Cluster) Online(conn iface.Connection) error {
+	uid := conn.GetUID()
+	if uid == "" || c.rdb == nil {
+		return nil
+	}
+	return c.rdb.Set(context.Background(), c.uidKey(uid), c.nodeID, 0).Err()
+}
+
+// Offline 移除uid所在节点的登记，一般在OnConnStop中调用
+func (c *Cluster) Offline(conn iface.Connection) error {
+	uid := conn.GetUID()
+	if uid == "" || c.rdb == nil {
+		return nil
+	}
+	return unbindScript.Run(context.Background(), c.rdb, []string{c.uidKey(uid)}, c.nodeID).Err()
+}
+
+// Nodes 当前存活的全部节点ID，未配置Redis时为空
+func (c *Cluster) Nodes() ([]string, error) {
+	if c.rdb == nil {
+		return nil, nil
+	}
+	ctx := context.Background()
+	prefix := KeyPrefix + "node:"
+	var nodes []string
+	iter := c.rdb.Scan(ctx, 0, prefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		nodes = append(nodes, iter.Val()[len(prefix):])
+	}
+	return nodes, iter.Err()
+}
+
+// NodeInfos 当前存活的全部节点注册信息，未配置Redis时为空
+func (c *Cluster) NodeInfos() ([]NodeInfo, error) {
+	nodes, err := c.Nodes()
+	if err != nil || len(nodes) == 0 {
+		return nil, err
+	}
+	keys := make([]string, len(nodes))
+	for i, nodeID := range nodes {
+		keys[i] = c.nodeKey(nodeID)
+	}
+	values, err := c.rdb.MGet(context.Background(), keys...).Result()
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]NodeInfo, 0, len(values))
+	for i, value := range values {
+		str, ok := value.(string)
+		if !ok {
+			// 扫描之后过期
+			continue
+		}
+		var info NodeInfo
+		if err := json.Unmarshal([]byte(str), &info); err != nil {
+			zap.S().Warn("cluster bad node info ", nodes[i], " ", err)
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// SendToUID 向uid发送消息，玩家连接在其它节点时经由消息总线转发，不在线时存入Server的离线消息存储；
+// 未配置Redis时投递给全部节点，无法判断uid是否在线
+func (c *Cluster) SendToUID(uid string, msgID uint32, data []byte) error {
+	err := c.sendToUID(uid, msgID, data)
+	if err == ErrUIDOffline {
+		if store := c.server.GetOfflineStore(); store != nil {
+			return store.Push(uid, iface.OfflineMessage{MsgID: msgID, Data: append([]byte(nil), data...), CreatedAt: time.Now()})
+		}
+	}
+	return err
+}
+
+func (c *Cluster) sendToUID(uid string, msgID uint32, data []byte) error {
+	if c.sendLocal(uid, msgID, data) {
+		return nil
+	}
+	if c.rdb == nil {
+		return c.publish(c.uidChannel(), message{UID: uid, MsgID: msgID, Data: data})
+	}
+	ctx := context.Background()
+	nodeID, err := c.rdb.Get(ctx, c.uidKey(uid)).Result()
+	if err == redis.Nil {
+		return ErrUIDOffline
+	}
+	if err != nil {
+		return err
+	}
+	if nodeID == c.nodeID {
+		// 登记在本节点但连接已断开
+		return ErrUIDOffline
+	}
+	if n, err := c.rdb.Exists(ctx, c.nodeKey(nodeID)).Result(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrUIDOffline
+	}
+	return c.publish(c.nodeChannel(nodeID), message{UID: uid, MsgID: msgID, Data: data})
+}
+
+// BroadcastCluster 向集群内全部节点的在线连接广播消息，包括当前节点
+func (c *Cluster) BroadcastCluster(msgID uint32, data []byte) error {
+	return c.publish(c.broadcastChannel(), message{MsgID: msgID, Data: data})
+}
+
+// sendLocal 向当前节点上uid的连接发送消息，返回是否找到连接
+func (c *Cluster) sendLocal(uid string, msgID uint32, data []byte) bool {
+	conns := c.server.GetConnMgr().GetByUID(uid)
+	for _, conn := range conns {
+		_ = conn.SendBuffMsg(msgID, data)
+	}
+	return len(conns) > 0
+}
+
+func (c *Cluster) publish(channel string, msg message) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	return c.bus.Publish(channel, payload)
+}
+
+// receive 处理其它节点转发给uid的消息
+func (c *Cluster) receive(data []byte) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		zap.S().Warn("cluster bad message ", err)
+		return
+	}
+	c.sendLocal(msg.UID, msg.MsgID, msg.Data)
+}
+
+// receiveBroadcast 处理集群广播消息
+func (c *Cluster) receiveBroadcast(data []byte) {
+	var msg message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		zap.S().Warn("cluster bad message ", err)
+		return
+	}
+	c.server.Broadcast(msg.MsgID, msg.Data)
+}
+
+// keepAlive 定时续期节点注册信息
+func (c *Cluster) keepAlive() {
+	ticker := time.NewTicker(NodeTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.quit:
+			return
+		case <-ticker.C:
+			if err := c.register(context.Background()); err != nil {
+				zap.S().Warn("cluster keepalive error ", err)
+			}
+		}
+	}
+}
+
+// register 写入节点注册信息，Redis重启后续期时也能重新注册
+func (c *Cluster) register(ctx context.Context) error {
+	info, err := json.Marshal(NodeInfo{
+		ID:        c.nodeID,
+		NodeMeta:  c.meta,
+		Conns:     c.server.GetConnMgr().Len(),
+		UpdatedAt: time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	return c.rdb.Set(ctx, c.nodeKey(c.nodeID), info, NodeTTL).Err()
+}
+
+func (c *Cluster) nodeKey(nodeID string) string {
+	return KeyPrefix + "node:" + nodeID
+}
+
+func (c *Cluster) uidKey(uid string) string {
+	return KeyPrefix + "uid:" + uid
+}
+
+func (c *Cluster) nodeChannel(nodeID string) string {
+	return KeyPrefix + "channel:node:" + nodeID
+}
+
+func (c *Cluster) uidChannel() string {
+	return KeyPrefix + "channel:uid"
+}
+
+func (c *Cluster) broadcastChannel() string {
+	return KeyPrefix + "channel:broadcast"
+}
@@ -0,0 +1,23 @@
+package cluster
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisIdempotencyStore 基于Redis的幂等键存储，集群内各节点共享
+type RedisIdempotencyStore struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedisIdempotencyStore 创建Redis幂等键存储
+func NewRedisIdempotencyStore(rdb redis.UniversalClient) *RedisIdempotencyStore {
+	return &RedisIdempotencyStore{rdb: rdb}
+}
+
+// SetNX key不存在时写入并返回true，ttl后过期
+func (s *RedisIdempotencyStore) SetNX(key string, ttl time.Duration) (bool, error) {
+	return s.rdb.SetNX(context.Background(), KeyPrefix+"idem:"+key, 1, ttl).Result()
+}
@@ -0,0 +1,58 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NatsBus 基于NATS的消息总线
+type NatsBus struct {
+	nc   *nats.Conn
+	subs []*nats.Subscription
+	lock sync.Mutex
+}
+
+// NewNatsBus 创建NATS消息总线，nc的生命周期由调用方管理
+func NewNatsBus(nc *nats.Conn) *NatsBus {
+	return &NatsBus{nc: nc}
+}
+
+// Publish 向主题发布消息
+func (b *NatsBus) Publish(subject string, data []byte) error {
+	return b.nc.Publish(subject, data)
+}
+
+// Subscribe 订阅主题
+func (b *NatsBus) Subscribe(subject string, handler func(data []byte)) error {
+	sub, err := b.nc.Subscribe(subject, func(m *nats.Msg) {
+		handler(m.Data)
+	})
+	if err != nil {
+		return err
+	}
+	b.lock.Lock()
+	b.subs = append(b.subs, sub)
+	b.lock.Unlock()
+	return nil
+}
+
+// Close 取消全部订阅
+func (b *NatsBus) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var err error
+	for _, sub := range b.subs {
+		if e := sub.Unsubscribe(); e != nil {
+			err = e
+		}
+	}
+	b.subs = nil
+	return err
+}
+
+// Ping 向NATS服务器发送PING并等待PONG
+func (b *NatsBus) Ping(ctx context.Context) error {
+	return b.nc.FlushWithContext(ctx)
+}
@@ -0,0 +1,77 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaomingping/game/iface"
+)
+
+// RedisOfflineStore 基于Redis列表的离线消息存储，集群内各节点共享
+type RedisOfflineStore struct {
+	rdb    redis.UniversalClient
+	maxLen int           // 每个用户保留的最大消息条数，<=0为不限制
+	ttl    time.Duration // 消息过期时间，<=0为不过期
+}
+
+// NewRedisOfflineStore 创建Redis离线消息存储
+func NewRedisOfflineStore(rdb redis.UniversalClient, maxLen int, ttl time.Duration) *RedisOfflineStore {
+	return &RedisOfflineStore{rdb: rdb, maxLen: maxLen, ttl: ttl}
+}
+
+// Push 追加一条离线消息，超出容量时丢弃最旧的消息，并续期列表的过期时间
+func (s *RedisOfflineStore) Push(uid string, msg iface.OfflineMessage) error {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	key := s.key(uid)
+	_, err = s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.RPush(ctx, key, payload)
+		if s.maxLen > 0 {
+			pipe.LTrim(ctx, key, int64(-s.maxLen), -1)
+		}
+		if s.ttl > 0 {
+			pipe.Expire(ctx, key, s.ttl)
+		}
+		return nil
+	})
+	return err
+}
+
+// Pop 取出并删除全部未过期的离线消息
+func (s *RedisOfflineStore) Pop(uid string) ([]iface.OfflineMessage, error) {
+	ctx := context.Background()
+	key := s.key(uid)
+	var values *redis.StringSliceCmd
+	_, err := s.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		values = pipe.LRange(ctx, key, 0, -1)
+		pipe.Del(ctx, key)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	var deadline time.Time
+	if s.ttl > 0 {
+		deadline = time.Now().Add(-s.ttl)
+	}
+	msgs := make([]iface.OfflineMessage, 0, len(values.Val()))
+	for _, value := range values.Val() {
+		var msg iface.OfflineMessage
+		if err := json.Unmarshal([]byte(value), &msg); err != nil {
+			continue
+		}
+		if msg.CreatedAt.After(deadline) {
+			msgs = append(msgs, msg)
+		}
+	}
+	return msgs, nil
+}
+
+func (s *RedisOfflineStore) key(uid string) string {
+	return KeyPrefix + "offline:" + uid
+}
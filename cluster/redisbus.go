@@ -0,0 +1,63 @@
+package cluster
+
+import (
+	"context"
+	"sync"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// RedisBus 基于Redis pub/sub的消息总线
+type RedisBus struct {
+	rdb  redis.UniversalClient
+	subs []*redis.PubSub
+	lock sync.Mutex
+}
+
+// NewRedisBus 创建Redis消息总线
+func NewRedisBus(rdb redis.UniversalClient) *RedisBus {
+	return &RedisBus{rdb: rdb}
+}
+
+// Publish 向频道发布消息
+func (b *RedisBus) Publish(subject string, data []byte) error {
+	return b.rdb.Publish(context.Background(), subject, data).Err()
+}
+
+// Subscribe 订阅频道
+func (b *RedisBus) Subscribe(subject string, handler func(data []byte)) error {
+	ctx := context.Background()
+	ps := b.rdb.Subscribe(ctx, subject)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return err
+	}
+	b.lock.Lock()
+	b.subs = append(b.subs, ps)
+	b.lock.Unlock()
+	go func() {
+		for m := range ps.Channel() {
+			handler([]byte(m.Payload))
+		}
+	}()
+	return nil
+}
+
+// Close 取消全部订阅
+func (b *RedisBus) Close() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var err error
+	for _, ps := range b.subs {
+		if e := ps.Close(); e != nil {
+			err = e
+		}
+	}
+	b.subs = nil
+	return err
+}
+
+// Ping 探测Redis连通性
+func (b *RedisBus) Ping(ctx context.Context) error {
+	return b.rdb.Ping(ctx).Err()
+}
@@ -0,0 +1,54 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaomingping/game/iface"
+)
+
+// RedisSessionStore 基于Redis的会话元数据存储，集群内各节点共享
+type RedisSessionStore struct {
+	rdb redis.UniversalClient
+}
+
+// NewRedisSessionStore 创建Redis会话元数据存储
+func NewRedisSessionStore(rdb redis.UniversalClient) *RedisSessionStore {
+	return &RedisSessionStore{rdb: rdb}
+}
+
+// Save 保存会话元数据，ttl后过期
+func (s *RedisSessionStore) Save(info iface.SessionInfo, ttl time.Duration) error {
+	payload, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return s.rdb.Set(context.Background(), s.key(info.Token), payload, ttl).Err()
+}
+
+// Load 利用token读取会话元数据
+func (s *RedisSessionStore) Load(token string) (iface.SessionInfo, bool, error) {
+	var info iface.SessionInfo
+	payload, err := s.rdb.Get(context.Background(), s.key(token)).Bytes()
+	if err == redis.Nil {
+		return info, false, nil
+	}
+	if err != nil {
+		return info, false, err
+	}
+	if err := json.Unmarshal(payload, &info); err != nil {
+		return info, false, err
+	}
+	return info, true, nil
+}
+
+// Delete 删除会话元数据
+func (s *RedisSessionStore) Delete(token string) error {
+	return s.rdb.Del(context.Background(), s.key(token)).Err()
+}
+
+func (s *RedisSessionStore) key(token string) string {
+	return KeyPrefix + "session:" + token
+}
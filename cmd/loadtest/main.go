@@ -0,0 +1,227 @@
+// loadtest 压测工具，模拟N个客户端按场景脚本发送消息，统计连接成功率、消息RTT分位数与错误数
+//
+//	go run ./cmd/loadtest -url ws://127.0.0.1:8080/ws -clients 1000 -scenario scenario.json
+//
+// 场景文件为JSON数组，每个步骤依次执行：
+//
+//	[
+//	  {"name": "login", "msg_id": 1, "payload": "token", "request": true},
+//	  {"name": "join",  "msg_id": 3, "payload": "room1", "request": true},
+//	  {"name": "spam",  "msg_id": 5, "payload": "hello", "repeat": 100, "interval_ms": 50}
+//	]
+//
+// request为true时等待服务端回复带相同请求ID的消息并统计RTT，否则只发送
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/client"
+)
+
+// Step 场景步骤
+type Step struct {
+	Name       string `json:"name"`
+	MsgID      uint32 `json:"msg_id"`
+	Payload    string `json:"payload"`
+	Base64     bool   `json:"base64"`      // payload为base64编码的二进制内容
+	Request    bool   `json:"request"`     // 等待回复并统计RTT
+	Repeat     int    `json:"repeat"`      // 重复次数，默认1
+	IntervalMs int    `json:"interval_ms"` // 每次发送的间隔
+	data       []byte
+}
+
+// stats 压测统计
+type stats struct {
+	connected int64
+	connFail  int64
+	sent      int64
+	lock      sync.Mutex
+	connTimes []time.Duration
+	rtts      map[string][]time.Duration
+	errors    map[string]int
+}
+
+func (s *stats) addRTT(step string, d time.Duration) {
+	s.lock.Lock()
+	s.rtts[step] = append(s.rtts[step], d)
+	s.lock.Unlock()
+}
+
+func (s *stats) addError(step string, err error) {
+	s.lock.Lock()
+	s.errors[step+": "+err.Error()]++
+	s.lock.Unlock()
+}
+
+var (
+	url       = flag.String("url", "ws://127.0.0.1:8080/ws", "服务端websocket地址")
+	clients   = flag.Int("clients", 100, "模拟客户端数量")
+	ramp      = flag.Duration("ramp", 10*time.Second, "全部客户端建立连接所用时间")
+	scenario  = flag.String("scenario", "", "场景文件，为空时只建立连接并保持心跳")
+	timeout   = flag.Duration("timeout", 5*time.Second, "单个请求等待回复的超时时间")
+	hold      = flag.Duration("hold", 0, "场景执行完后保持连接的时间")
+	heartbeat = flag.Uint("heartbeat", 0, "心跳消息MsgID，0为不发送")
+	hbEvery   = flag.Duration("heartbeat-interval", 10*time.Second, "心跳间隔")
+	errorMsg  = flag.Uint("error-msg-id", 0, "服务端回复错误的ErrorMsgID")
+	batchMsg  = flag.Uint("batch-msg-id", 0, "服务端写合并的BatchMsgID")
+)
+
+func main() {
+	flag.Parse()
+	steps, err := loadScenario(*scenario)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load scenario error:", err)
+		os.Exit(1)
+	}
+	st := &stats{rtts: make(map[string][]time.Duration), errors: make(map[string]int)}
+	opts := []client.Option{
+		client.WithErrorMsgID(uint32(*errorMsg)),
+		client.WithBatchMsgID(uint32(*batchMsg)),
+		client.WithHeartbeat(uint32(*heartbeat), *hbEvery),
+	}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < *clients; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runClient(steps, opts, st)
+		}()
+		if *clients > 1 {
+			time.Sleep(*ramp / time.Duration(*clients))
+		}
+	}
+	wg.Wait()
+	report(st, steps, time.Since(start))
+}
+
+// runClient 单个模拟客户端：建立连接后依次执行场景步骤
+func runClient(steps []*Step, opts []client.Option, st *stats) {
+	begin := time.Now()
+	c, err := client.Dial(*url, opts...)
+	if err != nil {
+		atomic.AddInt64(&st.connFail, 1)
+		st.addError("connect", err)
+		return
+	}
+	defer c.Close()
+	atomic.AddInt64(&st.connected, 1)
+	st.lock.Lock()
+	st.connTimes = append(st.connTimes, time.Since(begin))
+	st.lock.Unlock()
+
+	for _, step := range steps {
+		for i := 0; i < step.Repeat; i++ {
+			if i > 0 && step.IntervalMs > 0 {
+				time.Sleep(time.Duration(step.IntervalMs) * time.Millisecond)
+			}
+			atomic.AddInt64(&st.sent, 1)
+			if !step.Request {
+				if err := c.SendMsg(step.MsgID, step.data); err != nil {
+					st.addError(step.Name, err)
+					return
+				}
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+			sent := time.Now()
+			_, err := c.RequestRaw(ctx, step.MsgID, step.data)
+			cancel()
+			if err != nil {
+				st.addError(step.Name, err)
+				if _, ok := err.(*client.ServerError); !ok {
+					return
+				}
+				continue
+			}
+			st.addRTT(step.Name, time.Since(sent))
+		}
+	}
+	if *hold > 0 {
+		time.Sleep(*hold)
+	}
+}
+
+func loadScenario(path string) ([]*Step, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var steps []*Step
+	if err := json.Unmarshal(data, &steps); err != nil {
+		return nil, err
+	}
+	for i, step := range steps {
+		if step.Name == "" {
+			step.Name = fmt.Sprintf("step%d", i+1)
+		}
+		if step.Repeat <= 0 {
+			step.Repeat = 1
+		}
+		step.data = []byte(step.Payload)
+		if step.Base64 {
+			if step.data, err = base64.StdEncoding.DecodeString(step.Payload); err != nil {
+				return nil, fmt.Errorf("%s: %v", step.Name, err)
+			}
+		}
+	}
+	return steps, nil
+}
+
+func report(st *stats, steps []*Step, elapsed time.Duration) {
+	total := st.connected + st.connFail
+	fmt.Printf("elapsed        %v\n", elapsed.Round(time.Millisecond))
+	fmt.Printf("connections    %d/%d succeeded (%.2f%%)\n", st.connected, total, percent(st.connected, total))
+	fmt.Printf("connect time   %s\n", percentiles(st.connTimes))
+	fmt.Printf("messages sent  %d\n", st.sent)
+	for _, step := range steps {
+		if rtts, ok := st.rtts[step.Name]; ok {
+			fmt.Printf("rtt %-10s %s\n", step.Name, percentiles(rtts))
+		}
+	}
+	if len(st.errors) == 0 {
+		return
+	}
+	fmt.Println("errors:")
+	keys := make([]string, 0, len(st.errors))
+	for k := range st.errors {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Printf("  %6d  %s\n", st.errors[k], k)
+	}
+}
+
+func percentiles(ds []time.Duration) string {
+	if len(ds) == 0 {
+		return "n/a"
+	}
+	sort.Slice(ds, func(i, j int) bool { return ds[i] < ds[j] })
+	at := func(p float64) time.Duration {
+		return ds[int(p*float64(len(ds)-1))].Round(time.Microsecond)
+	}
+	return fmt.Sprintf("n=%d p50=%v p90=%v p99=%v max=%v", len(ds), at(0.5), at(0.9), at(0.99), ds[len(ds)-1].Round(time.Microsecond))
+}
+
+func percent(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,92 @@
+// protodoc 从运行中服务的管理后台拉取协议描述，生成供客户端使用的JSON或.proto文件
+//
+//	go run ./cmd/protodoc -admin http://127.0.0.1:9090 -token xxx -format proto -package game -o msgid.proto
+//
+// 也可以读取之前保存的JSON协议描述重新生成：
+//
+//	go run ./cmd/protodoc -in protocol.json -format proto -o msgid.proto
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/xiaomingping/game/admin"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/protodoc"
+)
+
+var (
+	addr   = flag.String("admin", "http://127.0.0.1:9090", "管理后台地址")
+	token  = flag.String("token", "", "管理后台token")
+	in     = flag.String("in", "", "JSON协议描述文件，设置后不请求管理后台")
+	format = flag.String("format", "json", "输出格式，json或proto")
+	pkg    = flag.String("package", "", "proto包名")
+	out    = flag.String("o", "", "输出文件，为空时输出到标准输出")
+)
+
+func main() {
+	flag.Parse()
+	p, err := load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "load protocol error:", err)
+		os.Exit(1)
+	}
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "create output error:", err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		w = f
+	}
+	switch *format {
+	case "json":
+		err = protodoc.WriteJSON(w, p)
+	case "proto":
+		err = protodoc.WriteProto(w, p, *pkg)
+	default:
+		err = fmt.Errorf("unknown format %q", *format)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "write protocol error:", err)
+		os.Exit(1)
+	}
+}
+
+// load 读取协议描述文件或请求管理后台的 /admin/protocol
+func load() (iface.Protocol, error) {
+	var p iface.Protocol
+	if *in != "" {
+		data, err := ioutil.ReadFile(*in)
+		if err != nil {
+			return p, err
+		}
+		return p, json.Unmarshal(data, &p)
+	}
+	req, err := http.NewRequest(http.MethodGet, *addr+"/admin/protocol", nil)
+	if err != nil {
+		return p, err
+	}
+	if *token != "" {
+		req.Header.Set(admin.TokenHeader, *token)
+	}
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return p, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return p, fmt.Errorf("admin status %s", resp.Status)
+	}
+	return p, json.NewDecoder(resp.Body).Decode(&p)
+}
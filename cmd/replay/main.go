@@ -0,0 +1,124 @@
+// replay 回放recorder录制的会话，按原始时间间隔将某个连接的入站消息重新发送给服务端，用于调试与回归测试
+//
+//	go run ./cmd/replay -url ws://127.0.0.1:8080/ws -conn 42 game-20260101-120000.000000.rec
+//	go run ./cmd/replay -dump game-20260101-120000.000000.rec
+//
+// 未指定-conn时回放录制中出现的第一个连接；多个文件按参数顺序依次读取
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/xiaomingping/game/client"
+	"github.com/xiaomingping/game/recorder"
+)
+
+var (
+	url    = flag.String("url", "ws://127.0.0.1:8080/ws", "服务端websocket地址")
+	connID = flag.Int64("conn", 0, "回放的连接ID，0为录制中的第一个连接")
+	speed  = flag.Float64("speed", 1, "回放速度倍数，0为不等待直接发送")
+	dump   = flag.Bool("dump", false, "只打印录制内容，不回放")
+	wait   = flag.Duration("wait", time.Second, "回放结束后等待服务端响应的时间")
+)
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: replay [flags] file.rec ...")
+		os.Exit(2)
+	}
+	records, err := readAll(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "read recording error:", err)
+		os.Exit(1)
+	}
+	if *dump {
+		for _, rec := range records {
+			printRecord(rec)
+		}
+		return
+	}
+	if err := replay(records); err != nil {
+		fmt.Fprintln(os.Stderr, "replay error:", err)
+		os.Exit(1)
+	}
+}
+
+func readAll(files []string) ([]*recorder.Record, error) {
+	var records []*recorder.Record
+	for _, name := range files {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		rd := recorder.NewReader(f)
+		for {
+			rec, err := rd.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return nil, fmt.Errorf("%s: %v", name, err)
+			}
+			records = append(records, rec)
+		}
+		f.Close()
+	}
+	return records, nil
+}
+
+func replay(records []*recorder.Record) error {
+	c, err := client.Dial(*url, client.WithOnDisconnect(func(c *client.Client, err error) {
+		fmt.Println("disconnected:", err)
+	}))
+	if err != nil {
+		return err
+	}
+	defer c.Close()
+	target := *connID
+	var last time.Time
+	sent := 0
+	for _, rec := range records {
+		if rec.Direction != recorder.Inbound {
+			continue
+		}
+		if target == 0 {
+			target = rec.ConnID
+		}
+		if rec.ConnID != target {
+			continue
+		}
+		if !last.IsZero() && *speed > 0 {
+			time.Sleep(time.Duration(float64(rec.Time.Sub(last)) / *speed))
+		}
+		last = rec.Time
+		if err := c.SendMsg(rec.MsgID, rec.Data); err != nil {
+			return err
+		}
+		fmt.Printf("-> msgID=%d len=%d\n", rec.MsgID, len(rec.Data))
+		sent++
+	}
+	time.Sleep(*wait)
+	fmt.Printf("replayed %d messages of conn %d\n", sent, target)
+	return nil
+}
+
+func printRecord(rec *recorder.Record) {
+	dir := "->"
+	if rec.Direction == recorder.Outbound {
+		dir = "<-"
+	}
+	data := rec.Data
+	suffix := ""
+	if len(data) > 32 {
+		data, suffix = data[:32], "..."
+	}
+	fmt.Printf("%s conn=%d %s msgID=%d reqID=%d len=%d %s%s\n",
+		rec.Time.Format("15:04:05.000000"), rec.ConnID, dir, rec.MsgID, rec.ReqID, len(rec.Data), hex.EncodeToString(data), suffix)
+}
@@ -0,0 +1,33 @@
+package codec
+
+import (
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+var (
+	codecs   = make(map[string]iface.Codec)
+	codecsMu sync.RWMutex
+)
+
+func init() {
+	Register(NewProtoCodec())
+	Register(NewJSONCodec())
+	Register(NewMsgpackCodec())
+}
+
+// Register 注册编解码器，同名编解码器会被覆盖
+func Register(c iface.Codec) {
+	codecsMu.Lock()
+	defer codecsMu.Unlock()
+	codecs[c.Name()] = c
+}
+
+// Get 根据名称获取编解码器
+func Get(name string) (iface.Codec, bool) {
+	codecsMu.RLock()
+	defer codecsMu.RUnlock()
+	c, ok := codecs[name]
+	return c, ok
+}
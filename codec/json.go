@@ -0,0 +1,29 @@
+package codec
+
+import "encoding/json"
+
+// JSONName JSON编解码器名称
+const JSONName = "json"
+
+// JSONCodec JSON编解码器，便于Web客户端调试
+type JSONCodec struct{}
+
+// NewJSONCodec 创建JSON编解码器
+func NewJSONCodec() *JSONCodec {
+	return &JSONCodec{}
+}
+
+// Name 编解码器名称
+func (c *JSONCodec) Name() string {
+	return JSONName
+}
+
+// Marshal 序列化
+func (c *JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal 反序列化
+func (c *JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
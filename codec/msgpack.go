@@ -0,0 +1,35 @@
+package codec
+
+import "github.com/ugorji/go/codec"
+
+// MsgpackName MessagePack编解码器名称
+const MsgpackName = "msgpack"
+
+// MsgpackCodec MessagePack编解码器，体积比JSON更小
+type MsgpackCodec struct {
+	handle *codec.MsgpackHandle
+}
+
+// NewMsgpackCodec 创建MessagePack编解码器
+func NewMsgpackCodec() *MsgpackCodec {
+	h := &codec.MsgpackHandle{}
+	h.WriteExt = true
+	return &MsgpackCodec{handle: h}
+}
+
+// Name 编解码器名称
+func (c *MsgpackCodec) Name() string {
+	return MsgpackName
+}
+
+// Marshal 序列化
+func (c *MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var data []byte
+	err := codec.NewEncoderBytes(&data, c.handle).Encode(v)
+	return data, err
+}
+
+// Unmarshal 反序列化
+func (c *MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return codec.NewDecoderBytes(data, c.handle).Decode(v)
+}
@@ -0,0 +1,44 @@
+package codec
+
+import (
+	"errors"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// ProtoName Protobuf编解码器名称
+const ProtoName = "proto"
+
+// ErrNotProtoMessage 待编解码对象没有实现proto.Message
+var ErrNotProtoMessage = errors.New("codec: value is not a proto.Message")
+
+// ProtoCodec Protobuf编解码器
+type ProtoCodec struct{}
+
+// NewProtoCodec 创建Protobuf编解码器
+func NewProtoCodec() *ProtoCodec {
+	return &ProtoCodec{}
+}
+
+// Name 编解码器名称
+func (c *ProtoCodec) Name() string {
+	return ProtoName
+}
+
+// Marshal 序列化，v必须实现proto.Message
+func (c *ProtoCodec) Marshal(v interface{}) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, ErrNotProtoMessage
+	}
+	return proto.Marshal(msg)
+}
+
+// Unmarshal 反序列化，v必须实现proto.Message
+func (c *ProtoCodec) Unmarshal(data []byte, v interface{}) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return ErrNotProtoMessage
+	}
+	return proto.Unmarshal(data, msg)
+}
@@ -0,0 +1,144 @@
+package director
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/cluster"
+
+	"go.uber.org/zap"
+)
+
+var ErrNoGateway = errors.New("director: no available gateway")
+
+// Registry 节点注册表，cluster.Cluster实现了该接口
+type Registry interface {
+	NodeInfos() ([]cluster.NodeInfo, error)
+}
+
+// Options 网关选择参数
+type Options struct {
+	SameRegionLatency time.Duration // 未上报延迟时同区域节点的估算延迟，默认30ms
+	CrossRegionDelay  time.Duration // 未上报延迟时跨区域节点的估算延迟，默认200ms
+	LoadWeight        float64       // 负载对评分的影响，评分为 延迟*(1+LoadWeight*负载率)，默认1
+	RefreshInterval   time.Duration // 节点注册信息的缓存时间，默认1s
+}
+
+// Candidate 候选网关与评分，评分越低越优先
+type Candidate struct {
+	cluster.NodeInfo
+	LatencyMs int64   `json:"latency_ms"` // 上报或估算的延迟(毫秒)
+	Load      float64 `json:"load"`       // 负载率(0~1)
+	Score     float64 `json:"score"`
+}
+
+// Director 按客户端区域与延迟采样从集群注册表中选择网关
+type Director struct {
+	registry Registry
+	opts     Options
+
+	lock      sync.Mutex
+	nodes     []cluster.NodeInfo
+	fetchedAt time.Time
+}
+
+// New 创建网关选择服务
+func New(registry Registry, opts Options) *Director {
+	if opts.SameRegionLatency <= 0 {
+		opts.SameRegionLatency = 30 * time.Millisecond
+	}
+	if opts.CrossRegionDelay <= 0 {
+		opts.CrossRegionDelay = 200 * time.Millisecond
+	}
+	if opts.LoadWeight <= 0 {
+		opts.LoadWeight = 1
+	}
+	if opts.RefreshInterval <= 0 {
+		opts.RefreshInterval = time.Second
+	}
+	return &Director{registry: registry, opts: opts}
+}
+
+// Select 选择评分最低的网关，latency为客户端到各区域的延迟采样，可为nil
+func (d *Director) Select(region string, latency map[string]time.Duration) (Candidate, error) {
+	candidates, err := d.Rank(region, latency)
+	if err != nil {
+		return Candidate{}, err
+	}
+	if len(candidates) == 0 {
+		return Candidate{}, ErrNoGateway
+	}
+	return candidates[0], nil
+}
+
+// Rank 按评分从低到高返回全部可用网关，已满与未公布Endpoint的节点不参与选择
+func (d *Director) Rank(region string, latency map[string]time.Duration) ([]Candidate, error) {
+	nodes, err := d.fetch()
+	if err != nil {
+		return nil, err
+	}
+	// 未设置Capacity的节点以连接数最多的节点为满载
+	maxConns := 1
+	for _, node := range nodes {
+		if node.Conns > maxConns {
+			maxConns = node.Conns
+		}
+	}
+	candidates := make([]Candidate, 0, len(nodes))
+	for _, node := range nodes {
+		if node.Endpoint == "" || (node.Capacity > 0 && node.Conns >= node.Capacity) {
+			continue
+		}
+		c := Candidate{NodeInfo: node, LatencyMs: d.estimate(node.Region, region, latency).Milliseconds()}
+		if node.Capacity > 0 {
+			c.Load = float64(node.Conns) / float64(node.Capacity)
+		} else {
+			c.Load = float64(node.Conns) / float64(maxConns)
+		}
+		c.Score = float64(c.LatencyMs+1) * (1 + d.opts.LoadWeight*c.Load)
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Score != candidates[j].Score {
+			return candidates[i].Score < candidates[j].Score
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+	return candidates, nil
+}
+
+// estimate 客户端到节点所在区域的延迟，优先使用采样
+func (d *Director) estimate(nodeRegion, region string, latency map[string]time.Duration) time.Duration {
+	if rtt, ok := latency[nodeRegion]; ok {
+		return rtt
+	}
+	if nodeRegion == region {
+		return d.opts.SameRegionLatency
+	}
+	return d.opts.CrossRegionDelay
+}
+
+// fetch 获取节点注册信息，RefreshInterval内使用缓存，注册表出错时沿用上次的结果
+func (d *Director) fetch() ([]cluster.NodeInfo, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if d.nodes != nil && time.Since(d.fetchedAt) < d.opts.RefreshInterval {
+		return d.nodes, nil
+	}
+	nodes, err := d.registry.NodeInfos()
+	if err != nil {
+		if d.nodes != nil {
+			zap.S().Warn("director fetch nodes error ", err)
+			return d.nodes, nil
+		}
+		return nil, err
+	}
+	if nodes == nil {
+		nodes = []cluster.NodeInfo{}
+	}
+	d.nodes = nodes
+	d.fetchedAt = time.Now()
+	return nodes, nil
+}
@@ -0,0 +1,114 @@
+package director
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// RegionHeader 未传region参数时读取客户端区域的请求头，可由CDN或负载均衡写入
+	RegionHeader = "X-Client-Region"
+)
+
+// Server 网关选择HTTP服务，客户端登录前请求获取应连接的网关地址:
+//
+//	GET /gateway?region=ap-east&latency=ap-east:40,us-west:180
+//
+// latency为客户端测得的到各区域的延迟(毫秒)，返回评分最低的网关，/gateways返回全部候选
+type Server struct {
+	director *Director
+	engine   *gin.Engine
+	http     *http.Server
+}
+
+// NewServer 创建网关选择HTTP服务
+func NewServer(d *Director, addr string) *Server {
+	s := &Server{
+		director: d,
+		engine:   gin.New(),
+	}
+	s.engine.Use(gin.Recovery())
+	s.engine.GET("/gateway", s.selectGateway)
+	s.engine.GET("/gateways", s.listGateways)
+	s.http = &http.Server{Addr: addr, Handler: s.engine}
+	return s
+}
+
+// Engine 获取路由，可用于挂载鉴权中间件或自定义接口
+func (s *Server) Engine() *gin.Engine {
+	return s.engine
+}
+
+// Start 启动监听
+func (s *Server) Start() {
+	go func() {
+		zap.S().Info("[START] director server listen ", s.http.Addr)
+		if err := s.http.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.S().Error("director server error ", err)
+		}
+	}()
+}
+
+// Stop 停止监听
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_ = s.http.Shutdown(ctx)
+}
+
+// selectGateway 返回评分最低的网关
+func (s *Server) selectGateway(c *gin.Context) {
+	region, latency := parseQuery(c)
+	candidate, err := s.director.Select(region, latency)
+	if err == ErrNoGateway {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, candidate)
+}
+
+// listGateways 按评分返回全部候选网关
+func (s *Server) listGateways(c *gin.Context) {
+	region, latency := parseQuery(c)
+	candidates, err := s.director.Rank(region, latency)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"total": len(candidates), "gateways": candidates})
+}
+
+// parseQuery 解析客户端区域与延迟采样，格式错误的采样被忽略
+func parseQuery(c *gin.Context) (string, map[string]time.Duration) {
+	region := c.Query("region")
+	if region == "" {
+		region = c.GetHeader(RegionHeader)
+	}
+	var latency map[string]time.Duration
+	for _, sample := range strings.Split(c.Query("latency"), ",") {
+		i := strings.LastIndexByte(sample, ':')
+		if i <= 0 {
+			continue
+		}
+		ms, err := strconv.Atoi(sample[i+1:])
+		if err != nil || ms < 0 {
+			continue
+		}
+		if latency == nil {
+			latency = make(map[string]time.Duration)
+		}
+		latency[sample[:i]] = time.Duration(ms) * time.Millisecond
+	}
+	return region, latency
+}
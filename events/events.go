@@ -0,0 +1,175 @@
+package events
+
+import (
+	"errors"
+	"reflect"
+	"runtime/debug"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+var ErrBadHandler = errors.New("events: handler must be func(T) with exactly one argument")
+
+// SubOption 订阅选项
+type SubOption func(s *subscriber)
+
+// Async 在独立goroutine中处理事件，Publish不等待处理完成
+func Async() SubOption {
+	return func(s *subscriber) {
+		s.async = true
+	}
+}
+
+// Once 处理一次事件后自动取消订阅
+func Once() SubOption {
+	return func(s *subscriber) {
+		s.once = true
+	}
+}
+
+// subscriber 事件的一个订阅者
+type subscriber struct {
+	id    uint64
+	fn    reflect.Value
+	async bool
+	once  bool
+}
+
+// Bus 进程内事件总线，按事件的类型分发：订阅 func(PlayerLevelUp) 的处理函数会收到全部
+// PlayerLevelUp 事件；同步处理函数依订阅顺序在Publish的goroutine中执行，处理函数panic不影响其它订阅者
+type Bus struct {
+	subs  map[reflect.Type][]*subscriber
+	idGen uint64
+	wg    sync.WaitGroup
+	lock  sync.RWMutex
+}
+
+// Default 默认事件总线
+var Default = NewBus()
+
+// NewBus 创建事件总线
+func NewBus() *Bus {
+	return &Bus{subs: make(map[reflect.Type][]*subscriber)}
+}
+
+// Publish 在默认事件总线发布事件
+func Publish(event interface{}) int {
+	return Default.Publish(event)
+}
+
+// Subscribe 在默认事件总线订阅事件，fn为 func(T)，如 events.Subscribe(func(e PlayerLevelUp) {...})
+func Subscribe(fn interface{}, opts ...SubOption) (uint64, error) {
+	return Default.Subscribe(fn, opts...)
+}
+
+// Unsubscribe 在默认事件总线取消订阅
+func Unsubscribe(id uint64) {
+	Default.Unsubscribe(id)
+}
+
+// Subscribe 订阅参数类型为T的事件，fn为 func(T)，T为接口类型时接收实现该接口的全部事件，返回订阅ID
+func (b *Bus) Subscribe(fn interface{}, opts ...SubOption) (uint64, error) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func || v.Type().NumIn() != 1 || v.IsNil() {
+		return 0, ErrBadHandler
+	}
+	s := &subscriber{fn: v}
+	for _, opt := range opts {
+		opt(s)
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.idGen++
+	s.id = b.idGen
+	t := v.Type().In(0)
+	b.subs[t] = append(b.subs[t], s)
+	return s.id, nil
+}
+
+// Unsubscribe 取消订阅，正在执行的处理函数不会被中断
+func (b *Bus) Unsubscribe(id uint64) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.remove(id)
+}
+
+// remove 移除订阅者，调用方需持有锁
+func (b *Bus) remove(id uint64) bool {
+	for t, subs := range b.subs {
+		for i, s := range subs {
+			if s.id != id {
+				continue
+			}
+			// 复制而非原地修改，避免影响正在分发的切片
+			rest := make([]*subscriber, 0, len(subs)-1)
+			rest = append(rest, subs[:i]...)
+			rest = append(rest, subs[i+1:]...)
+			if len(rest) == 0 {
+				delete(b.subs, t)
+			} else {
+				b.subs[t] = rest
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// Publish 发布事件，返回接收该事件的订阅者数量
+func (b *Bus) Publish(event interface{}) int {
+	if event == nil {
+		return 0
+	}
+	v := reflect.ValueOf(event)
+	subs := b.match(v.Type())
+	for _, s := range subs {
+		if s.once {
+			// 并发Publish时只有成功移除的一方处理
+			b.lock.Lock()
+			removed := b.remove(s.id)
+			b.lock.Unlock()
+			if !removed {
+				continue
+			}
+		}
+		if s.async {
+			b.wg.Add(1)
+			go func(s *subscriber) {
+				defer b.wg.Done()
+				b.call(s, v)
+			}(s)
+			continue
+		}
+		b.call(s, v)
+	}
+	return len(subs)
+}
+
+// match 查找事件类型对应的订阅者，包括订阅了其实现的接口类型的订阅者
+func (b *Bus) match(t reflect.Type) []*subscriber {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	subs := b.subs[t]
+	for it, isubs := range b.subs {
+		if it != t && it.Kind() == reflect.Interface && t.Implements(it) {
+			subs = append(subs[:len(subs):len(subs)], isubs...)
+		}
+	}
+	return subs
+}
+
+// call 执行处理函数并捕获panic
+func (b *Bus) call(s *subscriber, v reflect.Value) {
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Errorw("event handler panic", "event", v.Type().String(), "err", err, "stack", string(debug.Stack()))
+		}
+	}()
+	s.fn.Call([]reflect.Value{v})
+}
+
+// Wait 等待全部异步处理函数执行完成，一般在停服时调用
+func (b *Bus) Wait() {
+	b.wg.Wait()
+}
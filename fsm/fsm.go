@@ -0,0 +1,265 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrCode 消息不属于连接当前阶段时ReplyError回复的错误码
+const ErrCode int32 = 1300
+
+var (
+	ErrUnknownState = errors.New("fsm: unknown state")
+	ErrTransition   = errors.New("fsm: transition not allowed")
+)
+
+// State 连接所处的阶段，如 Handshake、Authed、InLobby、InGame
+type State string
+
+// state 阶段允许的消息与可以转换到的阶段
+type state struct {
+	msgIDs  map[uint32]struct{}
+	ranges  [][2]uint32
+	next    map[State]struct{}
+	onEnter []func(conn iface.Connection, from State)
+	onExit  []func(conn iface.Connection, to State)
+}
+
+// allows 阶段是否允许msgID
+func (st *state) allows(msgID uint32) bool {
+	if _, ok := st.msgIDs[msgID]; ok {
+		return true
+	}
+	for _, r := range st.ranges {
+		if msgID >= r[0] && msgID <= r[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// connState 连接当前的阶段，保存在连接属性中
+type connState struct {
+	lock  sync.Mutex
+	state State
+}
+
+// Machine 连接阶段的状态机，每个阶段只允许处理声明的MsgID，阶段之间只能按声明的方向转换；
+// 阶段与转换需在服务启动前声明，连接的当前阶段保存在连接属性中
+type Machine struct {
+	name         string
+	initial      State
+	states       map[State]*state
+	always       map[uint32]struct{}
+	onTransition []func(conn iface.Connection, from, to State)
+	onReject     func(request iface.Request, current State)
+	lock         sync.Mutex // 保护连接属性的初始化
+}
+
+// New 创建状态机，name用于区分连接属性的Key，新连接处于initial阶段
+func New(name string, initial State) *Machine {
+	m := &Machine{
+		name:    name,
+		initial: initial,
+		states:  make(map[State]*state),
+		always:  make(map[uint32]struct{}),
+	}
+	m.Define(initial)
+	return m
+}
+
+// Define 声明阶段与阶段内允许的MsgID，重复声明时追加MsgID
+func (m *Machine) Define(name State, msgIDs ...uint32) *Machine {
+	st, ok := m.states[name]
+	if !ok {
+		st = &state{msgIDs: make(map[uint32]struct{}), next: make(map[State]struct{})}
+		m.states[name] = st
+	}
+	for _, msgID := range msgIDs {
+		st.msgIDs[msgID] = struct{}{}
+	}
+	return m
+}
+
+// DefineRange 声明阶段内允许的MsgID区间[start, end]，一般与路由分组的区间一致
+func (m *Machine) DefineRange(name State, start, end uint32) *Machine {
+	m.Define(name)
+	st := m.states[name]
+	st.ranges = append(st.ranges, [2]uint32{start, end})
+	return m
+}
+
+// Always 在任何阶段都允许的MsgID，如心跳与时间同步
+func (m *Machine) Always(msgIDs ...uint32) *Machine {
+	for _, msgID := range msgIDs {
+		m.always[msgID] = struct{}{}
+	}
+	return m
+}
+
+// Allow 声明from阶段可以转换到的阶段，未声明的阶段panic
+func (m *Machine) Allow(from State, to ...State) *Machine {
+	st := m.mustState(from)
+	for _, next := range to {
+		m.mustState(next)
+		st.next[next] = struct{}{}
+	}
+	return m
+}
+
+// OnEnter 追加进入阶段后的Hook函数，from为之前的阶段
+func (m *Machine) OnEnter(name State, hookFunc func(conn iface.Connection, from State)) *Machine {
+	st := m.mustState(name)
+	st.onEnter = append(st.onEnter, hookFunc)
+	return m
+}
+
+// OnExit 追加离开阶段后的Hook函数，to为之后的阶段，在OnEnter之前调用
+func (m *Machine) OnExit(name State, hookFunc func(conn iface.Connection, to State)) *Machine {
+	st := m.mustState(name)
+	st.onExit = append(st.onExit, hookFunc)
+	return m
+}
+
+// OnTransition 追加任意阶段转换后的Hook函数，在OnExit与OnEnter之后调用
+func (m *Machine) OnTransition(hookFunc func(conn iface.Connection, from, to State)) *Machine {
+	m.onTransition = append(m.onTransition, hookFunc)
+	return m
+}
+
+// SetOnReject 设置消息不属于当前阶段时的Hook函数，在回复错误之前调用
+func (m *Machine) SetOnReject(hookFunc func(request iface.Request, current State)) *Machine {
+	m.onReject = hookFunc
+	return m
+}
+
+func (m *Machine) mustState(name State) *state {
+	st, ok := m.states[name]
+	if !ok {
+		panic(fmt.Sprintf("fsm %s: state %s not defined", m.name, name))
+	}
+	return st
+}
+
+// property 连接属性中保存当前阶段的Key
+func (m *Machine) property() string {
+	return "fsm." + m.name
+}
+
+// connState 获取连接的阶段，首次获取时为initial
+func (m *Machine) connState(conn iface.Connection) *connState {
+	if v, err := conn.GetProperty(m.property()); err == nil {
+		if cs, ok := v.(*connState); ok {
+			return cs
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if v, err := conn.GetProperty(m.property()); err == nil {
+		if cs, ok := v.(*connState); ok {
+			return cs
+		}
+	}
+	cs := &connState{state: m.initial}
+	conn.SetProperty(m.property(), cs)
+	return cs
+}
+
+// Current 连接当前所处的阶段
+func (m *Machine) Current(conn iface.Connection) State {
+	cs := m.connState(conn)
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	return cs.state
+}
+
+// Is 连接是否处于name阶段
+func (m *Machine) Is(conn iface.Connection, name State) bool {
+	return m.Current(conn) == name
+}
+
+// Allowed 连接当前阶段是否允许处理msgID
+func (m *Machine) Allowed(conn iface.Connection, msgID uint32) bool {
+	if _, ok := m.always[msgID]; ok {
+		return true
+	}
+	st, ok := m.states[m.Current(conn)]
+	return ok && st.allows(msgID)
+}
+
+// Transition 将连接转换到to阶段，未声明该方向的转换时返回ErrTransition；
+// Hook函数在转换完成后调用，其中可以继续转换
+func (m *Machine) Transition(conn iface.Connection, to State) error {
+	next, ok := m.states[to]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownState, to)
+	}
+	cs := m.connState(conn)
+	cs.lock.Lock()
+	from := cs.state
+	if _, ok := m.states[from].next[to]; !ok {
+		cs.lock.Unlock()
+		return fmt.Errorf("%w: %s -> %s", ErrTransition, from, to)
+	}
+	cs.state = to
+	cs.lock.Unlock()
+	m.notify(conn, from, to, next)
+	return nil
+}
+
+// Force 不检查转换方向，将连接设置为to阶段，用于断线重连恢复会话等场景
+func (m *Machine) Force(conn iface.Connection, to State) error {
+	next, ok := m.states[to]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownState, to)
+	}
+	cs := m.connState(conn)
+	cs.lock.Lock()
+	from := cs.state
+	cs.state = to
+	cs.lock.Unlock()
+	if from != to {
+		m.notify(conn, from, to, next)
+	}
+	return nil
+}
+
+// notify 依次调用OnExit、OnEnter与OnTransition Hook函数
+func (m *Machine) notify(conn iface.Connection, from, to State, next *state) {
+	for _, hookFunc := range m.states[from].onExit {
+		hookFunc(conn, to)
+	}
+	for _, hookFunc := range next.onEnter {
+		hookFunc(conn, from)
+	}
+	for _, hookFunc := range m.onTransition {
+		hookFunc(conn, from, to)
+	}
+}
+
+// Attach 将状态机的中间件挂载到Server
+func (m *Machine) Attach(s iface.Server) {
+	s.Use(m.Middleware())
+}
+
+// Middleware 拒绝不属于连接当前阶段的消息，回复ErrCode后丢弃，不调用后续的处理方法
+func (m *Machine) Middleware() iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			conn := request.GetConnection()
+			if m.Allowed(conn, request.GetMsgID()) {
+				next(request)
+				return
+			}
+			current := m.Current(conn)
+			if m.onReject != nil {
+				m.onReject(request, current)
+			}
+			request.Logger().Info("fsm ", m.name, " reject msgID = ", request.GetMsgID(), " state = ", current)
+			_ = request.ReplyError(ErrCode, fmt.Sprintf("msg %d not allowed in state %s", request.GetMsgID(), current))
+		}
+	}
+}
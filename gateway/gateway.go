@@ -0,0 +1,165 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+// ErrCode 后端不可用或转发超时时ReplyError回复的错误码
+const ErrCode int32 = 1200
+
+var ErrBackendClosed = errors.New("gateway: backend closed")
+
+// ForwardRequest 转发到后端的客户端消息与连接元数据，字段与forward.proto一致
+type ForwardRequest struct {
+	ConnID     int64             // 网关连接ID，后端可通过bridge推送服务向该连接推送消息
+	UID        string            // 已鉴权的用户ID
+	Namespace  string            // 连接所属的命名空间
+	RemoteAddr string            // 客户端真实地址
+	MsgID      uint32            // 客户端消息的MsgID
+	ReqID      uint64            // 客户端请求ID
+	Data       []byte            // 客户端消息内容，原样转发
+	Metadata   map[string]string // Options.Metadata返回的连接元数据
+}
+
+// ForwardReply 后端的回复，Code不为0时以ErrorMsgID回复错误，否则MsgID不为0时以请求ID回复客户端
+type ForwardReply struct {
+	MsgID   uint32
+	Data    []byte
+	Code    int32
+	Message string
+}
+
+// Backend 后端服务，需支持并发调用
+type Backend interface {
+	Forward(ctx context.Context, req *ForwardRequest) (*ForwardReply, error) // 转发一条客户端消息并等待回复，不需要回复时返回nil
+	Close() error                                                            // 关闭到后端的连接
+}
+
+// Options 网关转发的参数
+type Options struct {
+	Timeout  time.Duration                                 // 等待后端回复的时间，默认5s
+	Ordered  bool                                          // 在处理方法中等待后端回复，同一连接的消息按到达顺序转发，需配合OrderedDispatch
+	Metadata func(conn iface.Connection) map[string]string // 附加到转发请求的连接元数据，如登录时保存的角色与区服
+}
+
+// Gateway 转发网关，MsgID区间内的消息连同连接元数据转发到后端服务，后端的回复按请求ID回复给客户端；
+// 后端主动推送消息可通过bridge推送服务，以ForwardRequest.ConnID或UID定位连接
+type Gateway struct {
+	server   iface.Server
+	opts     Options
+	backends []Backend
+	lock     sync.Mutex
+}
+
+// New 创建转发网关
+func New(s iface.Server, opts Options) *Gateway {
+	if opts.Timeout <= 0 {
+		opts.Timeout = 5 * time.Second
+	}
+	return &Gateway{server: s, opts: opts}
+}
+
+// Route 将MsgID区间[start, end]的消息转发到backend，Server上单独注册的MsgID与路由分组优先，需在服务启动前调用
+func (g *Gateway) Route(start, end uint32, backend Backend) {
+	g.addBackend(backend)
+	g.server.AddRouterRange(start, end, &forwardRouter{g: g, backend: backend})
+}
+
+// Default 将没有任何路由匹配的消息转发到backend
+func (g *Gateway) Default(backend Backend) {
+	g.addBackend(backend)
+	g.server.SetDefaultRouter(&forwardRouter{g: g, backend: backend})
+}
+
+// Close 关闭全部后端
+func (g *Gateway) Close() error {
+	g.lock.Lock()
+	backends := g.backends
+	g.backends = nil
+	g.lock.Unlock()
+	var err error
+	for _, b := range backends {
+		if e := b.Close(); e != nil && err == nil {
+			err = e
+		}
+	}
+	return err
+}
+
+func (g *Gateway) addBackend(backend Backend) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	for _, b := range g.backends {
+		if b == backend {
+			return
+		}
+	}
+	g.backends = append(g.backends, backend)
+}
+
+// forwardRouter 将消息转发到后端的路由
+type forwardRouter struct {
+	netw.BaseRouter
+	g       *Gateway
+	backend Backend
+}
+
+// Handle 转发消息，未开启Ordered时在连接的goroutine中等待回复，不占用worker
+func (r *forwardRouter) Handle(request iface.Request) {
+	req := r.g.newRequest(request)
+	if r.g.opts.Ordered {
+		r.g.forward(request.Context(), request, r.backend, req)
+		return
+	}
+	reply := request.Copy()
+	request.GetConnection().Go(func(ctx context.Context) {
+		r.g.forward(ctx, reply, r.backend, req)
+	})
+}
+
+// newRequest 复制客户端消息与连接元数据，处理方法返回后请求的缓冲会被回收
+func (g *Gateway) newRequest(request iface.Request) *ForwardRequest {
+	conn := request.GetConnection()
+	req := &ForwardRequest{
+		ConnID:    conn.GetConnID(),
+		UID:       conn.GetUID(),
+		Namespace: conn.GetNamespace(),
+		MsgID:     request.GetMsgID(),
+		ReqID:     request.GetReqID(),
+		Data:      append([]byte(nil), request.GetData()...),
+	}
+	if addr := conn.RemoteAddr(); addr != nil {
+		req.RemoteAddr = addr.String()
+	}
+	if g.opts.Metadata != nil {
+		req.Metadata = g.opts.Metadata(conn)
+	}
+	return req
+}
+
+// forward 转发并回复客户端，后端出错时回复ErrCode
+func (g *Gateway) forward(ctx context.Context, request iface.Request, backend Backend, req *ForwardRequest) {
+	ctx, cancel := context.WithTimeout(ctx, g.opts.Timeout)
+	defer cancel()
+	reply, err := backend.Forward(ctx, req)
+	if err != nil {
+		zap.S().Warn("gateway forward msgID = ", req.MsgID, " ConnID = ", req.ConnID, " error ", err)
+		_ = request.ReplyError(ErrCode, "backend unavailable")
+		return
+	}
+	switch {
+	case reply == nil:
+	case reply.Code != 0:
+		_ = request.ReplyError(reply.Code, reply.Message)
+	case reply.MsgID != 0:
+		_ = request.Reply(reply.MsgID, reply.Data)
+	}
+}
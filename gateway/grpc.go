@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/grpc"
+)
+
+// ForwardMethod 后端gRPC服务的方法，后端以forward.proto生成服务端代码
+const ForwardMethod = "/gateway.Backend/Forward"
+
+// GRPCBackend 以gRPC调用后端的Backend.Forward
+type GRPCBackend struct {
+	cc *grpc.ClientConn
+}
+
+// NewGRPCBackend 创建gRPC后端，Close时关闭cc
+func NewGRPCBackend(cc *grpc.ClientConn) *GRPCBackend {
+	return &GRPCBackend{cc: cc}
+}
+
+// Forward 调用后端的Backend.Forward
+func (b *GRPCBackend) Forward(ctx context.Context, req *ForwardRequest) (*ForwardReply, error) {
+	reply := &ForwardReply{}
+	if err := b.cc.Invoke(ctx, ForwardMethod, req, reply, grpc.ForceCodec(wireCodec{})); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Close 关闭gRPC连接
+func (b *GRPCBackend) Close() error {
+	return b.cc.Close()
+}
+
+// wireCodec 按forward.proto编解码转发请求与回复，与后端生成的protobuf代码兼容
+type wireCodec struct{}
+
+func (wireCodec) Marshal(v interface{}) ([]byte, error) {
+	switch m := v.(type) {
+	case *ForwardRequest:
+		return marshalRequest(m, 0), nil
+	case *ForwardReply:
+		return marshalReply(m, 0), nil
+	}
+	return nil, fmt.Errorf("gateway: unsupported message %T", v)
+}
+
+func (wireCodec) Unmarshal(data []byte, v interface{}) error {
+	switch m := v.(type) {
+	case *ForwardRequest:
+		req, _, err := unmarshalRequest(data)
+		if err == nil {
+			*m = *req
+		}
+		return err
+	case *ForwardReply:
+		reply, _, err := unmarshalReply(data)
+		if err == nil {
+			*m = *reply
+		}
+		return err
+	}
+	return fmt.Errorf("gateway: unsupported message %T", v)
+}
+
+func (wireCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,223 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// MaxFrameSize TCP后端单个帧的最大字节数
+var MaxFrameSize = 16 << 20
+
+var ErrFrameTooLarge = errors.New("gateway: frame too large")
+
+// TCPBackend 以长连接多路复用转发到后端，帧格式为 | 长度 4B 小端序 | forward.proto编码的消息 |，
+// 每个请求带网关分配的forward_id，后端回复时原样带回，回复可以乱序；连接断开后下一次转发时重新连接
+type TCPBackend struct {
+	addr        string
+	dialTimeout time.Duration
+	lock        sync.Mutex
+	conn        net.Conn
+	pending     map[uint64]chan *ForwardReply
+	nextID      uint64
+	closed      bool
+	wlock       sync.Mutex // 保护连接写
+}
+
+// NewTCPBackend 创建TCP后端，首次转发时建立连接
+func NewTCPBackend(addr string) *TCPBackend {
+	return &TCPBackend{
+		addr:        addr,
+		dialTimeout: 5 * time.Second,
+		pending:     make(map[uint64]chan *ForwardReply),
+	}
+}
+
+// Forward 写出请求并等待相同forward_id的回复
+func (b *TCPBackend) Forward(ctx context.Context, req *ForwardRequest) (*ForwardReply, error) {
+	conn, id, ch, err := b.register(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.wlock.Lock()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetWriteDeadline(deadline)
+	}
+	err = writeFrame(conn, marshalRequest(req, id))
+	_ = conn.SetWriteDeadline(time.Time{})
+	b.wlock.Unlock()
+	if err != nil {
+		b.unregister(id)
+		b.reset(conn, err)
+		return nil, err
+	}
+	select {
+	case reply, ok := <-ch:
+		if !ok {
+			return nil, ErrBackendClosed
+		}
+		return reply, nil
+	case <-ctx.Done():
+		b.unregister(id)
+		return nil, ctx.Err()
+	}
+}
+
+// Close 关闭连接，等待中的转发返回ErrBackendClosed
+func (b *TCPBackend) Close() error {
+	b.lock.Lock()
+	b.closed = true
+	conn := b.conn
+	b.lock.Unlock()
+	if conn != nil {
+		b.reset(conn, ErrBackendClosed)
+	}
+	return nil
+}
+
+// register 分配forward_id，未连接时建立连接
+func (b *TCPBackend) register(ctx context.Context) (net.Conn, uint64, chan *ForwardReply, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.closed {
+		return nil, 0, nil, ErrBackendClosed
+	}
+	if b.conn == nil {
+		dialer := net.Dialer{Timeout: b.dialTimeout}
+		conn, err := dialer.DialContext(ctx, "tcp", b.addr)
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		b.conn = conn
+		go b.readLoop(conn)
+	}
+	b.nextID++
+	ch := make(chan *ForwardReply, 1)
+	b.pending[b.nextID] = ch
+	return b.conn, b.nextID, ch, nil
+}
+
+func (b *TCPBackend) unregister(id uint64) {
+	b.lock.Lock()
+	delete(b.pending, id)
+	b.lock.Unlock()
+}
+
+// readLoop 读取回复并交给等待相同forward_id的转发，连接出错时关闭连接
+func (b *TCPBackend) readLoop(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			b.reset(conn, err)
+			return
+		}
+		reply, id, err := unmarshalReply(frame)
+		if err != nil {
+			b.reset(conn, err)
+			return
+		}
+		b.lock.Lock()
+		ch, ok := b.pending[id]
+		delete(b.pending, id)
+		b.lock.Unlock()
+		if ok {
+			ch <- reply
+		}
+	}
+}
+
+// reset 关闭出错的连接，该连接上等待中的转发返回ErrBackendClosed
+func (b *TCPBackend) reset(conn net.Conn, reason error) {
+	b.lock.Lock()
+	if b.conn != conn {
+		b.lock.Unlock()
+		return
+	}
+	b.conn = nil
+	pending := b.pending
+	b.pending = make(map[uint64]chan *ForwardReply)
+	b.lock.Unlock()
+	_ = conn.Close()
+	if reason != io.EOF && reason != ErrBackendClosed {
+		zap.S().Warn("gateway backend ", b.addr, " disconnected ", reason)
+	}
+	for _, ch := range pending {
+		close(ch)
+	}
+}
+
+// ServeTCP 在后端服务中处理网关的TCP转发，每个请求在独立的goroutine中调用backend.Forward，l关闭时返回
+func ServeTCP(l net.Listener, backend Backend) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go serveTCPConn(conn, backend)
+	}
+}
+
+func serveTCPConn(conn net.Conn, backend Backend) {
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var wlock sync.Mutex
+	r := bufio.NewReader(conn)
+	for {
+		frame, err := readFrame(r)
+		if err != nil {
+			return
+		}
+		req, id, err := unmarshalRequest(frame)
+		if err != nil {
+			zap.S().Warn("gateway tcp request error ", err)
+			return
+		}
+		go func() {
+			reply, err := backend.Forward(ctx, req)
+			if err != nil {
+				reply = &ForwardReply{Code: ErrCode, Message: err.Error()}
+			}
+			if reply == nil {
+				reply = &ForwardReply{}
+			}
+			wlock.Lock()
+			defer wlock.Unlock()
+			if err := writeFrame(conn, marshalReply(reply, id)); err != nil {
+				_ = conn.Close()
+			}
+		}()
+	}
+}
+
+func readFrame(r io.Reader) ([]byte, error) {
+	var head [4]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(head[:])
+	if int64(n) > int64(MaxFrameSize) {
+		return nil, ErrFrameTooLarge
+	}
+	frame := make([]byte, n)
+	if _, err := io.ReadFull(r, frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+func writeFrame(w io.Writer, frame []byte) error {
+	buf := make([]byte, 4+len(frame))
+	binary.LittleEndian.PutUint32(buf, uint32(len(frame)))
+	copy(buf[4:], frame)
+	_, err := w.Write(buf)
+	return err
+}
@@ -0,0 +1,170 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var errBadWire = errors.New("gateway: malformed message")
+
+// marshalRequest 按forward.proto编码转发请求
+func marshalRequest(req *ForwardRequest, forwardID uint64) []byte {
+	var b []byte
+	if req.ConnID != 0 {
+		b = protowire.AppendTag(b, 1, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(req.ConnID))
+	}
+	b = appendString(b, 2, req.UID)
+	b = appendString(b, 3, req.Namespace)
+	b = appendString(b, 4, req.RemoteAddr)
+	b = appendVarint(b, 5, uint64(req.MsgID))
+	b = appendVarint(b, 6, req.ReqID)
+	b = appendBytes(b, 7, req.Data)
+	for key, value := range req.Metadata {
+		var entry []byte
+		entry = appendString(entry, 1, key)
+		entry = appendString(entry, 2, value)
+		b = protowire.AppendTag(b, 8, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+	return appendVarint(b, 9, forwardID)
+}
+
+// unmarshalRequest 解码转发请求
+func unmarshalRequest(b []byte) (*ForwardRequest, uint64, error) {
+	req := &ForwardRequest{}
+	var forwardID uint64
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			req.ConnID = int64(v)
+		case 2:
+			req.UID = string(data)
+		case 3:
+			req.Namespace = string(data)
+		case 4:
+			req.RemoteAddr = string(data)
+		case 5:
+			req.MsgID = uint32(v)
+		case 6:
+			req.ReqID = v
+		case 7:
+			req.Data = append([]byte(nil), data...)
+		case 8:
+			var key, value string
+			if err := walk(data, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+				switch num {
+				case 1:
+					key = string(data)
+				case 2:
+					value = string(data)
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+			if req.Metadata == nil {
+				req.Metadata = make(map[string]string)
+			}
+			req.Metadata[key] = value
+		case 9:
+			forwardID = v
+		}
+		return nil
+	})
+	return req, forwardID, err
+}
+
+// marshalReply 按forward.proto编码后端回复
+func marshalReply(reply *ForwardReply, forwardID uint64) []byte {
+	var b []byte
+	b = appendVarint(b, 1, uint64(reply.MsgID))
+	b = appendBytes(b, 2, reply.Data)
+	if reply.Code != 0 {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(int64(reply.Code)))
+	}
+	b = appendString(b, 4, reply.Message)
+	return appendVarint(b, 5, forwardID)
+}
+
+// unmarshalReply 解码后端回复
+func unmarshalReply(b []byte) (*ForwardReply, uint64, error) {
+	reply := &ForwardReply{}
+	var forwardID uint64
+	err := walk(b, func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			reply.MsgID = uint32(v)
+		case 2:
+			reply.Data = append([]byte(nil), data...)
+		case 3:
+			reply.Code = int32(v)
+		case 4:
+			reply.Message = string(data)
+		case 5:
+			forwardID = v
+		}
+		return nil
+	})
+	return reply, forwardID, err
+}
+
+func appendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+func appendString(b []byte, num protowire.Number, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+func appendBytes(b []byte, num protowire.Number, data []byte) []byte {
+	if len(data) == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, data)
+}
+
+// walk 遍历消息的字段，varint字段以v传入，长度前缀字段以data传入，其它类型的字段跳过
+func walk(b []byte, field func(num protowire.Number, typ protowire.Type, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return fmt.Errorf("%w: %v", errBadWire, protowire.ParseError(n))
+		}
+		b = b[n:]
+		var (
+			v    uint64
+			data []byte
+		)
+		switch typ {
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.BytesType:
+			data, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+		}
+		if n < 0 {
+			return fmt.Errorf("%w: %v", errBadWire, protowire.ParseError(n))
+		}
+		b = b[n:]
+		if typ == protowire.VarintType || typ == protowire.BytesType {
+			if err := field(num, typ, v, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
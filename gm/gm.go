@@ -0,0 +1,174 @@
+package gm
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+// ErrCode GM指令执行失败时ReplyError回复的错误码
+const ErrCode int32 = 1100
+
+// LevelProperty 连接属性中保存GM权限等级的Key，值为Level
+var LevelProperty = "gm.level"
+
+var (
+	ErrNotGM            = errors.New("gm: not a gm connection")
+	ErrUnknownCommand   = errors.New("gm: unknown command")
+	ErrPermissionDenied = errors.New("gm: permission denied")
+	ErrEmptyCommand     = errors.New("gm: empty command")
+)
+
+// Level GM权限等级，数值越大权限越高，0为普通玩家
+type Level int
+
+// SetLevel 标记连接的GM权限等级，一般在鉴权Hook函数中根据账号权限调用
+func SetLevel(conn iface.Connection, level Level) {
+	conn.SetProperty(LevelProperty, level)
+}
+
+// LevelOf 获取连接的GM权限等级，未标记时为0
+func LevelOf(conn iface.Connection) Level {
+	v, err := conn.GetProperty(LevelProperty)
+	if err != nil {
+		return 0
+	}
+	level, _ := v.(Level)
+	return level
+}
+
+// Command 一条GM指令
+type Command struct {
+	Conn iface.Connection
+	Name string
+	Args []string
+	Raw  string
+}
+
+// Handler GM指令处理方法，返回的文本回复给GM客户端
+type Handler func(cmd *Command) (string, error)
+
+// AuditEntry 审计记录
+type AuditEntry struct {
+	Time   time.Time
+	ConnID int64
+	UID    string
+	Level  Level
+	Raw    string
+	Err    error // 被拒绝或执行失败的原因，成功时为nil
+}
+
+// Auditor 审计记录输出，可替换为写入数据库等
+type Auditor func(entry AuditEntry)
+
+// LogAuditor 以zap日志输出审计记录
+func LogAuditor(entry AuditEntry) {
+	zap.S().Infow("gm audit", "connID", entry.ConnID, "uid", entry.UID, "level", entry.Level, "command", entry.Raw, "err", entry.Err)
+}
+
+type command struct {
+	level Level
+	usage string
+	fn    Handler
+}
+
+// Console GM指令控制台，GM连接以CommandMsgID发送文本指令，如 "kick 10086 cheating"，
+// 执行结果以ResponseMsgID(CommandMsgID)回复，失败时以ReplyError回复
+type Console struct {
+	commands map[string]*command
+	auditor  Auditor
+	lock     sync.RWMutex
+}
+
+// NewConsole 创建GM控制台并注册指令路由，auditor为nil时使用LogAuditor
+func NewConsole(s iface.Server, commandMsgID uint32, auditor Auditor) *Console {
+	if auditor == nil {
+		auditor = LogAuditor
+	}
+	c := &Console{
+		commands: make(map[string]*command),
+		auditor:  auditor,
+	}
+	c.Register("help", 1, "help 列出可用的指令", c.help)
+	s.AddRouter(commandMsgID, &consoleRouter{console: c})
+	return c
+}
+
+// Register 注册指令，level为执行该指令所需的最低GM权限等级
+func (c *Console) Register(name string, level Level, usage string, fn Handler) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.commands[strings.ToLower(name)] = &command{level: level, usage: usage, fn: fn}
+}
+
+// Exec 以conn的权限执行一条文本指令并记录审计
+func (c *Console) Exec(conn iface.Connection, raw string) (string, error) {
+	level := LevelOf(conn)
+	out, err := c.exec(conn, level, raw)
+	c.auditor(AuditEntry{
+		Time:   time.Now(),
+		ConnID: conn.GetConnID(),
+		UID:    conn.GetUID(),
+		Level:  level,
+		Raw:    raw,
+		Err:    err,
+	})
+	return out, err
+}
+
+func (c *Console) exec(conn iface.Connection, level Level, raw string) (string, error) {
+	if level <= 0 {
+		return "", ErrNotGM
+	}
+	fields := strings.Fields(strings.TrimPrefix(strings.TrimSpace(raw), "/"))
+	if len(fields) == 0 {
+		return "", ErrEmptyCommand
+	}
+	c.lock.RLock()
+	cmd, ok := c.commands[strings.ToLower(fields[0])]
+	c.lock.RUnlock()
+	if !ok {
+		return "", ErrUnknownCommand
+	}
+	if level < cmd.level {
+		return "", ErrPermissionDenied
+	}
+	return cmd.fn(&Command{Conn: conn, Name: fields[0], Args: fields[1:], Raw: raw})
+}
+
+// help 列出当前GM权限等级可用的指令
+func (c *Console) help(cmd *Command) (string, error) {
+	level := LevelOf(cmd.Conn)
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	lines := make([]string, 0, len(c.commands))
+	for _, command := range c.commands {
+		if level >= command.level {
+			lines = append(lines, command.usage)
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+// consoleRouter GM指令路由
+type consoleRouter struct {
+	netw.BaseRouter
+	console *Console
+}
+
+func (r *consoleRouter) Handle(request iface.Request) {
+	out, err := r.console.Exec(request.GetConnection(), string(request.GetData()))
+	if err != nil {
+		_ = request.ReplyError(ErrCode, err.Error())
+		return
+	}
+	_ = request.Reply(netw.ResponseMsgID(request.GetMsgID()), []byte(out))
+}
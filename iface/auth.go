@@ -0,0 +1,13 @@
+package iface
+
+import "net/http"
+
+/*
+	鉴权抽象层，连接通过鉴权前只允许路由白名单内的MsgID
+*/
+type Authenticator interface {
+	// 握手阶段鉴权(如校验URL参数或Cookie中的token)，返回空uid表示等待消息鉴权，返回错误则拒绝连接
+	AuthHandshake(r *http.Request) (uid string, err error)
+	// 未鉴权连接收到AuthMsgIDs中的消息时鉴权(如校验登录消息中的token)，返回错误则关闭连接
+	AuthMessage(request Request) (uid string, err error)
+}
@@ -0,0 +1,12 @@
+package iface
+
+import "time"
+
+/*
+	封禁名单抽象层，可替换为Redis等外部存储实现
+*/
+type BanList interface {
+	Ban(key string, ttl time.Duration) // 封禁，ttl<=0为永久封禁
+	Unban(key string)                  // 解除封禁
+	IsBanned(key string) bool          // 是否处于封禁中
+}
@@ -0,0 +1,10 @@
+package iface
+
+/*
+	节点间消息总线抽象层，用于集群路由与跨服广播，可选Redis、NATS等实现
+*/
+type MessageBus interface {
+	Publish(subject string, data []byte) error                 // 向主题发布消息
+	Subscribe(subject string, handler func(data []byte)) error // 订阅主题，handler在总线的接收goroutine中调用
+	Close() error                                              // 取消全部订阅
+}
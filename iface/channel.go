@@ -0,0 +1,7 @@
+package iface
+
+// ChannelConfig 连接内逻辑通道的配置，同一通道内的消息按顺序处理与发送，不同通道之间互不阻塞
+type ChannelConfig struct {
+	Backlog  int            // 入站与出站各自的排队上限，默认MaxMsgChanLen
+	Overflow OverflowPolicy // 排队已满时的处理方式
+}
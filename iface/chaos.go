@@ -0,0 +1,49 @@
+package iface
+
+import "fmt"
+
+// ChaosRule 单个方向的网络故障注入规则
+type ChaosRule struct {
+	Delay   int     `json:"delay"`   // 每条消息的固定延迟(毫秒)
+	Jitter  int     `json:"jitter"`  // 在Delay之上的随机延迟上限(毫秒)
+	Drop    float64 `json:"drop"`    // 丢弃消息的概率，0~1
+	Reorder float64 `json:"reorder"` // 消息与下一条消息交换顺序的概率，0~1
+}
+
+// Enabled 是否注入故障
+func (r ChaosRule) Enabled() bool {
+	return r.Delay > 0 || r.Jitter > 0 || r.Drop > 0 || r.Reorder > 0
+}
+
+// Validate 校验参数，延迟不能为负，概率须在[0, 1]内
+func (r ChaosRule) Validate() error {
+	if r.Delay < 0 || r.Jitter < 0 {
+		return fmt.Errorf("delay and jitter must be >= 0, got %d, %d", r.Delay, r.Jitter)
+	}
+	if r.Drop < 0 || r.Drop > 1 || r.Reorder < 0 || r.Reorder > 1 {
+		return fmt.Errorf("drop and reorder must be in [0, 1], got %v, %v", r.Drop, r.Reorder)
+	}
+	return nil
+}
+
+// Chaos 连接的网络故障注入，用于在不借助外部工具的情况下测试弱网下的游戏逻辑
+type Chaos struct {
+	Read  ChaosRule `json:"read"`  // 客户端上行的消息，在拆包之前注入
+	Write ChaosRule `json:"write"` // 下发给客户端的消息，在写出之前注入
+}
+
+// Enabled 是否注入故障
+func (c Chaos) Enabled() bool {
+	return c.Read.Enabled() || c.Write.Enabled()
+}
+
+// Validate 校验两个方向的参数
+func (c Chaos) Validate() error {
+	if err := c.Read.Validate(); err != nil {
+		return fmt.Errorf("read %v", err)
+	}
+	if err := c.Write.Validate(); err != nil {
+		return fmt.Errorf("write %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package iface
+
+/*
+	消息内容加密抽象层，位于编解码器之下、封包之上
+*/
+type Cipher interface {
+	Encrypt(plain []byte) ([]byte, error)  // 加密
+	Decrypt(cipher []byte) ([]byte, error) // 解密
+}
+
+// AEADCipher 支持附加认证数据的加密器，连接以消息的msgID与序号作为附加数据，
+// 包头中的msgID或序号被篡改时解密失败
+type AEADCipher interface {
+	Cipher
+	Seal(plain, aad []byte) ([]byte, error)  // 加密并认证附加数据
+	Open(cipher, aad []byte) ([]byte, error) // 解密并校验附加数据
+}
+
+// KeyExchange 密钥交换，data为客户端发来的密钥交换消息，
+// 返回该连接使用的加密器与回复给客户端的消息(回复以明文发送)
+type KeyExchange func(conn Connection, data []byte) (cipher Cipher, reply []byte, err error)
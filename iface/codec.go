@@ -0,0 +1,12 @@
+package iface
+
+/*
+	编解码器抽象层，负责消息内容(data)的序列化格式
+	Unmarshal的data来自缓冲池，消息处理完成后会被复用，返回后不能再持有data或其子切片；
+	Marshal返回的[]byte归调用方所有
+*/
+type Codec interface {
+	Name() string                               // 编解码器名称
+	Marshal(v interface{}) ([]byte, error)      // 序列化
+	Unmarshal(data []byte, v interface{}) error // 反序列化
+}
@@ -1,8 +1,205 @@
 package iface
 
 type Config struct {
-	PingTime         int    // 心跳检测时间
-	MaxConn          int    // 当前服务器主机允许的最大链接个数
-	WorkerPoolSize   uint32 // 业务工作Worker池的数量
-	MessageType      int    // 消息类型
+	PingTime       int    // 心跳检测时间
+	MaxConn        int    // 当前服务器主机允许的最大链接个数，0为不限制
+	ConnShards     int    // 连接管理的分片数量，默认32
+	WorkerPoolSize uint32 // 业务工作Worker池的数量，开启弹性伸缩时为最小数量
+	MessageType    int    // 消息类型
+	LogLevel       string // 日志级别(debug/info/warn/error)，作用于netw.LogLevel
+
+	SnowflakeNodeID int64 // 大于0时ConnID使用雪花算法生成，集群内各节点需不同(1~1023)
+
+	HeartbeatMode HeartbeatMode // 心跳方式，默认由业务消息调用SetPing
+	PingInterval  int           // 控制帧心跳时服务端发送Ping帧的间隔(秒)，默认PingTime/2
+	// 业务心跳时测量往返延迟的MsgID：服务端每隔PingInterval下发8字节时间戳，客户端原样回复，0为不测量；
+	// 控制帧心跳时以Ping帧的内容测量，不需要设置
+	RTTMsgID uint32
+
+	EnableCompression bool // 开启permessage-deflate出站压缩
+	CompressionLevel  int  // permessage-deflate压缩级别(-2~9)，0为默认级别
+	CompressThreshold int  // 自定义封包时消息内容超过该字节数进行gzip压缩，0为不压缩
+
+	MaxMsgChanLen   int            // SendBuffMsg发送消息的缓冲最大长度
+	SendBuffTimeout int            // SendBuffMsg缓冲已满时的等待时间(毫秒)
+	OverflowPolicy  OverflowPolicy // SendBuffMsg等待超时后的溢出策略
+
+	// 逻辑通道：Channels中的通道在连接内独立排队，入站消息在通道自己的goroutine中按顺序处理，
+	// 出站消息与其它通道轮流写出，一个通道的积压不会延迟其它通道；通道ID由包头携带，
+	// 包头未携带时按MsgChannel的MsgID映射，未配置的通道与0号通道按原有方式处理
+	Channels   map[uint8]ChannelConfig
+	MsgChannel map[uint32]uint8
+
+	// 写合并：SendBuffMsg的多条消息合并为一个msgID为BatchMsgID的websocket帧，
+	// 消息内容为若干个 | 包长度 4B | 数据包 |，BatchMsgID为0时不合并
+	WriteBatchSize  int    // 单帧最多合并的消息条数，小于等于1时不合并
+	WriteBatchDelay int    // 等待凑满一批的最长时间(毫秒)，0为只合并已排队的消息
+	BatchMsgID      uint32 // 合并帧的MsgID
+
+	WriteDeadline      int // 单次写消息超时时间(毫秒)，超时后关闭连接，0为不限制
+	SlowWriteThreshold int // 单次写消息超过该时间(毫秒)视为慢写
+	MaxSlowWrites      int // 连续慢写达到该次数时关闭连接，0为不限制
+
+	MaxWorkerPoolSize    uint32 // 弹性工作池最大worker数量，大于WorkerPoolSize时开启弹性伸缩
+	MaxWorkerTaskLen     uint32 // 每个worker对应任务队列的最大长度，默认1
+	WorkerScaleThreshold int    // 任一worker的队列长度达到该值时扩容，默认为MaxWorkerTaskLen
+	WorkerScaleInterval  int    // 弹性伸缩检测间隔(毫秒)，默认1000
+	WorkerIdleTimeout    int    // worker空闲超过该时间(秒)时缩容，默认60
+
+	HandlerTimeout int // 单条消息处理超时时间(毫秒)，超时后取消Request.Context并记录慢处理日志，0为不限制
+
+	// 处理失败重试：处理方法返回netw.Retryable包装的错误时，间隔RetryBackoff(毫秒，默认100)起每次翻倍、
+	// 不超过RetryMaxBackoff(毫秒，默认5000)重新处理，最多RetryMax(默认3，小于0时不重试)次后写入死信队列；
+	// 重试期间同一连接之后的消息暂存并按顺序处理，暂存超过RetryBacklog(默认64)条时丢弃
+	RetryMax        int
+	RetryBackoff    int
+	RetryMaxBackoff int
+	RetryBacklog    int
+
+	GoWaitTimeout int  // 连接Stop时等待c.Go启动的goroutine退出的最长时间(毫秒)，默认1000，小于0时不等待
+	GoLeakDetect  bool // 调试模式，记录c.Go的启动位置，等待超时时输出仍未退出的goroutine
+
+	CloseTimeout int // Close发送关闭帧后等待客户端回复关闭帧的时间(毫秒)，默认1000
+
+	MsgPriority map[uint32]Priority // MsgID对应的消息优先级，未配置时使用Router声明的优先级
+
+	// 背压：连接对应worker任务队列或发送缓冲的占用比例达到BackpressureHigh时暂停读取，
+	// 降到BackpressureLow(默认BackpressureHigh/2)以下时恢复，BackpressureHigh为0时不开启
+	BackpressureHigh float64
+	BackpressureLow  float64
+	FlowControlMsgID uint32 // 暂停与恢复读取时通知客户端的MsgID，消息内容1B，1为暂停0为恢复，0为不通知
+
+	// 保证同一连接的消息按到达顺序处理：同一ConnID固定由同一worker处理，
+	// 开启后弹性伸缩与优先级失效；未开启工作池时在读goroutine中同步处理
+	OrderedDispatch bool
+
+	// 公平调度：同一worker的普通优先级任务按连接差额轮询(DRR)取出，每轮每个连接最多处理FairQuantum(默认1)条，
+	// 单个连接排队的任务达到MaxWorkerTaskLen时只阻塞该连接的读取，刷屏的连接不会占满共用worker的队列
+	FairDispatch bool
+	FairQuantum  int
+
+	// 入站配额：按连接累计收到的字节数与消息数，每经过QuotaHalfLife(秒，默认60)衰减一半，
+	// 用于发现长期保持在限流之下持续发送的抓取与模糊测试客户端；MsgQuota为连接内各MsgID的配额
+	InboundQuota  Quota
+	MsgQuota      map[uint32]Quota
+	QuotaHalfLife int
+
+	// 网络故障注入：按ChaosRatio(0~1，为0时全部)的比例对新连接注入Chaos，只用于测试环境；
+	// 运行中的连接可以通过SetChaos或管理后台单独开启
+	Chaos      Chaos
+	ChaosRatio float64
+
+	// 消息丢失告警：按原因统计DropAlertWindow(秒，默认10)内每秒丢失的消息数，
+	// 超过阈值时调用OnDropAlert Hook函数，DropAlertRate为全部连接合计的阈值，ConnDropAlertRate为单个连接的阈值，0为不告警
+	DropAlertWindow   int
+	DropAlertRate     float64
+	ConnDropAlertRate float64
+
+	GlobalRateLimit Rate            // 全局消息限流
+	ConnRateLimit   Rate            // 单个连接的消息限流
+	MsgRateLimit    map[uint32]Rate // 单个连接内各MsgID的消息限流
+	RateLimitAction RateLimitAction // 触发限流后的处理方式
+
+	// 命名空间：握手时未声明命名空间的连接归入DefaultNamespace，为空时需声明；
+	// NamespaceRateLimit为各命名空间全部连接共享的消息限流，NamespaceMaxConn为各命名空间的最大连接数
+	DefaultNamespace   string
+	NamespaceRateLimit map[string]Rate
+	NamespaceMaxConn   map[string]int
+
+	SchemaAction SchemaAction // RegisterSchema注册的消息内容校验失败后的处理方式
+
+	// 重放保护：开启InboundSeqCheck时客户端消息需带严格递增的序号(SeqFlag)，重复、回退或缺少序号的消息被丢弃
+	InboundSeqCheck bool
+	// 幂等：IdempotentMsgIDs中的请求按netw.IdempotencyKey去重，窗口期(秒，默认60)内重复时回复ErrCodeDuplicate
+	IdempotentMsgIDs  []uint32
+	IdempotencyWindow int
+	// 输入合并：CoalesceMsgIDs中的消息(如移动同步)每个连接只保留最新一条排队，尚未开始处理的旧消息被替换后丢弃，
+	// 被丢弃的请求不会回复，只适用于不需要响应的消息
+	CoalesceMsgIDs []uint32
+
+	// 出站带宽限制，Rate为每秒字节数，Burst为允许突发的字节数(默认等于Rate)；
+	// SendBuffMsg的消息等待令牌，SendMsg的消息不等待但计入用量，避免心跳等控制消息被广播饿死
+	GlobalBandwidth Rate // 单个Server全部连接共享的出站带宽
+	ConnBandwidth   Rate // 单个连接的出站带宽
+
+	// 过载保护，触发时以503拒绝新连接的升级请求，响应头Retry-After与JSON内容 {reason, retry_after} 中带有建议的重试时间
+	AcceptRate     Rate    // 每秒接受的新连接数量，Burst默认等于Rate
+	ShedQueueDepth int     // worker任务队列中等待处理的消息总数达到该值时拒绝新连接，0为不限制
+	ShedCPU        float64 // 进程CPU使用率(按核数归一化，0~1)达到该值时拒绝新连接，0为不限制
+	RetryAfter     int     // 建议客户端重试的等待时间(秒)，默认5
+
+	AuthWhitelist []uint32 // 设置Authenticator后，未鉴权连接允许路由的MsgID
+	AuthMsgIDs    []uint32 // 未鉴权连接收到其中的消息时调用Authenticator.AuthMessage，鉴权成功后继续路由；其它MsgID被拒绝
+
+	// 可信代理的IP或CIDR，直连地址属于可信代理时从RealIPHeaders解析客户端真实IP
+	TrustedProxies []string
+	RealIPHeaders  []string // 真实IP所在的请求头，默认 X-Forwarded-For 与 X-Real-IP
+
+	ConnRejectMsgID uint32 // OnConnStart Hook返回错误时下发拒绝原因的MsgID，消息内容为错误信息，0为直接断开
+
+	DuplicateLogin      DuplicateLoginPolicy // 同一用户ID重复登录时的处理策略，默认允许多连接
+	DuplicateLoginMsgID uint32               // 被踢出或被拒绝的连接下发原因的MsgID，消息内容为原因文本，0为直接断开
+
+	// 分阶段的连接生命周期超时(秒)，超时后调用对应阶段的OnLifecycleTimeout Hook函数并关闭连接，0为不限制
+	AuthTimeout        int // 建立连接后需在该时间内完成鉴权(Authenticator或SetAuthenticated)
+	IdleTimeout        int // 超过该时间未收到任何消息
+	MaxSessionDuration int // 连接的最长存活时间
+
+	// Request.ReplyError回复错误的MsgID，消息内容为 | 请求MsgID 4B | 错误码 4B | 请求ID 8B | 错误信息 |
+	ErrorMsgID uint32
+
+	SessionGracePeriod int    // 断线后会话保留时间(秒)，大于0时开启会话重连
+	SessionBufferSize  int    // 会话离线期间消息缓冲的最大条数，默认256
+	SessionMsgID       uint32 // 新会话创建后下发会话token的MsgID，0为不下发
+	SessionStoreTTL    int    // 设置SessionStore时在线会话元数据的过期时间(秒)，默认86400
+	MigrateMsgID       uint32 // Server.Migrate下发迁移通知的MsgID，消息内容为JSON {url, token}
+
+	EnableAck  bool   // 开启出站消息序号与客户端ACK确认
+	AckMsgID   uint32 // 客户端ACK消息的MsgID，消息内容为8字节小端序的已收到最大序号
+	MaxUnacked int    // 每个连接保留的未确认消息最大条数，默认1024
+
+	Listeners []Listener // Server.ListenAndServe启动的监听入口
+
+	HealthAddr string // 健康检查监听地址，如 :8081，提供 /healthz 存活检查与 /readyz 就绪检查，为空时不开启
+
+	AdminAddr  string // 管理后台监听地址，如 127.0.0.1:9090，为空时不开启
+	AdminToken string // 管理后台访问token，通过 X-Admin-Token 请求头传递，为空时只监听本机回环地址
+
+	BridgeAddr  string // gRPC推送服务监听地址，如 127.0.0.1:9091，为空时不开启
+	BridgeToken string // gRPC推送服务访问token，通过 x-bridge-token metadata传递，为空时必须配置BridgeCertFile开启TLS
+
+	BridgeCertFile     string // gRPC推送服务的TLS证书，与BridgeKeyFile同时配置时开启TLS
+	BridgeKeyFile      string // gRPC推送服务的TLS私钥
+	BridgeClientCAFile string // 校验客户端证书的CA，配置后开启mTLS
+
+	MaxPacketSize int // 单个数据包(含解压后)允许的最大字节数，超出时断开连接，0为不限制
+
+	// 慢速连接防护：客户端建立连接后不发送或逐字节缓慢发送时，读goroutine不会被无限占用
+	ReadLimit        int // 单个websocket消息允许的最大字节数，超出时断开连接，默认MaxPacketSize
+	ReadTimeout      int // 读取消息的超时时间(秒)，每条消息与控制帧到达时重置，超时未读完一条消息时断开连接，0为不限制
+	HandshakeTimeout int // 读取HTTP请求头与websocket升级握手的超时时间(秒)，默认10，小于0时不限制
+
+	// 支持的客户端协议版本区间，握手时通过ProtocolQueryKey参数声明，超出区间时拒绝连接，MaxProtocolVersion为0时不限制上限
+	MinProtocolVersion uint32
+	MaxProtocolVersion uint32
+
+	KeyExchangeMsgID uint32 // 密钥交换消息的MsgID，需同时设置KeyExchange，0为不加密
+	RequireCipher    bool   // 配置KeyExchangeMsgID时，密钥交换完成前收到其它消息断开连接
 }
+
+// HeartbeatMode 心跳方式
+type HeartbeatMode int
+
+const (
+	HeartbeatMessage  HeartbeatMode = iota // 业务心跳消息，由处理方法调用SetPing
+	HeartbeatPingPong                      // WebSocket Ping/Pong控制帧，浏览器自动回复Pong帧
+)
+
+// OverflowPolicy 发送缓冲溢出策略
+type OverflowPolicy int
+
+const (
+	OverflowDropNewest OverflowPolicy = iota // 丢弃最新的消息
+	OverflowDropOldest                       // 丢弃缓冲中最旧的消息
+	OverflowClose                            // 关闭连接
+)
@@ -3,27 +3,84 @@ package iface
 import (
 	"context"
 	"net"
+	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/timerwheel"
+	"go.uber.org/zap"
 )
 
 /**
 定义连接接口
 */
 type Connection interface {
-	Start()                                  // 启动连接，让当前连接开始工作
-	Stop()                                   // 停止连接，结束当前连接状态M
-	Context() context.Context                // 返回ctx，用于用户自定义的go程获取连接退出状态
-	GetConnection() *websocket.Conn          // 从当前连接获取原始的socket Conn
-	GetConnID() int64                        // 获取当前连接ID
-	RemoteAddr() net.Addr                    // 获取远程客户端地址信息
-	SendMsg(msgID uint32, data []byte) error // 直接将Message数据发送数据给远程的客户端
-	SetPing()                                // 设置心跳
-	GetPing() bool                           // 获取心跳
-	RemovePing()                             //取消心跳
-	IsHeartbeatTimeout()                     // 检测心跳
+	Start()                                      // 启动连接，让当前连接开始工作
+	Stop()                                       // 停止连接，结束当前连接状态M
+	StopWithMsg(msgID uint32, data []byte)       // 发送最后一条消息后停止连接
+	Close(code int, reason string) error         // 发送关闭帧，等待客户端回复关闭帧后停止连接
+	Context() context.Context                    // 返回ctx，用于用户自定义的go程获取连接退出状态
+	Go(fn func(ctx context.Context))             // 启动绑定到连接的goroutine，连接关闭时取消ctx并等待其退出
+	GetConnection() *websocket.Conn              // 从当前连接获取原始的socket Conn
+	GetConnID() int64                            // 获取当前连接ID
+	Codec() Codec                                // 获取当前连接使用的编解码器
+	SetCodec(codec Codec)                        // 设置当前连接使用的编解码器
+	RemoteAddr() net.Addr                        // 获取远程客户端地址信息
+	SendMsg(msgID uint32, data []byte) error     // 直接将Message数据发送数据给远程的客户端
+	SendObj(msgID uint32, v interface{}) error   // 使用编解码器序列化后发送给远程的客户端
+	SendBuffMsg(msgID uint32, data []byte) error // 带缓冲发送消息，缓冲已满时按溢出策略处理
+	GetDropCount() uint64                        // 获取因缓冲溢出被丢弃的消息数量
+	Ack(seq uint64)                              // 确认序号小于等于seq的消息已被客户端收到
+	GetUnacked() []OutboundMsg                   // 获取已发送未被客户端确认的消息
+	SetPing()                                    // 设置心跳
+	GetPing() bool                               // 获取心跳
+	RemovePing()                                 //取消心跳
+	IsHeartbeatTimeout()                         // 检测心跳
+	GetHeartbeatTime() time.Time                 // 获取最后一次收到心跳的时间
+	GetStartTime() time.Time                     // 获取连接建立时间
+	Stats() ConnStats                            // 获取连接收发统计
+	Latency() time.Duration                      // 获取平滑后的往返延迟，未测量时为0
+	AddError()                                   // 错误次数加一，业务层可用于记录协议错误
+
+	SendReqMsg(reqID uint64, msgID uint32, data []byte) error                    // 发送带请求ID的消息
+	SendChannelMsg(channel uint8, reqID uint64, msgID uint32, data []byte) error // 以逻辑通道发送消息
+	Call(ctx context.Context, msgID uint32, req, resp interface{}) error         // 向客户端发送请求并等待响应
+	SendMsgAfter(d time.Duration, msgID uint32, data []byte) timerwheel.TimerID  // 延迟d后发送消息，返回定时器ID
+
+	GetMessageType() int                                        // 获取出站消息的websocket帧类型，默认由客户端首个消息帧决定
+	SetMessageType(messageType int)                             // 设置出站消息的websocket帧类型，覆盖全局MessageType
+	SendFrame(messageType int, msgID uint32, data []byte) error // 以指定的websocket帧类型发送单条消息
+
+	GetServer() Server                 // 获取连接所属的Server
+	GetListenerTag() string            // 获取连接所属监听入口的标签
+	GetNamespace() string              // 获取连接所属的命名空间，未使用命名空间时为空
+	SetProtocolVersion(version uint32) // 设置连接协商后的协议版本
+	GetProtocolVersion() uint32        // 获取连接协商后的协议版本
+	SetAuthenticated(uid string) error // 设置连接已通过鉴权并绑定用户ID，按DuplicateLogin策略拒绝时返回错误
+	IsAuthenticated() bool             // 连接是否已通过鉴权
+	GetUID() string                    // 获取连接绑定的用户ID
+	Logger() *zap.SugaredLogger        // 获取携带连接信息的日志
+	SetCipher(cipher Cipher)           // 设置连接的加密器，为nil时不加密
+	GetCipher() Cipher                 // 获取连接的加密器
+	SetChaos(chaos Chaos)              // 设置连接的网络故障注入，零值时关闭
+	GetChaos() Chaos                   // 获取连接的网络故障注入
 
 	SetProperty(key string, value interface{})   //设置链接属性
 	GetProperty(key string) (interface{}, error) //获取链接属性
 	RemoveProperty(key string)                   //移除链接属性
 }
+
+// OutboundMsg 已发送的出站消息
+type OutboundMsg struct {
+	Seq   uint64 // 消息序号
+	MsgID uint32 // 消息ID
+	Data  []byte // 消息内容
+}
+
+// TimeoutStage 连接生命周期超时阶段
+type TimeoutStage int
+
+const (
+	TimeoutAuth    TimeoutStage = iota // 未在AuthTimeout内完成鉴权
+	TimeoutIdle                        // 超过IdleTimeout未收到消息
+	TimeoutSession                     // 连接时长超过MaxSessionDuration
+)
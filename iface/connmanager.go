@@ -5,10 +5,15 @@ package iface
 */
 type Search func(Connection)
 type ConnManager interface {
-	Add(conn Connection)                  // 添加链接
-	Remove(conn Connection)               // 删除连接
-	Get(connID int64) (Connection, error) // 利用ConnID获取链接
-	Len() int                             // 获取链接数量
-	Search(Search)                        // 查找连接
-	ClearConn()                           // 删除并停止所有链接
+	Add(conn Connection)                                  // 添加链接
+	Remove(conn Connection)                               // 删除连接
+	Get(connID int64) (Connection, error)                 // 利用ConnID获取链接
+	Len() int                                             // 获取链接数量
+	Search(Search)                                        // 查找连接
+	ClearConn()                                           // 删除并停止所有链接
+	Kick(connID int64, reason string, msgID uint32) error // 发送原因消息后踢掉链接
+	Stats() ConnMgrStats                                  // 汇总全部在线链接的收发统计
+
+	BindUID(conn Connection, uid string, policy DuplicateLoginPolicy) ([]Connection, error) // 按策略绑定用户ID，返回该用户ID已绑定的其它链接
+	GetByUID(uid string) []Connection                                                       // 获取用户ID绑定的全部链接
 }
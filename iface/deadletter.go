@@ -0,0 +1,50 @@
+package iface
+
+import "time"
+
+// DeadLetterReason 消息进入死信队列的原因
+type DeadLetterReason int
+
+const (
+	DeadLetterNoHandler  DeadLetterReason = iota // MsgID未注册处理方法
+	DeadLetterBadRequest                         // 请求数据解码失败
+	DeadLetterError                              // 处理方法返回错误
+	DeadLetterPanic                              // 处理方法panic
+	DeadLetterRetry                              // 可重试的错误达到最大重试次数
+)
+
+// String 原因名称
+func (r DeadLetterReason) String() string {
+	switch r {
+	case DeadLetterNoHandler:
+		return "no_handler"
+	case DeadLetterBadRequest:
+		return "bad_request"
+	case DeadLetterError:
+		return "error"
+	case DeadLetterPanic:
+		return "panic"
+	case DeadLetterRetry:
+		return "retry_exhausted"
+	}
+	return "unknown"
+}
+
+// DeadLetter 无法路由或处理失败的消息
+type DeadLetter struct {
+	Time   time.Time        `json:"time"`
+	ConnID int64            `json:"conn_id"`
+	UID    string           `json:"uid"`
+	MsgID  uint32           `json:"msg_id"`
+	ReqID  uint64           `json:"req_id"`
+	Data   []byte           `json:"data"`
+	Reason DeadLetterReason `json:"reason"`
+	Err    string           `json:"err,omitempty"`
+}
+
+/*
+	死信队列存储抽象层，可替换为文件、Kafka等持久化实现
+*/
+type DeadLetterStore interface {
+	Push(letter DeadLetter) error // 写入一条死信
+}
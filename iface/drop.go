@@ -0,0 +1,54 @@
+package iface
+
+import "time"
+
+// DropReason 消息丢失的原因
+type DropReason int
+
+const (
+	DropSendOverflow    DropReason = iota // 发送缓冲已满被丢弃
+	DropChannelOverflow                   // 逻辑通道排队已满被丢弃
+	DropUnpack                            // 拆包或解密失败
+	DropFiltered                          // 被OnReceiveRaw过滤或序号未递增
+	DropUnroutable                        // 没有对应的路由
+	DropRateLimited                       // 触发限流被丢弃
+	DropWrite                             // 写出失败或连接关闭时仍在排队
+	DropRetryOverflow                     // 连接重试期间暂存的消息已满被丢弃
+)
+
+// DropReasons 全部的消息丢失原因
+var DropReasons = []DropReason{
+	DropSendOverflow, DropChannelOverflow, DropUnpack, DropFiltered, DropUnroutable, DropRateLimited, DropWrite, DropRetryOverflow,
+}
+
+func (r DropReason) String() string {
+	switch r {
+	case DropSendOverflow:
+		return "send_overflow"
+	case DropChannelOverflow:
+		return "channel_overflow"
+	case DropUnpack:
+		return "unpack"
+	case DropFiltered:
+		return "filtered"
+	case DropUnroutable:
+		return "unroutable"
+	case DropRateLimited:
+		return "rate_limited"
+	case DropWrite:
+		return "write"
+	case DropRetryOverflow:
+		return "retry_overflow"
+	}
+	return "unknown"
+}
+
+// DropAlert 统计窗口内的消息丢失速率超过阈值
+type DropAlert struct {
+	Conn      Connection // 单个连接的告警，全部连接合计的告警时为nil
+	Reason    DropReason
+	Count     uint64        // 窗口内丢失的消息数
+	Rate      float64       // 窗口内每秒丢失的消息数
+	Threshold float64       // 超过的阈值
+	Window    time.Duration // 统计窗口
+}
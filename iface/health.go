@@ -0,0 +1,36 @@
+package iface
+
+import "context"
+
+// HealthKind 健康检查类型
+type HealthKind int
+
+const (
+	HealthLiveness  HealthKind = iota // 存活检查，失败时进程应被重启，如Kubernetes livenessProbe
+	HealthReadiness                   // 就绪检查，失败时不应再分配新连接，如Kubernetes readinessProbe
+)
+
+// HealthCheck 健康检查函数，返回错误表示检查失败，需在ctx超时前返回
+type HealthCheck func(ctx context.Context) error
+
+// Pinger 可探测连通性的依赖，如消息总线，Cluster将其注册为就绪检查
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// HealthResult 单项检查的结果
+type HealthResult struct {
+	Status string `json:"status"`          // ok 或 fail
+	Error  string `json:"error,omitempty"` // 失败原因
+}
+
+// HealthReport 一次健康检查的结果，全部检查通过时Status为ok
+type HealthReport struct {
+	Status string                  `json:"status"`
+	Checks map[string]HealthResult `json:"checks"`
+}
+
+// OK 全部检查是否通过
+func (r HealthReport) OK() bool {
+	return r.Status == "ok"
+}
@@ -0,0 +1,10 @@
+package iface
+
+import "time"
+
+/*
+	幂等键存储抽象层，用于拒绝窗口期内重复的敏感请求，集群部署时可替换为Redis等共享存储
+*/
+type IdempotencyStore interface {
+	SetNX(key string, ttl time.Duration) (bool, error) // key不存在时写入并返回true，ttl后过期
+}
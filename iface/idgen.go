@@ -0,0 +1,8 @@
+package iface
+
+/*
+	ID生成器抽象层，用于生成ConnID，集群部署时需保证各节点生成的ID不重复
+*/
+type IDGenerator interface {
+	NextID() int64 // 生成下一个ID
+}
@@ -0,0 +1,14 @@
+package iface
+
+// Listener 监听入口，同一Server可同时监听多个入口，如web与原生客户端使用不同端口
+type Listener struct {
+	Tag      string // 入口标签，连接可通过GetListenerTag获取
+	Addr     string // 监听地址，如 :8080
+	Path     string // websocket路径，默认 /ws
+	CertFile string // TLS证书文件，与KeyFile同时设置时为wss
+	KeyFile  string // TLS私钥文件
+
+	StaticDir string // 以该目录下的文件响应websocket路径与HTTP路由之外的GET请求，如web客户端的资源包，默认为Server.Static("/")的目录
+
+	ProxyProtocol bool // 入口位于四层负载均衡之后，连接需以PROXY protocol v1/v2头开始
+}
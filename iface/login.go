@@ -0,0 +1,10 @@
+package iface
+
+// DuplicateLoginPolicy 同一用户ID重复登录时的处理策略
+type DuplicateLoginPolicy int
+
+const (
+	DuplicateAllowMulti DuplicateLoginPolicy = iota // 允许多个连接同时在线
+	DuplicateKickOld                                // 踢掉旧连接，保留新连接
+	DuplicateRejectNew                              // 拒绝新连接，保留旧连接
+)
@@ -4,9 +4,18 @@ package iface
 	将请求的一个消息封装到message中，定义抽象层接口
 */
 type Message interface {
-	GetMsgID() uint32     // 获取消息ID
-	GetData() []byte // 获取消息内容
+	GetMsgID() uint32 // 获取消息ID
+	GetData() []byte  // 获取消息内容
 
-	SetMsgID(uint32)     // 设置消息ID
-	SetData([]byte) // 设置消息内容
+	SetMsgID(uint32) // 设置消息ID
+	SetData([]byte)  // 设置消息内容
+
+	GetSeq() uint64 // 获取消息序号，0表示不带序号
+	SetSeq(uint64)  // 设置消息序号
+
+	GetReqID() uint64 // 获取请求ID，0表示不带请求ID
+	SetReqID(uint64)  // 设置请求ID，回复时原样带回用于请求与响应的关联
+
+	GetChannel() uint8 // 获取逻辑通道ID，0为默认通道
+	SetChannel(uint8)  // 设置逻辑通道ID
 }
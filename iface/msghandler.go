@@ -1,11 +1,50 @@
 package iface
 
+import "time"
+
 /*
 	消息管理抽象层
 */
 type MsgHandle interface {
 	DoMsgHandler(request Request)          // 马上以非阻塞方式处理消息
 	AddRouter(msgID uint32, router Router) // 为消息添加具体的处理逻辑
+	Use(middlewares ...Middleware)         // 添加消息处理中间件
+	Group(start, end uint32) RouterGroup   // 创建并挂载路由分组
+	AddGroup(group RouterGroup)            // 挂载路由分组
+	RemoveGroup(group RouterGroup)         // 卸载路由分组
 	StartWorkerPool()                      // 启动worker工作池
+	StopWorkerPool()                       // 停止worker工作池，worker处理完已分配的任务后退出
 	SendMsgToTaskQueue(request Request)    // 将消息交给TaskQueue,由worker进行处理
+	Stats() WorkerPoolStats                // 获取工作池统计信息
+	SetWorkerBounds(min, max uint32) bool  // 运行时调整弹性工作池的worker数量范围
+	QueueLoad(connID int64) float64        // 连接对应worker任务队列的占用比例
+
+	AddVersionRouter(msgID uint32, min, max uint32, router Router) // 为协议版本在[min, max]内的连接添加处理逻辑，max为0时不限制上限
+	AddNamespace(ns Namespace)                                     // 挂载命名空间，其中的路由优先于公共路由
+	AddRouterRange(start, end uint32, router Router)               // 为MsgID区间[start, end]添加共用的处理逻辑
+	SetDefault(router Router)                                      // 设置没有任何路由匹配时的处理逻辑
+
+	SetOnHandlerPanic(func(request Request, err interface{})) // 设置业务处理panic时的Hook函数
+	PanicCount() uint64                                       // 获取业务处理发生panic的次数
+
+	SetOnDeadLetter(func(letter DeadLetter))                              // 设置消息进入死信队列时的Hook函数
+	SetDeadLetterStore(store DeadLetterStore)                             // 设置死信队列存储
+	DeadLetter(request Request, reason DeadLetterReason, err interface{}) // 将无法路由或处理失败的消息写入死信队列
 }
+
+// WorkerPoolStats 工作池统计信息
+type WorkerPoolStats struct {
+	Workers    int           `json:"workers"`     // 当前运行的worker数量
+	MinWorkers int           `json:"min_workers"` // 最小worker数量
+	MaxWorkers int           `json:"max_workers"` // 最大worker数量
+	QueueDepth []int         `json:"queue_depth"` // 每个worker任务队列的当前长度
+	Handled    uint64        `json:"handled"`     // 已处理的任务数量
+	AvgWait    time.Duration `json:"avg_wait"`    // 任务平均排队耗时
+	AvgHandle  time.Duration `json:"avg_handle"`  // 任务平均处理耗时
+}
+
+// HandlerFunc 消息处理函数
+type HandlerFunc func(request Request)
+
+// Middleware 中间件，在路由业务之前执行，不调用next即可中断后续处理
+type Middleware func(next HandlerFunc) HandlerFunc
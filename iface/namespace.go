@@ -0,0 +1,27 @@
+package iface
+
+import "net/http"
+
+/*
+	命名空间抽象层，一个网关上的多个租户或游戏相互隔离：
+	连接在握手时归属一个命名空间，只能路由到本命名空间与Server上注册的公共路由，
+	用户ID、广播、限流与指标都按命名空间区分
+*/
+type Namespace interface {
+	Name() string                          // 命名空间名称
+	AddRouter(msgID uint32, router Router) // 注册只对本命名空间连接生效的路由
+	Handle(msgID uint32, fn interface{})   // 注册只对本命名空间连接生效的类型化处理方法
+	Use(middlewares ...Middleware)         // 添加本命名空间路由共享的中间件
+	Group(start, end uint32) RouterGroup   // 在命名空间内创建MsgID区间为[start, end]的路由分组
+
+	Route(msgID uint32) (Router, []Middleware) // 查找命名空间内的路由与需由外到内执行的中间件，未注册时返回nil
+
+	Len() int                                              // 命名空间内的连接数量
+	Search(Search)                                         // 遍历命名空间内的连接
+	Broadcast(msgID uint32, data []byte) int               // 向命名空间内的全部连接发送消息
+	GetByUID(uid string) []Connection                      // 获取命名空间内用户ID绑定的全部连接
+	SendToUID(uid string, msgID uint32, data []byte) error // 向命名空间内的用户ID发送消息，不在线时存入离线消息
+}
+
+// NamespaceResolver 握手时解析连接所属的命名空间，如按域名或鉴权信息区分租户，返回空字符串时使用默认命名空间
+type NamespaceResolver func(r *http.Request) string
@@ -0,0 +1,18 @@
+package iface
+
+import "time"
+
+// OfflineMessage 用户离线期间暂存的消息
+type OfflineMessage struct {
+	MsgID     uint32    `json:"msg_id"`
+	Data      []byte    `json:"data"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+/*
+	离线消息存储抽象层，可替换为Redis等外部存储实现
+*/
+type OfflineStore interface {
+	Push(uid string, msg OfflineMessage) error // 追加一条离线消息，超出容量时丢弃最旧的消息；msg.Data归存储所有
+	Pop(uid string) ([]OfflineMessage, error)  // 取出并删除全部未过期的离线消息
+}
@@ -0,0 +1,5 @@
+package iface
+
+// OutboundInterceptor 出站拦截器，在封包与加密之前按连接检查或修改消息内容，返回值替换原消息内容；
+// 用于按玩家过滤其它玩家的私有字段、本地化服务端文本或按实验分组下发不同内容
+type OutboundInterceptor func(conn Connection, msgID uint32, data []byte) ([]byte, error)
@@ -2,8 +2,16 @@ package iface
 
 /*
 	封包数据和拆包数据
+	Pack返回的[]byte应从netw.GetBuffer获取，写出后由连接调用netw.PutBuffer归还；
+	Unpack返回的消息内容可以直接引用入参，入参来自缓冲池，在消息处理完成后归还
 */
 type Packet interface {
 	Pack(msg Message) ([]byte, error) // 封包方法
 	Unpack([]byte) (Message, error)   // 拆包方法
 }
+
+// FrameFormat websocket帧类型对应的封包格式与编解码器，为nil的字段使用Server的默认值
+type FrameFormat struct {
+	Packet Packet
+	Codec  Codec
+}
@@ -0,0 +1,17 @@
+package iface
+
+// Priority 消息优先级，worker总是优先处理高优先级队列中的消息
+type Priority int
+
+const (
+	PriorityNormal Priority = iota // 普通优先级
+	PriorityHigh                   // 高优先级，如战斗操作
+	PriorityLow                    // 低优先级，如聊天等批量消息
+)
+
+/*
+	路由可选实现该接口声明消息优先级
+*/
+type PriorityRouter interface {
+	Priority() Priority // 获取该路由消息的优先级
+}
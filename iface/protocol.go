@@ -0,0 +1,53 @@
+package iface
+
+// MsgDesc MsgID的协议描述，补充无法从路由推断的名称、说明与消息类型
+type MsgDesc struct {
+	Name          string      // 消息名称，如 Login，为空时使用请求类型名
+	Doc           string      // 说明
+	Request       interface{} // 请求消息类型的指针，如 &pb.LoginReq{}，为nil时从类型化路由或TypeSchema推断
+	Response      interface{} // 响应消息类型的指针，为nil时从类型化路由推断
+	ResponseMsgID uint32      // 响应的MsgID，为0时类型化路由为ResponseMsgID(msgID)
+}
+
+// Protocol 已注册路由的协议描述，供客户端生成协议绑定
+type Protocol struct {
+	MinVersion uint32          `json:"min_version,omitempty"` // 支持的最低协议版本
+	MaxVersion uint32          `json:"max_version,omitempty"` // 支持的最高协议版本，0为不限制
+	Messages   []ProtocolMsg   `json:"messages"`              // 按MsgID、命名空间与协议版本排序
+	Ranges     []ProtocolRange `json:"ranges,omitempty"`      // 按MsgID区间注册的路由
+}
+
+// ProtocolMsg 协议描述中的一个MsgID，同一MsgID在不同命名空间或协议版本下各为一条
+type ProtocolMsg struct {
+	MsgID         uint32        `json:"msg_id"`
+	Name          string        `json:"name"`
+	Doc           string        `json:"doc,omitempty"`
+	Namespace     string        `json:"namespace,omitempty"`   // 只对该命名空间的连接生效
+	MinVersion    uint32        `json:"min_version,omitempty"` // 只对协议版本在[MinVersion, MaxVersion]内的连接生效
+	MaxVersion    uint32        `json:"max_version,omitempty"`
+	Request       *ProtocolType `json:"request,omitempty"`
+	Response      *ProtocolType `json:"response,omitempty"`
+	ResponseMsgID uint32        `json:"response_msg_id,omitempty"`
+}
+
+// ProtocolType 消息内容的类型
+type ProtocolType struct {
+	Name   string          `json:"name"`           // proto消息为全名，如 game.LoginReq，其它为Go类型名
+	File   string          `json:"file,omitempty"` // proto消息所在的.proto文件
+	Fields []ProtocolField `json:"fields,omitempty"`
+}
+
+// ProtocolField 消息内容的字段
+type ProtocolField struct {
+	Name     string `json:"name"`
+	Number   int32  `json:"number,omitempty"` // proto字段编号
+	Type     string `json:"type"`
+	Repeated bool   `json:"repeated,omitempty"`
+}
+
+// ProtocolRange 按MsgID区间注册的路由
+type ProtocolRange struct {
+	Start uint32 `json:"start"`
+	End   uint32 `json:"end"`
+	Name  string `json:"name"` // 路由的类型名
+}
@@ -0,0 +1,17 @@
+package iface
+
+// Quota 入站配额，累计的字节数与消息数按QuotaHalfLife衰减，各阈值为0时不限制
+type Quota struct {
+	WarnBytes int64 // 累计字节数超过该值时调用OnQuota Hook函数告警
+	KickBytes int64 // 累计字节数超过该值时断开连接
+	WarnMsgs  int64 // 累计消息数超过该值时调用OnQuota Hook函数告警
+	KickMsgs  int64 // 累计消息数超过该值时断开连接
+}
+
+// QuotaEvent 连接超过入站配额
+type QuotaEvent struct {
+	MsgID uint32  // 超过MsgQuota时为对应的MsgID，超过InboundQuota时为0
+	Bytes float64 // 衰减后的累计字节数
+	Msgs  float64 // 衰减后的累计消息数
+	Kick  bool    // 超过断开阈值，Hook返回后断开连接
+}
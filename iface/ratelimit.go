@@ -0,0 +1,27 @@
+package iface
+
+// Rate 令牌桶限流速率
+type Rate struct {
+	Rate  float64 // 每秒允许的消息数量，0为不限制
+	Burst int     // 允许的突发消息数量
+}
+
+// RateLimitAction 触发限流后的处理方式
+type RateLimitAction int
+
+const (
+	RateLimitDrop  RateLimitAction = iota // 丢弃消息
+	RateLimitDelay                        // 延迟到有令牌时再处理
+	RateLimitWarn                         // 仅调用OnRateLimited Hook函数并继续处理
+	RateLimitKick                         // 关闭连接
+)
+
+// RateLimitScope 触发限流的维度
+type RateLimitScope int
+
+const (
+	RateLimitGlobal RateLimitScope = iota // 全局
+	RateLimitConn                         // 单个连接
+	RateLimitMsg                          // 单个连接内的单个MsgID
+	RateLimitNamespace                    // 命名空间内的全部连接
+)
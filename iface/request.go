@@ -1,11 +1,33 @@
 package iface
 
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
 /*
 	Request 接口：
 	实际上是把客户端请求的链接信息 和 请求的数据 包装到了 Request里
 */
 type Request interface {
-	GetConnection() Connection // 获取请求连接信息
-	GetData() []byte      // 获取请求消息的数据
-	GetMsgID() uint32          // 获取请求的消息ID
+	GetConnection() Connection  // 获取请求连接信息
+	GetData() []byte            // 获取请求消息的数据
+	GetMsgID() uint32           // 获取请求的消息ID
+	GetReqID() uint64           // 获取客户端请求ID，回复时原样带回
+	GetChannel() uint8          // 获取请求所属的逻辑通道ID，0为默认通道
+	Bind(v interface{}) error   // 使用编解码器将请求数据解码到v
+	Logger() *zap.SugaredLogger // 获取携带连接信息与msgID的日志
+	Copy() Request              // 复制请求，Request在处理完成后会被回收复用，需要在处理方法之外持有时使用
+
+	Context() context.Context       // 处理消息的上下文，连接关闭或超过HandlerTimeout时取消
+	SetContext(ctx context.Context) // 替换处理消息的上下文，如在中间件中附加值
+
+	Reply(msgID uint32, data []byte) error      // 向请求连接回复消息
+	ReplyObj(msgID uint32, v interface{}) error // 使用编解码器序列化后回复
+	ReplyError(code int32, msg string) error    // 以ErrorMsgID向请求连接回复错误
+	Fail(code int32) error                      // 以错误码表中注册的错误信息回复错误
+
+	SetProperty(key string, value interface{})   // 设置请求连接的属性
+	GetProperty(key string) (interface{}, error) // 获取请求连接的属性
 }
@@ -0,0 +1,21 @@
+package iface
+
+/*
+	路由分组抽象层，一段连续的MsgID共享同一组中间件
+	例如 1000-1999 为大厅模块，2000-2999 为战斗模块
+*/
+type RouterGroup interface {
+	Start() uint32                         // 分组起始MsgID(包含)
+	End() uint32                           // 分组结束MsgID(包含)
+	Contains(msgID uint32) bool            // MsgID是否属于该分组
+	Use(middlewares ...Middleware)         // 添加分组中间件
+	AddRouter(msgID uint32, router Router) // 在分组内注册路由
+	Handle(msgID uint32, fn interface{})   // 在分组内注册类型化处理方法
+	GetRouter(msgID uint32) (Router, bool) // 获取分组内的路由
+	Middlewares() []Middleware             // 获取分组中间件
+
+	SetOnAttach(func(RouterGroup)) // 设置分组挂载时的Hook函数
+	SetOnDetach(func(RouterGroup)) // 设置分组卸载时的Hook函数
+	CallOnAttach()                 // 调用分组挂载Hook函数
+	CallOnDetach()                 // 调用分组卸载Hook函数
+}
@@ -0,0 +1,25 @@
+package iface
+
+/*
+	消息内容校验抽象层，按MsgID注册，在路由之前执行
+*/
+type Schema interface {
+	Validate(request Request) error // 校验请求数据，返回错误时按SchemaAction处理
+}
+
+// SchemaFunc 函数形式的消息内容校验
+type SchemaFunc func(request Request) error
+
+// Validate 校验请求数据
+func (f SchemaFunc) Validate(request Request) error {
+	return f(request)
+}
+
+// SchemaAction 消息内容校验失败后的处理方式
+type SchemaAction int
+
+const (
+	SchemaReject SchemaAction = iota // 以ReplyError回复错误并丢弃消息
+	SchemaLog                        // 仅记录日志并继续处理
+	SchemaKick                       // 关闭连接
+)
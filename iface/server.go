@@ -1,7 +1,12 @@
 package iface
 
 import (
+	"context"
+	"time"
+
 	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/timerwheel"
 )
 
 /**
@@ -12,14 +17,108 @@ type Server interface {
 	Stop()                                 // 停止服务器方法
 	Serve(c *gin.Context)                  // 开启业务服务方法
 	AddRouter(msgID uint32, router Router) // 路由功能：给当前服务注册一个路由业务方法，供客户端链接处理使用
+	Handle(msgID uint32, fn interface{})   // 注册类型化处理方法，自动解码请求并编码响应
+	Use(middlewares ...Middleware)         // 添加消息处理中间件
+	Group(start, end uint32) RouterGroup   // 创建MsgID区间为[start, end]的路由分组
+	AddGroup(group RouterGroup)            // 挂载路由分组
+	RemoveGroup(group RouterGroup)         // 卸载路由分组
+
+	UseOutbound(interceptors ...OutboundInterceptor)                              // 添加出站拦截器，在封包之前按连接检查或修改消息内容
+	InterceptOutbound(conn Connection, msgID uint32, data []byte) ([]byte, error) // 依次执行出站拦截器
+
+	DescribeMsg(msgID uint32, desc MsgDesc) // 补充MsgID的协议描述
+	Protocol() Protocol                     // 获取已注册路由的协议描述
+
+	AddVersionRouter(msgID uint32, min, max uint32, router Router) // 为协议版本在[min, max]内的连接注册路由，max为0时不限制上限
+	HandleVersion(msgID uint32, min, max uint32, fn interface{})   // 为协议版本在[min, max]内的连接注册类型化处理方法
+	RegisterSchema(msgID uint32, schema Schema)                    // 为MsgID注册消息内容校验
+	AddRouterRange(start, end uint32, router Router)               // 为MsgID区间[start, end]注册共用的路由，单独注册的MsgID优先
+	SetDefaultRouter(router Router)                                // 设置没有任何路由匹配时的默认路由
+	Namespace(name string) Namespace                               // 获取或创建命名空间，创建任一命名空间后握手需声明已创建的命名空间
+
+	ServeTagged(tag string) gin.HandlerFunc // 带入口标签的业务服务方法，用于挂载到自有gin路由
+	Listen(l Listener) error                // 启动一个监听入口
+	ListenAndServe() error                  // 启动配置中的全部监听入口
+	Run() error                             // 启动配置中的全部监听入口并阻塞，收到SIGINT、SIGTERM或调用Stop后停止服务
+	Restart() error                         // 重启配置中的全部监听入口，已建立的连接不受影响，用于更换端口或证书
+
+	HandleHTTP(method, path string, handlers ...gin.HandlerFunc) // 在全部监听入口上注册普通HTTP路由，需在Listen之前注册
+	Static(prefix, dir string)                                   // 在全部监听入口上以dir目录下的文件响应prefix下的GET请求
+
+	AddOnStart(func() error)                                        // 追加Run启动监听入口之前的Hook函数，返回错误时停止启动
+	AddOnRestart(func())                                            // 追加Restart关闭监听入口之前的Hook函数
+	AddHealthCheck(name string, kind HealthKind, check HealthCheck) // 注册存活或就绪检查，同名的检查会被替换
+	CheckHealth(ctx context.Context, kind HealthKind) HealthReport  // 执行存活或就绪检查
+	HealthHandler(kind HealthKind) gin.HandlerFunc                  // 健康检查HTTP处理方法，通过时返回200，否则返回503
+
+	ReloadConfig(next *Config)          // 以next中可热更新的字段更新配置
+	GetConfig() *Config                 // 获取当前配置，热更新后为更新后的配置，不能修改返回值
+	Clock() clock.Clock                 // 心跳、时间轮、限流与重试使用的时钟
+	TimerWheel() *timerwheel.TimerWheel // 心跳检测、延迟发送与周期任务共用的时间轮
+	WatchConfig(path string) error      // 监听配置文件变化与SIGHUP信号并热更新配置
+
+	GetConnMgr() ConnManager       // 得到链接管理
+	GetBanList() BanList           // 得到封禁名单
+	GetSessionMgr() SessionManager // 得到会话管理，未开启会话重连时为nil
+
+	SetAccepting(accept bool)                // 设置是否接受新连接
+	IsAccepting() bool                       // 是否接受新连接
+	Broadcast(msgID uint32, data []byte) int // 向全部在线链接发送消息
+
+	SendToUID(uid string, msgID uint32, data []byte) error // 向用户ID的全部链接发送消息，不在线时存入离线消息
+	GetOfflineStore() OfflineStore                         // 获取离线消息存储，未设置时为nil
+
+	Schedule(interval time.Duration, fn func()) uint32 // 添加周期任务，返回任务ID，Stop时取消
+	Unschedule(id uint32)                              // 取消周期任务
+
+	BanIP(ip string, ttl time.Duration, reason string, msgID uint32)   // 封禁IP并踢掉该IP的在线链接
+	BanUID(uid string, ttl time.Duration, reason string, msgID uint32) // 封禁用户ID并踢掉该用户的在线链接
+
+	AddOnConnStart(func(Connection) error) // 追加连接创建时的Hook函数，返回错误时拒绝该连接
+	AddOnConnStop(func(Connection))        // 追加连接断开时的Hook函数
+	SetOnConnStart(func(Connection))       // 追加不会拒绝连接的OnConnStart Hook函数，兼容旧接口
+	SetOnConnStop(func(Connection))        // 同AddOnConnStop，兼容旧接口
+
+	CallOnConnStart(conn Connection) error // 依次调用OnConnStart Hook函数，返回第一个错误
+	CallOnConnStop(conn Connection)        // 逆序调用OnConnStop Hook函数
+	AddOnStop(func())                      // 追加Server停止时的Hook函数，在断开全部连接之前逆序调用
+	Migrate(target string) int             // 通知全部连接携带会话token重连到target后断开，用于滚动升级
+
+	SetOnOversizedPacket(func(conn Connection, size int)) // 设置收到超长数据包时的Hook函数
+	CallOnOversizedPacket(conn Connection, size int)      // 调用OnOversizedPacket Hook函数
+
+	SetOnLifecycleTimeout(stage TimeoutStage, hookFunc func(Connection)) // 设置连接生命周期超时阶段的Hook函数
+	CallOnLifecycleTimeout(conn Connection, stage TimeoutStage)          // 调用对应阶段的OnLifecycleTimeout Hook函数
+
+	SetOnDuplicateLogin(func(old, new Connection)) // 设置同一用户ID重复登录时的Hook函数，可在旧连接断开前下发通知
+	CallOnDuplicateLogin(old, new Connection)      // 调用OnDuplicateLogin Hook函数
+
+	AddOnAccept(func(conn Connection))                        // 追加连接升级完成、启动之前的Hook函数
+	AddOnReceiveRaw(func(conn Connection, data []byte) error) // 追加收到数据包、拆包路由之前的Hook函数，返回错误时丢弃该数据包
+	AddOnSend(func(conn Connection, data []byte))             // 追加写出websocket帧之前的Hook函数
+	AddOnClose(func(conn Connection, reason error))           // 追加连接关闭之后的Hook函数，reason为关闭原因
+	AddOnAuth(func(conn Connection, uid string, err error))   // 追加连接鉴权完成时的Hook函数，err为nil时鉴权成功
+	AddOnQuota(func(conn Connection, event QuotaEvent))       // 追加连接超过入站配额时的Hook函数
+	AddOnLatency(func(conn Connection, rtt time.Duration))    // 追加测量到往返延迟时的Hook函数，rtt为平滑后的值
+	AddOnDropAlert(func(alert DropAlert))                     // 追加消息丢失速率超过阈值时的Hook函数
+	CallOnReceiveRaw(conn Connection, data []byte) error      // 依次调用OnReceiveRaw Hook函数，返回第一个错误
+	CallOnSend(conn Connection, data []byte)                  // 调用OnSend Hook函数
+	CallOnClose(conn Connection, reason error)                // 调用OnClose Hook函数
+	CallOnAuth(conn Connection, uid string, err error)        // 调用OnAuth Hook函数
+	CallOnQuota(conn Connection, event QuotaEvent)            // 调用OnQuota Hook函数
+	CallOnLatency(conn Connection, rtt time.Duration)         // 调用OnLatency Hook函数
+	CallOnDropAlert(alert DropAlert)                          // 调用OnDropAlert Hook函数
+	DropStats() map[string]uint64                             // 服务启动以来各原因丢失的消息总数
 
-	GetConnMgr() ConnManager // 得到链接管理
+	SetOnHandlerPanic(func(request Request, err interface{}))     // 设置业务处理panic时的Hook函数
+	SetOnRateLimited(func(request Request, scope RateLimitScope)) // 设置触发限流时的Hook函数
+	SetOnDeadLetter(func(letter DeadLetter))                      // 设置消息进入死信队列时的Hook函数
+	GetMsgHandler() MsgHandle                                     // 得到消息管理
 
-	SetOnConnStart(func(Connection)) // 设置该Server的连接创建时Hook函数
-	SetOnConnStop(func(Connection))  // 设置该Server的连接断开时的Hook函数
+	Packet() Packet // 获取封包拆包实例
+	Codec() Codec   // 获取消息内容编解码器
 
-	CallOnConnStart(conn Connection) // 调用连接OnConnStart Hook函数
-	CallOnConnStop(conn Connection)  // 调用连接OnConnStop Hook函数
+	FrameFormat(messageType int) *FrameFormat // 获取websocket帧类型对应的封包格式与编解码器，未设置时为nil
 
-	Packet() Packet
+	GetKeyExchange() KeyExchange // 获取密钥交换函数
 }
@@ -0,0 +1,55 @@
+package iface
+
+import "time"
+
+/*
+	会话抽象层，会话生命周期独立于连接，断线后在宽限期内可重连恢复
+*/
+type Session interface {
+	ID() string                                  // 会话token，客户端重连时携带
+	GetUID() string                              // 会话绑定的用户ID
+	GetConnection() Connection                   // 当前绑定的连接，离线时为nil
+	IsOnline() bool                              // 是否在线
+	SendMsg(msgID uint32, data []byte) error     // 在线时直接发送，离线时写入缓冲，重连后补发
+	SetProperty(key string, value interface{})   // 设置会话属性
+	GetProperty(key string) (interface{}, error) // 获取会话属性
+	RemoveProperty(key string)                   // 移除会话属性
+}
+
+/*
+	会话管理抽象层
+*/
+type SessionManager interface {
+	Get(token string) (Session, bool)           // 利用token获取会话
+	GetByConn(conn Connection) (Session, bool)  // 获取连接绑定的会话
+	Bind(conn Connection, token string) Session // 连接绑定会话，token对应的会话不存在时创建新会话
+	Rebind(conn Connection) (Session, bool)     // 连接鉴权后恢复等待鉴权的会话并返回是否恢复，没有等待的会话时为当前会话记录用户ID并返回nil
+	Unbind(conn Connection)                     // 连接断开，会话进入宽限期
+	Len() int                                   // 获取会话数量
+
+	SetOnSessionExpire(func(Session)) // 设置会话宽限期结束被销毁时的Hook函数
+}
+
+// SessionInfo 持久化的会话元数据
+type SessionInfo struct {
+	Token     string    `json:"token"`      // 会话token，即重连凭证
+	UID       string    `json:"uid"`        // 会话绑定的用户ID
+	Namespace string    `json:"namespace"`  // 会话所属的命名空间
+	NodeID    string    `json:"node_id"`    // 最后绑定会话的节点
+	LoginTime time.Time `json:"login_time"` // 会话创建时间
+	LastSeen  time.Time `json:"last_seen"`  // 最后一次绑定或断开的时间
+
+	// 以下字段只在Server.Migrate迁移时保存，属性值经JSON序列化，恢复后数字为float64、结构体为map
+	Properties     map[string]interface{} `json:"properties,omitempty"`      // 会话属性
+	ConnProperties map[string]interface{} `json:"conn_properties,omitempty"` // 连接属性，恢复后写入新连接
+	Pending        []OutboundMsg          `json:"pending,omitempty"`         // 离线缓冲与未确认的出站消息
+}
+
+/*
+	会话元数据存储抽象层，会话可在网关重启后或集群内其它节点上恢复，可选Redis等实现
+*/
+type SessionStore interface {
+	Save(info SessionInfo, ttl time.Duration) error // 保存会话元数据，ttl后过期
+	Load(token string) (SessionInfo, bool, error)   // 利用token读取会话元数据
+	Delete(token string) error                      // 删除会话元数据
+}
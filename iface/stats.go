@@ -0,0 +1,35 @@
+package iface
+
+import "time"
+
+// ConnStats 连接收发统计
+type ConnStats struct {
+	MsgsIn     uint64    `json:"msgs_in"`     // 收到的消息数
+	MsgsOut    uint64    `json:"msgs_out"`    // 发送的消息数
+	BytesIn    uint64    `json:"bytes_in"`    // 收到的字节数
+	BytesOut   uint64    `json:"bytes_out"`   // 写出的字节数
+	LastMsgID  uint32    `json:"last_msg_id"` // 最后收到的MsgID
+	LastActive time.Time `json:"last_active"` // 最后收到消息的时间
+	CreatedAt  time.Time `json:"created_at"`  // 连接建立时间
+	Errors     uint64    `json:"errors"`      // 拆包、解密失败与处理panic等错误次数
+	Dropped    uint64    `json:"dropped"`     // 因缓冲溢出丢弃的消息数
+
+	Drops map[string]uint64 `json:"drops,omitempty"` // 各原因丢失的消息数，包含Dropped
+
+	Latency time.Duration `json:"latency"` // 平滑后的往返延迟，未测量时为0
+
+	// 连接关闭后的websocket关闭码与原因，未关闭时为0，未收发关闭帧时为1006
+	CloseCode int    `json:"close_code,omitempty"`
+	CloseText string `json:"close_text,omitempty"`
+}
+
+// ConnMgrStats 全部在线连接的统计汇总
+type ConnMgrStats struct {
+	Conns    int    `json:"conns"`
+	MsgsIn   uint64 `json:"msgs_in"`
+	MsgsOut  uint64 `json:"msgs_out"`
+	BytesIn  uint64 `json:"bytes_in"`
+	BytesOut uint64 `json:"bytes_out"`
+	Errors   uint64 `json:"errors"`
+	Dropped  uint64 `json:"dropped"`
+}
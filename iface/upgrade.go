@@ -0,0 +1,15 @@
+package iface
+
+import (
+	"net"
+	"net/http"
+)
+
+/*
+	websocket升级阶段的Hook，在握手鉴权之前按注册顺序执行，可校验Origin、请求头与子协议，
+	并将URL参数或Cookie中的信息写入props，连接创建后作为连接属性设置；返回错误则拒绝连接
+*/
+type UpgradeHook func(r *http.Request, props map[string]interface{}) error
+
+// IPEnricher 握手阶段按客户端真实IP补充连接属性，如查询地区与ASN写入props，返回错误则拒绝连接
+type IPEnricher func(ip net.IP, props map[string]interface{}) error
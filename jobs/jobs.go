@@ -0,0 +1,177 @@
+package jobs
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// Func 任务函数，ctx在调度器停止时取消
+type Func func(ctx context.Context)
+
+// job 一个定时任务
+type job struct {
+	id       uint32
+	spec     string
+	schedule Schedule
+	fn       Func
+	running  int32
+	timer    clock.Timer
+}
+
+// Scheduler cron定时任务调度器：任务panic不影响其它任务，上一次执行未结束时跳过本次触发，
+// Stop时取消上下文并等待执行中的任务结束
+type Scheduler struct {
+	loc     *time.Location
+	clock   clock.Clock
+	jobs    map[uint32]*job
+	idGen   uint32
+	started bool
+	stopped bool
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	lock    sync.Mutex
+}
+
+// Default 默认调度器，使用本地时区
+var Default = NewScheduler(time.Local)
+
+// NewScheduler 创建调度器，按loc时区计算触发时间
+func NewScheduler(loc *time.Location) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		loc:    loc,
+		clock:  clock.Real,
+		jobs:   make(map[uint32]*job),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Register 在默认调度器注册任务，如 jobs.Register("0 4 * * *", dailyReset)
+func Register(spec string, fn Func) (uint32, error) {
+	return Default.Register(spec, fn)
+}
+
+// Attach 启动默认调度器，Server停止时随之停止
+func Attach(s iface.Server) {
+	Default.Attach(s)
+}
+
+// SetClock 设置计算触发时间与计时使用的时钟，需在Start之前调用，测试中传入clock.Fake
+func (s *Scheduler) SetClock(c clock.Clock) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.clock = c
+}
+
+// Register 注册任务，返回任务ID，调度器已启动时立即开始计时
+func (s *Scheduler) Register(spec string, fn Func) (uint32, error) {
+	schedule, err := Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.idGen++
+	j := &job{id: s.idGen, spec: spec, schedule: schedule, fn: fn}
+	s.jobs[j.id] = j
+	if s.started && !s.stopped {
+		s.arm(j)
+	}
+	return j.id, nil
+}
+
+// Remove 移除任务，执行中的任务不会被中断
+func (s *Scheduler) Remove(id uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if j, ok := s.jobs[id]; ok {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+		delete(s.jobs, id)
+	}
+}
+
+// Start 开始调度全部任务
+func (s *Scheduler) Start() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.started || s.stopped {
+		return
+	}
+	s.started = true
+	for _, j := range s.jobs {
+		s.arm(j)
+	}
+}
+
+// Attach 启动调度器，Server停止时随之停止
+func (s *Scheduler) Attach(server iface.Server) {
+	server.AddOnStop(s.Stop)
+	s.Start()
+}
+
+// Stop 停止调度，取消任务上下文并等待执行中的任务结束
+func (s *Scheduler) Stop() {
+	s.lock.Lock()
+	if s.stopped {
+		s.lock.Unlock()
+		return
+	}
+	s.stopped = true
+	for _, j := range s.jobs {
+		if j.timer != nil {
+			j.timer.Stop()
+		}
+	}
+	s.lock.Unlock()
+	s.cancel()
+	s.wg.Wait()
+}
+
+// arm 计算下一次触发时间并设置定时器，调用方需持有锁
+func (s *Scheduler) arm(j *job) {
+	now := s.clock.Now().In(s.loc)
+	next := j.schedule.Next(now)
+	if next.IsZero() {
+		zap.S().Warn("job ", j.spec, " will never run")
+		return
+	}
+	j.timer = s.clock.AfterFunc(next.Sub(now), func() {
+		s.run(j)
+	})
+}
+
+// run 执行任务并设置下一次触发
+func (s *Scheduler) run(j *job) {
+	s.lock.Lock()
+	if s.stopped || s.jobs[j.id] != j {
+		s.lock.Unlock()
+		return
+	}
+	s.arm(j)
+	s.lock.Unlock()
+	if !atomic.CompareAndSwapInt32(&j.running, 0, 1) {
+		zap.S().Warn("job ", j.spec, " still running, skip")
+		return
+	}
+	s.wg.Add(1)
+	defer s.wg.Done()
+	defer atomic.StoreInt32(&j.running, 0)
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Errorw("job panic", "spec", j.spec, "err", err, "stack", string(debug.Stack()))
+		}
+	}()
+	j.fn(s.ctx)
+}
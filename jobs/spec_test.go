@@ -0,0 +1,116 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+)
+
+// base 2024-01-15 周一 10:30:20
+var base = time.Date(2024, 1, 15, 10, 30, 20, 0, time.UTC)
+
+func TestParseBadSpec(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"1-x * * * *",
+		"a * * * *",
+		"@every",
+		"@every 0s",
+		"@every -1s",
+		"@every soon",
+		"@never",
+	} {
+		if _, err := Parse(spec); err != ErrBadSpec {
+			t.Errorf("Parse(%q) err = %v, want ErrBadSpec", spec, err)
+		}
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	date := func(y int, m time.Month, d, h, min int) time.Time {
+		return time.Date(y, m, d, h, min, 0, 0, time.UTC)
+	}
+	cases := []struct {
+		spec string
+		from time.Time
+		want time.Time
+	}{
+		{"*/15 * * * *", base, date(2024, 1, 15, 10, 45)},
+		{"5-10/2 * * * *", base, date(2024, 1, 15, 11, 5)},
+		{"30 10 * * *", base, date(2024, 1, 16, 10, 30)},
+		{"0 4 * * *", base, date(2024, 1, 16, 4, 0)},
+		{"0 12 1,15 * *", base, date(2024, 1, 15, 12, 0)},
+		{"0 9 * * 1-5", base, date(2024, 1, 16, 9, 0)},
+		{"0 0 * * 0", base, date(2024, 1, 21, 0, 0)},
+		{"0 0 * * 7", base, date(2024, 1, 21, 0, 0)},
+		{"0 0 * 3 *", base, date(2024, 3, 1, 0, 0)},
+		{"@hourly", base, date(2024, 1, 15, 11, 0)},
+		{"@daily", base, date(2024, 1, 16, 0, 0)},
+		{"@weekly", base, date(2024, 1, 21, 0, 0)},
+		{"@monthly", base, date(2024, 2, 1, 0, 0)},
+		{"@yearly", base, date(2025, 1, 1, 0, 0)},
+		// 日与星期同时限定时满足其一即可：13号或周五
+		{"0 0 13 * 5", base, date(2024, 1, 19, 0, 0)},
+		{"0 0 29 2 *", base, date(2024, 2, 29, 0, 0)},
+		{"0 0 29 2 *", date(2024, 3, 1, 0, 0), date(2028, 2, 29, 0, 0)},
+		{"0 0 31 2 *", base, time.Time{}},
+		{"@every 90s", base, base.Add(90 * time.Second)},
+	}
+	for _, c := range cases {
+		schedule, err := Parse(c.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", c.spec, err)
+		}
+		if got := schedule.Next(c.from); !got.Equal(c.want) {
+			t.Errorf("%q.Next(%v) = %v, want %v", c.spec, c.from, got, c.want)
+		}
+	}
+}
+
+func TestSchedulerFakeClock(t *testing.T) {
+	fake := clock.NewFake(base)
+	s := NewScheduler(time.UTC)
+	s.SetClock(fake)
+	t.Cleanup(s.Stop)
+	var runs []time.Time
+	id, err := s.Register("*/15 * * * *", func(ctx context.Context) {
+		runs = append(runs, fake.Now())
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Register("* * * * *", func(ctx context.Context) { panic("boom") }); err != nil {
+		t.Fatal(err)
+	}
+	s.Start()
+
+	fake.Advance(14 * time.Minute)
+	if len(runs) != 0 {
+		t.Fatalf("ran before 10:45: %v", runs)
+	}
+	// 每分钟panic的任务不影响其它任务
+	fake.Advance(30 * time.Minute)
+	want := []time.Time{
+		time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC),
+		time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC),
+	}
+	if len(runs) != len(want) || !runs[0].Equal(want[0]) || !runs[1].Equal(want[1]) {
+		t.Fatalf("runs = %v, want %v", runs, want)
+	}
+	s.Remove(id)
+	fake.Advance(time.Hour)
+	if len(runs) != len(want) {
+		t.Fatalf("removed job ran: %v", runs)
+	}
+}
@@ -0,0 +1,252 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var ErrBadRange = errors.New("leaderboard: bad range")
+
+// Entry 排行榜中的一条记录，Rank从1开始
+type Entry struct {
+	UID   string  `json:"uid"`
+	Score float64 `json:"score"`
+	Rank  int64   `json:"rank"`
+}
+
+// RankChange 名次变化通知，以NotifyMsgID的JSON消息推送给在线玩家，OldRank为0表示首次上榜
+type RankChange struct {
+	Board   string  `json:"board"`
+	Season  int64   `json:"season"`
+	Score   float64 `json:"score"`
+	OldRank int64   `json:"old_rank"`
+	Rank    int64   `json:"rank"`
+}
+
+// Options 排行榜配置
+type Options struct {
+	KeyPrefix   string        // Redis Key前缀，默认 game:rank:
+	Server      iface.Server  // 推送名次变化的Server，为nil时不推送
+	NotifyMsgID uint32        // 名次变化通知的MsgID，0为不推送
+	NotifyTopN  int64         // 只推送新名次在前N名内的变化，0为不限制
+	ArchiveTTL  time.Duration // 赛季轮换后旧赛季数据的保留时间，0为永久保留
+}
+
+// Leaderboard 基于Redis有序集合的排行榜，分数高者在前；每个榜单分赛季存储，Rotate后开始新赛季
+type Leaderboard struct {
+	rdb  redis.UniversalClient
+	opts Options
+}
+
+// New 创建排行榜
+func New(rdb redis.UniversalClient, opts Options) *Leaderboard {
+	if opts.KeyPrefix == "" {
+		opts.KeyPrefix = "game:rank:"
+	}
+	return &Leaderboard{rdb: rdb, opts: opts}
+}
+
+// Update 设置uid在当前赛季的分数，返回更新后的记录
+func (l *Leaderboard) Update(board string, uid string, score float64) (Entry, error) {
+	return l.write(board, uid, func(ctx context.Context, pipe redis.Pipeliner, key string) {
+		pipe.ZAdd(ctx, key, &redis.Z{Score: score, Member: uid})
+	})
+}
+
+// Incr 增加uid在当前赛季的分数，返回更新后的记录
+func (l *Leaderboard) Incr(board string, uid string, delta float64) (Entry, error) {
+	return l.write(board, uid, func(ctx context.Context, pipe redis.Pipeliner, key string) {
+		pipe.ZIncrBy(ctx, key, delta, uid)
+	})
+}
+
+// write 在同一事务中读取旧名次、更新分数并读取新名次，名次变化时推送通知
+func (l *Leaderboard) write(board string, uid string, update func(ctx context.Context, pipe redis.Pipeliner, key string)) (Entry, error) {
+	ctx := context.Background()
+	season, err := l.Season(board)
+	if err != nil {
+		return Entry{}, err
+	}
+	key := l.boardKey(board, season)
+	var oldRank, newRank *redis.IntCmd
+	var score *redis.FloatCmd
+	_, err = l.rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		oldRank = pipe.ZRevRank(ctx, key, uid)
+		update(ctx, pipe, key)
+		newRank = pipe.ZRevRank(ctx, key, uid)
+		score = pipe.ZScore(ctx, key, uid)
+		return nil
+	})
+	// 首次上榜时旧名次为redis.Nil
+	if err != nil && err != redis.Nil {
+		return Entry{}, err
+	}
+	if newRank.Err() != nil {
+		return Entry{}, newRank.Err()
+	}
+	entry := Entry{UID: uid, Score: score.Val(), Rank: newRank.Val() + 1}
+	old := int64(0)
+	if oldRank.Err() == nil {
+		old = oldRank.Val() + 1
+	}
+	if old != entry.Rank {
+		l.notify(RankChange{Board: board, Season: season, Score: entry.Score, OldRank: old, Rank: entry.Rank}, uid)
+	}
+	return entry, nil
+}
+
+// Rank 查询uid在当前赛季的记录，未上榜时返回false
+func (l *Leaderboard) Rank(board string, uid string) (Entry, bool, error) {
+	season, err := l.Season(board)
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return l.rank(l.boardKey(board, season), uid)
+}
+
+func (l *Leaderboard) rank(key string, uid string) (Entry, bool, error) {
+	ctx := context.Background()
+	var rank *redis.IntCmd
+	var score *redis.FloatCmd
+	_, err := l.rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		rank = pipe.ZRevRank(ctx, key, uid)
+		score = pipe.ZScore(ctx, key, uid)
+		return nil
+	})
+	if err == redis.Nil {
+		return Entry{}, false, nil
+	}
+	if err != nil {
+		return Entry{}, false, err
+	}
+	return Entry{UID: uid, Score: score.Val(), Rank: rank.Val() + 1}, true, nil
+}
+
+// Range 查询当前赛季第start到第stop名(从1开始，包含两端)
+func (l *Leaderboard) Range(board string, start, stop int64) ([]Entry, error) {
+	season, err := l.Season(board)
+	if err != nil {
+		return nil, err
+	}
+	return l.RangeSeason(board, season, start, stop)
+}
+
+// RangeSeason 查询指定赛季第start到第stop名，可用于读取已轮换的旧赛季
+func (l *Leaderboard) RangeSeason(board string, season int64, start, stop int64) ([]Entry, error) {
+	if start < 1 || stop < start {
+		return nil, ErrBadRange
+	}
+	return l.rangeKey(l.boardKey(board, season), start, stop)
+}
+
+func (l *Leaderboard) rangeKey(key string, start, stop int64) ([]Entry, error) {
+	zs, err := l.rdb.ZRevRangeWithScores(context.Background(), key, start-1, stop-1).Result()
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]Entry, 0, len(zs))
+	for i, z := range zs {
+		uid, _ := z.Member.(string)
+		entries = append(entries, Entry{UID: uid, Score: z.Score, Rank: start + int64(i)})
+	}
+	return entries, nil
+}
+
+// Around 查询uid在当前赛季前后各n名的记录(包含自己)，未上榜时返回空
+func (l *Leaderboard) Around(board string, uid string, n int64) ([]Entry, error) {
+	season, err := l.Season(board)
+	if err != nil {
+		return nil, err
+	}
+	key := l.boardKey(board, season)
+	entry, ok, err := l.rank(key, uid)
+	if err != nil || !ok {
+		return nil, err
+	}
+	start := entry.Rank - n
+	if start < 1 {
+		start = 1
+	}
+	return l.rangeKey(key, start, entry.Rank+n)
+}
+
+// Count 当前赛季上榜人数
+func (l *Leaderboard) Count(board string) (int64, error) {
+	season, err := l.Season(board)
+	if err != nil {
+		return 0, err
+	}
+	return l.rdb.ZCard(context.Background(), l.boardKey(board, season)).Result()
+}
+
+// Remove 从当前赛季移除uid
+func (l *Leaderboard) Remove(board string, uid string) error {
+	season, err := l.Season(board)
+	if err != nil {
+		return err
+	}
+	return l.rdb.ZRem(context.Background(), l.boardKey(board, season), uid).Err()
+}
+
+// Season 榜单的当前赛季，从未轮换时为0
+func (l *Leaderboard) Season(board string) (int64, error) {
+	season, err := l.rdb.Get(context.Background(), l.seasonKey(board)).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return season, err
+}
+
+// Rotate 开始新赛季并返回新赛季编号，旧赛季数据按ArchiveTTL保留，可通过RangeSeason读取；
+// 可配合jobs定时调用，如每周一零点轮换
+func (l *Leaderboard) Rotate(board string) (int64, error) {
+	ctx := context.Background()
+	season, err := l.rdb.Incr(ctx, l.seasonKey(board)).Result()
+	if err != nil {
+		return 0, err
+	}
+	if l.opts.ArchiveTTL > 0 {
+		if err := l.rdb.Expire(ctx, l.boardKey(board, season-1), l.opts.ArchiveTTL).Err(); err != nil {
+			return season, err
+		}
+	}
+	return season, nil
+}
+
+// notify 向在线的uid推送名次变化
+func (l *Leaderboard) notify(change RankChange, uid string) {
+	if l.opts.Server == nil || l.opts.NotifyMsgID == 0 {
+		return
+	}
+	if l.opts.NotifyTopN > 0 && change.Rank > l.opts.NotifyTopN {
+		return
+	}
+	conns := l.opts.Server.GetConnMgr().GetByUID(uid)
+	if len(conns) == 0 {
+		return
+	}
+	payload, err := json.Marshal(change)
+	if err != nil {
+		zap.S().Warn("leaderboard marshal error ", err)
+		return
+	}
+	for _, conn := range conns {
+		_ = conn.SendBuffMsg(l.opts.NotifyMsgID, payload)
+	}
+}
+
+func (l *Leaderboard) boardKey(board string, season int64) string {
+	return l.opts.KeyPrefix + board + ":" + strconv.FormatInt(season, 10)
+}
+
+func (l *Leaderboard) seasonKey(board string) string {
+	return l.opts.KeyPrefix + board + ":season"
+}
@@ -0,0 +1,203 @@
+package lockstep
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/room"
+)
+
+var (
+	ErrFrameEvicted = errors.New("lockstep: frame evicted from buffer")
+	ErrFrameRange   = errors.New("lockstep: invalid frame range")
+	ErrInputTooLong = errors.New("lockstep: input too long")
+	ErrFrameFull    = errors.New("lockstep: too many inputs in frame")
+)
+
+/*
+	帧同步引擎，帧数据包格式(小端序):
+	| frameID 4B | inputCount 2B | [connID 8B | inputLen 2B | input] ... |
+	由房间的OnTick驱动，每次Step打包一帧并广播给房间成员
+*/
+
+// Options 帧同步配置
+type Options struct {
+	FrameMsgID   uint32 // 下发帧数据的MsgID
+	BufferFrames int    // 保留的历史帧数量，用于断线重连与追帧，默认512，不宜超过连接的MaxMsgChanLen
+	MaxInputLen  int    // 单条输入的最大字节数，默认65535
+	MaxInputs    int    // 每帧最多收集的输入数量，超出时Input返回ErrFrameFull，默认且不超过65535
+}
+
+// defaultBufferFrames 默认保留的历史帧数量，追帧时全部写入发送缓冲，小于默认的MaxMsgChanLen(1024)
+const defaultBufferFrames = 512
+
+// input 玩家输入
+type input struct {
+	connID int64
+	data   []byte
+}
+
+// Engine 帧同步引擎
+type Engine struct {
+	room    *room.Room
+	opts    Options
+	frameID uint32   // 下一帧的帧号，从1开始
+	pending []input  // 当前帧收集到的输入
+	frames  [][]byte // 历史帧数据包，frames[i]的帧号为first+i
+	first   uint32   // frames中最早一帧的帧号
+	lock    sync.Mutex
+	// 串行化广播与中途加入，加入的玩家不会漏收或重复收到帧；与lock分开，广播期间不阻塞Input
+	sendLock sync.Mutex
+}
+
+// NewEngine 创建帧同步引擎，需在房间的OnTick中调用Step
+func NewEngine(r *room.Room, opts Options) *Engine {
+	if opts.MaxInputLen <= 0 || opts.MaxInputLen > 0xFFFF {
+		opts.MaxInputLen = 0xFFFF
+	}
+	if opts.MaxInputs <= 0 || opts.MaxInputs > 0xFFFF {
+		opts.MaxInputs = 0xFFFF
+	}
+	if opts.BufferFrames <= 0 {
+		opts.BufferFrames = defaultBufferFrames
+	}
+	return &Engine{room: r, opts: opts, frameID: 1, first: 1}
+}
+
+// Input 收集玩家输入，打包进下一帧，data会被复制；当前帧的输入已达MaxInputs时返回ErrFrameFull
+func (e *Engine) Input(conn iface.Connection, data []byte) error {
+	if len(data) > e.opts.MaxInputLen {
+		return ErrInputTooLong
+	}
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if len(e.pending) >= e.opts.MaxInputs {
+		return ErrFrameFull
+	}
+	e.pending = append(e.pending, input{connID: conn.GetConnID(), data: buf})
+	return nil
+}
+
+// FrameID 下一帧的帧号
+func (e *Engine) FrameID() uint32 {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return e.frameID
+}
+
+// Step 打包当前帧并广播，没有输入时也会下发空帧以驱动客户端
+func (e *Engine) Step() uint32 {
+	e.sendLock.Lock()
+	defer e.sendLock.Unlock()
+	e.lock.Lock()
+	frameID := e.frameID
+	e.frameID++
+	inputs := e.pending
+	e.pending = nil
+	packet := encodeFrame(frameID, inputs)
+	e.frames = append(e.frames, packet)
+	if len(e.frames) > e.opts.BufferFrames {
+		drop := len(e.frames) - e.opts.BufferFrames
+		e.frames = append(e.frames[:0:0], e.frames[drop:]...)
+		e.first += uint32(drop)
+	}
+	e.lock.Unlock()
+	e.room.Broadcast(e.opts.FrameMsgID, packet)
+	return frameID
+}
+
+// Frames 获取[from, to]范围内的历史帧数据包，to为0时到最新一帧
+func (e *Engine) Frames(from, to uint32) ([][]byte, error) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	last := e.frameID - 1
+	if to == 0 || to > last {
+		to = last
+	}
+	if from == 0 {
+		from = 1
+	}
+	if from > to {
+		return nil, ErrFrameRange
+	}
+	if from < e.first {
+		return nil, ErrFrameEvicted
+	}
+	frames := make([][]byte, 0, to-from+1)
+	frames = append(frames, e.frames[from-e.first:to-e.first+1]...)
+	return frames, nil
+}
+
+// CatchUp 向连接补发[from, to]范围内的历史帧，用于断线重连与追帧请求
+func (e *Engine) CatchUp(conn iface.Connection, from, to uint32) error {
+	frames, err := e.Frames(from, to)
+	if err != nil {
+		return err
+	}
+	for _, frame := range frames {
+		if err := conn.SendBuffMsg(e.opts.FrameMsgID, frame); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Join 补发缓冲中的全部历史帧后让中途加入的玩家加入房间，补发失败时不加入房间；
+// 大部分历史帧在sendLock之外补发，不阻塞Step与其它成员的广播
+func (e *Engine) Join(conn iface.Connection) error {
+	e.lock.Lock()
+	next := e.first
+	e.lock.Unlock()
+	next, err := e.catchUpFrom(conn, next)
+	if err != nil {
+		return err
+	}
+	e.sendLock.Lock()
+	defer e.sendLock.Unlock()
+	// 补发期间新打包的帧在加入房间之前补齐，之后的帧由广播下发，不会漏收或重复收到
+	if _, err := e.catchUpFrom(conn, next); err != nil {
+		return err
+	}
+	return e.room.Join(conn)
+}
+
+// catchUpFrom 补发from及之后的全部历史帧，返回下一个未补发的帧号
+func (e *Engine) catchUpFrom(conn iface.Connection, from uint32) (uint32, error) {
+	frames, err := e.Frames(from, 0)
+	if err == ErrFrameRange {
+		return from, nil
+	}
+	if err != nil {
+		return from, err
+	}
+	for _, frame := range frames {
+		if err := conn.SendBuffMsg(e.opts.FrameMsgID, frame); err != nil {
+			return from, err
+		}
+		from++
+	}
+	return from, nil
+}
+
+// encodeFrame 编码帧数据包
+func encodeFrame(frameID uint32, inputs []input) []byte {
+	size := 6
+	for _, in := range inputs {
+		size += 10 + len(in.data)
+	}
+	packet := make([]byte, size)
+	binary.LittleEndian.PutUint32(packet, frameID)
+	binary.LittleEndian.PutUint16(packet[4:], uint16(len(inputs)))
+	offset := 6
+	for _, in := range inputs {
+		binary.LittleEndian.PutUint64(packet[offset:], uint64(in.connID))
+		binary.LittleEndian.PutUint16(packet[offset+8:], uint16(len(in.data)))
+		offset += 10
+		offset += copy(packet[offset:], in.data)
+	}
+	return packet
+}
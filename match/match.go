@@ -0,0 +1,167 @@
+package match
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrAlreadyQueued = errors.New("match: already in queue")
+	ErrStopped       = errors.New("match: matchmaker stopped")
+)
+
+// Ticket 匹配票据
+type Ticket struct {
+	ID         string           // 玩家ID，同一ID同时只能排一个队
+	Conn       iface.Connection // 玩家连接，断开后自动出队
+	Rating     int              // 段位分
+	Mode       string           // 游戏模式，仅同模式的票据互相匹配
+	Attrs      map[string]interface{}
+	EnqueuedAt time.Time
+}
+
+// Wait 已等待时间
+func (t *Ticket) Wait(now time.Time) time.Duration {
+	return now.Sub(t.EnqueuedAt)
+}
+
+// Strategy 匹配策略，tickets为同一模式下按入队时间排序的票据，返回匹配成功的分组
+type Strategy interface {
+	Match(tickets []*Ticket, now time.Time) [][]*Ticket
+}
+
+// Matchmaker 匹配队列，按间隔对每个模式的队列执行匹配策略
+type Matchmaker struct {
+	strategy Strategy
+	interval time.Duration
+	onMatch  func(tickets []*Ticket)
+	tickets  map[string]*Ticket
+	quit     chan struct{}
+	stopped  bool
+	lock     sync.Mutex
+}
+
+// NewMatchmaker 创建匹配队列，onMatch在匹配goroutine中调用，interval<=0时默认1秒
+func NewMatchmaker(strategy Strategy, interval time.Duration, onMatch func(tickets []*Ticket)) *Matchmaker {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &Matchmaker{
+		strategy: strategy,
+		interval: interval,
+		onMatch:  onMatch,
+		tickets:  make(map[string]*Ticket),
+		quit:     make(chan struct{}),
+	}
+}
+
+// Start 启动匹配
+func (m *Matchmaker) Start() {
+	go m.loop()
+}
+
+// Stop 停止匹配，队列中的票据被丢弃
+func (m *Matchmaker) Stop() {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped {
+		return
+	}
+	m.stopped = true
+	m.tickets = make(map[string]*Ticket)
+	close(m.quit)
+}
+
+// Enqueue 入队
+func (m *Matchmaker) Enqueue(t *Ticket) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.stopped {
+		return ErrStopped
+	}
+	if _, ok := m.tickets[t.ID]; ok {
+		return ErrAlreadyQueued
+	}
+	if t.EnqueuedAt.IsZero() {
+		t.EnqueuedAt = time.Now()
+	}
+	m.tickets[t.ID] = t
+	return nil
+}
+
+// Cancel 出队，返回票据是否在队列中
+func (m *Matchmaker) Cancel(id string) bool {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.tickets[id]
+	delete(m.tickets, id)
+	return ok
+}
+
+// Len 队列中的票据数量
+func (m *Matchmaker) Len() int {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return len(m.tickets)
+}
+
+func (m *Matchmaker) loop() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.quit:
+			return
+		case now := <-ticker.C:
+			for _, group := range m.match(now) {
+				m.notify(group)
+			}
+		}
+	}
+}
+
+// match 按模式分组执行匹配策略，匹配成功的票据出队
+func (m *Matchmaker) match(now time.Time) [][]*Ticket {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	modes := make(map[string][]*Ticket)
+	for id, t := range m.tickets {
+		// 连接已断开的自动出队
+		if t.Conn != nil {
+			if ctx := t.Conn.Context(); ctx != nil && ctx.Err() != nil {
+				delete(m.tickets, id)
+				continue
+			}
+		}
+		modes[t.Mode] = append(modes[t.Mode], t)
+	}
+	var groups [][]*Ticket
+	for _, tickets := range modes {
+		sort.Slice(tickets, func(i, j int) bool {
+			return tickets[i].EnqueuedAt.Before(tickets[j].EnqueuedAt)
+		})
+		for _, group := range m.strategy.Match(tickets, now) {
+			for _, t := range group {
+				delete(m.tickets, t.ID)
+			}
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// notify 调用匹配成功回调，panic不影响匹配goroutine
+func (m *Matchmaker) notify(group []*Ticket) {
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Error("match callback panic: ", err)
+		}
+	}()
+	m.onMatch(group)
+}
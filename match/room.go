@@ -0,0 +1,30 @@
+package match
+
+import (
+	"github.com/xiaomingping/game/room"
+
+	"go.uber.org/zap"
+)
+
+// RoomHandler 匹配成功后创建房间并让玩家加入，以msgID向玩家下发房间ID，msgID为0时不下发
+func RoomHandler(mgr *room.Manager, opts room.Options, msgID uint32, newRoomID func([]*Ticket) string) func([]*Ticket) {
+	return func(tickets []*Ticket) {
+		r, err := mgr.Create(newRoomID(tickets), opts)
+		if err != nil {
+			zap.S().Error("match create room error ", err)
+			return
+		}
+		for _, t := range tickets {
+			if t.Conn == nil {
+				continue
+			}
+			if err := r.Join(t.Conn); err != nil {
+				zap.S().Warn("match join room error ", t.ID, " err = ", err)
+				continue
+			}
+			if msgID != 0 {
+				_ = t.Conn.SendBuffMsg(msgID, []byte(r.ID()))
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package match
+
+import (
+	"sort"
+	"time"
+)
+
+// FIFOStrategy 先到先得，凑满size人即成局
+type FIFOStrategy struct {
+	size int
+}
+
+// NewFIFOStrategy 创建先到先得匹配策略
+func NewFIFOStrategy(size int) *FIFOStrategy {
+	if size < 1 {
+		size = 1
+	}
+	return &FIFOStrategy{size: size}
+}
+
+// Match 按入队顺序每size人一组
+func (s *FIFOStrategy) Match(tickets []*Ticket, now time.Time) [][]*Ticket {
+	var groups [][]*Ticket
+	for len(tickets) >= s.size {
+		groups = append(groups, tickets[:s.size:s.size])
+		tickets = tickets[s.size:]
+	}
+	return groups
+}
+
+// EloStrategy 段位分相近的玩家成局，可接受的分差随等待时间放宽
+type EloStrategy struct {
+	size      int
+	baseRange int           // 初始可接受分差
+	widen     int           // 每等待per时间放宽的分差
+	per       time.Duration // 放宽间隔
+	maxRange  int           // 最大可接受分差，0为不限制
+}
+
+// NewEloStrategy 创建段位分匹配策略，如 NewEloStrategy(2, 50, 25, 5*time.Second, 400)
+func NewEloStrategy(size, baseRange, widen int, per time.Duration, maxRange int) *EloStrategy {
+	if per <= 0 {
+		per = time.Second
+	}
+	if size < 2 {
+		size = 2
+	}
+	return &EloStrategy{size: size, baseRange: baseRange, widen: widen, per: per, maxRange: maxRange}
+}
+
+// window 票据当前可接受的分差
+func (s *EloStrategy) window(t *Ticket, now time.Time) int {
+	w := s.baseRange + s.widen*int(t.Wait(now)/s.per)
+	if s.maxRange > 0 && w > s.maxRange {
+		w = s.maxRange
+	}
+	return w
+}
+
+// Match 等待最久的玩家优先，从分数相近的玩家中选出双方都能接受的size人
+func (s *EloStrategy) Match(tickets []*Ticket, now time.Time) [][]*Ticket {
+	used := make(map[string]bool)
+	var groups [][]*Ticket
+	for _, anchor := range tickets {
+		if used[anchor.ID] {
+			continue
+		}
+		var candidates []*Ticket
+		for _, t := range tickets {
+			if t == anchor || used[t.ID] {
+				continue
+			}
+			diff := abs(t.Rating - anchor.Rating)
+			if diff <= s.window(anchor, now) && diff <= s.window(t, now) {
+				candidates = append(candidates, t)
+			}
+		}
+		if len(candidates) < s.size-1 {
+			continue
+		}
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return abs(candidates[i].Rating-anchor.Rating) < abs(candidates[j].Rating-anchor.Rating)
+		})
+		group := append([]*Ticket{anchor}, candidates[:s.size-1]...)
+		for _, t := range group {
+			used[t.ID] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
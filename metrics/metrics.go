@@ -0,0 +1,286 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "game"
+
+var (
+	// Registry 框架指标注册表，独立于prometheus默认注册表
+	Registry = prometheus.NewRegistry()
+
+	connections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connections",
+		Help:      "当前连接数",
+	})
+	accepts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conn_accepts_total",
+		Help:      "建立连接总数",
+	})
+	rejects = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conn_rejects_total",
+		Help:      "过载保护拒绝的连接总数",
+	}, []string{"reason"})
+	closes = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conn_closes_total",
+		Help:      "关闭连接总数",
+	})
+	messagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_in_total",
+		Help:      "收到的消息总数",
+	}, []string{"msg_id"})
+	messagesOut = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_out_total",
+		Help:      "发送的消息总数",
+	}, []string{"msg_id"})
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "handler_duration_seconds",
+		Help:      "消息处理耗时",
+		Buckets:   []float64{.0005, .001, .005, .01, .025, .05, .1, .25, .5, 1, 5},
+	}, []string{"msg_id"})
+	bytesSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_sent_total",
+		Help:      "发送的字节总数",
+	})
+	bytesReceived = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bytes_received_total",
+		Help:      "收到的字节总数",
+	})
+	heartbeatTimeouts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "heartbeat_timeouts_total",
+		Help:      "心跳超时断开的连接总数",
+	})
+	rtt = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rtt_seconds",
+		Help:      "心跳测量的连接往返延迟",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .15, .2, .3, .5, 1, 2},
+	})
+	throttledWrites = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bandwidth_throttled_writes_total",
+		Help:      "因出站带宽限制被延迟的写次数",
+	})
+	throttledSeconds = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "bandwidth_throttled_seconds_total",
+		Help:      "因出站带宽限制等待的总时间",
+	})
+	deadLetters = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "dead_letters_total",
+		Help:      "进入死信队列的消息总数",
+	}, []string{"reason"})
+	backpressurePauses = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "backpressure_pauses_total",
+		Help:      "因背压暂停读取的次数",
+	})
+	namespaceConns = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "namespace_connections",
+		Help:      "各命名空间的当前连接数",
+	}, []string{"namespace"})
+	namespaceMessagesIn = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "namespace_messages_in_total",
+		Help:      "各命名空间收到的消息总数",
+	}, []string{"namespace"})
+	coalescedInputs = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "coalesced_inputs_total",
+		Help:      "被同一连接更新的消息替换而丢弃的消息总数",
+	})
+	quotaExceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "quota_exceeded_total",
+		Help:      "连接超过入站配额的次数，action为warn或kick",
+	}, []string{"action"})
+	chaosInjected = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chaos_injected_total",
+		Help:      "网络故障注入的次数，direction为read或write，action为drop或reorder",
+	}, []string{"direction", "action"})
+	messagesDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_dropped_total",
+		Help:      "丢失的消息总数，reason为丢失原因",
+	}, []string{"reason"})
+	queueDepthFn atomic.Value // func() float64
+	queueDepth   = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_queue_depth",
+		Help:      "worker任务队列中等待处理的消息总数",
+	}, func() float64 {
+		if fn, ok := queueDepthFn.Load().(func() float64); ok {
+			return fn()
+		}
+		return 0
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		connections, accepts, rejects, closes,
+		messagesIn, messagesOut, handlerDuration,
+		bytesSent, bytesReceived, heartbeatTimeouts, rtt, queueDepth,
+		throttledWrites, throttledSeconds, deadLetters, backpressurePauses,
+		namespaceConns, namespaceMessagesIn, coalescedInputs, quotaExceeded,
+		chaosInjected, messagesDropped,
+	)
+}
+
+// Handler /metrics 指标接口
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// GinHandler gin路由使用的 /metrics 指标接口，如 g.GET("/metrics", metrics.GinHandler())
+func GinHandler() gin.HandlerFunc {
+	return gin.WrapH(Handler())
+}
+
+// RegisterQueueDepth 设置worker任务队列总长度的采集函数，重复设置时覆盖
+func RegisterQueueDepth(fn func() float64) {
+	queueDepthFn.Store(fn)
+}
+
+// ConnAccepted 建立连接
+func ConnAccepted() {
+	accepts.Inc()
+	connections.Inc()
+}
+
+// ConnRejected 过载保护拒绝新连接
+func ConnRejected(reason string) {
+	rejects.WithLabelValues(reason).Inc()
+}
+
+// ConnClosed 关闭连接
+func ConnClosed() {
+	closes.Inc()
+	connections.Dec()
+}
+
+// msgLabels 已注册处理方法的MsgID对应的标签，客户端可发送任意MsgID，未注册的合并为unknown避免标签无限增长
+var msgLabels sync.Map
+
+// RegisterMsgID 登记已注册处理方法的MsgID，收到消息与处理耗时按登记的MsgID分别统计
+func RegisterMsgID(msgID uint32) {
+	msgLabels.Store(msgID, strconv.FormatUint(uint64(msgID), 10))
+}
+
+// msgLabel 入站MsgID的标签，未登记的为unknown
+func msgLabel(msgID uint32) string {
+	if label, ok := msgLabels.Load(msgID); ok {
+		return label.(string)
+	}
+	return "unknown"
+}
+
+// MessageIn 收到消息
+func MessageIn(msgID uint32, size int) {
+	messagesIn.WithLabelValues(msgLabel(msgID)).Inc()
+	bytesReceived.Add(float64(size))
+}
+
+// MessageOut 发送消息
+func MessageOut(msgID uint32) {
+	messagesOut.WithLabelValues(strconv.FormatUint(uint64(msgID), 10)).Inc()
+}
+
+// BytesSent 写出字节数
+func BytesSent(size int) {
+	bytesSent.Add(float64(size))
+}
+
+// HandlerObserve 记录消息处理耗时
+func HandlerObserve(msgID uint32, cost time.Duration) {
+	handlerDuration.WithLabelValues(msgLabel(msgID)).Observe(cost.Seconds())
+}
+
+// BandwidthThrottled 因出站带宽限制延迟写出
+func BandwidthThrottled(wait time.Duration) {
+	throttledWrites.Inc()
+	throttledSeconds.Add(wait.Seconds())
+}
+
+// DeadLetter 消息进入死信队列
+func DeadLetter(reason string) {
+	deadLetters.WithLabelValues(reason).Inc()
+}
+
+// BackpressurePaused 因背压暂停读取
+func BackpressurePaused() {
+	backpressurePauses.Inc()
+}
+
+// HeartbeatTimeout 心跳超时
+func HeartbeatTimeout() {
+	heartbeatTimeouts.Inc()
+}
+
+// RTT 一次往返延迟的测量样本
+func RTT(d time.Duration) {
+	rtt.Observe(d.Seconds())
+}
+
+// NamespaceConnOpened 命名空间内建立连接
+func NamespaceConnOpened(ns string) {
+	namespaceConns.WithLabelValues(ns).Inc()
+}
+
+// NamespaceConnClosed 命名空间内关闭连接
+func NamespaceConnClosed(ns string) {
+	namespaceConns.WithLabelValues(ns).Dec()
+}
+
+// NamespaceMessageIn 命名空间内收到消息
+func NamespaceMessageIn(ns string) {
+	namespaceMessagesIn.WithLabelValues(ns).Inc()
+}
+
+// InputCoalesced 排队中的消息被更新的消息替换
+func InputCoalesced() {
+	coalescedInputs.Inc()
+}
+
+// QuotaExceeded 连接超过入站配额，kick为true时连接被断开
+func QuotaExceeded(kick bool) {
+	if kick {
+		quotaExceeded.WithLabelValues("kick").Inc()
+	} else {
+		quotaExceeded.WithLabelValues("warn").Inc()
+	}
+}
+
+// ChaosInjected 网络故障注入丢弃或重排了一条消息
+func ChaosInjected(direction, action string) {
+	chaosInjected.WithLabelValues(direction, action).Inc()
+}
+
+// MessageDropped 丢失了n条消息
+func MessageDropped(reason string, n int) {
+	messagesDropped.WithLabelValues(reason).Add(float64(n))
+}
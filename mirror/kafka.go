@@ -0,0 +1,62 @@
+package mirror
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// KafkaPublisher 基于Kafka的镜像发布，消息内容为原始数据，
+// 连接信息放在消息头 msg_id、conn_id、uid 中，以uid(未鉴权时为ConnID)为Key保证同一玩家的消息有序
+type KafkaPublisher struct {
+	w       *kafka.Writer
+	timeout time.Duration
+}
+
+// NewKafkaPublisher 创建Kafka镜像发布
+func NewKafkaPublisher(brokers ...string) *KafkaPublisher {
+	return NewKafkaPublisherWithWriter(&kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireOne,
+		BatchTimeout: 10 * time.Millisecond,
+	})
+}
+
+// NewKafkaPublisherWithWriter 以自定义的Writer创建Kafka镜像发布，w.Topic需为空，主题由Record指定
+func NewKafkaPublisherWithWriter(w *kafka.Writer) *KafkaPublisher {
+	return &KafkaPublisher{w: w, timeout: 10 * time.Second}
+}
+
+// Publish 同步写入一批消息，超时或Kafka不可用时返回错误，该批消息被丢弃
+func (p *KafkaPublisher) Publish(records []Record) error {
+	msgs := make([]kafka.Message, len(records))
+	for i, record := range records {
+		connID := strconv.FormatInt(record.ConnID, 10)
+		key := record.UID
+		if key == "" {
+			key = connID
+		}
+		msgs[i] = kafka.Message{
+			Topic: record.Topic,
+			Key:   []byte(key),
+			Value: record.Data,
+			Time:  record.Time,
+			Headers: []kafka.Header{
+				{Key: "msg_id", Value: []byte(strconv.FormatUint(uint64(record.MsgID), 10))},
+				{Key: "conn_id", Value: []byte(connID)},
+				{Key: "uid", Value: []byte(record.UID)},
+			},
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), p.timeout)
+	defer cancel()
+	return p.w.WriteMessages(ctx, msgs...)
+}
+
+// Close 写出Writer中剩余的消息并关闭连接
+func (p *KafkaPublisher) Close() error {
+	return p.w.Close()
+}
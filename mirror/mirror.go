@@ -0,0 +1,188 @@
+package mirror
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// Record 镜像的一条客户端消息
+type Record struct {
+	Topic  string    `json:"topic"`
+	MsgID  uint32    `json:"msg_id"`
+	ConnID int64     `json:"conn_id"`
+	UID    string    `json:"uid,omitempty"`
+	Time   time.Time `json:"time"` // 服务端收到消息的时间
+	Data   []byte    `json:"data"`
+}
+
+// Publisher 镜像消息的发布目标，Publish在Mirror的发送goroutine中串行调用
+type Publisher interface {
+	Publish(records []Record) error
+	Close() error
+}
+
+// Options 镜像参数
+type Options struct {
+	MsgIDs        []uint32          // 需要镜像的MsgID，为空时镜像全部消息
+	Topic         string            // 默认主题
+	Topics        map[uint32]string // MsgID对应的主题，未配置时使用Topic
+	QueueSize     int               // 等待发布的消息队列长度，已满时丢弃新消息，默认10000
+	BatchSize     int               // 单次发布最多消息数，默认100
+	FlushInterval time.Duration     // 未凑满一批时的最长等待时间，默认100ms
+}
+
+// Mirror 将客户端消息异步镜像到Publisher，供数据分析与反作弊使用；
+// 队列已满时丢弃消息而不等待，不会阻塞读goroutine与业务处理
+type Mirror struct {
+	pub     Publisher
+	opts    Options
+	msgIDs  map[uint32]struct{}
+	queue   chan Record
+	dropped uint64
+	quit    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// New 创建消息镜像并启动后台发布
+func New(pub Publisher, opts Options) *Mirror {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 10000
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = 100 * time.Millisecond
+	}
+	m := &Mirror{
+		pub:   pub,
+		opts:  opts,
+		queue: make(chan Record, opts.QueueSize),
+		quit:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	if len(opts.MsgIDs) > 0 {
+		m.msgIDs = make(map[uint32]struct{}, len(opts.MsgIDs))
+		for _, msgID := range opts.MsgIDs {
+			m.msgIDs[msgID] = struct{}{}
+		}
+	}
+	go m.run()
+	return m
+}
+
+// Attach 以中间件的方式镜像Server收到的消息
+func (m *Mirror) Attach(s iface.Server) {
+	s.Use(m.Middleware())
+}
+
+// Middleware 镜像经过中间件的消息，之前的中间件拒绝的消息不会被镜像
+func (m *Mirror) Middleware() iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			m.Mirror(request)
+			next(request)
+		}
+	}
+}
+
+// Mirror 镜像一条消息，未选中的MsgID忽略，队列已满或已关闭时丢弃并返回false
+func (m *Mirror) Mirror(request iface.Request) bool {
+	msgID := request.GetMsgID()
+	if m.msgIDs != nil {
+		if _, ok := m.msgIDs[msgID]; !ok {
+			return false
+		}
+	}
+	select {
+	case <-m.quit:
+		atomic.AddUint64(&m.dropped, 1)
+		return false
+	default:
+	}
+	conn := request.GetConnection()
+	// 请求的缓冲在处理完成后归还，需复制消息内容
+	data := make([]byte, len(request.GetData()))
+	copy(data, request.GetData())
+	record := Record{
+		Topic:  m.topic(msgID),
+		MsgID:  msgID,
+		ConnID: conn.GetConnID(),
+		UID:    conn.GetUID(),
+		Time:   time.Now(),
+		Data:   data,
+	}
+	select {
+	case m.queue <- record:
+		return true
+	default:
+		atomic.AddUint64(&m.dropped, 1)
+		return false
+	}
+}
+
+// Dropped 因队列已满或已关闭丢弃的消息数
+func (m *Mirror) Dropped() uint64 {
+	return atomic.LoadUint64(&m.dropped)
+}
+
+// Close 停止镜像，发布队列中剩余的消息后关闭Publisher
+func (m *Mirror) Close() error {
+	m.once.Do(func() { close(m.quit) })
+	<-m.done
+	return m.pub.Close()
+}
+
+func (m *Mirror) topic(msgID uint32) string {
+	if topic, ok := m.opts.Topics[msgID]; ok {
+		return topic
+	}
+	return m.opts.Topic
+}
+
+// run 按批发布消息，关闭时发布队列中剩余的消息
+func (m *Mirror) run() {
+	defer close(m.done)
+	ticker := time.NewTicker(m.opts.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]Record, 0, m.opts.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := m.pub.Publish(batch); err != nil {
+			zap.S().Warn("mirror publish error ", err, " records = ", len(batch))
+		}
+		batch = make([]Record, 0, m.opts.BatchSize)
+	}
+	for {
+		select {
+		case record := <-m.queue:
+			batch = append(batch, record)
+			if len(batch) >= m.opts.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-m.quit:
+			for {
+				select {
+				case record := <-m.queue:
+					batch = append(batch, record)
+					if len(batch) >= m.opts.BatchSize {
+						flush()
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package modules
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/jobs"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrDuplicate = errors.New("modules: duplicate module")
+	ErrNotRanged = errors.New("modules: module loaded after start must declare MsgRange")
+)
+
+// Router 模块注册路由与中间件的入口，Server、命名空间与路由分组都满足该接口
+type Router interface {
+	AddRouter(msgID uint32, router iface.Router)
+	Handle(msgID uint32, fn interface{})
+	Use(middlewares ...iface.Middleware)
+}
+
+// Module 游戏功能模块，如聊天、邮件、商城，由Loader按加载顺序初始化与启动，按逆序停止
+type Module interface {
+	Name() string              // 模块名称，同一Loader内不允许重复
+	Init(s iface.Server) error // 初始化模块，读取配置并创建依赖，返回错误时停止加载
+	Routes(r Router)           // 注册模块的路由与中间件
+	OnStart() error            // Server启动监听入口之前调用，服务运行中加载时立即调用
+	OnStop()                   // Server停止时调用
+}
+
+// Ranged 声明MsgID区间的模块，路由与中间件注册在该区间的路由分组中，中间件只对本模块的消息生效
+type Ranged interface {
+	MsgRange() (start, end uint32)
+}
+
+// Job 模块的定时任务，Spec为cron表达式或@every间隔
+type Job struct {
+	Spec string
+	Fn   jobs.Func
+}
+
+// Scheduled 声明定时任务的模块，任务在Loader的调度器中执行
+type Scheduled interface {
+	Jobs() []Job
+}
+
+// registry 通过Register注册的模块
+var (
+	registry     []Module
+	registryLock sync.Mutex
+)
+
+// Register 注册模块，一般在模块包的init中调用，由Loader.LoadRegistered统一加载
+func Register(m Module) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	registry = append(registry, m)
+}
+
+// Registered 已注册的全部模块，按注册顺序
+func Registered() []Module {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+	return append([]Module(nil), registry...)
+}
+
+// Loader 模块加载器，创建时挂载到Server：OnStart随Server的OnStart Hook函数调用，OnStop随Server停止调用
+type Loader struct {
+	server    iface.Server
+	scheduler *jobs.Scheduler
+	modules   []Module
+	names     map[string]struct{}
+	started   bool
+	lock      sync.Mutex
+}
+
+// NewLoader 创建挂载到Server的模块加载器，模块的定时任务在jobs.Default中执行，scheduler不为nil时使用scheduler
+func NewLoader(s iface.Server, scheduler *jobs.Scheduler) *Loader {
+	if scheduler == nil {
+		scheduler = jobs.Default
+	}
+	l := &Loader{
+		server:    s,
+		scheduler: scheduler,
+		names:     make(map[string]struct{}),
+	}
+	s.AddOnStart(l.start)
+	s.AddOnStop(l.stop)
+	return l
+}
+
+// LoadRegistered 按注册顺序加载通过Register注册的全部模块
+func (l *Loader) LoadRegistered() error {
+	return l.Load(Registered()...)
+}
+
+// Load 依次加载模块：初始化、注册路由与定时任务，服务运行中加载时立即调用OnStart；
+// 任一模块失败时返回错误并撤销该模块已挂载的路由分组与已注册的定时任务，之前的模块保持加载；
+// 未声明MsgRange的模块直接注册在Server上的路由无法撤销
+func (l *Loader) Load(mods ...Module) error {
+	for _, m := range mods {
+		if err := l.load(m); err != nil {
+			return fmt.Errorf("load module %s: %w", m.Name(), err)
+		}
+	}
+	return nil
+}
+
+func (l *Loader) load(m Module) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	var (
+		group  iface.RouterGroup
+		jobIDs []uint32
+	)
+	// 加载失败时撤销已注册的定时任务与路由分组，修复后可以重新加载同名模块
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, id := range jobIDs {
+			l.scheduler.Remove(id)
+		}
+		if group != nil {
+			l.server.RemoveGroup(group)
+		}
+	}()
+	// 路由重复或分组区间重叠时panic，服务运行中加载插件时不应使进程退出
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("modules: %v", r)
+		}
+	}()
+	if _, ok := l.names[m.Name()]; ok {
+		return ErrDuplicate
+	}
+	ranged, isRanged := m.(Ranged)
+	// 服务运行中只能挂载新的路由分组，Server的路由表不支持并发注册
+	if l.started && !isRanged {
+		return ErrNotRanged
+	}
+	if err = m.Init(l.server); err != nil {
+		return err
+	}
+	if isRanged {
+		group = l.server.Group(ranged.MsgRange())
+		m.Routes(group)
+	} else {
+		m.Routes(l.server)
+	}
+	if sm, ok := m.(Scheduled); ok {
+		for _, job := range sm.Jobs() {
+			id, err := l.scheduler.Register(job.Spec, job.Fn)
+			if err != nil {
+				return err
+			}
+			jobIDs = append(jobIDs, id)
+		}
+	}
+	if l.started {
+		if err = m.OnStart(); err != nil {
+			return err
+		}
+	}
+	l.names[m.Name()] = struct{}{}
+	l.modules = append(l.modules, m)
+	zap.S().Info("[MODULE] loaded ", m.Name())
+	return nil
+}
+
+// Modules 已加载的全部模块，按加载顺序
+func (l *Loader) Modules() []Module {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return append([]Module(nil), l.modules...)
+}
+
+// start 依次调用已加载模块的OnStart并启动调度器
+func (l *Loader) start() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, m := range l.modules {
+		if err := m.OnStart(); err != nil {
+			return fmt.Errorf("start module %s: %w", m.Name(), err)
+		}
+	}
+	l.started = true
+	l.scheduler.Attach(l.server)
+	return nil
+}
+
+// stop 按加载的逆序调用模块的OnStop
+func (l *Loader) stop() {
+	l.lock.Lock()
+	mods := l.modules
+	l.lock.Unlock()
+	for i := len(mods) - 1; i >= 0; i-- {
+		mods[i].OnStop()
+	}
+}
@@ -0,0 +1,33 @@
+package modules
+
+import (
+	"errors"
+	"plugin"
+)
+
+// PluginSymbol Go插件中创建模块的导出函数名，签名为 func NewModule() modules.Module
+const PluginSymbol = "NewModule"
+
+var ErrPluginSymbol = errors.New("modules: plugin symbol NewModule is not func() modules.Module")
+
+// LoadPlugin 打开以 go build -buildmode=plugin 编译的.so文件并加载其中的模块，服务运行中加载的模块需实现Ranged；
+// 插件与主程序需使用相同的Go版本与依赖版本编译，插件加载后无法卸载
+func (l *Loader) LoadPlugin(path string) (Module, error) {
+	p, err := plugin.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	sym, err := p.Lookup(PluginSymbol)
+	if err != nil {
+		return nil, err
+	}
+	newModule, ok := sym.(func() Module)
+	if !ok {
+		return nil, ErrPluginSymbol
+	}
+	m := newModule()
+	if err := l.Load(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -0,0 +1,63 @@
+package netw
+
+import (
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// ErrCodeUnauthed 未鉴权连接发送不允许的MsgID时回复的错误码
+const ErrCodeUnauthed int32 = 4
+
+// containsMsgID msgIDs中是否包含msgID
+func containsMsgID(msgIDs []uint32, msgID uint32) bool {
+	for _, id := range msgIDs {
+		if id == msgID {
+			return true
+		}
+	}
+	return false
+}
+
+// authWhitelisted MsgID是否允许未鉴权的连接路由
+func authWhitelisted(cfg *iface.Config, msgID uint32) bool {
+	return containsMsgID(cfg.AuthWhitelist, msgID)
+}
+
+// authMiddleware 鉴权中间件，未设置Authenticator时直接放行；
+// 未鉴权连接只路由AuthWhitelist中的消息，AuthMsgIDs中的消息鉴权成功后路由，其它消息回复ErrCodeUnauthed后丢弃
+func (s *Server) authMiddleware(next iface.HandlerFunc) iface.HandlerFunc {
+	return func(request iface.Request) {
+		conn := request.GetConnection()
+		if s.authenticator == nil || conn.IsAuthenticated() || authWhitelisted(s.conf(), request.GetMsgID()) {
+			next(request)
+			return
+		}
+		if !containsMsgID(s.conf().AuthMsgIDs, request.GetMsgID()) {
+			request.Logger().Info("reject unauthenticated msgID = ", request.GetMsgID())
+			recordDrop(conn, iface.DropFiltered, 1)
+			_ = request.ReplyError(ErrCodeUnauthed, ErrorMessage(ErrCodeUnauthed))
+			return
+		}
+		uid, err := s.authenticator.AuthMessage(request)
+		if err != nil {
+			request.Logger().Warn("auth failed err = ", err)
+			s.CallOnAuth(conn, "", err)
+			setCloseReason(conn, err)
+			conn.Stop()
+			return
+		}
+		if s.banList.IsBanned(BanUIDKey(uid)) {
+			zap.S().Info("banned uid reject ", uid)
+			s.CallOnAuth(conn, uid, ErrBanned)
+			setCloseReason(conn, ErrBanned)
+			conn.Stop()
+			return
+		}
+		if err := conn.SetAuthenticated(uid); err != nil {
+			stopWithReason(conn, s.conf().DuplicateLoginMsgID, RejectedReason)
+			return
+		}
+		next(request)
+	}
+}
@@ -0,0 +1,82 @@
+package netw
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/metrics"
+)
+
+// backpressurePollInterval 暂停读取期间检查负载的间隔
+const backpressurePollInterval = 10 * time.Millisecond
+
+// 流控消息内容，以FlowControlMsgID下发
+const (
+	flowResume byte = 0
+	flowPause  byte = 1
+)
+
+// QueueLoad 连接对应worker任务队列的占用比例，开启FairDispatch时为连接自身排队任务的占用比例，未开启工作池时为0
+func (mh *MsgHandle) QueueLoad(connID int64) float64 {
+	workers := atomic.LoadUint32(&mh.activeWorkers)
+	if mh.conf().WorkerPoolSize == 0 || workers == 0 {
+		return 0
+	}
+	if mh.pool.fair != nil {
+		return mh.pool.fair[mh.workerOf(connID, workers)].connLoad(connID)
+	}
+	queue := mh.TaskQueue[mh.workerOf(connID, workers)]
+	if cap(queue) == 0 {
+		return 0
+	}
+	return float64(len(queue)) / float64(cap(queue))
+}
+
+// load 连接的处理压力，取目标worker任务队列与发送缓冲占用比例的较大值
+func (c *Connection) load() float64 {
+	load := c.MsgHandler.QueueLoad(c.ConnID)
+	if n := cap(c.msgBuffChan); n > 0 {
+		if buff := float64(len(c.msgBuffChan)) / float64(n); buff > load {
+			load = buff
+		}
+	}
+	return load
+}
+
+// waitBackpressure 负载达到BackpressureHigh时暂停读取，直到降到BackpressureLow以下，
+// 暂停期间客户端的数据积压在TCP窗口中；连接关闭时返回false
+func (c *Connection) waitBackpressure() bool {
+	high := c.conf().BackpressureHigh
+	if high <= 0 || c.load() < high {
+		return true
+	}
+	low := c.conf().BackpressureLow
+	if low <= 0 || low > high {
+		low = high / 2
+	}
+	metrics.BackpressurePaused()
+	c.Logger().Debug("backpressure pause reading load = ", c.load())
+	c.flowControl(flowPause)
+	ticker := time.NewTicker(backpressurePollInterval)
+	defer ticker.Stop()
+	for c.load() > low {
+		select {
+		case <-c.ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	c.Logger().Debug("backpressure resume reading")
+	c.flowControl(flowResume)
+	return true
+}
+
+// flowControl 配置FlowControlMsgID时通知客户端暂停或恢复发送
+func (c *Connection) flowControl(state byte) {
+	if c.conf().FlowControlMsgID == 0 {
+		return
+	}
+	if err := c.SendMsg(c.conf().FlowControlMsgID, []byte{state}); err != nil {
+		c.Logger().Debug("send flow control error ", err)
+	}
+}
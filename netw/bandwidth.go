@@ -0,0 +1,45 @@
+package netw
+
+import (
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// newBandwidthBucket 按字节计数的令牌桶，未配置Burst时允许突发1秒的流量
+func newBandwidthBucket(c clock.Clock, rate iface.Rate) *TokenBucket {
+	if rate.Rate <= 0 {
+		return nil
+	}
+	burst := rate.Burst
+	if burst <= 0 {
+		burst = int(rate.Rate)
+	}
+	return newTokenBucket(c, rate.Rate, burst)
+}
+
+// throttle 写出size字节前预定连接与全局带宽令牌，wait为true时等待到令牌足够；
+// 每个写goroutine每次只预定一帧，Server的带宽按帧在连接之间轮流分配，单个连接无法独占
+func (c *Connection) throttle(size int, wait bool) {
+	var delay time.Duration
+	for _, bucket := range [...]*TokenBucket{c.bandwidth, c.serverBandwidth} {
+		if bucket == nil {
+			continue
+		}
+		if d := bucket.ReserveN(float64(size)); d > delay {
+			delay = d
+		}
+	}
+	if delay <= 0 || !wait {
+		return
+	}
+	metrics.BandwidthThrottled(delay)
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-c.ctx.Done():
+	}
+}
@@ -0,0 +1,62 @@
+package netw
+
+import (
+	"sync"
+	"time"
+)
+
+// BanIPKey IP在封禁名单中的Key
+func BanIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// BanUIDKey 用户ID在封禁名单中的Key
+func BanUIDKey(uid string) string {
+	return "uid:" + uid
+}
+
+// MemoryBanList 内存封禁名单
+type MemoryBanList struct {
+	bans map[string]time.Time // 封禁Key对应的过期时间，零值为永久
+	lock sync.RWMutex
+}
+
+// NewMemoryBanList 创建内存封禁名单
+func NewMemoryBanList() *MemoryBanList {
+	return &MemoryBanList{
+		bans: make(map[string]time.Time),
+	}
+}
+
+// Ban 封禁，ttl<=0为永久封禁
+func (b *MemoryBanList) Ban(key string, ttl time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var expire time.Time
+	if ttl > 0 {
+		expire = time.Now().Add(ttl)
+	}
+	b.bans[key] = expire
+}
+
+// Unban 解除封禁
+func (b *MemoryBanList) Unban(key string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	delete(b.bans, key)
+}
+
+// IsBanned 是否处于封禁中，过期的封禁会被删除
+func (b *MemoryBanList) IsBanned(key string) bool {
+	b.lock.RLock()
+	expire, ok := b.bans[key]
+	b.lock.RUnlock()
+	if !ok {
+		return false
+	}
+	if expire.IsZero() || time.Now().Before(expire) {
+		return true
+	}
+	b.Unban(key)
+	return false
+}
@@ -0,0 +1,63 @@
+package netw
+
+import (
+	"io"
+	"sync"
+)
+
+const (
+	// minBufferSize 缓冲池中缓冲的初始容量
+	minBufferSize = 512
+	// maxPooledBufferSize 超过该容量的缓冲不放回缓冲池，避免长期占用大块内存
+	maxPooledBufferSize = 64 * 1024
+)
+
+// bufferPool 封包、拆包与写goroutine共用的[]byte缓冲池
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, minBufferSize)
+		return &b
+	},
+}
+
+// GetBuffer 从缓冲池获取长度为size的[]byte，使用完后调用PutBuffer归还
+func GetBuffer(size int) []byte {
+	bp := bufferPool.Get().(*[]byte)
+	if cap(*bp) < size {
+		bufferPool.Put(bp)
+		return make([]byte, size)
+	}
+	return (*bp)[:size]
+}
+
+// PutBuffer 归还缓冲，归还后不能再访问b
+func PutBuffer(b []byte) {
+	if cap(b) < minBufferSize || cap(b) > maxPooledBufferSize {
+		return
+	}
+	b = b[:0]
+	bufferPool.Put(&b)
+}
+
+// readBuffer 将r全部读入缓冲池获取的缓冲
+func readBuffer(r io.Reader) ([]byte, error) {
+	buf := GetBuffer(0)
+	for {
+		if len(buf) == cap(buf) {
+			// 扩容，旧缓冲归还缓冲池
+			grown := GetBuffer(2 * cap(buf))[:len(buf)]
+			copy(grown, buf)
+			PutBuffer(buf)
+			buf = grown
+		}
+		n, err := r.Read(buf[len(buf):cap(buf)])
+		buf = buf[:len(buf)+n]
+		if err == io.EOF {
+			return buf, nil
+		}
+		if err != nil {
+			PutBuffer(buf)
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package netw
+
+import (
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// Options 以代码构建Server，在创建之前校验配置，嵌入其它应用时不需要了解配置的必填字段：
+//
+//	s, err := netw.NewOptions().
+//		WithWorkerPool(8, 256).
+//		WithHeartbeat(iface.HeartbeatPingPong, 30*time.Second, 0).
+//		WithCodec(codec.NewJSONCodec()).
+//		Build()
+//
+// 配置文件是配置的一种来源，LoadConfig读取后以OptionsFromConfig继续设置；
+// 配置只属于Build创建的Server，通过Server.GetConfig读取，不影响SetConfig设置的配置与其它Server
+type Options struct {
+	config  *iface.Config
+	options []Option
+}
+
+// NewOptions 以DefaultConfig为基础构建
+func NewOptions() *Options {
+	return &Options{config: DefaultConfig()}
+}
+
+// OptionsFromConfig 以已有配置为基础构建，如LoadConfig读取的配置文件，不修改c
+func OptionsFromConfig(c *iface.Config) *Options {
+	cfg := *c
+	return &Options{config: &cfg}
+}
+
+// WithWorkerPool 设置工作池的worker数量与每个worker任务队列的最大长度，size为0时在读goroutine中处理消息
+func (o *Options) WithWorkerPool(size, taskLen uint32) *Options {
+	o.config.WorkerPoolSize = size
+	o.config.MaxWorkerTaskLen = taskLen
+	return o
+}
+
+// WithElasticWorkerPool 开启弹性工作池，worker数量在[min, max]之间伸缩
+func (o *Options) WithElasticWorkerPool(min, max uint32) *Options {
+	o.config.WorkerPoolSize = min
+	o.config.MaxWorkerPoolSize = max
+	return o
+}
+
+// WithHeartbeat 设置心跳方式与超时时间，interval为服务端发送Ping帧的间隔，0为超时时间的一半；不足1秒的部分向上取整
+func (o *Options) WithHeartbeat(mode iface.HeartbeatMode, timeout, interval time.Duration) *Options {
+	o.config.HeartbeatMode = mode
+	o.config.PingTime = ceilSeconds(timeout)
+	o.config.PingInterval = ceilSeconds(interval)
+	return o
+}
+
+// WithMessageType 设置默认的websocket帧类型，websocket.TextMessage或websocket.BinaryMessage
+func (o *Options) WithMessageType(messageType int) *Options {
+	o.config.MessageType = messageType
+	return o
+}
+
+// WithMaxConn 设置最大连接数，0为不限制
+func (o *Options) WithMaxConn(max int) *Options {
+	o.config.MaxConn = max
+	return o
+}
+
+// WithListener 添加ListenAndServe与Run启动的监听入口
+func (o *Options) WithListener(l iface.Listener) *Options {
+	o.config.Listeners = append(o.config.Listeners, l)
+	return o
+}
+
+// WithCodec 设置消息内容编解码器，默认使用Protobuf
+func (o *Options) WithCodec(c iface.Codec) *Options {
+	return o.With(WithCodec(c))
+}
+
+// WithPacket 设置封包拆包格式
+func (o *Options) WithPacket(pack iface.Packet) *Options {
+	return o.With(WithPacket(pack))
+}
+
+// Configure 设置其它配置字段
+func (o *Options) Configure(fn func(c *iface.Config)) *Options {
+	fn(o.config)
+	return o
+}
+
+// With 追加创建Server时的Option
+func (o *Options) With(options ...Option) *Options {
+	o.options = append(o.options, options...)
+	return o
+}
+
+// Config 当前构建的配置
+func (o *Options) Config() *iface.Config {
+	return o.config
+}
+
+// Validate 校验当前构建的配置
+func (o *Options) Validate() error {
+	return ValidateConfig(o.config)
+}
+
+// Build 校验配置后创建Server，配置不合法时返回ErrInvalidConfig
+func (o *Options) Build() (iface.Server, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := *o.config
+	return newServer(&cfg, o.options...), nil
+}
+
+// ceilSeconds 以秒为单位向上取整
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,66 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// CallReqIDFlag 服务端发起Call的请求ID最高位为1，与客户端发起的请求ID区分
+const CallReqIDFlag uint64 = 1 << 63
+
+// ErrConnClosed 连接已关闭
+var ErrConnClosed = errors.New("connection closed")
+
+// Call 向客户端发送请求并等待带相同请求ID的响应，resp为nil时忽略响应内容
+func (c *Connection) Call(ctx context.Context, msgID uint32, req interface{}, resp interface{}) error {
+	data, err := c.Codec().Marshal(req)
+	if err != nil {
+		return err
+	}
+	reqID := atomic.AddUint64(&c.callSeq, 1) | CallReqIDFlag
+	ch := make(chan []byte, 1)
+	c.callLock.Lock()
+	if c.calls == nil {
+		c.calls = make(map[uint64]chan []byte)
+	}
+	c.calls[reqID] = ch
+	c.callLock.Unlock()
+	defer func() {
+		c.callLock.Lock()
+		delete(c.calls, reqID)
+		c.callLock.Unlock()
+	}()
+	if err := c.SendReqMsg(reqID, msgID, data); err != nil {
+		return err
+	}
+	select {
+	case data := <-ch:
+		if resp == nil {
+			return nil
+		}
+		return c.Codec().Unmarshal(data, resp)
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.ctx.Done():
+		return ErrConnClosed
+	}
+}
+
+// deliverCall 将客户端响应交给等待中的Call，Call已超时返回时丢弃
+func (c *Connection) deliverCall(reqID uint64, data []byte) {
+	c.callLock.Lock()
+	ch, ok := c.calls[reqID]
+	c.callLock.Unlock()
+	if !ok {
+		c.Logger().Debug("drop late call response reqID = ", reqID)
+		return
+	}
+	// 读缓冲会被复用，需要复制
+	resp := make([]byte, len(data))
+	copy(resp, data)
+	select {
+	case ch <- resp:
+	default:
+	}
+}
@@ -0,0 +1,222 @@
+package netw
+
+import (
+	"context"
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrChannelOverflow 逻辑通道的排队已满
+var ErrChannelOverflow = errors.New("netw: channel backlog overflow")
+
+// channel 连接内的逻辑通道，入站与出站各自排队
+type channel struct {
+	id  uint8
+	cfg iface.ChannelConfig
+	in  chan *Request
+	out chan []byte
+}
+
+// msgChannel 包头未携带通道ID时MsgID映射的通道
+func msgChannel(cfg *iface.Config, msgID uint32) uint8 {
+	return cfg.MsgChannel[msgID]
+}
+
+// getChannel 获取或创建逻辑通道，0号通道与Channels中未配置的通道返回nil
+func (c *Connection) getChannel(id uint8) *channel {
+	if id == 0 {
+		return nil
+	}
+	cfg, ok := c.conf().Channels[id]
+	if !ok {
+		return nil
+	}
+	c.chanLock.Lock()
+	defer c.chanLock.Unlock()
+	if ch, ok := c.channels[id]; ok {
+		return ch
+	}
+	backlog := cfg.Backlog
+	if backlog <= 0 {
+		backlog = maxMsgChanLen(c.conf())
+	}
+	ch := &channel{
+		id:  id,
+		cfg: cfg,
+		in:  make(chan *Request, backlog),
+		out: make(chan []byte, backlog),
+	}
+	if c.channels == nil {
+		c.channels = make(map[uint8]*channel)
+	}
+	c.channels[id] = ch
+	c.chanOrder = append(c.chanOrder, ch)
+	c.Go(func(ctx context.Context) {
+		c.serveChannel(ctx, ch)
+	})
+	return ch
+}
+
+// serveChannel 按到达顺序处理通道内的入站消息，连接关闭时回收排队中的请求
+func (c *Connection) serveChannel(ctx context.Context, ch *channel) {
+	for {
+		select {
+		case req := <-ch.in:
+			c.MsgHandler.DoMsgHandler(req)
+		case <-ctx.Done():
+			for {
+				select {
+				case req := <-ch.in:
+					req.release()
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// dispatchChannel 将请求交给所属逻辑通道，返回false时请求不属于任何已配置的通道，按原有方式处理
+func (c *Connection) dispatchChannel(req *Request) bool {
+	id := req.msg.GetChannel()
+	if id == 0 {
+		id = msgChannel(c.conf(), req.GetMsgID())
+		req.msg.SetChannel(id)
+	}
+	ch := c.getChannel(id)
+	if ch == nil {
+		return false
+	}
+	select {
+	case ch.in <- req:
+		return true
+	default:
+	}
+	switch ch.cfg.Overflow {
+	case iface.OverflowDropOldest:
+		select {
+		case old := <-ch.in:
+			old.release()
+		default:
+		}
+		select {
+		case ch.in <- req:
+		default:
+			req.release()
+		}
+	case iface.OverflowClose:
+		req.release()
+		c.Logger().Warn("channel inbound overflow, close conn channel = ", id)
+		c.setCloseReason(ErrChannelOverflow)
+		c.Stop()
+	default:
+		req.release()
+	}
+	c.drop(iface.DropChannelOverflow, 1)
+	return true
+}
+
+// queueChannel 将封包后的消息交给逻辑通道排队写出，排队已满时按通道的Overflow处理
+func (c *Connection) queueChannel(ch *channel, data []byte) error {
+	select {
+	case ch.out <- data:
+		c.signalChannels()
+		return nil
+	default:
+	}
+	c.drop(iface.DropChannelOverflow, 1)
+	switch ch.cfg.Overflow {
+	case iface.OverflowDropOldest:
+		select {
+		case old := <-ch.out:
+			PutBuffer(old)
+		default:
+		}
+		select {
+		case ch.out <- data:
+			c.signalChannels()
+			return nil
+		default:
+		}
+	case iface.OverflowClose:
+		c.Logger().Warn("channel outbound overflow, close conn channel = ", ch.id)
+		c.setCloseReason(ErrChannelOverflow)
+		c.Stop()
+	}
+	PutBuffer(data)
+	return ErrChannelOverflow
+}
+
+// signalChannels 通知写goroutine有通道消息待写出
+func (c *Connection) signalChannels() {
+	select {
+	case c.chanReady <- struct{}{}:
+	default:
+	}
+}
+
+// writeChannels 在写goroutine中让每个通道轮流写出一条消息，仍有积压时再次通知，
+// 期间写goroutine可以处理其它消息，积压的通道不会独占写goroutine
+func (c *Connection) writeChannels() error {
+	c.chanLock.Lock()
+	chans := c.chanOrder
+	c.chanLock.Unlock()
+	pending := false
+	for _, ch := range chans {
+		select {
+		case data := <-ch.out:
+			if err := c.writeBatch([][]byte{data}); err != nil {
+				c.drop(iface.DropWrite, 1)
+				return err
+			}
+			pending = pending || len(ch.out) > 0
+		default:
+		}
+	}
+	if pending {
+		c.signalChannels()
+	}
+	return nil
+}
+
+// drainChannels 连接关闭时归还通道中排队的出站消息，返回归还的数量
+func (c *Connection) drainChannels() int {
+	c.chanLock.Lock()
+	chans := c.chanOrder
+	c.chanLock.Unlock()
+	n := 0
+	for _, ch := range chans {
+		for len(ch.out) > 0 {
+			PutBuffer(<-ch.out)
+			n++
+		}
+	}
+	return n
+}
+
+// SendChannelMsg 以逻辑通道发送消息，reqID为0时不带请求ID；Channels中配置的通道独立排队，
+// 其余通道与SendReqMsg相同直接发送，包头携带通道ID
+func (c *Connection) SendChannelMsg(channel uint8, reqID uint64, msgID uint32, data []byte) error {
+	c.RLock()
+	if c.isClosed {
+		c.RUnlock()
+		return errors.New("connection closed when send channel msg")
+	}
+	c.RUnlock()
+	unlock := c.lockSend()
+	defer unlock()
+	msg, err := c.packFrame(c.GetMessageType(), channel, msgID, reqID, data)
+	if err != nil {
+		return c.packError(msgID, err)
+	}
+	if ch := c.getChannel(channel); ch != nil {
+		return c.queueChannel(ch, msg)
+	}
+	return c.sendFrame(frame{messageType: c.GetMessageType(), data: msg})
+}
+
+// GetChannel 获取请求所属的逻辑通道ID
+func (r *Request) GetChannel() uint8 {
+	return r.msg.GetChannel()
+}
@@ -0,0 +1,115 @@
+package netw
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// chaosHeld 重排时暂存的一帧，之后的一帧写出或交给拆包后再处理
+type chaosHeld struct {
+	messageType int
+	data        []byte
+}
+
+// chaosDelay 按规则计算本条消息的延迟
+func chaosDelay(rule iface.ChaosRule) time.Duration {
+	delay := time.Millisecond * time.Duration(rule.Delay)
+	if rule.Jitter > 0 {
+		delay += time.Millisecond * time.Duration(rand.Intn(rule.Jitter+1))
+	}
+	return delay
+}
+
+func chance(p float64) bool {
+	return p > 0 && rand.Float64() < p
+}
+
+// SetChaos 设置连接的网络故障注入，零值时关闭，已暂存的重排消息随下一条消息处理
+func (c *Connection) SetChaos(chaos iface.Chaos) {
+	c.chaos.Store(chaos)
+}
+
+// GetChaos 获取连接的网络故障注入
+func (c *Connection) GetChaos() iface.Chaos {
+	chaos, _ := c.chaos.Load().(iface.Chaos)
+	return chaos
+}
+
+// initChaos 按ChaosRatio对新连接注入Chaos
+func (c *Connection) initChaos() {
+	if !c.conf().Chaos.Enabled() {
+		return
+	}
+	if c.conf().ChaosRatio > 0 && rand.Float64() >= c.conf().ChaosRatio {
+		return
+	}
+	c.SetChaos(c.conf().Chaos)
+	c.Logger().Info("chaos injected ", fmt.Sprintf("%+v", c.conf().Chaos))
+}
+
+// chaosSleep 等待d，连接关闭时返回false
+func (c *Connection) chaosSleep(d time.Duration) bool {
+	if d <= 0 {
+		return true
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// chaosRead 在读goroutine中对读取的一帧注入故障：按概率丢弃、延迟后交给拆包，
+// 按概率暂存一帧，在下一帧之后交给拆包；丢弃或暂存时返回nil，读取下一帧
+func (c *Connection) chaosRead(t int, data []byte) ([]byte, error) {
+	rule := c.GetChaos().Read
+	if chance(rule.Drop) {
+		metrics.ChaosInjected("read", "drop")
+		PutBuffer(data)
+		return nil, nil
+	}
+	if !c.chaosSleep(chaosDelay(rule)) {
+		PutBuffer(data)
+		return nil, c.ctx.Err()
+	}
+	if c.readHeld == nil && chance(rule.Reorder) {
+		metrics.ChaosInjected("read", "reorder")
+		c.readHeld = &chaosHeld{messageType: t, data: data}
+		return nil, nil
+	}
+	c.readReady, c.readHeld = c.readHeld, nil
+	return data, nil
+}
+
+// chaosWrite 在写goroutine中对写出的消息注入故障：按概率丢弃、延迟后写出，
+// 按概率暂存一帧，在下一帧之后写出；调用方在返回后归还data，暂存时复制
+func (c *Connection) chaosWrite(messageType int, data []byte) error {
+	rule := c.GetChaos().Write
+	if chance(rule.Drop) {
+		metrics.ChaosInjected("write", "drop")
+		return nil
+	}
+	if !c.chaosSleep(chaosDelay(rule)) {
+		return c.ctx.Err()
+	}
+	if c.writeHeld == nil && chance(rule.Reorder) {
+		metrics.ChaosInjected("write", "reorder")
+		c.writeHeld = &chaosHeld{messageType: messageType, data: append([]byte(nil), data...)}
+		return nil
+	}
+	if err := c.writeFrame(messageType, data); err != nil {
+		return err
+	}
+	if held := c.writeHeld; held != nil {
+		c.writeHeld = nil
+		return c.writeFrame(held.messageType, held.data)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package netw
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// LocaleQueryKey 握手时声明客户端语言的URL参数名，如 /ws?locale=zh-CN，未声明时取Accept-Language的第一个语言
+	LocaleQueryKey = "locale"
+	// PlatformQueryKey 握手时声明客户端平台的URL参数名，如 /ws?platform=ios，未声明时取PlatformHeader请求头
+	PlatformQueryKey = "platform"
+	// ClientVersionQueryKey 握手时声明客户端版本的URL参数名，如 /ws?app_version=1.4.2，未声明时取ClientVersionHeader请求头
+	ClientVersionQueryKey = "app_version"
+	PlatformHeader        = "X-Client-Platform"
+	ClientVersionHeader   = "X-Client-Version"
+
+	// 握手时记录客户端信息的连接属性，值为string
+	LocaleProperty        = "client.locale"
+	PlatformProperty      = "client.platform"
+	ClientVersionProperty = "client.version"
+)
+
+// UpgradeNotice 客户端版本过旧时以ClientVersionGate的msgID下发的JSON消息
+type UpgradeNotice struct {
+	Platform   string `json:"platform"`
+	Version    string `json:"version"`
+	MinVersion string `json:"min_version"`
+}
+
+// captureClientInfo 将握手请求中的客户端语言、平台与版本记录到连接属性
+func captureClientInfo(r *http.Request, conn iface.Connection) {
+	query := r.URL.Query()
+	locale := query.Get(LocaleQueryKey)
+	if locale == "" {
+		locale = primaryLanguage(r.Header.Get("Accept-Language"))
+	}
+	platform := query.Get(PlatformQueryKey)
+	if platform == "" {
+		platform = r.Header.Get(PlatformHeader)
+	}
+	version := query.Get(ClientVersionQueryKey)
+	if version == "" {
+		version = r.Header.Get(ClientVersionHeader)
+	}
+	if locale != "" {
+		conn.SetProperty(LocaleProperty, locale)
+	}
+	if platform != "" {
+		conn.SetProperty(PlatformProperty, strings.ToLower(platform))
+	}
+	if version != "" {
+		conn.SetProperty(ClientVersionProperty, version)
+	}
+}
+
+// primaryLanguage Accept-Language中的第一个语言，如 "zh-CN,zh;q=0.9" 为 zh-CN
+func primaryLanguage(accept string) string {
+	if i := strings.IndexByte(accept, ','); i >= 0 {
+		accept = accept[:i]
+	}
+	if i := strings.IndexByte(accept, ';'); i >= 0 {
+		accept = accept[:i]
+	}
+	accept = strings.TrimSpace(accept)
+	if accept == "*" {
+		return ""
+	}
+	return accept
+}
+
+// stringProperty 获取string类型的连接属性，不存在时为空
+func stringProperty(conn iface.Connection, key string) string {
+	value, err := conn.GetProperty(key)
+	if err != nil {
+		return ""
+	}
+	s, _ := value.(string)
+	return s
+}
+
+// Locale 连接握手时声明的客户端语言
+func Locale(conn iface.Connection) string {
+	return stringProperty(conn, LocaleProperty)
+}
+
+// Platform 连接握手时声明的客户端平台，小写
+func Platform(conn iface.Connection) string {
+	return stringProperty(conn, PlatformProperty)
+}
+
+// ClientVersion 连接握手时声明的客户端版本
+func ClientVersion(conn iface.Connection) string {
+	return stringProperty(conn, ClientVersionProperty)
+}
+
+// Locale 请求连接的客户端语言
+func (c *Context) Locale() string {
+	return Locale(c.GetConnection())
+}
+
+// Platform 请求连接的客户端平台
+func (c *Context) Platform() string {
+	return Platform(c.GetConnection())
+}
+
+// ClientVersion 请求连接的客户端版本
+func (c *Context) ClientVersion() string {
+	return ClientVersion(c.GetConnection())
+}
+
+// CompareVersion 比较以点分隔的版本号，a小于、等于、大于b时分别返回-1、0、1；
+// 每段只比较开头的数字，如 1.4.2-beta 视为 1.4.2，缺少的段视为0
+func CompareVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x = leadingNumber(as[i])
+		}
+		if i < len(bs) {
+			y = leadingNumber(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func leadingNumber(s string) int {
+	end := 0
+	for end < len(s) && s[end] >= '0' && s[end] <= '9' {
+		end++
+	}
+	n, _ := strconv.Atoi(s[:end])
+	return n
+}
+
+// ClientVersionGate 拒绝过旧客户端的中间件，minVersions为各平台允许的最低版本，键为空字符串时作用于其它平台；
+// 版本过旧或未声明版本的连接收到msgID的UpgradeNotice后断开，msgID为0时直接断开
+func ClientVersionGate(minVersions map[string]string, msgID uint32) iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			conn := request.GetConnection()
+			platform := Platform(conn)
+			min, ok := minVersions[platform]
+			if !ok {
+				min, ok = minVersions[""]
+			}
+			version := ClientVersion(conn)
+			if !ok || (version != "" && CompareVersion(version, min) >= 0) {
+				next(request)
+				return
+			}
+			zap.S().Info("outdated client reject ConnID = ", conn.GetConnID(), " platform = ", platform, " version = ", version)
+			if msgID == 0 {
+				conn.Stop()
+				return
+			}
+			data, _ := json.Marshal(UpgradeNotice{Platform: platform, Version: version, MinVersion: min})
+			conn.StopWithMsg(msgID, data)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package netw
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+// closeFrameTimeout 写出关闭帧的超时时间
+const closeFrameTimeout = 100 * time.Millisecond
+
+// CloseCodes 关闭原因对应的websocket关闭码，连接停止时以该关闭码向客户端发送关闭帧，
+// 未列出的原因以1006记录在Stats中且不发送关闭帧，可在服务启动前追加自定义的关闭原因
+var CloseCodes = map[error]int{
+	ErrConnClosed:       websocket.CloseNormalClosure,
+	ErrServerStopped:    websocket.CloseGoingAway,
+	ErrKicked:           websocket.ClosePolicyViolation,
+	ErrBanned:           websocket.ClosePolicyViolation,
+	ErrDuplicateLogin:   websocket.ClosePolicyViolation,
+	ErrQuotaExceeded:    websocket.ClosePolicyViolation,
+	ErrHeartbeatTimeout: websocket.ClosePolicyViolation,
+	ErrLifecycleTimeout: websocket.ClosePolicyViolation,
+	ErrReadTimeout:      websocket.ClosePolicyViolation,
+	ErrFrameType:        websocket.CloseUnsupportedData,
+	ErrCipherRequired:   websocket.ClosePolicyViolation,
+	ErrPacketTooLarge:   websocket.CloseMessageTooBig,
+	ErrSendOverflow:     websocket.CloseTryAgainLater,
+	ErrChannelOverflow:  websocket.CloseTryAgainLater,
+}
+
+// closeTimeout Close等待客户端回复关闭帧的时间
+func closeTimeout(cfg *iface.Config) time.Duration {
+	if cfg.CloseTimeout <= 0 {
+		return time.Second
+	}
+	return time.Millisecond * time.Duration(cfg.CloseTimeout)
+}
+
+// closeStatus 关闭原因对应的关闭码与原因，客户端发起或Close指定的关闭帧原样返回
+func closeStatus(reason error) (int, string) {
+	var ce *websocket.CloseError
+	if errors.As(reason, &ce) {
+		return ce.Code, ce.Text
+	}
+	if reason == websocket.ErrReadLimit {
+		return websocket.CloseMessageTooBig, reason.Error()
+	}
+	if code, ok := CloseCodes[reason]; ok {
+		return code, reason.Error()
+	}
+	for err, code := range CloseCodes {
+		if errors.Is(reason, err) {
+			return code, reason.Error()
+		}
+	}
+	return websocket.CloseAbnormalClosure, reason.Error()
+}
+
+// Close 在排队中的消息之后发送关闭帧，收到客户端回复的关闭帧或超过CloseTimeout后停止连接，
+// 关闭码与原因作为关闭原因传给OnClose Hook函数，并记录在Stats中；只排队关闭帧，不等待连接停止
+func (c *Connection) Close(code int, reason string) error {
+	c.RLock()
+	if c.isClosed {
+		c.RUnlock()
+		return ErrConnClosed
+	}
+	c.RUnlock()
+	c.setCloseReason(&websocket.CloseError{Code: code, Text: reason})
+	timer := time.AfterFunc(closeTimeout(c.conf()), c.Stop)
+	select {
+	case c.msgChan <- frame{messageType: websocket.CloseMessage, data: websocket.FormatCloseMessage(code, reason)}:
+		return nil
+	case <-c.ctx.Done():
+		timer.Stop()
+		return ErrConnClosed
+	}
+}
+
+// writeClose 在写goroutine中写出关闭帧，之后只丢弃待发送的消息，直到连接停止
+func (c *Connection) writeClose(data []byte) {
+	atomic.StoreInt32(&c.closeSent, 1)
+	if err := c.Conn.WriteControl(websocket.CloseMessage, data, time.Now().Add(closeFrameTimeout)); err != nil {
+		c.Logger().Debug("write close frame error ", err)
+		c.Stop()
+		return
+	}
+	for {
+		select {
+		case f := <-c.msgChan:
+			if f.data != nil && f.messageType != websocket.CloseMessage {
+				PutBuffer(f.data)
+				c.drop(iface.DropWrite, 1)
+			}
+		case data := <-c.msgBuffChan:
+			PutBuffer(data)
+			c.drop(iface.DropWrite, 1)
+		case <-c.chanReady:
+			c.drop(iface.DropWrite, c.drainChannels())
+		case <-c.ctx.Done():
+			return
+		}
+	}
+}
+
+// sendCloseFrame 停止连接前按关闭原因发送关闭帧，已发送过关闭帧或原因为1006时不发送；
+// 客户端发起的关闭帧已由websocket库回复，再次写出只返回错误
+func (c *Connection) sendCloseFrame(reason error) {
+	code, text := closeStatus(reason)
+	if code == websocket.CloseAbnormalClosure || !atomic.CompareAndSwapInt32(&c.closeSent, 0, 1) {
+		return
+	}
+	_ = c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(closeFrameTimeout))
+}
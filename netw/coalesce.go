@@ -0,0 +1,63 @@
+package netw
+
+import (
+	"sync/atomic"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// coalescedInputs 被同一连接更新的消息替换而丢弃的消息数量
+var coalescedInputs uint64
+
+// CoalescedInputs 因CoalesceMsgIDs被替换丢弃的消息累计数量
+func CoalescedInputs() uint64 {
+	return atomic.LoadUint64(&coalescedInputs)
+}
+
+// coalesceMsgID 是否为只处理最新一条的MsgID
+func coalesceMsgID(cfg *iface.Config, msgID uint32) bool {
+	for _, id := range cfg.CoalesceMsgIDs {
+		if id == msgID {
+			return true
+		}
+	}
+	return false
+}
+
+// coalesce 同一连接同一MsgID已有排队中尚未开始处理的消息时，将新消息换入排队中的请求并丢弃旧消息，
+// 返回true表示新消息已合并，无需再投递
+func (c *Connection) coalesce(req *Request) bool {
+	if len(c.conf().CoalesceMsgIDs) == 0 || !coalesceMsgID(c.conf(), req.GetMsgID()) {
+		return false
+	}
+	msgID := req.GetMsgID()
+	c.coalesceLock.Lock()
+	pending := c.pendingInputs[msgID]
+	if pending == nil {
+		if c.pendingInputs == nil {
+			c.pendingInputs = make(map[uint32]*Request)
+		}
+		req.coalesced = true
+		c.pendingInputs[msgID] = req
+		c.coalesceLock.Unlock()
+		return false
+	}
+	pending.msg, req.msg = req.msg, pending.msg
+	pending.buf, req.buf = req.buf, pending.buf
+	c.coalesceLock.Unlock()
+	// 归还被替换的旧消息
+	req.release()
+	atomic.AddUint64(&coalescedInputs, 1)
+	metrics.InputCoalesced()
+	return true
+}
+
+// claimCoalesced 开始处理时移出排队中的请求，之后到达的消息重新投递
+func (c *Connection) claimCoalesced(req *Request) {
+	c.coalesceLock.Lock()
+	if c.pendingInputs[req.GetMsgID()] == req {
+		delete(c.pendingInputs, req.GetMsgID())
+	}
+	c.coalesceLock.Unlock()
+}
@@ -1,12 +1,78 @@
 package netw
 
-import "github.com/xiaomingping/game/iface"
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/timerwheel"
+)
 
 var (
-	config  *iface.Config
+	// config SetConfig设置的配置，之后创建的Server以它为初始配置
+	config atomic.Value // *iface.Config
+	// clk SetClock设置的时钟，之后创建的Server默认使用它
+	clk clock.Clock = clock.Real
 )
 
-func SetConfig(c *iface.Config)  {
-	config = c
+// SetConfig 设置之后由NewServer创建的Server使用的配置，已创建的Server不受影响，运行中更新使用Server.ReloadConfig
+func SetConfig(c *iface.Config) {
+	config.Store(c)
+}
+
+// sharedConfig SetConfig设置的配置，未调用时为nil
+func sharedConfig() *iface.Config {
+	c, _ := config.Load().(*iface.Config)
+	return c
+}
+
+// SetClock 设置之后创建的Server默认使用的时钟，单个Server可用WithClock指定；
+// 测试中传入clock.Fake，心跳超时等逻辑通过Advance推进而无需真实等待
+func SetClock(c clock.Clock) {
+	clk = c
+}
+
+// configOf Server的配置，s为nil时使用SetConfig设置的配置
+func configOf(s iface.Server) *iface.Config {
+	if s != nil {
+		if c := s.GetConfig(); c != nil {
+			return c
+		}
+	}
+	return sharedConfig()
+}
+
+// clockOf Server的时钟，s为nil时使用SetClock设置的时钟
+func clockOf(s iface.Server) clock.Clock {
+	if s != nil {
+		return s.Clock()
+	}
+	return clk
 }
 
+// GetConfig 获取当前配置，热更新时整体替换，不能修改返回值
+func (s *Server) GetConfig() *iface.Config {
+	c, _ := s.config.Load().(*iface.Config)
+	return c
+}
+
+// conf 同GetConfig
+func (s *Server) conf() *iface.Config {
+	return s.GetConfig()
+}
+
+// Clock 心跳、时间轮、限流与重试使用的时钟
+func (s *Server) Clock() clock.Clock {
+	return s.clock
+}
+
+// TimerWheel 心跳检测、延迟发送与周期任务共用的时间轮，Stop时停止
+func (s *Server) TimerWheel() *timerwheel.TimerWheel {
+	return s.timers
+}
+
+// newTimerWheel 创建Server的时间轮
+func newTimerWheel(c clock.Clock) *timerwheel.TimerWheel {
+	return timerwheel.NewWithClock(c, 10*time.Millisecond, 256)
+}
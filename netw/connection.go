@@ -2,13 +2,18 @@ package netw
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
-	"github.com/xiaomingping/ztimer"
 	"net"
+	"runtime/pprof"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+	"github.com/xiaomingping/game/timerwheel"
 
 	"go.uber.org/zap"
 
@@ -27,12 +32,22 @@ type Connection struct {
 	MsgHandler iface.MsgHandle
 	// 用户上次心跳时间
 	Heartbeat bool
+	// 最后一次收到心跳的时间
+	heartbeatTime time.Time
+	// 连接建立时间
+	startTime time.Time
 	// 告知该链接已经退出/停止的channel
 	ctx context.Context
 
 	cancel context.CancelFunc
 	//缓冲管道，用于写goroutine之间的消息通信
-	msgChan chan []byte
+	msgChan chan frame
+	//有缓冲管道，用于读、写两个goroutine之间的消息通信
+	msgBuffChan chan []byte
+	//因缓冲溢出被丢弃的消息数量
+	dropCount uint64
+	//连续慢写次数
+	slowWrites int
 	sync.RWMutex
 	//链接属性
 	property map[string]interface{}
@@ -40,37 +55,186 @@ type Connection struct {
 	propertyLock sync.Mutex
 	// 当前连接的关闭状态
 	isClosed bool
+	// 是否已调用Start，1为已启动
+	started int32
+	// 当前连接协商的编解码器，为空时使用帧类型对应的编解码器或Server的编解码器
+	codec iface.Codec
+	// 出站消息的websocket帧类型，0为全局MessageType
+	messageType int32
+	// 最后一条客户端消息的序号，开启InboundSeqCheck时校验递增
+	inboundSeq uint64
+	// 是否已通过鉴权
+	authenticated bool
+	// 鉴权后绑定的用户ID
+	uid string
+	// 下一条出站消息的序号
+	seq uint64
+	// 已发送未被客户端确认的消息
+	unacked []iface.OutboundMsg
+	// 保护seq与unacked的锁
+	ackLock sync.Mutex
+	// 开启ACK时串行化封包与排队，先分配序号的消息先进入发送队列
+	sendLock sync.Mutex
+	// 携带连接信息的日志
+	logger *zap.SugaredLogger
+	// 保护codec、鉴权信息与logger的锁，OnConnStop Hook中也可安全读取
+	infoLock sync.RWMutex
+	// 密钥交换后的加密器，为nil时不加密
+	cipher iface.Cipher
+	// 服务端发起Call的请求ID流水号
+	callSeq uint64
+	// 等待客户端响应的Call
+	calls map[uint64]chan []byte
+	// 保护calls的锁
+	callLock sync.Mutex
+	// 连接出站带宽令牌桶，为nil时不限制
+	bandwidth *TokenBucket
+	// 所属Server的出站带宽令牌桶，为nil时不限制
+	serverBandwidth *TokenBucket
+	// 最后一次收到消息的时间(UnixNano)
+	lastActive int64
+	// 连接的生命周期定时器，关闭时全部取消
+	timers *timerwheel.Group
+	// 连接所属监听入口的标签
+	listenerTag string
+	// 客户端真实地址，为nil时使用socket的远程地址
+	remoteAddr net.Addr
+	// 握手时协商的协议版本
+	protocolVersion uint32
+	// 连接所属的命名空间，未使用命名空间时为nil
+	namespace *Namespace
+	// 收发统计
+	msgsIn    uint64
+	msgsOut   uint64
+	bytesIn   uint64
+	bytesOut  uint64
+	lastMsgID uint32
+	errCount  uint64
+	// 连接关闭的原因，只记录第一次
+	closeReason error
+	// c.Go启动的goroutine，goClosed后不再启动
+	goroutines map[*connGoroutine]struct{}
+	goClosed   bool
+	goExited   chan struct{}
+	goLock     sync.Mutex
+	// CoalesceMsgIDs中排队等待处理的请求
+	pendingInputs map[uint32]*Request
+	coalesceLock  sync.Mutex
+	// 入站配额的累计值，只在读goroutine中访问
+	quota    quotaCounter
+	msgQuota map[uint32]*quotaCounter
+	// 网络故障注入(iface.Chaos)与重排时暂存的帧，暂存的帧只在读写goroutine中访问
+	chaos     atomic.Value
+	readHeld  *chaosHeld
+	readReady *chaosHeld
+	writeHeld *chaosHeld
+	// 等待回复的往返延迟探测的发送时间(UnixNano)，平滑后的往返延迟与偏差(纳秒)
+	rttProbe int64
+	srtt     int64
+	rttvar   int64
+	// 逻辑通道，chanOrder为创建顺序，写goroutine按该顺序轮流写出
+	channels  map[uint8]*channel
+	chanOrder []*channel
+	chanLock  sync.Mutex
+	chanReady chan struct{}
+	closeSent int32 // 是否已发送关闭帧
+	// 各原因丢失的消息数与告警窗口
+	drops connDrops
 }
 
 // NewConnection 创建连接的方法
 func NewConnection(s iface.Server, conn *websocket.Conn, connID int64, msgHandler iface.MsgHandle) *Connection {
+	cfg := configOf(s)
 	// 初始化Conn属性
 	c := &Connection{
-		Server:     s,
-		Conn:       conn,
-		ConnID:     connID,
-		isClosed:   false,
-		MsgHandler: msgHandler,
-		Heartbeat:  false,
-		msgChan:    make(chan []byte, 1),
-		property:   nil,
+		Server:      s,
+		Conn:        conn,
+		ConnID:      connID,
+		isClosed:    false,
+		MsgHandler:  msgHandler,
+		Heartbeat:   false,
+		startTime:   clockOf(s).Now(),
+		msgChan:     make(chan frame, 1),
+		msgBuffChan: make(chan []byte, maxMsgChanLen(cfg)),
+		chanReady:   make(chan struct{}, 1),
+		property:    nil,
+		bandwidth:   newBandwidthBucket(clockOf(s), cfg.ConnBandwidth),
+		timers:      s.TimerWheel().NewGroup(),
 	}
+	c.logger = zap.S().With("connID", connID, "remoteAddr", conn.RemoteAddr().String())
+	c.goExited = make(chan struct{}, 1)
+	// ctx在创建时生成，启动前被拒绝或关闭的连接同样可以安全Stop
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	// 限制单个websocket消息的最大长度，超出时读取失败并断开连接
+	if limit := readLimit(cfg); limit > 0 {
+		conn.SetReadLimit(int64(limit))
+	}
+	// 出站消息压缩
+	conn.EnableWriteCompression(cfg.EnableCompression)
+	if cfg.EnableCompression && cfg.CompressionLevel != 0 {
+		if err := conn.SetCompressionLevel(cfg.CompressionLevel); err != nil {
+			c.logger.Warn("set compression level error ", err)
+		}
+	}
+	c.initChaos()
 	// 将新创建的Conn添加到链接管理中
 	c.Server.GetConnMgr().Add(c)
 	c.IsHeartbeatTimeout()
+	if usePingPong(cfg) {
+		c.startPingPong()
+	} else if cfg.RTTMsgID != 0 {
+		c.scheduleRTTProbe()
+	}
 	return c
 }
 
 // StartWriter 写消息Goroutine， 用户将数据发送给客户端
 func (c *Connection) StartWriter() {
-	zap.S().Debug("start [Writer Goroutine is running]")
-	defer zap.S().Debug(c.RemoteAddr().String(), "[conn Writer exit!]")
+	c.Logger().Debug("start [Writer Goroutine is running]")
+	// 设置pprof标签，便于在goroutine dump中定位连接的读写goroutine
+	pprof.SetGoroutineLabels(pprof.WithLabels(c.ctx, c.pprofLabels("writer")))
+	defer c.Logger().Debug("[conn Writer exit!]")
+	defer c.drain()
 	for {
 		select {
-		case data := <-c.msgChan:
-			// 有数据要写给客户端
-			if err := c.Conn.WriteMessage(config.MessageType, data); err != nil {
-				zap.S().Error("Send Data error:, ", err, " Conn Writer exit")
+		case f := <-c.msgChan:
+			// Close发出的关闭帧，之前的消息已写完
+			if f.messageType == websocket.CloseMessage {
+				c.writeClose(f.data)
+				return
+			}
+			// 空帧为StopWithMsg发出的关闭信号，之前的消息已写完
+			if f.data == nil {
+				c.Stop()
+				return
+			}
+			// 有数据要写给客户端，写完后归还缓冲，不等待带宽令牌
+			c.throttle(len(f.data), false)
+			err := c.writeMessage(f.messageType, f.data)
+			PutBuffer(f.data)
+			if err != nil {
+				c.drop(iface.DropWrite, 1)
+				c.Logger().Error("Send Data error:, ", err, " Conn Writer exit")
+				c.setCloseReason(err)
+				c.Stop()
+				return
+			}
+		case data := <-c.msgBuffChan:
+			// 有缓冲数据要写给客户端，开启写合并时与排队中的消息合并为一帧
+			batch := c.collectBatch(data)
+			if err := c.writeBatch(batch); err != nil {
+				c.drop(iface.DropWrite, len(batch))
+				c.Logger().Error("Send Buff Data error:, ", err, " Conn Writer exit")
+				c.setCloseReason(err)
+				c.Stop()
+				return
+			}
+		case <-c.chanReady:
+			// 逻辑通道的消息，每个通道轮流写出一条
+			if err := c.writeChannels(); err != nil {
+				c.Logger().Error("Send Channel Data error:, ", err, " Conn Writer exit")
+				c.setCloseReason(err)
+				c.Stop()
 				return
 			}
 		case <-c.ctx.Done():
@@ -79,42 +243,280 @@ func (c *Connection) StartWriter() {
 	}
 }
 
+// pprofLabels 读写goroutine的pprof标签
+func (c *Connection) pprofLabels(role string) pprof.LabelSet {
+	return pprof.Labels("conn_id", strconv.FormatInt(c.ConnID, 10), "role", role)
+}
+
+// collectBatch 以first开始收集一批待合并的缓冲消息
+func (c *Connection) collectBatch(first []byte) [][]byte {
+	batch := [][]byte{first}
+	if c.conf().WriteBatchSize <= 1 || c.conf().BatchMsgID == 0 {
+		return batch
+	}
+	var timeout <-chan time.Time
+	if c.conf().WriteBatchDelay > 0 {
+		timer := time.NewTimer(time.Millisecond * time.Duration(c.conf().WriteBatchDelay))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	for len(batch) < c.conf().WriteBatchSize {
+		select {
+		case data := <-c.msgBuffChan:
+			batch = append(batch, data)
+			continue
+		default:
+		}
+		if timeout == nil {
+			break
+		}
+		select {
+		case data := <-c.msgBuffChan:
+			batch = append(batch, data)
+		case <-timeout:
+			return batch
+		case <-c.ctx.Done():
+			return batch
+		}
+	}
+	return batch
+}
+
+// writeBatch 写出一批消息，多于一条时合并为一个BatchMsgID帧，写完后归还缓冲
+func (c *Connection) writeBatch(batch [][]byte) error {
+	if len(batch) == 1 {
+		c.throttle(len(batch[0]), true)
+		err := c.writeMessage(c.GetMessageType(), batch[0])
+		PutBuffer(batch[0])
+		return err
+	}
+	size := 0
+	for _, data := range batch {
+		size += 4 + len(data)
+	}
+	payload := GetBuffer(size)
+	offset := 0
+	for _, data := range batch {
+		binary.LittleEndian.PutUint32(payload[offset:], uint32(len(data)))
+		offset += 4
+		offset += copy(payload[offset:], data)
+		PutBuffer(data)
+	}
+	packed, err := c.packet(c.GetMessageType()).Pack(NewMsgPackage(c.conf().BatchMsgID, payload))
+	PutBuffer(payload)
+	if err != nil {
+		return err
+	}
+	c.throttle(len(packed), true)
+	err = c.writeMessage(c.GetMessageType(), packed)
+	PutBuffer(packed)
+	return err
+}
+
+// writeMessage 写出一条消息，开启网络故障注入时先注入故障
+func (c *Connection) writeMessage(messageType int, data []byte) error {
+	if c.GetChaos().Write.Enabled() || c.writeHeld != nil {
+		return c.chaosWrite(messageType, data)
+	}
+	return c.writeFrame(messageType, data)
+}
+
+// writeFrame 带写超时的发送，写超时一次或连续慢写达到MaxSlowWrites次时返回错误
+func (c *Connection) writeFrame(messageType int, data []byte) error {
+	if c.conf().WriteDeadline > 0 {
+		deadline := time.Millisecond * time.Duration(c.conf().WriteDeadline)
+		if err := c.Conn.SetWriteDeadline(time.Now().Add(deadline)); err != nil {
+			return err
+		}
+	}
+	c.Server.CallOnSend(c, data)
+	start := time.Now()
+	if err := c.Conn.WriteMessage(messageType, data); err != nil {
+		return err
+	}
+	metrics.BytesSent(len(data))
+	atomic.AddUint64(&c.bytesOut, uint64(len(data)))
+	if c.conf().SlowWriteThreshold <= 0 || c.conf().MaxSlowWrites <= 0 {
+		return nil
+	}
+	// 统计连续慢写次数，只在写goroutine中访问
+	if time.Since(start) > time.Millisecond*time.Duration(c.conf().SlowWriteThreshold) {
+		c.slowWrites++
+		if c.slowWrites >= c.conf().MaxSlowWrites {
+			return errors.New("slow client evicted")
+		}
+	} else {
+		c.slowWrites = 0
+	}
+	return nil
+}
+
 // StartReader 读消息Goroutine，用于从客户端中读取数据
 func (c *Connection) StartReader() {
-	zap.S().Debug("start [Reader Goroutine is running]")
-	defer zap.S().Debug(c.RemoteAddr().String(), "[conn Reader exit!]")
+	c.Logger().Debug("start [Reader Goroutine is running]")
+	pprof.SetGoroutineLabels(pprof.WithLabels(c.ctx, c.pprofLabels("reader")))
+	defer pprof.SetGoroutineLabels(context.Background())
+	defer c.Logger().Debug("[conn Reader exit!]")
 	// 创建拆包解包的对象
 	for {
 		select {
 		case <-c.ctx.Done():
 			return
 		default:
-			// 读取客户端的Msg
-			t, msgData, err := c.Conn.ReadMessage()
+			// 处理不过来时暂停读取
+			if !c.waitBackpressure() {
+				return
+			}
+			// 读取客户端的Msg，缓冲在消息处理完成后归还
+			t, msgData, err := c.readMessage()
 			if err != nil {
+				if err == websocket.ErrReadLimit {
+					c.Logger().Warn("oversized frame, read limit = ", readLimit(c.conf()))
+					c.Server.CallOnOversizedPacket(c, readLimit(c.conf())+1)
+				} else if isTimeout(err) {
+					c.Logger().Info("read timeout, slow or idle client")
+					err = ErrReadTimeout
+				}
+				c.setCloseReason(err)
 				goto Wrr
 			}
-			if t != config.MessageType {
+			if !c.acceptFrame(t) {
+				PutBuffer(msgData)
+				c.setCloseReason(ErrFrameType)
 				c.Stop()
 				continue
 			}
+			if c.conf().MaxPacketSize > 0 && len(msgData) > c.conf().MaxPacketSize {
+				c.Logger().Warn("oversized packet size = ", len(msgData))
+				c.Server.CallOnOversizedPacket(c, len(msgData))
+				PutBuffer(msgData)
+				c.setCloseReason(ErrPacketTooLarge)
+				goto Wrr
+			}
+			// 拆包之前的原始数据包过滤
+			if err := c.Server.CallOnReceiveRaw(c, msgData); err != nil {
+				c.AddError()
+				c.drop(iface.DropFiltered, 1)
+				c.Logger().Warn("raw packet dropped ", err)
+				PutBuffer(msgData)
+				continue
+			}
 			// 拆包，得到msgID 和 data 放在msg中
-			msg, err := c.Server.Packet().Unpack(msgData)
+			msg, err := c.packet(t).Unpack(msgData)
 			if err != nil {
-				zap.S().Error("unpack error ", err)
+				c.AddError()
+				c.drop(iface.DropUnpack, 1)
+				c.Logger().Error("unpack error ", err)
+				if errors.Is(err, ErrPacketTooLarge) {
+					c.Server.CallOnOversizedPacket(c, len(msgData))
+				}
+				PutBuffer(msgData)
+				c.setCloseReason(err)
+				goto Wrr
+			}
+			metrics.MessageIn(msg.GetMsgID(), len(msgData))
+			if c.namespace != nil {
+				metrics.NamespaceMessageIn(c.namespace.name)
+			}
+			c.touch()
+			atomic.AddUint64(&c.msgsIn, 1)
+			atomic.AddUint64(&c.bytesIn, uint64(len(msgData)))
+			atomic.StoreUint32(&c.lastMsgID, msg.GetMsgID())
+			// 入站配额，超过断开阈值时断开连接
+			if !c.checkQuota(msg.GetMsgID(), len(msgData)) {
+				PutBuffer(msgData)
+				c.setCloseReason(ErrQuotaExceeded)
+				goto Wrr
+			}
+			// 密钥交换消息，不进入路由
+			if c.conf().KeyExchangeMsgID != 0 && msg.GetMsgID() == c.conf().KeyExchangeMsgID {
+				err := c.keyExchange(msg.GetData())
+				PutBuffer(msgData)
+				if err != nil {
+					c.Logger().Warn("key exchange error ", err)
+					c.setCloseReason(err)
+					goto Wrr
+				}
+				continue
+			}
+			// 已完成密钥交换的连接解密消息内容
+			cipher := c.GetCipher()
+			if cipher == nil && c.conf().RequireCipher && c.conf().KeyExchangeMsgID != 0 {
+				c.AddError()
+				c.drop(iface.DropFiltered, 1)
+				c.Logger().Warn("msg before key exchange msgID = ", msg.GetMsgID())
+				PutBuffer(msgData)
+				c.setCloseReason(ErrCipherRequired)
+				goto Wrr
+			}
+			if err := checkEncrypted(c.packet(t), msg, cipher != nil); err != nil {
+				c.AddError()
+				c.drop(iface.DropUnpack, 1)
+				c.Logger().Warn("encryption mismatch msgID = ", msg.GetMsgID())
+				PutBuffer(msgData)
+				c.setCloseReason(err)
 				goto Wrr
 			}
+			if cipher != nil {
+				plain, err := open(cipher, msg)
+				if err != nil {
+					c.AddError()
+					c.drop(iface.DropUnpack, 1)
+					c.Logger().Warn("decrypt error ", err)
+					PutBuffer(msgData)
+					c.setCloseReason(err)
+					goto Wrr
+				}
+				msg.SetData(plain)
+			}
+			// 重放保护，丢弃序号未递增的消息
+			if !c.checkInboundSeq(msg.GetSeq()) {
+				c.AddError()
+				c.drop(iface.DropFiltered, 1)
+				c.Logger().Warn("replayed msg dropped msgID = ", msg.GetMsgID(), " seq = ", msg.GetSeq())
+				PutBuffer(msgData)
+				continue
+			}
+			// 客户端确认已收到的消息序号，不进入路由
+			if c.conf().EnableAck && msg.GetMsgID() == c.conf().AckMsgID {
+				if len(msg.GetData()) >= 8 {
+					c.Ack(binary.LittleEndian.Uint64(msg.GetData()))
+				}
+				PutBuffer(msgData)
+				continue
+			}
+			// 客户端回复的往返延迟探测，同时记为心跳
+			if c.conf().RTTMsgID != 0 && msg.GetMsgID() == c.conf().RTTMsgID {
+				c.observeRTT(msg.GetData())
+				c.SetPing()
+				PutBuffer(msgData)
+				continue
+			}
+			// 客户端对服务端Call的响应，交给等待中的调用方
+			if msg.GetReqID()&CallReqIDFlag != 0 {
+				c.deliverCall(msg.GetReqID(), msg.GetData())
+				PutBuffer(msgData)
+				continue
+			}
 			// 得到当前客户端请求的Request数据
-			req := Request{
-				conn: c,
-				msg:  msg,
+			req := newPoolRequest(c, msg, msgData)
+			// 已有排队中的同类消息时合并，只处理最新一条
+			if c.coalesce(req) {
+				continue
 			}
-			if config.WorkerPoolSize > 0 {
+			// 属于已配置逻辑通道的消息在通道的goroutine中按顺序处理
+			if c.dispatchChannel(req) {
+				continue
+			}
+			if c.conf().WorkerPoolSize > 0 {
 				// 已经启动工作池机制，将消息交给Worker处理
-				c.MsgHandler.SendMsgToTaskQueue(&req)
+				c.MsgHandler.SendMsgToTaskQueue(req)
+			} else if c.conf().OrderedDispatch {
+				// 保证消息顺序，在读goroutine中同步处理
+				c.MsgHandler.DoMsgHandler(req)
 			} else {
 				// 从绑定好的消息和对应的处理方法中执行对应的Handle方法
-				go c.MsgHandler.DoMsgHandler(&req)
+				go c.MsgHandler.DoMsgHandler(req)
 			}
 		}
 	}
@@ -122,40 +524,129 @@ Wrr:
 	c.Stop()
 }
 
+// readMessage 读取一条消息，开启网络故障注入时先注入故障
+func (c *Connection) readMessage() (int, []byte, error) {
+	for {
+		if held := c.readReady; held != nil {
+			c.readReady = nil
+			return held.messageType, held.data, nil
+		}
+		t, data, err := c.readFrame()
+		if err != nil || (!c.GetChaos().Read.Enabled() && c.readHeld == nil) {
+			return t, data, err
+		}
+		if data, err = c.chaosRead(t, data); data != nil || err != nil {
+			return t, data, err
+		}
+	}
+}
+
+// readFrame 读取一条websocket消息到缓冲池获取的缓冲中
+func (c *Connection) readFrame() (int, []byte, error) {
+	if err := c.extendReadDeadline(); err != nil {
+		return 0, nil, err
+	}
+	t, r, err := c.Conn.NextReader()
+	if err != nil {
+		return t, nil, err
+	}
+	data, err := readBuffer(r)
+	return t, data, err
+}
+
 // 启动连接，让当前连接开始工作
 func (c *Connection) Start() {
-	c.ctx, c.cancel = context.WithCancel(context.Background())
+	atomic.StoreInt32(&c.started, 1)
 	// 1 开启用于写回客户端数据流程的Goroutine
 	go c.StartWriter()
-	// 按照用户传递进来的创建连接时需要处理的业务，执行钩子方法
-	c.Server.CallOnConnStart(c)
+	// 按照用户传递进来的创建连接时需要处理的业务，执行钩子方法，返回错误时拒绝连接
+	if err := c.Server.CallOnConnStart(c); err != nil {
+		c.Logger().Info("conn rejected ", err)
+		if c.conf().ConnRejectMsgID != 0 {
+			c.StopWithMsg(c.conf().ConnRejectMsgID, []byte(err.Error()))
+		} else {
+			c.Stop()
+		}
+		return
+	}
+	c.startLifecycleTimers()
+	if uid := c.GetUID(); uid != "" {
+		go c.flushOffline(uid)
+	}
 	// 2 开启用户从客户端读取数据流程的Goroutine
 	c.StartReader()
 
 }
 
-// 停止连接，结束当前连接状态M
+// 停止连接，结束当前连接状态M，之后等待c.Go启动的goroutine退出
 func (c *Connection) Stop() {
+	if c.stop() {
+		c.waitGoroutines()
+	}
+}
+
+// stop 关闭连接，返回是否由本次调用关闭；只有第一次调用执行清理，
+// Hook函数在锁外调用，其中可以安全调用连接的方法，发送消息会返回错误
+func (c *Connection) stop() bool {
 	c.Lock()
-	defer c.Unlock()
-	// 如果用户注册了该链接的关闭回调业务，那么在此刻应该显示调用
-	c.Server.CallOnConnStop(c)
 	// 如果当前链接已经关闭
 	if c.isClosed == true {
-		return
+		c.Unlock()
+		return false
 	}
+	// 设置标志位，之后的发送直接返回错误
+	c.isClosed = true
+	c.Unlock()
 
-	zap.S().Debug("Conn Stop()...ConnID = ", c.ConnID)
-	// 关闭Writer
+	c.Logger().Debug("Conn Stop()...ConnID = ", c.ConnID)
+	// 如果用户注册了该链接的关闭回调业务，那么在此刻应该显示调用
+	c.Server.CallOnConnStop(c)
+	metrics.ConnClosed()
+	if c.namespace != nil {
+		c.namespace.connClosed()
+	}
+	// 取消生命周期定时器
+	c.timers.CancelAll()
+	// 关闭Writer，管道不关闭，写goroutine退出前归还排队中的缓冲，并发的发送方通过ctx返回
 	c.cancel()
-	// 关闭socket链接
+	// 关闭socket链接，之前按关闭原因发送关闭帧
+	c.sendCloseFrame(c.getCloseReason())
 	c.Conn.Close()
-	// 关闭该链接全部管道
-	close(c.msgChan)
-	// 设置标志位
-	c.isClosed = true
 	// 将链接从连接管理器中删除
 	c.Server.GetConnMgr().Remove(c)
+	c.Server.CallOnClose(c, c.getCloseReason())
+	return true
+}
+
+// sendFrame 将封包后的消息交给写goroutine，连接关闭时归还缓冲并返回ErrConnClosed
+func (c *Connection) sendFrame(f frame) error {
+	select {
+	case c.msgChan <- f:
+		return nil
+	case <-c.ctx.Done():
+		PutBuffer(f.data)
+		return ErrConnClosed
+	}
+}
+
+// drain 写goroutine退出时归还排队中未写出的缓冲，计入丢失的消息
+func (c *Connection) drain() {
+	n := 0
+	for {
+		select {
+		case f := <-c.msgChan:
+			if f.data != nil && f.messageType != websocket.CloseMessage {
+				PutBuffer(f.data)
+				n++
+			}
+		case data := <-c.msgBuffChan:
+			PutBuffer(data)
+			n++
+		default:
+			c.drop(iface.DropWrite, n+c.drainChannels())
+			return
+		}
+	}
 }
 
 // 返回ctx，用于用户自定义的go程获取连接退出状态
@@ -173,30 +664,461 @@ func (c *Connection) GetConnID() int64 {
 	return c.ConnID
 }
 
+// 获取连接所属的Server
+func (c *Connection) GetServer() iface.Server {
+	return c.Server
+}
+
+// conf 连接所属Server的配置
+func (c *Connection) conf() *iface.Config {
+	return configOf(c.Server)
+}
+
+// 获取连接所属监听入口的标签，通过Serve建立的连接为空
+func (c *Connection) GetListenerTag() string {
+	return c.listenerTag
+}
+
 // 获取远程客户端地址信息
 func (c *Connection) RemoteAddr() net.Addr {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
 	return c.Conn.RemoteAddr()
 }
 
 // 直接将Message数据发送数据给远程的客户端
 func (c *Connection) SendMsg(msgID uint32, data []byte) error {
+	return c.SendReqMsg(0, msgID, data)
+}
+
+// 发送带请求ID的消息，用于回复客户端请求或发起Call
+func (c *Connection) SendReqMsg(reqID uint64, msgID uint32, data []byte) error {
 	c.RLock()
 	if c.isClosed == true {
+		c.RUnlock()
 		return errors.New("connection closed when send msg")
 	}
 	c.RUnlock()
+	unlock := c.lockSend()
+	defer unlock()
 	// 将data封包，并且发送
-	dp := c.Server.Packet()
-	msg, err := dp.Pack(NewMsgPackage(msgID, data))
+	msg, err := c.pack(msgID, reqID, data)
 	if err != nil {
-		zap.S().Error("pack error msg ID = ", msgID)
-		return errors.New("pack error msg ")
+		return c.packError(msgID, err)
 	}
 	// 写回客户端
-	c.msgChan <- msg
+	return c.sendFrame(frame{messageType: c.GetMessageType(), data: msg})
+}
+
+// 发送最后一条消息后关闭连接，超时未发送完成时直接关闭
+func (c *Connection) StopWithMsg(msgID uint32, data []byte) {
+	// 写goroutine阻塞时发送同样会阻塞，先开始计时，超时后Stop使发送返回
+	timer := time.AfterFunc(stopWithMsgTimeout, c.Stop)
+	if err := c.SendMsg(msgID, data); err != nil {
+		timer.Stop()
+		c.Stop()
+		return
+	}
+	select {
+	case c.msgChan <- frame{}:
+	case <-c.ctx.Done():
+		timer.Stop()
+	}
+}
+
+// 使用编解码器序列化后发送给远程的客户端
+func (c *Connection) SendObj(msgID uint32, v interface{}) error {
+	data, err := c.Codec().Marshal(v)
+	if err != nil {
+		c.Logger().Error("marshal error msg ID = ", msgID, " err = ", err)
+		return err
+	}
+	return c.SendMsg(msgID, data)
+}
+
+// 获取当前连接使用的编解码器
+func (c *Connection) Codec() iface.Codec {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	if c.codec != nil {
+		return c.codec
+	}
+	if t := c.GetMessageType(); t != c.conf().MessageType {
+		if f := c.Server.FrameFormat(t); f != nil && f.Codec != nil {
+			return f.Codec
+		}
+	}
+	return c.Server.Codec()
+}
+
+// 设置当前连接使用的编解码器，可在首条协商消息的处理方法中调用
+func (c *Connection) SetCodec(codec iface.Codec) {
+	c.infoLock.Lock()
+	c.codec = codec
+	c.infoLock.Unlock()
+}
+
+// 带缓冲发送消息，缓冲已满时等待SendBuffTimeout，超时后按OverflowPolicy处理
+func (c *Connection) SendBuffMsg(msgID uint32, data []byte) error {
+	c.RLock()
+	if c.isClosed == true {
+		c.RUnlock()
+		return errors.New("connection closed when send buff msg")
+	}
+	c.RUnlock()
+	unlock := c.lockSend()
+	defer unlock()
+	// 将data封包，并且发送
+	msg, err := c.pack(msgID, 0, data)
+	if err != nil {
+		return c.packError(msgID, err)
+	}
+	// 属于已配置逻辑通道的消息在通道内排队
+	if ch := c.getChannel(msgChannel(c.conf(), msgID)); ch != nil {
+		return c.queueChannel(ch, msg)
+	}
+	// 缓冲未满直接发送
+	select {
+	case c.msgBuffChan <- msg:
+		return nil
+	default:
+	}
+	// 缓冲已满，等待写goroutine消费
+	timer := time.NewTimer(time.Millisecond * time.Duration(c.conf().SendBuffTimeout))
+	defer timer.Stop()
+	select {
+	case c.msgBuffChan <- msg:
+		return nil
+	case <-c.ctx.Done():
+		PutBuffer(msg)
+		return errors.New("connection closed when send buff msg")
+	case <-timer.C:
+	}
+	switch c.conf().OverflowPolicy {
+	case iface.OverflowDropOldest:
+		// 丢弃缓冲中最旧的一条消息，再尝试放入当前消息
+		select {
+		case dropped := <-c.msgBuffChan:
+			PutBuffer(dropped)
+			c.drop(iface.DropSendOverflow, 1)
+		default:
+		}
+		select {
+		case c.msgBuffChan <- msg:
+			return nil
+		default:
+			c.drop(iface.DropSendOverflow, 1)
+			return errors.New("send buff msg overflow, msg dropped")
+		}
+	case iface.OverflowClose:
+		c.drop(iface.DropSendOverflow, 1)
+		c.Logger().Warn("send buff msg overflow, close conn ConnID = ", c.ConnID)
+		c.setCloseReason(ErrSendOverflow)
+		c.Stop()
+		return errors.New("send buff msg overflow, connection closed")
+	default:
+		c.drop(iface.DropSendOverflow, 1)
+		return errors.New("send buff msg overflow, msg dropped")
+	}
+}
+
+// 获取连接收发统计
+func (c *Connection) Stats() iface.ConnStats {
+	stats := iface.ConnStats{
+		MsgsIn:     atomic.LoadUint64(&c.msgsIn),
+		MsgsOut:    atomic.LoadUint64(&c.msgsOut),
+		BytesIn:    atomic.LoadUint64(&c.bytesIn),
+		BytesOut:   atomic.LoadUint64(&c.bytesOut),
+		LastMsgID:  atomic.LoadUint32(&c.lastMsgID),
+		LastActive: time.Unix(0, atomic.LoadInt64(&c.lastActive)),
+		CreatedAt:  c.startTime,
+		Errors:     atomic.LoadUint64(&c.errCount),
+		Dropped:    atomic.LoadUint64(&c.dropCount),
+		Drops:      c.dropStats(),
+		Latency:    c.Latency(),
+	}
+	c.RLock()
+	closed := c.isClosed
+	c.RUnlock()
+	if closed {
+		stats.CloseCode, stats.CloseText = closeStatus(c.getCloseReason())
+	}
+	return stats
+}
+
+// 错误次数加一
+func (c *Connection) AddError() {
+	atomic.AddUint64(&c.errCount, 1)
+}
+
+// 获取因缓冲溢出被丢弃的消息数量
+func (c *Connection) GetDropCount() uint64 {
+	return atomic.LoadUint64(&c.dropCount)
+}
+
+// stopWithMsgTimeout StopWithMsg等待最后一条消息发送完成的时间
+const stopWithMsgTimeout = 3 * time.Second
+
+// pack 封包，开启ACK时为消息分配序号并记录到未确认列表
+func (c *Connection) pack(msgID uint32, reqID uint64, data []byte) ([]byte, error) {
+	return c.packFrame(c.GetMessageType(), msgChannel(c.conf(), msgID), msgID, reqID, data)
+}
+
+// packFrame 执行出站拦截器后使用帧类型对应的封包格式封包，包头携带逻辑通道ID
+func (c *Connection) packFrame(messageType int, channel uint8, msgID uint32, reqID uint64, data []byte) ([]byte, error) {
+	return c.packSeq(messageType, channel, msgID, reqID, 0, data, c.GetCipher())
+}
+
+// packSeq 封包，seq为0时分配新序号，否则使用指定的序号(会话补发离线消息)；cipher为nil时以明文封包
+func (c *Connection) packSeq(messageType int, channel uint8, msgID uint32, reqID, seq uint64, data []byte, cipher iface.Cipher) ([]byte, error) {
+	data, err := c.intercept(msgID, data)
+	if err != nil {
+		return nil, err
+	}
+	metrics.MessageOut(msgID)
+	atomic.AddUint64(&c.msgsOut, 1)
+	plain := data
+	msg := NewMsgPackage(msgID, data)
+	msg.SetReqID(reqID)
+	msg.SetChannel(channel)
+	if !c.conf().EnableAck {
+		msg.SetSeq(seq)
+		if err := seal(cipher, msg); err != nil {
+			return nil, err
+		}
+		return c.packet(messageType).Pack(msg)
+	}
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+	if seq == 0 {
+		c.seq++
+		seq = c.seq
+	} else if seq > c.seq {
+		c.seq = seq
+	}
+	msg.SetSeq(seq)
+	if err := seal(cipher, msg); err != nil {
+		return nil, err
+	}
+	packed, err := c.packet(messageType).Pack(msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(c.unacked) >= maxUnacked(c.conf()) {
+		c.Logger().Warn("unacked msg overflow, oldest dropped ConnID = ", c.ConnID)
+		c.unacked = c.unacked[1:]
+	}
+	// 未确认列表按序号排序，补发的旧序号插入到对应位置
+	i := len(c.unacked)
+	for i > 0 && c.unacked[i-1].Seq > seq {
+		i--
+	}
+	c.unacked = append(c.unacked, iface.OutboundMsg{})
+	copy(c.unacked[i+1:], c.unacked[i:])
+	// 调用方的data可能是请求的缓冲，处理结束后回收复用，补发需要保留一份拷贝
+	c.unacked[i] = iface.OutboundMsg{Seq: seq, MsgID: msgID, Data: append([]byte(nil), plain...)}
+	return packed, nil
+}
+
+// sendWith 以指定的序号与加密器发送消息，用于会话重连后补发离线消息与以明文回复密钥交换
+func (c *Connection) sendWith(seq uint64, msgID uint32, data []byte, cipher iface.Cipher) error {
+	c.RLock()
+	if c.isClosed {
+		c.RUnlock()
+		return errors.New("connection closed when send msg")
+	}
+	c.RUnlock()
+	unlock := c.lockSend()
+	defer unlock()
+	msg, err := c.packSeq(c.GetMessageType(), msgChannel(c.conf(), msgID), msgID, 0, seq, data, cipher)
+	if err != nil {
+		return c.packError(msgID, err)
+	}
+	return c.sendFrame(frame{messageType: c.GetMessageType(), data: msg})
+}
+
+// lockSend 开启ACK时在同一临界区内分配序号与排队发送，避免并发发送时序号小的消息后写出，返回解锁方法
+func (c *Connection) lockSend() func() {
+	if !c.conf().EnableAck {
+		return func() {}
+	}
+	c.sendLock.Lock()
+	return c.sendLock.Unlock
+}
+
+// lastSeq 最后分配的消息序号
+func (c *Connection) lastSeq() uint64 {
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+	return c.seq
+}
+
+// advanceSeq 之后分配的序号从seq之后开始
+func (c *Connection) advanceSeq(seq uint64) {
+	c.ackLock.Lock()
+	if seq > c.seq {
+		c.seq = seq
+	}
+	c.ackLock.Unlock()
+}
+
+// 确认序号小于等于seq的消息已被客户端收到
+func (c *Connection) Ack(seq uint64) {
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+	i := 0
+	for i < len(c.unacked) && c.unacked[i].Seq <= seq {
+		i++
+	}
+	c.unacked = c.unacked[i:]
+}
+
+// 获取已发送未被客户端确认的消息
+func (c *Connection) GetUnacked() []iface.OutboundMsg {
+	c.ackLock.Lock()
+	defer c.ackLock.Unlock()
+	unacked := make([]iface.OutboundMsg, len(c.unacked))
+	copy(unacked, c.unacked)
+	return unacked
+}
+
+// maxUnacked 未确认消息的最大条数，默认1024
+func maxUnacked(cfg *iface.Config) int {
+	if cfg.MaxUnacked > 0 {
+		return cfg.MaxUnacked
+	}
+	return 1024
+}
+
+// maxMsgChanLen 发送缓冲长度，未配置时默认1024
+func maxMsgChanLen(cfg *iface.Config) int {
+	if cfg.MaxMsgChanLen > 0 {
+		return cfg.MaxMsgChanLen
+	}
+	return 1024
+}
+
+// 设置连接已通过鉴权并绑定用户ID，按DuplicateLogin策略拒绝时返回ErrDuplicateLogin
+func (c *Connection) SetAuthenticated(uid string) error {
+	if err := c.login(uid); err != nil {
+		c.Server.CallOnAuth(c, uid, err)
+		return err
+	}
+	c.infoLock.Lock()
+	c.authenticated = true
+	c.uid = uid
+	addr := c.remoteAddr
+	if addr == nil {
+		addr = c.Conn.RemoteAddr()
+	}
+	c.logger = zap.S().With("connID", c.ConnID, "remoteAddr", addr.String(), "uid", uid)
+	c.infoLock.Unlock()
+	c.Server.CallOnAuth(c, uid, nil)
+	// 通过AuthMsgIDs鉴权时会话在用户ID确定后才恢复
+	if s, ok := c.Server.(*Server); ok {
+		s.rebindSession(c)
+	}
+	// 握手阶段鉴权时连接尚未启动，离线消息在Start中下发
+	if atomic.LoadInt32(&c.started) == 1 {
+		go c.flushOffline(uid)
+	}
+	return nil
+}
+
+// keyExchange 处理客户端的密钥交换消息，先以明文回复再启用加密
+func (c *Connection) keyExchange(data []byte) error {
+	exchange := c.Server.GetKeyExchange()
+	if exchange == nil {
+		return errors.New("key exchange not supported")
+	}
+	cipher, reply, err := exchange(c, data)
+	if err != nil {
+		return err
+	}
+	// 回复以明文封包，不清空连接当前的加密器，并发发送的其它消息不会以明文写出
+	if len(reply) > 0 {
+		if err := c.sendWith(0, c.conf().KeyExchangeMsgID, reply, nil); err != nil {
+			return err
+		}
+	}
+	c.SetCipher(cipher)
+	return nil
+}
+
+// messageAAD 加密的附加认证数据: msgID 4B | seq 8B，小端序
+func messageAAD(msgID uint32, seq uint64) []byte {
+	aad := make([]byte, 12)
+	binary.LittleEndian.PutUint32(aad, msgID)
+	binary.LittleEndian.PutUint64(aad[4:], seq)
+	return aad
+}
+
+// seal 加密消息内容，加密器支持附加数据时以msgID与序号作为附加数据
+func seal(cipher iface.Cipher, msg *Message) error {
+	if cipher == nil {
+		return nil
+	}
+	var data []byte
+	var err error
+	if aead, ok := cipher.(iface.AEADCipher); ok {
+		data, err = aead.Seal(msg.Data, messageAAD(msg.ID, msg.Seq))
+	} else {
+		data, err = cipher.Encrypt(msg.Data)
+	}
+	if err != nil {
+		return err
+	}
+	msg.Data = data
+	msg.Encrypted = true
 	return nil
 }
 
+// open 解密消息内容，附加数据与seal一致
+func open(cipher iface.Cipher, msg iface.Message) ([]byte, error) {
+	if aead, ok := cipher.(iface.AEADCipher); ok {
+		return aead.Open(msg.GetData(), messageAAD(msg.GetMsgID(), msg.GetSeq()))
+	}
+	return cipher.Decrypt(msg.GetData())
+}
+
+// 设置连接的加密器，为nil时不加密
+func (c *Connection) SetCipher(cipher iface.Cipher) {
+	c.infoLock.Lock()
+	c.cipher = cipher
+	c.infoLock.Unlock()
+}
+
+// 获取连接的加密器
+func (c *Connection) GetCipher() iface.Cipher {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	return c.cipher
+}
+
+// 获取携带ConnID、远程地址与用户ID的日志
+func (c *Connection) Logger() *zap.SugaredLogger {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	return c.logger
+}
+
+// 连接是否已通过鉴权
+func (c *Connection) IsAuthenticated() bool {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	return c.authenticated
+}
+
+// 获取连接绑定的用户ID
+func (c *Connection) GetUID() string {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	return c.uid
+}
+
 //SetProperty 设置链接属性
 func (c *Connection) SetProperty(key string, value interface{}) {
 	c.propertyLock.Lock()
@@ -232,9 +1154,22 @@ func (c *Connection) RemoveProperty(key string) {
 func (c *Connection) SetPing() {
 	c.Lock()
 	c.Heartbeat = true
+	c.heartbeatTime = clockOf(c.Server).Now()
 	c.Unlock()
 }
 
+// 获取最后一次收到心跳的时间
+func (c *Connection) GetHeartbeatTime() time.Time {
+	c.RLock()
+	defer c.RUnlock()
+	return c.heartbeatTime
+}
+
+// 获取连接建立时间
+func (c *Connection) GetStartTime() time.Time {
+	return c.startTime
+}
+
 // 获取心跳
 func (c *Connection) GetPing() bool {
 	return c.Heartbeat
@@ -247,20 +1182,19 @@ func (c *Connection) RemovePing() {
 	c.Unlock()
 }
 
-// 心跳延时检查
-func DelayFunc(v ...interface{}) {
-	if ConnID, ok := v[0].(int64); ok {
-		conn, err := GlobalServer.GetConnMgr().Get(ConnID)
-		if err != nil {
-			return
-		}
-		if !conn.GetPing() {
-			conn.Stop()
-		} else {
-			conn.RemovePing()
-			conn.IsHeartbeatTimeout()
-		}
-
+// 心跳延时检查，连接已从所属Server的连接管理中移除时不再检查
+func (c *Connection) checkHeartbeat() {
+	conn, err := c.Server.GetConnMgr().Get(c.ConnID)
+	if err != nil {
+		return
+	}
+	if !conn.GetPing() {
+		metrics.HeartbeatTimeout()
+		setCloseReason(conn, ErrHeartbeatTimeout)
+		conn.Stop()
+	} else {
+		conn.RemovePing()
+		conn.IsHeartbeatTimeout()
 	}
 }
 
@@ -268,8 +1202,10 @@ func DelayFunc(v ...interface{}) {
 心跳超时
 */
 func (c *Connection) IsHeartbeatTimeout() {
-	PingTime := time.Second * time.Duration(config.PingTime + 1)
-	foo := ztimer.NewDelayFunc(DelayFunc, []interface{}{c.ConnID})
-	ZTimer.CreateTimerAfter(foo, PingTime)
+	PingTime := time.Second * time.Duration(c.conf().PingTime + 1)
+	c.timers.AddTimer(PingTime, func() {
+		// 回调在时间轮goroutine中执行，Stop可能阻塞
+		go c.checkHeartbeat()
+	})
 	return
 }
@@ -4,81 +4,229 @@ import (
 	"errors"
 	"github.com/xiaomingping/game/iface"
 	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
 )
 
-// ConnManager 连接管理模块
-type ConnManager struct {
+// defaultConnShards 未配置ConnShards时的分片数量
+const defaultConnShards = 32
+
+// connShard 连接分片，每个分片独立加锁
+type connShard struct {
 	connections map[int64]iface.Connection
 	connLock    sync.RWMutex
 }
 
-// NewConnManager 创建一个链接管理
+// snapshot 复制分片内的全部连接，回调在锁外执行，避免回调中Stop连接时死锁
+func (shard *connShard) snapshot() []iface.Connection {
+	shard.connLock.RLock()
+	defer shard.connLock.RUnlock()
+	conns := make([]iface.Connection, 0, len(shard.connections))
+	for _, conn := range shard.connections {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// ConnManager 连接管理模块，按ConnID分片以降低高连接数下的锁竞争
+type ConnManager struct {
+	shards []*connShard
+	count  int64 // 连接数量
+	// 用户ID与链接的绑定关系
+	uids    map[string]map[int64]iface.Connection
+	connUID map[int64]string
+	uidLock sync.RWMutex
+}
+
+// NewConnManager 创建一个链接管理，分片数量读取SetConfig设置的配置
 func NewConnManager() *ConnManager {
-	return &ConnManager{
-		connections: make(map[int64]iface.Connection),
+	shards := 0
+	if cfg := sharedConfig(); cfg != nil {
+		shards = cfg.ConnShards
 	}
+	return newConnManager(shards)
+}
+
+// newConnManager 创建分为shards个分片的链接管理，不大于0时使用默认分片数量
+func newConnManager(shards int) *ConnManager {
+	n := defaultConnShards
+	if shards > 0 {
+		n = shards
+	}
+	connMgr := &ConnManager{
+		shards:  make([]*connShard, n),
+		uids:    make(map[string]map[int64]iface.Connection),
+		connUID: make(map[int64]string),
+	}
+	for i := range connMgr.shards {
+		connMgr.shards[i] = &connShard{connections: make(map[int64]iface.Connection)}
+	}
+	return connMgr
+}
+
+// shard 得到ConnID所在的分片
+func (connMgr *ConnManager) shard(connID int64) *connShard {
+	return connMgr.shards[mixID(connID)%uint64(len(connMgr.shards))]
 }
 
 func (connMgr *ConnManager) Add(conn iface.Connection) {
-	connMgr.connLock.Lock()
-	defer connMgr.connLock.Unlock()
-	connMgr.connections[conn.GetConnID()] = conn
+	shard := connMgr.shard(conn.GetConnID())
+	shard.connLock.Lock()
+	defer shard.connLock.Unlock()
+	if _, ok := shard.connections[conn.GetConnID()]; !ok {
+		atomic.AddInt64(&connMgr.count, 1)
+	}
+	shard.connections[conn.GetConnID()] = conn
 }
 
 func (connMgr *ConnManager) Remove(conn iface.Connection) {
-	connMgr.connLock.Lock()
-	defer connMgr.connLock.Unlock()
-	delete(connMgr.connections, conn.GetConnID())
+	connMgr.unbindUID(conn.GetConnID())
+	shard := connMgr.shard(conn.GetConnID())
+	shard.connLock.Lock()
+	defer shard.connLock.Unlock()
+	if _, ok := shard.connections[conn.GetConnID()]; ok {
+		delete(shard.connections, conn.GetConnID())
+		atomic.AddInt64(&connMgr.count, -1)
+	}
 }
 
 func (connMgr *ConnManager) Get(connID int64) (iface.Connection, error) {
-	connMgr.connLock.RLock()
-	defer connMgr.connLock.RUnlock()
-	if conn, ok := connMgr.connections[connID]; ok {
+	shard := connMgr.shard(connID)
+	shard.connLock.RLock()
+	defer shard.connLock.RUnlock()
+	if conn, ok := shard.connections[connID]; ok {
 		return conn, nil
 	}
 	return nil, errors.New("connection not found")
 }
 
+// Len 获取链接数量，不加锁
 func (connMgr *ConnManager) Len() int {
-	connMgr.connLock.RLock()
-	defer connMgr.connLock.RUnlock()
-	length := len(connMgr.connections)
-	return length
+	return int(atomic.LoadInt64(&connMgr.count))
 }
 
 func (connMgr *ConnManager) ClearConn() {
-	connMgr.connLock.Lock()
-	defer connMgr.connLock.Unlock()
-	// 停止并删除全部的连接信息
-	for connID, conn := range connMgr.connections {
-		// 停止
-		conn.Stop()
-		// 删除
-		delete(connMgr.connections, connID)
+	// 停止并删除全部的连接信息，Stop中会从分片中删除连接
+	for _, shard := range connMgr.shards {
+		for _, conn := range shard.snapshot() {
+			setCloseReason(conn, ErrServerStopped)
+			conn.Stop()
+			connMgr.Remove(conn)
+		}
 	}
 }
 
+// Search 遍历全部连接，逐个分片复制后在锁外回调
 func (connMgr *ConnManager) Search(s iface.Search) {
-	connMgr.connLock.Lock()
-	defer connMgr.connLock.Unlock()
-	// 停止并删除全部的连接信息
-	for _, conn := range connMgr.connections {
-		s(conn)
+	for _, shard := range connMgr.shards {
+		for _, conn := range shard.snapshot() {
+			s(conn)
+		}
+	}
+}
+
+// Stats 汇总全部在线连接的收发统计
+func (connMgr *ConnManager) Stats() iface.ConnMgrStats {
+	var total iface.ConnMgrStats
+	connMgr.Search(func(conn iface.Connection) {
+		st := conn.Stats()
+		total.Conns++
+		total.MsgsIn += st.MsgsIn
+		total.MsgsOut += st.MsgsOut
+		total.BytesIn += st.BytesIn
+		total.BytesOut += st.BytesOut
+		total.Errors += st.Errors
+		total.Dropped += st.Dropped
+	})
+	return total
+}
+
+// BindUID 按策略绑定用户ID，返回该用户ID已绑定的其它链接；
+// DuplicateKickOld时其它链接被解除绑定，DuplicateRejectNew且存在其它链接时不绑定并返回ErrDuplicateLogin
+func (connMgr *ConnManager) BindUID(conn iface.Connection, uid string, policy iface.DuplicateLoginPolicy) ([]iface.Connection, error) {
+	connID := conn.GetConnID()
+	connMgr.uidLock.Lock()
+	defer connMgr.uidLock.Unlock()
+	var others []iface.Connection
+	for id, other := range connMgr.uids[uid] {
+		if id != connID {
+			others = append(others, other)
+		}
 	}
+	if len(others) > 0 && policy == iface.DuplicateRejectNew {
+		return others, ErrDuplicateLogin
+	}
+	connMgr.unbindUIDLocked(connID)
+	bound := connMgr.uids[uid]
+	if bound == nil || policy == iface.DuplicateKickOld {
+		for _, other := range bound {
+			delete(connMgr.connUID, other.GetConnID())
+		}
+		bound = make(map[int64]iface.Connection)
+		connMgr.uids[uid] = bound
+	}
+	bound[connID] = conn
+	connMgr.connUID[connID] = uid
+	return others, nil
+}
+
+// GetByUID 获取用户ID绑定的全部链接
+func (connMgr *ConnManager) GetByUID(uid string) []iface.Connection {
+	connMgr.uidLock.RLock()
+	defer connMgr.uidLock.RUnlock()
+	conns := make([]iface.Connection, 0, len(connMgr.uids[uid]))
+	for _, conn := range connMgr.uids[uid] {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// unbindUID 解除链接的用户ID绑定
+func (connMgr *ConnManager) unbindUID(connID int64) {
+	connMgr.uidLock.Lock()
+	connMgr.unbindUIDLocked(connID)
+	connMgr.uidLock.Unlock()
+}
+
+func (connMgr *ConnManager) unbindUIDLocked(connID int64) {
+	uid, ok := connMgr.connUID[connID]
+	if !ok {
+		return
+	}
+	delete(connMgr.connUID, connID)
+	if bound := connMgr.uids[uid]; bound != nil {
+		delete(bound, connID)
+		if len(bound) == 0 {
+			delete(connMgr.uids, uid)
+		}
+	}
+}
+
+// Kick 以msgID向链接发送踢出原因后关闭链接，msgID为0时不发送直接关闭
+func (connMgr *ConnManager) Kick(connID int64, reason string, msgID uint32) error {
+	conn, err := connMgr.Get(connID)
+	if err != nil {
+		return err
+	}
+	zap.S().Info("kick ConnID = ", connID, " reason = ", reason)
+	setCloseReason(conn, ErrKicked)
+	if msgID == 0 {
+		conn.Stop()
+		return nil
+	}
+	conn.StopWithMsg(msgID, []byte(reason))
+	return nil
 }
 
 // ClearOneConn  利用ConnID获取一个链接 并且删除
 func (connMgr *ConnManager) ClearOneConn(connID int64) {
-	connMgr.connLock.Lock()
-	defer connMgr.connLock.Unlock()
-	connections := connMgr.connections
-	if conn, ok := connections[connID]; ok {
-		// 停止
-		conn.Stop()
-		// 删除
-		delete(connections, connID)
+	conn, err := connMgr.Get(connID)
+	if err != nil {
 		return
 	}
-	return
+	// 停止
+	conn.Stop()
+	// 删除
+	connMgr.Remove(conn)
 }
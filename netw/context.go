@@ -0,0 +1,162 @@
+package netw
+
+import (
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Context 处理单条消息的上下文，包装Request并携带连接、请求级的键值与回复方法，
+// 在中间件与处理方法之间共享；与Request一样在处理完成后回收，需要在处理方法之外持有时使用Copy
+type Context struct {
+	iface.Request
+	keys       map[string]interface{}
+	lock       sync.RWMutex
+	dispatched bool            // 是否由框架分发
+	reserved   bool            // 限流令牌已预定，延迟处理时不再检查限流
+	retry      *RetryableError // 处理方法请求重试的错误
+}
+
+// ContextFunc 以Context为参数的处理方法
+type ContextFunc func(c *Context)
+
+var contextPool = sync.Pool{New: func() interface{} { return &Context{} }}
+
+// newContext 从对象池获取上下文，处理完成后由release回收
+func newContext(request iface.Request) *Context {
+	c := contextPool.Get().(*Context)
+	c.Request = request
+	return c
+}
+
+// release 回收上下文
+func (c *Context) release() {
+	c.Request = nil
+	c.keys = nil
+	c.dispatched = false
+	c.reserved = false
+	c.retry = nil
+	contextPool.Put(c)
+}
+
+// ContextOf 获取请求对应的Context，在框架分发的中间件与处理方法中返回同一个Context
+func ContextOf(request iface.Request) *Context {
+	if c, ok := request.(*Context); ok {
+		return c
+	}
+	return &Context{Request: request}
+}
+
+// Conn 请求连接
+func (c *Context) Conn() iface.Connection {
+	return c.GetConnection()
+}
+
+// Server 连接所属的Server
+func (c *Context) Server() iface.Server {
+	return c.GetConnection().GetServer()
+}
+
+// UID 连接绑定的用户ID
+func (c *Context) UID() string {
+	return c.GetConnection().GetUID()
+}
+
+// Set 设置请求级的值，只在本条消息的处理过程中有效
+func (c *Context) Set(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.keys == nil {
+		c.keys = make(map[string]interface{})
+	}
+	c.keys[key] = value
+}
+
+// Get 获取请求级的值
+func (c *Context) Get(key string) (interface{}, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	value, ok := c.keys[key]
+	return value, ok
+}
+
+// MustGet 获取请求级的值，不存在时panic
+func (c *Context) MustGet(key string) interface{} {
+	if value, ok := c.Get(key); ok {
+		return value
+	}
+	panic("key \"" + key + "\" does not exist")
+}
+
+// Span 当前链路追踪的span，未开启tracing.Middleware时为空操作的span
+func (c *Context) Span() trace.Span {
+	return trace.SpanFromContext(c.Context())
+}
+
+// OK 以ResponseMsgID(请求MsgID)回复使用编解码器序列化后的响应
+func (c *Context) OK(v interface{}) error {
+	return c.ReplyObj(ResponseMsgID(c.GetMsgID()), v)
+}
+
+// Error 以错误回复，错误实现Code()时带上其错误码，否则为ErrCodeUnknown；
+// 可重试的错误不回复，稍后重新处理本条消息
+func (c *Context) Error(err error) error {
+	if IsRetryable(err) && c.Retry(err) {
+		return nil
+	}
+	code := ErrCodeUnknown
+	if ce, ok := err.(codeError); ok {
+		code = ce.Code()
+	}
+	return c.ReplyError(code, err.Error())
+}
+
+// Copy 复制上下文，复制得到的上下文不会被回收，请求级的值一并复制
+func (c *Context) Copy() iface.Request {
+	cp := &Context{Request: c.Request.Copy()}
+	c.lock.RLock()
+	for key, value := range c.keys {
+		cp.Set(key, value)
+	}
+	c.lock.RUnlock()
+	return cp
+}
+
+// ContextRouter 以Context为参数的路由
+type ContextRouter struct {
+	BaseRouter
+	fn ContextFunc
+}
+
+// NewContextRouter 创建以Context为参数的路由
+func NewContextRouter(fn ContextFunc) *ContextRouter {
+	return &ContextRouter{fn: fn}
+}
+
+// Handle 调用处理方法
+func (cr *ContextRouter) Handle(request iface.Request) {
+	cr.fn(ContextOf(request))
+}
+
+// handlerRouter 由处理方法创建路由，func(*Context)创建ContextRouter，其余创建TypedRouter
+func handlerRouter(msgID uint32, fn interface{}) iface.Router {
+	switch f := fn.(type) {
+	case func(*Context):
+		return NewContextRouter(f)
+	case ContextFunc:
+		return NewContextRouter(f)
+	}
+	return NewTypedRouter(msgID, fn)
+}
+
+// ContextMiddleware 以Context为参数的中间件，调用next继续处理，不调用时中断
+func ContextMiddleware(fn func(c *Context, next func())) iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			c := ContextOf(request)
+			fn(c, func() { next(c) })
+		}
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+// +build !windows
+
+package netw
+
+import (
+	"syscall"
+	"time"
+)
+
+// processCPUTime 进程累计使用的用户态与内核态CPU时间
+func processCPUTime() (time.Duration, bool) {
+	var usage syscall.Rusage
+	if err := syscall.Getrusage(syscall.RUSAGE_SELF, &usage); err != nil {
+		return 0, false
+	}
+	return time.Duration(usage.Utime.Nano() + usage.Stime.Nano()), true
+}
@@ -0,0 +1,11 @@
+//go:build windows
+// +build windows
+
+package netw
+
+import "time"
+
+// processCPUTime Windows下不支持，ShedCPU不生效
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
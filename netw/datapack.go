@@ -2,48 +2,194 @@ package netw
 
 import (
 	"bytes"
+	"compress/gzip"
 	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
 
 	"github.com/xiaomingping/game/iface"
 )
 
-//DataPack 封包拆包类实例，暂时不需要成员
-type DataPack struct{}
+const (
+	// CompressFlag msgID最高位为1时表示消息内容经过gzip压缩
+	CompressFlag uint32 = 1 << 31
+	// SeqFlag msgID次高位为1时表示msgID之后带有8字节的消息序号
+	SeqFlag uint32 = 1 << 30
+	// ReqIDFlag msgID第30位为1时表示消息序号之后带有8字节的请求ID
+	ReqIDFlag uint32 = 1 << 29
+	// ChannelFlag msgID第29位为1时表示请求ID之后带有1字节的逻辑通道ID
+	ChannelFlag uint32 = 1 << 28
+	// MaxMsgID 最大的msgID，更高的4位为标志位
+	MaxMsgID = ChannelFlag - 1
+)
+
+//DataPack 封包拆包类实例
+type DataPack struct {
+	compressThreshold int // 消息内容超过该字节数时进行压缩，0为不压缩
+	maxPacketSize     int // 拆包时允许的最大包长度(含解压后)，0为不限制
+}
 
 //NewDataPack 封包拆包实例初始化方法
 func NewDataPack() iface.Packet {
 	return &DataPack{}
 }
 
+//NewCompressDataPack 创建消息内容超过threshold字节时自动gzip压缩的封包拆包实例
+func NewCompressDataPack(threshold int) iface.Packet {
+	return &DataPack{compressThreshold: threshold}
+}
+
+//NewLimitDataPack 创建限制最大包长度的封包拆包实例
+func NewLimitDataPack(threshold int, maxPacketSize int) iface.Packet {
+	return &DataPack{compressThreshold: threshold, maxPacketSize: maxPacketSize}
+}
+
 //Pack 封包方法(压缩数据)
 func (dp *DataPack) Pack(msg iface.Message) ([]byte, error) {
-	//创建一个存放bytes字节的缓冲
-	dataBuff := bytes.NewBuffer([]byte{})
+	msgID, data := msg.GetMsgID(), msg.GetData()
+	if msgID > MaxMsgID {
+		return nil, ErrMsgIDOverflow
+	}
+	if dp.compressThreshold > 0 && len(data) > dp.compressThreshold {
+		compressed, err := gzipCompress(data)
+		if err != nil {
+			return nil, err
+		}
+		msgID, data = msgID|CompressFlag, compressed
+	}
+	headLen := 4
+	if msg.GetSeq() > 0 {
+		msgID |= SeqFlag
+		headLen += 8
+	}
+	if msg.GetReqID() > 0 {
+		msgID |= ReqIDFlag
+		headLen += 8
+	}
+	if msg.GetChannel() > 0 {
+		msgID |= ChannelFlag
+		headLen++
+	}
+	//从缓冲池获取存放bytes字节的缓冲
+	dataBuff := GetBuffer(headLen + len(data))
 	//写msgID
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetMsgID()); err != nil {
-		return nil, err
+	binary.LittleEndian.PutUint32(dataBuff, msgID)
+	offset := 4
+	//写消息序号
+	if msg.GetSeq() > 0 {
+		binary.LittleEndian.PutUint64(dataBuff[offset:], msg.GetSeq())
+		offset += 8
 	}
-	//写data数据
-	if err := binary.Write(dataBuff, binary.LittleEndian, msg.GetData()); err != nil {
-		return nil, err
+	//写请求ID
+	if msg.GetReqID() > 0 {
+		binary.LittleEndian.PutUint64(dataBuff[offset:], msg.GetReqID())
+		offset += 8
+	}
+	//写逻辑通道ID
+	if msg.GetChannel() > 0 {
+		dataBuff[offset] = msg.GetChannel()
 	}
-	return dataBuff.Bytes(), nil
+	//写data数据
+	copy(dataBuff[headLen:], data)
+	return dataBuff, nil
 }
 
-//Unpack 拆包方法(解压数据)
+//Unpack 拆包方法(解压数据)，包头不完整时返回ErrIncomplete，压缩内容损坏时返回ErrCorrupt
 func (dp *DataPack) Unpack(binaryData []byte) (iface.Message, error) {
-	//创建一个从输入二进制数据的ioReader
-	dataBuff := bytes.NewReader(binaryData)
-	//只解压head的信息，得到dataLen和msgID
-	msg := &Message{}
-	//读msgID
-	if err := binary.Read(dataBuff, binary.LittleEndian, &msg.ID); err != nil {
+	if dp.maxPacketSize > 0 && len(binaryData) > dp.maxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+	//读msgID，按标志位计算包头长度
+	if len(binaryData) < 4 {
+		return nil, ErrIncomplete
+	}
+	id := binary.LittleEndian.Uint32(binaryData)
+	headLen := 4
+	if id&SeqFlag != 0 {
+		headLen += 8
+	}
+	if id&ReqIDFlag != 0 {
+		headLen += 8
+	}
+	if id&ChannelFlag != 0 {
+		headLen++
+	}
+	if len(binaryData) < headLen {
+		return nil, ErrIncomplete
+	}
+	msg := newPoolMessage()
+	msg.ID = id &^ (SeqFlag | ReqIDFlag | ChannelFlag)
+	offset := 4
+	//读消息序号
+	if id&SeqFlag != 0 {
+		msg.Seq = binary.LittleEndian.Uint64(binaryData[offset:])
+		offset += 8
+	}
+	//读请求ID
+	if id&ReqIDFlag != 0 {
+		msg.ReqID = binary.LittleEndian.Uint64(binaryData[offset:])
+		offset += 8
+	}
+	//读逻辑通道ID
+	if id&ChannelFlag != 0 {
+		msg.Channel = binaryData[offset]
+	}
+	//读data数据，直接引用binaryData避免复制
+	msg.Data = binaryData[headLen:]
+	//压缩标志位，解压消息内容
+	if msg.ID&CompressFlag != 0 {
+		data, err := gzipDecompress(msg.Data, dp.maxPacketSize)
+		if err != nil {
+			messagePool.Put(msg)
+			return nil, err
+		}
+		msg.ID &^= CompressFlag
+		msg.Data = data
+	}
+	return msg, nil
+}
+
+// PeekMsgID 只读取包头中的msgID，不拆包也不解压
+func (dp *DataPack) PeekMsgID(binaryData []byte) (uint32, bool) {
+	if len(binaryData) < 4 {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(binaryData) &^ (CompressFlag | SeqFlag | ReqIDFlag | ChannelFlag), true
+}
+
+// gzipCompress gzip压缩
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
 		return nil, err
 	}
-	//读dataLen
-	if err := binary.Read(dataBuff, binary.LittleEndian, &msg.Data); err != nil {
+	if err := w.Close(); err != nil {
 		return nil, err
 	}
-	//这里只需要把head的数据拆包出来就可以了，然后再通过head的长度，再从conn读取一次数据
-	return msg, nil
+	return buf.Bytes(), nil
+}
+
+// MaxDecompressSize 未限制最大包长度时解压后允许的最大字节数，避免压缩炸弹
+var MaxDecompressSize = 16 << 20
+
+// gzipDecompress gzip解压，解压后超出limit字节(limit小于等于0时为MaxDecompressSize)返回ErrPacketTooLarge，内容损坏时返回ErrCorrupt
+func gzipDecompress(data []byte, limit int) ([]byte, error) {
+	if limit <= 0 {
+		limit = MaxDecompressSize
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer r.Close()
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	if len(out) > limit {
+		return nil, ErrPacketTooLarge
+	}
+	return out, nil
 }
@@ -0,0 +1,32 @@
+//go:build go1.18
+// +build go1.18
+
+package netw_test
+
+import (
+	"testing"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+)
+
+// FuzzUnpack 以FuzzSeeds为初始语料校验DataPack与HeaderPack，go test -fuzz FuzzUnpack ./netw
+func FuzzUnpack(f *testing.F) {
+	for _, seed := range netw.FuzzSeeds() {
+		f.Add(seed)
+	}
+	var packets []iface.Packet
+	for _, p := range netw.FuzzPackets() {
+		switch p.(type) {
+		case *netw.DataPack, *netw.HeaderPack:
+			packets = append(packets, p)
+		}
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, p := range packets {
+			if err := netw.CheckPacket(p, data); err != nil {
+				t.Fatalf("%T: %v", p, err)
+			}
+		}
+	})
+}
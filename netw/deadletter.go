@@ -0,0 +1,92 @@
+package netw
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+
+	"go.uber.org/zap"
+)
+
+// MemoryDeadLetterQueue 内存死信队列，保留最近size条
+type MemoryDeadLetterQueue struct {
+	letters []iface.DeadLetter
+	next    int
+	full    bool
+	lock    sync.Mutex
+}
+
+// NewMemoryDeadLetterQueue 创建内存死信队列
+func NewMemoryDeadLetterQueue(size int) *MemoryDeadLetterQueue {
+	if size <= 0 {
+		size = 1024
+	}
+	return &MemoryDeadLetterQueue{letters: make([]iface.DeadLetter, size)}
+}
+
+// Push 写入一条死信，队列已满时覆盖最旧的一条
+func (q *MemoryDeadLetterQueue) Push(letter iface.DeadLetter) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	q.letters[q.next] = letter
+	q.next = (q.next + 1) % len(q.letters)
+	if q.next == 0 {
+		q.full = true
+	}
+	return nil
+}
+
+// Recent 按时间正序返回保留的全部死信
+func (q *MemoryDeadLetterQueue) Recent() []iface.DeadLetter {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	if !q.full {
+		return append([]iface.DeadLetter(nil), q.letters[:q.next]...)
+	}
+	letters := make([]iface.DeadLetter, 0, len(q.letters))
+	letters = append(letters, q.letters[q.next:]...)
+	return append(letters, q.letters[:q.next]...)
+}
+
+// SetOnDeadLetter 设置消息进入死信队列时的Hook函数
+func (mh *MsgHandle) SetOnDeadLetter(hookFunc func(letter iface.DeadLetter)) {
+	mh.onDeadLetter = hookFunc
+}
+
+// SetDeadLetterStore 设置死信队列存储，为nil时只调用Hook函数
+func (mh *MsgHandle) SetDeadLetterStore(store iface.DeadLetterStore) {
+	mh.deadLetters = store
+}
+
+// DeadLetter 将无法路由或处理失败的消息写入死信队列
+func (mh *MsgHandle) DeadLetter(request iface.Request, reason iface.DeadLetterReason, err interface{}) {
+	metrics.DeadLetter(reason.String())
+	if mh.onDeadLetter == nil && mh.deadLetters == nil {
+		return
+	}
+	conn := request.GetConnection()
+	letter := iface.DeadLetter{
+		Time:   time.Now(),
+		ConnID: conn.GetConnID(),
+		UID:    conn.GetUID(),
+		MsgID:  request.GetMsgID(),
+		ReqID:  request.GetReqID(),
+		// Request处理完成后会被回收，需要复制消息内容
+		Data:   append([]byte(nil), request.GetData()...),
+		Reason: reason,
+	}
+	if err != nil {
+		letter.Err = fmt.Sprint(err)
+	}
+	if mh.deadLetters != nil {
+		if pushErr := mh.deadLetters.Push(letter); pushErr != nil {
+			zap.S().Warn("push dead letter error ", pushErr)
+		}
+	}
+	if mh.onDeadLetter != nil {
+		mh.onDeadLetter(letter)
+	}
+}
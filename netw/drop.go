@@ -0,0 +1,173 @@
+package netw
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+
+	"go.uber.org/zap"
+)
+
+// dropReasons 消息丢失原因的数量
+const dropReasons = int(iface.DropWrite) + 1
+
+// dropWindow 单个原因在统计窗口内的丢失数量
+type dropWindow struct {
+	start   time.Time
+	count   uint64
+	alerted bool
+}
+
+// connDrops 连接各原因的丢失统计
+type connDrops struct {
+	total   [dropReasons]uint64
+	lock    sync.Mutex // 保护windows
+	windows [dropReasons]dropWindow
+}
+
+// dropAlertWindow 丢失告警的统计窗口
+func dropAlertWindow(cfg *iface.Config) time.Duration {
+	if cfg.DropAlertWindow <= 0 {
+		return 10 * time.Second
+	}
+	return time.Second * time.Duration(cfg.DropAlertWindow)
+}
+
+// drop 记录连接丢失了n条消息，缓冲溢出同时计入Dropped，单个连接的丢失速率超过ConnDropAlertRate时告警，
+// 每个窗口只告警一次
+func (c *Connection) drop(reason iface.DropReason, n int) {
+	if n <= 0 {
+		return
+	}
+	if reason == iface.DropSendOverflow || reason == iface.DropChannelOverflow {
+		atomic.AddUint64(&c.dropCount, uint64(n))
+	}
+	atomic.AddUint64(&c.drops.total[reason], uint64(n))
+	if s, ok := c.Server.(*Server); ok {
+		s.drop(reason, n)
+	} else {
+		metrics.MessageDropped(reason.String(), n)
+	}
+	threshold := c.conf().ConnDropAlertRate
+	if threshold <= 0 {
+		return
+	}
+	window := dropAlertWindow(c.conf())
+	now := clockOf(c.Server).Now()
+	c.drops.lock.Lock()
+	w := &c.drops.windows[reason]
+	if now.Sub(w.start) >= window {
+		*w = dropWindow{start: now}
+	}
+	w.count += uint64(n)
+	count := w.count
+	fire := !w.alerted && float64(count) > threshold*window.Seconds()
+	if fire {
+		w.alerted = true
+	}
+	c.drops.lock.Unlock()
+	if fire {
+		c.Logger().Warn("message drop alert reason = ", reason, " count = ", count)
+		c.Server.CallOnDropAlert(iface.DropAlert{
+			Conn:      c,
+			Reason:    reason,
+			Count:     count,
+			Rate:      float64(count) / window.Seconds(),
+			Threshold: threshold,
+			Window:    window,
+		})
+	}
+}
+
+// dropStats 连接各原因丢失的消息数，没有丢失时为nil
+func (c *Connection) dropStats() map[string]uint64 {
+	var stats map[string]uint64
+	for _, reason := range iface.DropReasons {
+		if n := atomic.LoadUint64(&c.drops.total[reason]); n > 0 {
+			if stats == nil {
+				stats = make(map[string]uint64)
+			}
+			stats[reason.String()] = n
+		}
+	}
+	return stats
+}
+
+// recordDrop 为连接记录丢失的消息，非netw的连接只计入指标
+func recordDrop(conn iface.Connection, reason iface.DropReason, n int) {
+	if c, ok := conn.(*Connection); ok {
+		c.drop(reason, n)
+		return
+	}
+	metrics.MessageDropped(reason.String(), n)
+}
+
+// drop 记录服务丢失了n条消息
+func (s *Server) drop(reason iface.DropReason, n int) {
+	atomic.AddUint64(&s.drops[reason], uint64(n))
+	metrics.MessageDropped(reason.String(), n)
+}
+
+// DropStats 服务启动以来各原因丢失的消息总数，包含已关闭的连接
+func (s *Server) DropStats() map[string]uint64 {
+	stats := make(map[string]uint64, dropReasons)
+	for _, reason := range iface.DropReasons {
+		stats[reason.String()] = atomic.LoadUint64(&s.drops[reason])
+	}
+	return stats
+}
+
+// watchDrops 每个统计窗口检查全部连接合计的丢失速率，超过DropAlertRate时告警
+func (s *Server) watchDrops() {
+	var last [dropReasons]uint64
+	window := dropAlertWindow(s.conf())
+	timer := time.NewTimer(window)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case <-timer.C:
+		}
+		threshold := s.conf().DropAlertRate
+		for _, reason := range iface.DropReasons {
+			total := atomic.LoadUint64(&s.drops[reason])
+			count := total - last[reason]
+			last[reason] = total
+			if threshold <= 0 || float64(count) <= threshold*window.Seconds() {
+				continue
+			}
+			zap.S().Warn("message drop alert reason = ", reason, " count = ", count)
+			s.CallOnDropAlert(iface.DropAlert{
+				Reason:    reason,
+				Count:     count,
+				Rate:      float64(count) / window.Seconds(),
+				Threshold: threshold,
+				Window:    window,
+			})
+		}
+		// 统计窗口支持热更新
+		window = dropAlertWindow(s.conf())
+		timer.Reset(window)
+	}
+}
+
+// AddOnDropAlert 追加消息丢失速率超过阈值时的Hook函数，单个连接的告警在丢失消息的goroutine中调用
+func (s *Server) AddOnDropAlert(hookFunc func(alert iface.DropAlert)) {
+	s.hookLock.Lock()
+	s.onDropAlert = append(s.onDropAlert, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// CallOnDropAlert 调用OnDropAlert Hook函数
+func (s *Server) CallOnDropAlert(alert iface.DropAlert) {
+	s.hookLock.RLock()
+	hooks := s.onDropAlert
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(alert)
+	}
+}
@@ -0,0 +1,91 @@
+package netw
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sync"
+)
+
+// ErrorCode 注册到错误码表的业务错误码，可作为TypedRouter处理方法的返回值，回复时带上错误码与注册的错误信息
+type ErrorCode int32
+
+// Code 错误码
+func (e ErrorCode) Code() int32 {
+	return int32(e)
+}
+
+func (e ErrorCode) Error() string {
+	return ErrorMessage(int32(e))
+}
+
+var (
+	errCodes = map[int32]string{
+		ErrCodeUnknown:    "unknown error",
+		ErrCodeBadRequest: "bad request",
+		ErrCodeDuplicate:  "duplicate request",
+		ErrCodeUnauthed:   "unauthenticated",
+	}
+	errCodeLock sync.RWMutex
+)
+
+// RegisterErrorCode 注册错误码与默认错误信息，一般在包初始化时调用，如
+// var ErrNoGold = netw.RegisterErrorCode(1001, "not enough gold")；重复注册同一错误码时panic
+func RegisterErrorCode(code int32, msg string) ErrorCode {
+	errCodeLock.Lock()
+	defer errCodeLock.Unlock()
+	if old, ok := errCodes[code]; ok {
+		panic(fmt.Sprintf("error code %d already registered: %s", code, old))
+	}
+	errCodes[code] = msg
+	return ErrorCode(code)
+}
+
+// ErrorMessage 错误码注册的错误信息，未注册时为空
+func ErrorMessage(code int32) string {
+	errCodeLock.RLock()
+	defer errCodeLock.RUnlock()
+	return errCodes[code]
+}
+
+// ErrorCodes 全部已注册的错误码，可用于生成客户端错误码表
+func ErrorCodes() map[int32]string {
+	errCodeLock.RLock()
+	defer errCodeLock.RUnlock()
+	codes := make(map[int32]string, len(errCodes))
+	for code, msg := range errCodes {
+		codes[code] = msg
+	}
+	return codes
+}
+
+// ErrorFrame 以ErrorMsgID下发的标准错误响应，
+// 消息内容为 | 请求MsgID 4B | 错误码 4B | 请求ID 8B | 错误信息 |，整数均为小端序
+type ErrorFrame struct {
+	MsgID   uint32 // 出错的请求MsgID
+	Code    int32
+	ReqID   uint64 // 客户端请求ID，非请求-响应消息为0
+	Message string
+}
+
+// EncodeErrorFrame 编码错误响应
+func EncodeErrorFrame(f ErrorFrame) []byte {
+	data := make([]byte, 16+len(f.Message))
+	binary.LittleEndian.PutUint32(data, f.MsgID)
+	binary.LittleEndian.PutUint32(data[4:], uint32(f.Code))
+	binary.LittleEndian.PutUint64(data[8:], f.ReqID)
+	copy(data[16:], f.Message)
+	return data
+}
+
+// DecodeErrorFrame 解码错误响应，长度不足时整体作为错误信息
+func DecodeErrorFrame(data []byte) ErrorFrame {
+	if len(data) < 16 {
+		return ErrorFrame{Code: ErrCodeUnknown, Message: string(data)}
+	}
+	return ErrorFrame{
+		MsgID:   binary.LittleEndian.Uint32(data),
+		Code:    int32(binary.LittleEndian.Uint32(data[4:])),
+		ReqID:   binary.LittleEndian.Uint64(data[8:]),
+		Message: string(data[16:]),
+	}
+}
@@ -0,0 +1,140 @@
+package netw
+
+import (
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// fairConn 公平队列中一个连接排队的任务
+type fairConn struct {
+	id      int64
+	tasks   []iface.Request
+	deficit int
+}
+
+// fairQueue 一个worker的普通优先级公平队列，按连接差额轮询(DRR)取出任务，同一连接的任务保持到达顺序
+type fairQueue struct {
+	lock   sync.Mutex
+	cond   *sync.Cond
+	conns  map[int64]*fairConn
+	ring   []*fairConn // 有排队任务的连接，按轮询顺序
+	pos    int
+	len    int
+	closed bool                 // 工作池已停止，pop不再阻塞
+	conf   func() *iface.Config // 所属MsgHandle的配置
+}
+
+func newFairQueue(conf func() *iface.Config) *fairQueue {
+	q := &fairQueue{conns: make(map[int64]*fairConn), conf: conf}
+	q.cond = sync.NewCond(&q.lock)
+	return q
+}
+
+// fairQuantum 每轮每个连接最多取出的任务数
+func fairQuantum(cfg *iface.Config) int {
+	if cfg.FairQuantum > 0 {
+		return cfg.FairQuantum
+	}
+	return 1
+}
+
+// push 将任务放入连接的队列，连接排队的任务达到MaxWorkerTaskLen时阻塞，只影响该连接
+func (q *fairQueue) push(connID int64, task iface.Request) {
+	q.lock.Lock()
+	fc := q.conns[connID]
+	for !q.closed && fc != nil && len(fc.tasks) >= int(maxWorkerTaskLen(q.conf())) {
+		q.cond.Wait()
+		fc = q.conns[connID]
+	}
+	if q.closed {
+		q.lock.Unlock()
+		return
+	}
+	if fc == nil {
+		fc = &fairConn{id: connID}
+		q.conns[connID] = fc
+		q.ring = append(q.ring, fc)
+	}
+	fc.tasks = append(fc.tasks, task)
+	q.len++
+	q.lock.Unlock()
+	q.cond.Broadcast()
+}
+
+// pop 按差额轮询取出下一个任务，队列为空时阻塞，队列关闭后返回false
+func (q *fairQueue) pop() (iface.Request, bool) {
+	q.lock.Lock()
+	for !q.closed && len(q.ring) == 0 {
+		q.cond.Wait()
+	}
+	if q.closed {
+		q.lock.Unlock()
+		return nil, false
+	}
+	fc := q.ring[q.pos]
+	if fc.deficit <= 0 {
+		fc.deficit += fairQuantum(q.conf())
+	}
+	task := fc.tasks[0]
+	fc.tasks[0] = nil
+	fc.tasks = fc.tasks[1:]
+	fc.deficit--
+	q.len--
+	switch {
+	case len(fc.tasks) == 0:
+		// 没有排队任务的连接移出轮询，下次入队时重新计算额度
+		delete(q.conns, fc.id)
+		q.ring = append(q.ring[:q.pos], q.ring[q.pos+1:]...)
+		if q.pos >= len(q.ring) {
+			q.pos = 0
+		}
+	case fc.deficit <= 0:
+		q.pos = (q.pos + 1) % len(q.ring)
+	}
+	q.lock.Unlock()
+	q.cond.Broadcast()
+	return task, true
+}
+
+// close 关闭队列，唤醒阻塞的push与pop，之后入队的任务被丢弃
+func (q *fairQueue) close() {
+	q.lock.Lock()
+	q.closed = true
+	q.lock.Unlock()
+	q.cond.Broadcast()
+}
+
+// Len 排队中的任务数量
+func (q *fairQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.len
+}
+
+// connLoad 连接排队的任务占MaxWorkerTaskLen的比例
+func (q *fairQueue) connLoad(connID int64) float64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	fc := q.conns[connID]
+	if fc == nil {
+		return 0
+	}
+	return float64(len(fc.tasks)) / float64(maxWorkerTaskLen(q.conf()))
+}
+
+// pumpFair 按公平队列的顺序将任务交给worker，TaskQueue不带缓冲，worker空闲时才取出下一个任务
+func (mh *MsgHandle) pumpFair(workerID int) {
+	q := mh.pool.fair[workerID]
+	for {
+		task, ok := q.pop()
+		if !ok {
+			return
+		}
+		select {
+		case mh.TaskQueue[workerID] <- task:
+		case <-mh.pool.stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package netw_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+func TestFairDispatch(t *testing.T) {
+	s := newTestServer(t, func(c *iface.Config) {
+		c.WorkerPoolSize = 1
+		c.FairDispatch = true
+	})
+	gate := make(chan struct{})
+	var (
+		order []int64
+		lock  sync.Mutex
+		done  sync.WaitGroup
+	)
+	s.Handle(1, func(c *netw.Context) {
+		<-gate
+		lock.Lock()
+		order = append(order, c.Conn().GetConnID())
+		lock.Unlock()
+		done.Done()
+	})
+	flood, light := netwtest.NewConn(s), netwtest.NewConn(s)
+	const n = 10
+	done.Add(n + 1)
+	for i := 0; i < n; i++ {
+		s.GetMsgHandler().SendMsgToTaskQueue(netwtest.NewRequest(flood, 1, nil))
+	}
+	s.GetMsgHandler().SendMsgToTaskQueue(netwtest.NewRequest(light, 1, nil))
+	close(gate)
+	waitGroup(t, &done, time.Second)
+	// 按连接轮询，后到的连接不必等待先到连接的全部消息处理完
+	for i, id := range order {
+		if id == light.GetConnID() {
+			if i > 3 {
+				t.Fatalf("light conn handled at %d, order = %v", i, order)
+			}
+			return
+		}
+	}
+	t.Fatalf("light conn not handled, order = %v", order)
+}
+
+// waitGroup 等待wg完成，超过timeout时测试失败
+func waitGroup(t *testing.T, wg *sync.WaitGroup, timeout time.Duration) {
+	t.Helper()
+	ch := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(ch)
+	}()
+	select {
+	case <-ch:
+	case <-time.After(timeout):
+		t.Fatal("timeout")
+	}
+}
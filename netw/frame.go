@@ -0,0 +1,137 @@
+package netw
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+// frame 写goroutine待写出的一帧，data为nil时为StopWithMsg发出的关闭信号
+type frame struct {
+	messageType int
+	data        []byte
+}
+
+// 设置websocket帧类型对应的封包格式与编解码器，客户端首个消息帧的类型与MessageType不同时
+// 该连接改用对应的格式，如 WithFrameFormat(websocket.TextMessage, iface.FrameFormat{Packet: NewJSONPack(), Codec: codec.NewJSONCodec()})
+func WithFrameFormat(messageType int, format iface.FrameFormat) Option {
+	return func(s *Server) {
+		if s.frameFormats == nil {
+			s.frameFormats = make(map[int]*iface.FrameFormat)
+		}
+		s.frameFormats[messageType] = &format
+	}
+}
+
+// FrameFormat 获取websocket帧类型对应的封包格式与编解码器，未设置时为nil
+func (s *Server) FrameFormat(messageType int) *iface.FrameFormat {
+	return s.frameFormats[messageType]
+}
+
+// GetMessageType 获取连接出站消息的websocket帧类型
+func (c *Connection) GetMessageType() int {
+	if t := atomic.LoadInt32(&c.messageType); t != 0 {
+		return int(t)
+	}
+	return c.conf().MessageType
+}
+
+// SetMessageType 设置连接出站消息的websocket帧类型，覆盖全局MessageType，封包格式与编解码器随之切换
+func (c *Connection) SetMessageType(messageType int) {
+	atomic.StoreInt32(&c.messageType, int32(messageType))
+}
+
+// SendFrame 以指定的websocket帧类型发送单条消息，使用该帧类型对应的封包格式
+func (c *Connection) SendFrame(messageType int, msgID uint32, data []byte) error {
+	c.RLock()
+	if c.isClosed == true {
+		c.RUnlock()
+		return errors.New("connection closed when send frame")
+	}
+	c.RUnlock()
+	unlock := c.lockSend()
+	defer unlock()
+	msg, err := c.packFrame(messageType, msgChannel(c.conf(), msgID), msgID, 0, data)
+	if err != nil {
+		return c.packError(msgID, err)
+	}
+	return c.sendFrame(frame{messageType: messageType, data: msg})
+}
+
+// packet 帧类型对应的封包格式
+func (c *Connection) packet(messageType int) iface.Packet {
+	if messageType != c.conf().MessageType {
+		if f := c.Server.FrameFormat(messageType); f != nil && f.Packet != nil {
+			return f.Packet
+		}
+	}
+	return c.Server.Packet()
+}
+
+// acceptFrame 判断是否接受该类型的消息帧，客户端首个消息帧决定连接使用的帧类型
+func (c *Connection) acceptFrame(messageType int) bool {
+	if messageType != websocket.TextMessage && messageType != websocket.BinaryMessage {
+		return false
+	}
+	if atomic.LoadInt32(&c.messageType) == 0 && messageType != c.conf().MessageType {
+		if c.Server.FrameFormat(messageType) == nil {
+			return false
+		}
+		atomic.CompareAndSwapInt32(&c.messageType, 0, int32(messageType))
+	}
+	return messageType == c.GetMessageType()
+}
+
+// jsonFrame JSONPack的消息格式，消息内容为合法JSON时放在data中，否则以base64放在bin中
+type jsonFrame struct {
+	ID    uint32          `json:"id"`
+	Seq   uint64          `json:"seq,omitempty"`
+	ReqID uint64          `json:"req,omitempty"`
+	Ch    uint8           `json:"ch,omitempty"`
+	Data  json.RawMessage `json:"data,omitempty"`
+	Bin   []byte          `json:"bin,omitempty"`
+}
+
+// JSONPack 文本帧的JSON封包格式，如 {"id":1,"req":3,"data":{"name":"a"}}，便于调试客户端直接收发
+type JSONPack struct{}
+
+// NewJSONPack 创建JSON封包格式
+func NewJSONPack() iface.Packet {
+	return &JSONPack{}
+}
+
+// Pack 封包方法
+func (jp *JSONPack) Pack(msg iface.Message) ([]byte, error) {
+	f := jsonFrame{ID: msg.GetMsgID(), Seq: msg.GetSeq(), ReqID: msg.GetReqID(), Ch: msg.GetChannel()}
+	if data := msg.GetData(); json.Valid(data) {
+		f.Data = data
+	} else {
+		f.Bin = data
+	}
+	payload, err := json.Marshal(f)
+	if err != nil {
+		return nil, err
+	}
+	buf := GetBuffer(len(payload))
+	copy(buf, payload)
+	return buf, nil
+}
+
+// Unpack 拆包方法
+func (jp *JSONPack) Unpack(data []byte) (iface.Message, error) {
+	var f jsonFrame
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	msg := newPoolMessage()
+	msg.ID, msg.Seq, msg.ReqID, msg.Channel = f.ID, f.Seq, f.ReqID, f.Ch
+	msg.Data = f.Data
+	if f.Data == nil {
+		msg.Data = f.Bin
+	}
+	return msg, nil
+}
@@ -0,0 +1,21 @@
+//go:build gofuzz
+// +build gofuzz
+
+package netw
+
+// Fuzz go-fuzz入口，以全部FuzzPackets校验data
+func Fuzz(data []byte) int {
+	valid := false
+	for _, p := range FuzzPackets() {
+		if err := CheckPacket(p, data); err != nil {
+			panic(err)
+		}
+		if msg, err := p.Unpack(data); err == nil && msg != nil {
+			valid = true
+		}
+	}
+	if valid {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,18 @@
+package netw_test
+
+import (
+	"testing"
+
+	"github.com/xiaomingping/game/netw"
+)
+
+func TestCheckPacketSeeds(t *testing.T) {
+	seeds := netw.FuzzSeeds()
+	for i, p := range netw.FuzzPackets() {
+		for j, seed := range seeds {
+			if err := netw.CheckPacket(p, seed); err != nil {
+				t.Errorf("packet %d (%T) seed %d: %v", i, p, j, err)
+			}
+		}
+	}
+}
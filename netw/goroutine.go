@@ -0,0 +1,157 @@
+package netw
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// goroutineLeaks 连接关闭后等待超时仍未退出的goroutine数量
+var goroutineLeaks uint64
+
+// GoroutineLeaks 连接关闭后超过GoWaitTimeout仍未退出的c.Go goroutine累计数量
+func GoroutineLeaks() uint64 {
+	return atomic.LoadUint64(&goroutineLeaks)
+}
+
+// connGoroutine c.Go启动的goroutine
+type connGoroutine struct {
+	id    uint64 // goroutine的ID，用于识别在其中调用的Stop
+	start time.Time
+	stack []byte // 开启GoLeakDetect时记录启动位置
+}
+
+// Go 启动绑定到连接的goroutine，连接关闭时ctx被取消，Stop最多等待GoWaitTimeout让其退出；
+// 连接已关闭时不再启动，fn中的panic被恢复并记录错误
+func (c *Connection) Go(fn func(ctx context.Context)) {
+	c.goLock.Lock()
+	if c.goClosed {
+		c.goLock.Unlock()
+		c.Logger().Warn("conn goroutine not started, conn closed")
+		return
+	}
+	g := &connGoroutine{start: time.Now()}
+	if c.conf().GoLeakDetect {
+		g.stack = debug.Stack()
+	}
+	if c.goroutines == nil {
+		c.goroutines = make(map[*connGoroutine]struct{})
+	}
+	c.goroutines[g] = struct{}{}
+	c.goLock.Unlock()
+	go func() {
+		defer c.goExit(g)
+		defer func() {
+			if err := recover(); err != nil {
+				c.AddError()
+				c.Logger().Error("conn goroutine panic ", err, "\n", string(debug.Stack()))
+			}
+		}()
+		pprof.SetGoroutineLabels(pprof.WithLabels(c.ctx, c.pprofLabels("go")))
+		g.setID()
+		fn(c.ctx)
+	}()
+}
+
+// goExit 移除已退出的goroutine并通知等待中的Stop
+func (c *Connection) goExit(g *connGoroutine) {
+	c.goLock.Lock()
+	delete(c.goroutines, g)
+	c.goLock.Unlock()
+	select {
+	case c.goExited <- struct{}{}:
+	default:
+	}
+}
+
+// waitGoroutines 等待c.Go启动的goroutine退出，在其中调用Stop时不等待自身
+func (c *Connection) waitGoroutines() {
+	c.goLock.Lock()
+	c.goClosed = true
+	c.goLock.Unlock()
+	timeout := goWaitTimeout(c.conf())
+	if timeout <= 0 {
+		return
+	}
+	self := currentGoroutineID()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		remaining := c.runningGoroutines(self)
+		if len(remaining) == 0 {
+			return
+		}
+		select {
+		case <-c.goExited:
+		case <-timer.C:
+			c.reportLeaks(c.runningGoroutines(self))
+			return
+		}
+	}
+}
+
+// runningGoroutines 仍在运行的goroutine，不含self
+func (c *Connection) runningGoroutines(self uint64) []*connGoroutine {
+	c.goLock.Lock()
+	defer c.goLock.Unlock()
+	var remaining []*connGoroutine
+	for g := range c.goroutines {
+		if g.getID() != self {
+			remaining = append(remaining, g)
+		}
+	}
+	return remaining
+}
+
+// reportLeaks 记录连接关闭后仍未退出的goroutine
+func (c *Connection) reportLeaks(leaked []*connGoroutine) {
+	if len(leaked) == 0 {
+		return
+	}
+	atomic.AddUint64(&goroutineLeaks, uint64(len(leaked)))
+	for _, g := range leaked {
+		if g.stack != nil {
+			c.Logger().Warn("conn goroutine leaked, running ", time.Since(g.start).Truncate(time.Millisecond), " started at\n", string(g.stack))
+		}
+	}
+	if !c.conf().GoLeakDetect {
+		c.Logger().Warn("conn goroutines leaked count = ", len(leaked), ", enable GoLeakDetect for stacks")
+	}
+}
+
+func goWaitTimeout(cfg *iface.Config) time.Duration {
+	if cfg.GoWaitTimeout < 0 {
+		return 0
+	}
+	if cfg.GoWaitTimeout == 0 {
+		return time.Second
+	}
+	return time.Millisecond * time.Duration(cfg.GoWaitTimeout)
+}
+
+func (g *connGoroutine) setID() {
+	atomic.StoreUint64(&g.id, currentGoroutineID())
+}
+
+func (g *connGoroutine) getID() uint64 {
+	return atomic.LoadUint64(&g.id)
+}
+
+// currentGoroutineID 从栈信息的首行 "goroutine 123 [running]:" 中解析当前goroutine的ID
+func currentGoroutineID() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	if i := bytes.IndexByte(buf, ' '); i > 0 {
+		buf = buf[:i]
+	}
+	id, _ := strconv.ParseUint(string(buf), 10, 64)
+	return id
+}
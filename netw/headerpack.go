@@ -0,0 +1,255 @@
+package netw
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+/*
+	HeaderPack 带版本与标志位的封包格式，全部字段为小端序:
+	| magic 2B | version 1B | flags 1B | msgID 4B | [seq 8B] | [reqID 8B] | [channel 1B] | dataLen 4B | [crc32 4B] | data |
+	seq 在 FlagSeq 置位时存在，reqID 在 FlagReqID 置位时存在，channel 在 FlagChannel 置位时存在，
+	crc32 在 FlagCRC 置位时存在，校验范围为 data；FlagEncrypted 置位时 data 为连接加密器加密后的密文
+*/
+
+const (
+	// HeaderMagic 包头魔数
+	HeaderMagic uint16 = 0x4D47
+	// HeaderVersion 当前协议版本
+	HeaderVersion uint8 = 1
+	// headerFixedLen 固定包头长度: magic + version + flags + msgID + dataLen
+	headerFixedLen = 2 + 1 + 1 + 4 + 4
+)
+
+// 包头标志位
+const (
+	FlagCompressed uint8 = 1 << iota // 消息内容经过gzip压缩
+	FlagEncrypted                    // 消息内容经过加密，由连接的加密器解密
+	FlagSeq                          // 包头带有消息序号
+	FlagCRC                          // 包头带有CRC32校验和
+	FlagReqID                        // 包头带有请求ID
+	FlagChannel                      // 包头带有逻辑通道ID
+)
+
+var (
+	ErrBadMagic           = errors.New("packet: bad magic")
+	ErrUnsupportedVersion = errors.New("packet: unsupported version")
+	ErrPacketTooLarge     = errors.New("packet: packet too large")
+	ErrBadLength          = errors.New("packet: data length mismatch")
+	ErrChecksum           = errors.New("packet: checksum mismatch")
+	ErrIncomplete         = errors.New("packet: incomplete packet, need more data")
+	ErrCorrupt            = errors.New("packet: corrupt packet")
+	ErrMsgIDOverflow      = errors.New("packet: msgID overlaps flag bits")
+	// ErrEncryptionMismatch 包头的FlagEncrypted与连接是否已完成密钥交换不一致
+	ErrEncryptionMismatch = errors.New("packet: encryption flag mismatch")
+)
+
+// IsIncomplete 拆包错误是否因数据不完整，流式传输可等待更多数据后重试
+func IsIncomplete(err error) bool {
+	return errors.Is(err, ErrIncomplete)
+}
+
+// IsCorrupt 拆包错误是否因数据损坏，重试无法恢复，应断开连接
+func IsCorrupt(err error) bool {
+	switch {
+	case errors.Is(err, ErrCorrupt), errors.Is(err, ErrBadMagic), errors.Is(err, ErrUnsupportedVersion),
+		errors.Is(err, ErrBadLength), errors.Is(err, ErrChecksum):
+		return true
+	}
+	return false
+}
+
+// PeekMsgID 按封包格式只读取包头中的msgID，不拆包；封包格式没有固定包头(如JSONPack)或包头不完整时返回false
+func PeekMsgID(p iface.Packet, binaryData []byte) (uint32, bool) {
+	peeker, ok := p.(interface {
+		PeekMsgID(binaryData []byte) (uint32, bool)
+	})
+	if !ok {
+		return 0, false
+	}
+	return peeker.PeekMsgID(binaryData)
+}
+
+// checkEncrypted HeaderPack拆出的消息的FlagEncrypted必须与连接是否已完成密钥交换一致，
+// 防止加密后的连接被降级为明文，其它封包格式不携带该标志位
+func checkEncrypted(p iface.Packet, msg iface.Message, encrypted bool) error {
+	if _, ok := p.(*HeaderPack); !ok {
+		return nil
+	}
+	if m, ok := msg.(*Message); ok && m.Encrypted != encrypted {
+		return ErrEncryptionMismatch
+	}
+	return nil
+}
+
+// HeaderPackOptions HeaderPack配置
+type HeaderPackOptions struct {
+	CompressThreshold int  // 消息内容超过该字节数时进行gzip压缩，0为不压缩
+	CRC               bool // 封包时附带CRC32校验和
+	MaxPacketSize     int  // 拆包时允许的最大包长度(含解压后)，0为不限制
+}
+
+// HeaderPack 带版本与标志位的封包拆包实例
+type HeaderPack struct {
+	opts HeaderPackOptions
+}
+
+// NewHeaderPack 创建带版本与标志位的封包拆包实例
+func NewHeaderPack(opts HeaderPackOptions) iface.Packet {
+	return &HeaderPack{opts: opts}
+}
+
+// Pack 封包方法
+func (hp *HeaderPack) Pack(msg iface.Message) ([]byte, error) {
+	var flags uint8
+	data := msg.GetData()
+	if hp.opts.CompressThreshold > 0 && len(data) > hp.opts.CompressThreshold {
+		compressed, err := gzipCompress(data)
+		if err != nil {
+			return nil, err
+		}
+		data = compressed
+		flags |= FlagCompressed
+	}
+	if m, ok := msg.(*Message); ok && m.Encrypted {
+		flags |= FlagEncrypted
+	}
+	if msg.GetSeq() > 0 {
+		flags |= FlagSeq
+	}
+	if msg.GetReqID() > 0 {
+		flags |= FlagReqID
+	}
+	if msg.GetChannel() > 0 {
+		flags |= FlagChannel
+	}
+	if hp.opts.CRC {
+		flags |= FlagCRC
+	}
+	headLen := headerFixedLen
+	if flags&FlagSeq != 0 {
+		headLen += 8
+	}
+	if flags&FlagReqID != 0 {
+		headLen += 8
+	}
+	if flags&FlagChannel != 0 {
+		headLen++
+	}
+	if flags&FlagCRC != 0 {
+		headLen += 4
+	}
+	dataBuff := GetBuffer(headLen + len(data))
+	binary.LittleEndian.PutUint16(dataBuff, HeaderMagic)
+	dataBuff[2] = HeaderVersion
+	dataBuff[3] = flags
+	binary.LittleEndian.PutUint32(dataBuff[4:], msg.GetMsgID())
+	offset := 8
+	if flags&FlagSeq != 0 {
+		binary.LittleEndian.PutUint64(dataBuff[offset:], msg.GetSeq())
+		offset += 8
+	}
+	if flags&FlagReqID != 0 {
+		binary.LittleEndian.PutUint64(dataBuff[offset:], msg.GetReqID())
+		offset += 8
+	}
+	if flags&FlagChannel != 0 {
+		dataBuff[offset] = msg.GetChannel()
+		offset++
+	}
+	binary.LittleEndian.PutUint32(dataBuff[offset:], uint32(len(data)))
+	offset += 4
+	if flags&FlagCRC != 0 {
+		binary.LittleEndian.PutUint32(dataBuff[offset:], crc32.ChecksumIEEE(data))
+	}
+	copy(dataBuff[headLen:], data)
+	return dataBuff, nil
+}
+
+// PeekMsgID 只读取包头中的msgID，不校验与解密消息内容
+func (hp *HeaderPack) PeekMsgID(binaryData []byte) (uint32, bool) {
+	if len(binaryData) < 8 || binary.LittleEndian.Uint16(binaryData) != HeaderMagic || binaryData[2] != HeaderVersion {
+		return 0, false
+	}
+	return binary.LittleEndian.Uint32(binaryData[4:]), true
+}
+
+// Unpack 拆包方法，包头或消息内容不完整时返回ErrIncomplete，其余格式错误见IsCorrupt
+func (hp *HeaderPack) Unpack(binaryData []byte) (iface.Message, error) {
+	if hp.opts.MaxPacketSize > 0 && len(binaryData) > hp.opts.MaxPacketSize {
+		return nil, ErrPacketTooLarge
+	}
+	if len(binaryData) < 4 {
+		return nil, ErrIncomplete
+	}
+	if binary.LittleEndian.Uint16(binaryData) != HeaderMagic {
+		return nil, ErrBadMagic
+	}
+	if binaryData[2] != HeaderVersion {
+		return nil, ErrUnsupportedVersion
+	}
+	flags := binaryData[3]
+	headLen := headerFixedLen
+	if flags&FlagSeq != 0 {
+		headLen += 8
+	}
+	if flags&FlagReqID != 0 {
+		headLen += 8
+	}
+	if flags&FlagChannel != 0 {
+		headLen++
+	}
+	if flags&FlagCRC != 0 {
+		headLen += 4
+	}
+	if len(binaryData) < headLen {
+		return nil, ErrIncomplete
+	}
+	msg := newPoolMessage()
+	msg.ID = binary.LittleEndian.Uint32(binaryData[4:])
+	msg.Encrypted = flags&FlagEncrypted != 0
+	offset := 8
+	if flags&FlagSeq != 0 {
+		msg.Seq = binary.LittleEndian.Uint64(binaryData[offset:])
+		offset += 8
+	}
+	if flags&FlagReqID != 0 {
+		msg.ReqID = binary.LittleEndian.Uint64(binaryData[offset:])
+		offset += 8
+	}
+	if flags&FlagChannel != 0 {
+		msg.Channel = binaryData[offset]
+		offset++
+	}
+	dataLen := uint64(binary.LittleEndian.Uint32(binaryData[offset:]))
+	offset += 4
+	var sum uint32
+	if flags&FlagCRC != 0 {
+		sum = binary.LittleEndian.Uint32(binaryData[offset:])
+	}
+	// 按uint64比较，避免32位平台上的溢出
+	if rest := uint64(len(binaryData) - headLen); dataLen != rest {
+		messagePool.Put(msg)
+		if dataLen > rest {
+			return nil, ErrIncomplete
+		}
+		return nil, ErrBadLength
+	}
+	msg.Data = binaryData[headLen:]
+	if flags&FlagCRC != 0 && crc32.ChecksumIEEE(msg.Data) != sum {
+		messagePool.Put(msg)
+		return nil, ErrChecksum
+	}
+	if flags&FlagCompressed != 0 {
+		data, err := gzipDecompress(msg.Data, hp.opts.MaxPacketSize)
+		if err != nil {
+			messagePool.Put(msg)
+			return nil, err
+		}
+		msg.Data = data
+	}
+	return msg, nil
+}
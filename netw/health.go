@@ -0,0 +1,231 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// HealthCheckTimeout 每项健康检查的超时时间
+	HealthCheckTimeout = 2 * time.Second
+	// HealthStallTimeout worker队列中有任务、但超过该时间没有处理完任何任务时存活检查失败
+	HealthStallTimeout = time.Minute
+
+	ErrServerStopping   = errors.New("netw: server stopping")
+	ErrNotAccepting     = errors.New("netw: not accepting new connections")
+	ErrListenerDown     = errors.New("netw: listener not serving")
+	ErrNoWorker         = errors.New("netw: no active worker")
+	ErrWorkerStalled    = errors.New("netw: worker stalled")
+	ErrWorkersSaturated = errors.New("netw: worker queues saturated")
+)
+
+const (
+	healthOK   = "ok"
+	healthFail = "fail"
+)
+
+// healthCheck 已注册的健康检查
+type healthCheck struct {
+	name  string
+	kind  iface.HealthKind
+	check iface.HealthCheck
+}
+
+// AddHealthCheck 注册存活或就绪检查，同名的检查会被替换；
+// 内置的检查为存活检查workers，就绪检查accepting、listeners、workers与overload
+func (s *Server) AddHealthCheck(name string, kind iface.HealthKind, check iface.HealthCheck) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	for i, c := range s.healthChecks {
+		if c.name == name && c.kind == kind {
+			s.healthChecks[i].check = check
+			return
+		}
+	}
+	s.healthChecks = append(s.healthChecks, healthCheck{name: name, kind: kind, check: check})
+}
+
+// CheckHealth 并发执行全部同类检查，每项检查最多等待HealthCheckTimeout
+func (s *Server) CheckHealth(ctx context.Context, kind iface.HealthKind) iface.HealthReport {
+	s.hookLock.RLock()
+	checks := make([]healthCheck, 0, len(s.healthChecks))
+	for _, c := range s.healthChecks {
+		if c.kind == kind {
+			checks = append(checks, c)
+		}
+	}
+	s.hookLock.RUnlock()
+	type result struct {
+		name string
+		err  error
+	}
+	results := make(chan result, len(checks))
+	for _, c := range checks {
+		go func(c healthCheck) {
+			cctx, cancel := context.WithTimeout(ctx, HealthCheckTimeout)
+			defer cancel()
+			results <- result{name: c.name, err: runHealthCheck(cctx, c.check)}
+		}(c)
+	}
+	report := iface.HealthReport{Status: healthOK, Checks: make(map[string]iface.HealthResult, len(checks))}
+	for range checks {
+		r := <-results
+		if r.err != nil {
+			report.Status = healthFail
+			report.Checks[r.name] = iface.HealthResult{Status: healthFail, Error: r.err.Error()}
+			continue
+		}
+		report.Checks[r.name] = iface.HealthResult{Status: healthOK}
+	}
+	return report
+}
+
+// runHealthCheck 执行检查，检查panic或超时未返回时视为失败
+func runHealthCheck(ctx context.Context, check iface.HealthCheck) (err error) {
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- check(ctx)
+	}()
+	select {
+	case err = <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// HealthHandler 健康检查HTTP处理方法，全部检查通过时返回200，否则返回503，内容为JSON格式的检查结果
+func (s *Server) HealthHandler(kind iface.HealthKind) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		report := s.CheckHealth(c.Request.Context(), kind)
+		status := http.StatusOK
+		if !report.OK() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, report)
+	}
+}
+
+// registerHealthChecks 注册内置的健康检查
+func (s *Server) registerHealthChecks() {
+	s.AddHealthCheck("workers", iface.HealthLiveness, s.checkWorkerStall)
+	s.AddHealthCheck("accepting", iface.HealthReadiness, s.checkAccepting)
+	s.AddHealthCheck("listeners", iface.HealthReadiness, s.checkListeners)
+	s.AddHealthCheck("workers", iface.HealthReadiness, s.checkWorkers)
+	s.AddHealthCheck("overload", iface.HealthReadiness, s.checkOverload)
+}
+
+func (s *Server) checkAccepting(ctx context.Context) error {
+	select {
+	case <-s.quit:
+		return ErrServerStopping
+	default:
+	}
+	if !s.IsAccepting() {
+		return ErrNotAccepting
+	}
+	return nil
+}
+
+// checkListeners 已启动的监听入口都在服务，配置了Listeners时至少启动一个入口
+func (s *Server) checkListeners(ctx context.Context) error {
+	s.listenerLock.Lock()
+	started := len(s.listeners)
+	s.listenerLock.Unlock()
+	if started == 0 && len(s.conf().Listeners) > 0 {
+		return fmt.Errorf("%w: 0/%d started", ErrListenerDown, len(s.conf().Listeners))
+	}
+	if serving := int(atomic.LoadInt32(&s.serving)); serving < started {
+		return fmt.Errorf("%w: %d/%d serving", ErrListenerDown, serving, started)
+	}
+	return nil
+}
+
+// checkWorkers 工作池有活跃worker且队列未满，未开启工作池时直接通过
+func (s *Server) checkWorkers(ctx context.Context) error {
+	stats := s.msgHandler.Stats()
+	if stats.MaxWorkers == 0 {
+		return nil
+	}
+	if stats.Workers == 0 {
+		return ErrNoWorker
+	}
+	capacity := int(s.conf().MaxWorkerTaskLen)
+	if capacity <= 0 {
+		return nil
+	}
+	for _, depth := range stats.QueueDepth {
+		if depth < capacity {
+			return nil
+		}
+	}
+	return ErrWorkersSaturated
+}
+
+func (s *Server) checkWorkerStall(ctx context.Context) error {
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if !ok {
+		return nil
+	}
+	if workerID, ok := mh.stalled(HealthStallTimeout); ok {
+		return fmt.Errorf("%w: worker %d", ErrWorkerStalled, workerID)
+	}
+	return nil
+}
+
+// checkOverload 触发过载保护时不再就绪，负载均衡将新连接分配到其它节点
+func (s *Server) checkOverload(ctx context.Context) error {
+	if reason := s.shedReason(); reason != "" {
+		return errors.New("netw: overload " + reason)
+	}
+	return nil
+}
+
+// stalled 查找队列中有任务、但超过timeout没有处理完任何任务的worker
+func (mh *MsgHandle) stalled(timeout time.Duration) (int, bool) {
+	active := int(atomic.LoadUint32(&mh.activeWorkers))
+	for i := 0; i < active && i < len(mh.pool.lastActive); i++ {
+		if mh.queueDepth(i) == 0 {
+			continue
+		}
+		if time.Since(time.Unix(0, atomic.LoadInt64(&mh.pool.lastActive[i]))) > timeout {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// startHealthServer 在HealthAddr上提供 /healthz 与 /readyz
+func (s *Server) startHealthServer() {
+	g := gin.New()
+	g.Use(gin.Recovery())
+	g.GET("/healthz", s.HealthHandler(iface.HealthLiveness))
+	g.GET("/readyz", s.HealthHandler(iface.HealthReadiness))
+	s.health = &http.Server{Addr: s.conf().HealthAddr, Handler: g}
+	go func() {
+		zap.S().Info("[START] health server listen ", s.conf().HealthAddr)
+		if err := s.health.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			zap.S().Error("health server error ", err)
+		}
+	}()
+}
+
+func (s *Server) stopHealthServer() {
+	ctx, cancel := context.WithTimeout(context.Background(), listenerShutdownTimeout)
+	defer cancel()
+	_ = s.health.Shutdown(ctx)
+}
@@ -0,0 +1,69 @@
+package netw
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+// pingInterval 服务端发送Ping帧的间隔
+func pingInterval(cfg *iface.Config) time.Duration {
+	if cfg.PingInterval > 0 {
+		return time.Second * time.Duration(cfg.PingInterval)
+	}
+	if d := time.Second * time.Duration(cfg.PingTime) / 2; d >= time.Second {
+		return d
+	}
+	return time.Second
+}
+
+// startPingPong 使用WebSocket控制帧心跳：定时发送Ping帧，收到Pong帧或客户端的Ping帧时记为心跳，
+// Ping帧的内容为发送时间，按Pong帧回复的内容测量往返延迟
+func (c *Connection) startPingPong() {
+	c.Conn.SetPongHandler(func(data string) error {
+		c.SetPing()
+		c.observeRTT([]byte(data))
+		return c.extendReadDeadline()
+	})
+	c.Conn.SetPingHandler(func(data string) error {
+		c.SetPing()
+		if err := c.extendReadDeadline(); err != nil {
+			return err
+		}
+		// 与默认处理一致回复Pong帧
+		err := c.Conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		}
+		return err
+	})
+	c.schedulePing()
+}
+
+// schedulePing 在pingInterval后发送下一个Ping帧，连接关闭后停止
+func (c *Connection) schedulePing() {
+	c.timers.AddTimer(pingInterval(c.conf()), func() {
+		// 回调在时间轮goroutine中执行，写控制帧可能阻塞
+		go c.ping()
+	})
+}
+
+func (c *Connection) ping() {
+	c.RLock()
+	closed := c.isClosed
+	c.RUnlock()
+	if closed {
+		return
+	}
+	if err := c.Conn.WriteControl(websocket.PingMessage, c.newRTTProbe(), time.Now().Add(pingInterval(c.conf()))); err != nil {
+		c.Logger().Debug("write ping error ", err)
+		return
+	}
+	c.schedulePing()
+}
+
+// usePingPong 是否使用WebSocket控制帧心跳
+func usePingPong(cfg *iface.Config) bool {
+	return cfg.HeartbeatMode == iface.HeartbeatPingPong
+}
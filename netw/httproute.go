@@ -0,0 +1,70 @@
+package netw
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// httpRoute 监听入口上的普通HTTP路由
+type httpRoute struct {
+	method   string
+	path     string
+	handlers []gin.HandlerFunc
+}
+
+// HandleHTTP 在全部监听入口上注册普通HTTP路由，如版本号与运维页面，与websocket路径共用端口；
+// 需在Listen之前注册，之后注册的路由在Restart后生效
+func (s *Server) HandleHTTP(method, path string, handlers ...gin.HandlerFunc) {
+	s.listenerLock.Lock()
+	defer s.listenerLock.Unlock()
+	s.httpRoutes = append(s.httpRoutes, httpRoute{method: method, path: path, handlers: handlers})
+}
+
+// Static 在全部监听入口上以dir目录下的文件响应prefix下的GET与HEAD请求，如web客户端的资源包；
+// prefix为"/"时只响应其它路由都未匹配的请求，目录请求返回其中的index.html
+func (s *Server) Static(prefix, dir string) {
+	if prefix == "" || prefix == "/" {
+		s.listenerLock.Lock()
+		s.staticRoot = dir
+		s.listenerLock.Unlock()
+		return
+	}
+	prefix = "/" + strings.Trim(prefix, "/")
+	handler := staticHandler(prefix, dir)
+	s.HandleHTTP(http.MethodGet, prefix+"/*filepath", handler)
+	s.HandleHTTP(http.MethodHead, prefix+"/*filepath", handler)
+}
+
+// staticHandler 去掉prefix后以dir目录下的文件响应
+func staticHandler(prefix, dir string) gin.HandlerFunc {
+	fs := http.StripPrefix(prefix, http.FileServer(http.Dir(dir)))
+	return func(c *gin.Context) {
+		fs.ServeHTTP(c.Writer, c.Request)
+	}
+}
+
+// mountHTTP 将已注册的HTTP路由挂载到监听入口，dir不为空时以该目录响应未匹配的GET与HEAD请求
+func (s *Server) mountHTTP(g *gin.Engine, dir string) {
+	s.listenerLock.Lock()
+	routes := s.httpRoutes
+	if dir == "" {
+		dir = s.staticRoot
+	}
+	s.listenerLock.Unlock()
+	for _, r := range routes {
+		g.Handle(r.method, r.path, r.handlers...)
+	}
+	if dir == "" {
+		return
+	}
+	root := staticHandler("", dir)
+	g.NoRoute(func(c *gin.Context) {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		root(c)
+	})
+}
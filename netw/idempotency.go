@@ -0,0 +1,131 @@
+package netw
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrCodeDuplicate 重复请求被拒绝时回复的错误码
+const ErrCodeDuplicate int32 = 3
+
+// IdempotencyKey 计算请求的幂等键，默认为 用户ID(未鉴权时为ConnID):MsgID:请求ID，
+// 客户端超时重试时需复用原请求ID；可替换为从消息内容中读取客户端生成的幂等键，返回空时不去重
+var IdempotencyKey = func(request iface.Request) string {
+	reqID := request.GetReqID()
+	if reqID == 0 {
+		return ""
+	}
+	conn := request.GetConnection()
+	owner := conn.GetUID()
+	if owner == "" {
+		owner = "conn:" + strconv.FormatInt(conn.GetConnID(), 10)
+	}
+	return owner + ":" + strconv.FormatUint(uint64(request.GetMsgID()), 10) + ":" + strconv.FormatUint(reqID, 10)
+}
+
+// MemoryIdempotencyStore 内存幂等键存储
+type MemoryIdempotencyStore struct {
+	keys   map[string]time.Time // 幂等键对应的过期时间
+	writes int                  // 写入次数，每sweepEvery次清理一次过期的键
+	clock  clock.Clock
+	lock   sync.Mutex
+}
+
+const sweepEvery = 1024
+
+// NewMemoryIdempotencyStore 创建内存幂等键存储
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{keys: make(map[string]time.Time), clock: clk}
+}
+
+// SetClock 设置判断过期使用的时钟，挂载到Server的内存存储使用Server的时钟
+func (m *MemoryIdempotencyStore) SetClock(c clock.Clock) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.clock = c
+}
+
+// SetNX key不存在或已过期时写入并返回true
+func (m *MemoryIdempotencyStore) SetNX(key string, ttl time.Duration) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.clock.Now()
+	if expire, ok := m.keys[key]; ok && now.Before(expire) {
+		return false, nil
+	}
+	m.keys[key] = now.Add(ttl)
+	m.writes++
+	if m.writes >= sweepEvery {
+		m.writes = 0
+		for k, expire := range m.keys {
+			if !now.Before(expire) {
+				delete(m.keys, k)
+			}
+		}
+	}
+	return true, nil
+}
+
+// idempotencyWindow 幂等键的有效期
+func idempotencyWindow(cfg *iface.Config) time.Duration {
+	if cfg.IdempotencyWindow > 0 {
+		return time.Second * time.Duration(cfg.IdempotencyWindow)
+	}
+	return time.Minute
+}
+
+// idempotentMsgID 是否为需要去重的MsgID
+func idempotentMsgID(cfg *iface.Config, msgID uint32) bool {
+	for _, id := range cfg.IdempotentMsgIDs {
+		if id == msgID {
+			return true
+		}
+	}
+	return false
+}
+
+// idempotencyMiddleware 幂等中间件，IdempotentMsgIDs中的请求在窗口期内重复时回复ErrCodeDuplicate并丢弃
+func (s *Server) idempotencyMiddleware(next iface.HandlerFunc) iface.HandlerFunc {
+	return func(request iface.Request) {
+		if len(s.conf().IdempotentMsgIDs) == 0 || !idempotentMsgID(s.conf(), request.GetMsgID()) {
+			next(request)
+			return
+		}
+		key := IdempotencyKey(request)
+		if key == "" {
+			next(request)
+			return
+		}
+		ok, err := s.idempotency.SetNX(key, idempotencyWindow(s.conf()))
+		if err != nil {
+			// 存储不可用时放行，避免敏感请求全部失败
+			request.Logger().Warn("idempotency store error ", err)
+			next(request)
+			return
+		}
+		if !ok {
+			request.Logger().Info("duplicate request rejected key = ", key)
+			_ = request.Fail(ErrCodeDuplicate)
+			return
+		}
+		next(request)
+	}
+}
+
+// checkInboundSeq 开启InboundSeqCheck时校验客户端消息序号严格递增，拒绝重放与缺少序号的消息，只在读goroutine中调用
+func (c *Connection) checkInboundSeq(seq uint64) bool {
+	if !c.conf().InboundSeqCheck {
+		return true
+	}
+	last := atomic.LoadUint64(&c.inboundSeq)
+	if seq <= last {
+		return false
+	}
+	atomic.StoreUint64(&c.inboundSeq, seq)
+	return true
+}
@@ -0,0 +1,106 @@
+package netw
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var ErrBadNodeID = errors.New("netw: snowflake node id out of range")
+
+// SequenceIDGenerator 进程内自增ID
+type SequenceIDGenerator struct {
+	seq int64
+}
+
+// NewSequenceIDGenerator 创建进程内自增ID生成器，ID从1开始
+func NewSequenceIDGenerator() *SequenceIDGenerator {
+	return &SequenceIDGenerator{}
+}
+
+// NextID 生成下一个ID
+func (g *SequenceIDGenerator) NextID() int64 {
+	return atomic.AddInt64(&g.seq, 1)
+}
+
+const (
+	snowflakeNodeBits = 10
+	snowflakeSeqBits  = 12
+	// SnowflakeMaxNode 雪花算法允许的最大节点ID
+	SnowflakeMaxNode = 1<<snowflakeNodeBits - 1
+	snowflakeMaxSeq  = 1<<snowflakeSeqBits - 1
+)
+
+// SnowflakeEpoch 雪花算法的起始时间
+var SnowflakeEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Snowflake 雪花算法ID生成器：| 毫秒时间戳 41位 | 节点ID 10位 | 毫秒内序号 12位 |，
+// 集群内节点ID不同时ID全局唯一，且按生成时间递增
+type Snowflake struct {
+	node  int64
+	last  int64 // 上一次生成ID的毫秒时间戳
+	seq   int64
+	epoch time.Time
+	lock  sync.Mutex
+}
+
+// NewSnowflake 创建雪花算法ID生成器，nodeID取值范围0~SnowflakeMaxNode
+func NewSnowflake(nodeID int64) (*Snowflake, error) {
+	if nodeID < 0 || nodeID > SnowflakeMaxNode {
+		return nil, ErrBadNodeID
+	}
+	return &Snowflake{node: nodeID, epoch: SnowflakeEpoch}, nil
+}
+
+// NextID 生成下一个ID，同一毫秒内序号用完或时钟回拨时等待到下一毫秒
+func (sf *Snowflake) NextID() int64 {
+	sf.lock.Lock()
+	defer sf.lock.Unlock()
+	now := sf.millis()
+	if now < sf.last {
+		// 时钟回拨，沿用上一次的时间戳继续分配序号
+		now = sf.last
+	}
+	if now == sf.last {
+		sf.seq = (sf.seq + 1) & snowflakeMaxSeq
+		if sf.seq == 0 {
+			for now <= sf.last {
+				time.Sleep(100 * time.Microsecond)
+				now = sf.millis()
+			}
+		}
+	} else {
+		sf.seq = 0
+	}
+	sf.last = now
+	return now<<(snowflakeNodeBits+snowflakeSeqBits) | sf.node<<snowflakeSeqBits | sf.seq
+}
+
+func (sf *Snowflake) millis() int64 {
+	return time.Since(sf.epoch).Milliseconds()
+}
+
+// SnowflakeTime 雪花算法ID的生成时间
+func SnowflakeTime(id int64) time.Time {
+	return SnowflakeEpoch.Add(time.Duration(id>>(snowflakeNodeBits+snowflakeSeqBits)) * time.Millisecond)
+}
+
+// SnowflakeNode 雪花算法ID的节点ID
+func SnowflakeNode(id int64) int64 {
+	return id >> snowflakeSeqBits & SnowflakeMaxNode
+}
+
+// workerIndex 连接对应的worker，同一连接始终由同一worker处理
+func workerIndex(connID int64, workers uint32) uint32 {
+	return uint32(mixID(connID) % uint64(workers))
+}
+
+// mixID 打散ID的低位，雪花算法ID低位多为0，直接取模会集中到少数分片或worker
+func mixID(id int64) uint64 {
+	x := uint64(id)
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	return x
+}
@@ -0,0 +1,58 @@
+package netw
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// startLifecycleTimers 按配置开启鉴权、空闲与最长存活三个阶段的超时检测
+func (c *Connection) startLifecycleTimers() {
+	atomic.StoreInt64(&c.lastActive, clockOf(c.Server).Now().UnixNano())
+	if c.conf().AuthTimeout > 0 {
+		c.timers.AddTimer(time.Second*time.Duration(c.conf().AuthTimeout), func() {
+			if !c.IsAuthenticated() {
+				go c.lifecycleTimeout(iface.TimeoutAuth)
+			}
+		})
+	}
+	if c.conf().IdleTimeout > 0 {
+		c.checkIdle(time.Second * time.Duration(c.conf().IdleTimeout))
+	}
+	if c.conf().MaxSessionDuration > 0 {
+		c.timers.AddTimer(time.Second*time.Duration(c.conf().MaxSessionDuration), func() {
+			go c.lifecycleTimeout(iface.TimeoutSession)
+		})
+	}
+}
+
+// checkIdle 在最后一次收到消息的timeout之后检查，期间有新消息时顺延
+func (c *Connection) checkIdle(timeout time.Duration) {
+	last := time.Unix(0, atomic.LoadInt64(&c.lastActive))
+	wait := timeout - clockOf(c.Server).Since(last)
+	if wait <= 0 {
+		go c.lifecycleTimeout(iface.TimeoutIdle)
+		return
+	}
+	c.timers.AddTimer(wait, func() { c.checkIdle(timeout) })
+}
+
+// touch 记录收到消息的时间
+func (c *Connection) touch() {
+	atomic.StoreInt64(&c.lastActive, clockOf(c.Server).Now().UnixNano())
+}
+
+// lifecycleTimeout 调用超时阶段的Hook函数后关闭连接
+func (c *Connection) lifecycleTimeout(stage iface.TimeoutStage) {
+	c.RLock()
+	closed := c.isClosed
+	c.RUnlock()
+	if closed {
+		return
+	}
+	c.Logger().Info("lifecycle timeout stage = ", stage)
+	c.Server.CallOnLifecycleTimeout(c, stage)
+	c.setCloseReason(ErrLifecycleTimeout)
+	c.Stop()
+}
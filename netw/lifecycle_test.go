@@ -0,0 +1,56 @@
+package netw_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+func TestIdleTimeoutFakeClock(t *testing.T) {
+	fake := clock.NewFake(time.Time{})
+	s, err := netw.NewOptions().Configure(func(c *iface.Config) {
+		c.IdleTimeout = 5
+	}).With(netw.WithClock(fake)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	s.Handle(1, reply(101))
+	idle := make(chan struct{})
+	s.SetOnLifecycleTimeout(iface.TimeoutIdle, func(iface.Connection) { close(idle) })
+	tr := netwtest.NewServerTransport(s)
+	t.Cleanup(func() { _ = tr.Close() })
+	client, err := tr.Dial("/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	// 收到回复时空闲检测已开始计时
+	if err := client.Send(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	client.Expect(t, 101)
+
+	fake.Advance(4 * time.Second)
+	if err := client.Send(1, nil); err != nil {
+		t.Fatal(err)
+	}
+	client.Expect(t, 101)
+	// 第4秒收到消息，空闲时间从第4秒起算
+	fake.Advance(4 * time.Second)
+	select {
+	case <-idle:
+		t.Fatal("idle timeout before IdleTimeout since last message")
+	case <-time.After(50 * time.Millisecond):
+	}
+	fake.Advance(2 * time.Second)
+	select {
+	case <-idle:
+	case <-time.After(time.Second):
+		t.Fatal("no idle timeout after IdleTimeout")
+	}
+}
@@ -0,0 +1,173 @@
+package netw
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// listenerTagKey gin上下文中保存入口标签的Key
+const listenerTagKey = "netw.listener"
+
+// listenerShutdownTimeout Stop时等待监听入口关闭的时间
+const listenerShutdownTimeout = 5 * time.Second
+
+// ServeTagged 挂载到自有gin路由的处理方法，建立的连接带有入口标签tag
+func (s *Server) ServeTagged(tag string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(listenerTagKey, tag)
+		s.Start(c)
+	}
+}
+
+// Listen 启动一个监听入口，监听失败时返回错误，Stop时关闭
+func (s *Server) Listen(l iface.Listener) error {
+	path := l.Path
+	if path == "" {
+		path = "/ws"
+	}
+	g := gin.New()
+	g.Use(gin.Recovery())
+	g.GET(path, s.ServeTagged(l.Tag))
+	s.mountHTTP(g, l.StaticDir)
+	lis, err := net.Listen("tcp", l.Addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: g, ReadHeaderTimeout: handshakeTimeout(s.conf())}
+	serveTLS := l.CertFile != "" && l.KeyFile != ""
+	if l.ProxyProtocol {
+		pl := &proxyListener{Listener: lis}
+		// PROXY protocol头在TLS握手之前，由监听器进行TLS握手，ConnContext才能找到其下的PROXY protocol连接
+		if serveTLS {
+			cert, err := tls.LoadX509KeyPair(l.CertFile, l.KeyFile)
+			if err != nil {
+				_ = lis.Close()
+				return err
+			}
+			pl.tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, NextProtos: []string{"http/1.1"}}
+			serveTLS = false
+		}
+		lis = pl
+		srv.ConnContext = pl.connContext
+	}
+	s.listenerLock.Lock()
+	s.listeners = append(s.listeners, srv)
+	s.listenerLock.Unlock()
+	atomic.AddInt32(&s.serving, 1)
+	go func() {
+		defer atomic.AddInt32(&s.serving, -1)
+		zap.S().Info("[START] listener tag = ", l.Tag, " addr = ", lis.Addr(), " path = ", path)
+		if serveTLS {
+			err = srv.ServeTLS(lis, l.CertFile, l.KeyFile)
+		} else {
+			err = srv.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			zap.S().Error("listener tag = ", l.Tag, " error ", err)
+		}
+	}()
+	return nil
+}
+
+// ListenAndServe 启动配置中的全部监听入口，任一入口监听失败时关闭已启动的入口并返回错误
+func (s *Server) ListenAndServe() error {
+	for _, l := range s.conf().Listeners {
+		if err := s.Listen(l); err != nil {
+			s.closeListeners()
+			return err
+		}
+	}
+	return nil
+}
+
+// Run 依次调用OnStart Hook函数并启动配置中的全部监听入口，之后阻塞到收到SIGINT、SIGTERM或调用Stop，
+// 返回前Server已停止；Hook函数或监听入口启动失败时停止服务并返回错误
+func (s *Server) Run() error {
+	s.hookLock.RLock()
+	onStart := s.onStart
+	s.hookLock.RUnlock()
+	for _, fn := range onStart {
+		if err := fn(); err != nil {
+			s.Stop()
+			return err
+		}
+	}
+	if err := s.ListenAndServe(); err != nil {
+		s.Stop()
+		return err
+	}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	select {
+	case sig := <-signals:
+		zap.S().Info("[STOP] received signal ", sig)
+		s.Stop()
+	case <-s.quit:
+	}
+	<-s.stopped
+	return nil
+}
+
+// Restart 依次调用OnRestart Hook函数后关闭并重新启动配置中的全部监听入口，
+// 已建立的连接不受影响，可在热更新Listeners或更换证书文件后调用
+func (s *Server) Restart() error {
+	select {
+	case <-s.quit:
+		return ErrServerStopping
+	default:
+	}
+	s.restartLock.Lock()
+	defer s.restartLock.Unlock()
+	s.hookLock.RLock()
+	onRestart := s.onRestart
+	s.hookLock.RUnlock()
+	for _, fn := range onRestart {
+		fn()
+	}
+	zap.S().Info("[RESTART] listeners...")
+	s.closeListeners()
+	return s.ListenAndServe()
+}
+
+// AddOnStart 追加Run启动监听入口之前的Hook函数，如启动集群网关，返回错误时停止启动
+func (s *Server) AddOnStart(hookFunc func() error) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	s.onStart = append(s.onStart, hookFunc)
+}
+
+// AddOnRestart 追加Restart关闭监听入口之前的Hook函数
+func (s *Server) AddOnRestart(hookFunc func()) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	s.onRestart = append(s.onRestart, hookFunc)
+}
+
+// closeListeners 关闭全部监听入口，不再接受新连接
+func (s *Server) closeListeners() {
+	s.listenerLock.Lock()
+	listeners := s.listeners
+	s.listeners = nil
+	s.listenerLock.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), listenerShutdownTimeout)
+	defer cancel()
+	for _, srv := range listeners {
+		// websocket连接已被劫持，Shutdown只等待普通HTTP请求
+		if err := srv.Shutdown(ctx); err != nil {
+			zap.S().Warn("listener shutdown error ", err)
+		}
+	}
+}
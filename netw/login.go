@@ -0,0 +1,59 @@
+package netw
+
+import (
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+var (
+	ErrDuplicateLogin = errors.New("netw: duplicate login")
+
+	// KickedReason 重复登录时下发给被踢出旧连接的原因
+	KickedReason = "logged in elsewhere"
+	// RejectedReason 重复登录被拒绝时下发给新连接的原因
+	RejectedReason = "already logged in"
+)
+
+// login 按DuplicateLogin策略绑定用户ID，踢出的旧连接在调用OnDuplicateLogin Hook函数后异步断开；
+// 命名空间内以NamespaceUID绑定，其它命名空间的相同用户ID不算重复登录
+func (c *Connection) login(uid string) error {
+	connMgr := c.Server.GetConnMgr()
+	others, err := connMgr.BindUID(c, NamespaceUID(c.GetNamespace(), uid), c.conf().DuplicateLogin)
+	if err != nil {
+		for _, old := range others {
+			c.Server.CallOnDuplicateLogin(old, c)
+		}
+		return err
+	}
+	if c.conf().DuplicateLogin != iface.DuplicateKickOld {
+		return nil
+	}
+	for _, old := range others {
+		c.Server.CallOnDuplicateLogin(old, c)
+		go stopWithReason(old, c.conf().DuplicateLoginMsgID, KickedReason)
+	}
+	return nil
+}
+
+// stopWithReason msgID不为0时下发原因后断开连接
+func stopWithReason(conn iface.Connection, msgID uint32, reason string) {
+	conn.Logger().Info("duplicate login, stop conn reason = ", reason)
+	setCloseReason(conn, ErrDuplicateLogin)
+	if msgID != 0 {
+		conn.StopWithMsg(msgID, []byte(reason))
+		return
+	}
+	conn.Stop()
+}
+
+// rejectBeforeStart 连接启动前直接写出原因后关闭连接，此时写goroutine尚未运行
+func (c *Connection) rejectBeforeStart(msgID uint32, reason string) {
+	if msgID != 0 {
+		if data, err := c.pack(msgID, 0, []byte(reason)); err == nil {
+			_ = c.writeMessage(c.GetMessageType(), data)
+		}
+	}
+	c.setCloseReason(ErrDuplicateLogin)
+	c.Stop()
+}
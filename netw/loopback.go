@@ -0,0 +1,145 @@
+package netw
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+var ErrLoopbackClosed = errors.New("netw: loopback closed")
+
+// loopbackSkipHeaders 不转发到进程内握手的请求头，由websocket握手自行设置或只对原始传输有意义
+var loopbackSkipHeaders = map[string]bool{
+	"Upgrade":             true,
+	"Connection":          true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Accept":              true,
+	"Accept-Encoding":     true,
+	"Cache-Control":       true,
+	"Last-Event-Id":       true,
+	"Transfer-Encoding":   true,
+	"Keep-Alive":          true,
+	"Te":                  true,
+	"Trailer":             true,
+	"Proxy-Authorization": true,
+}
+
+// Loopback 进程内的websocket入口，HTTP回退、WebTransport等其它传输在内存中以websocket连接到Server，
+// 对Server而言与普通连接相同，中间件、会话、鉴权与限流都不需要区分传输
+type Loopback struct {
+	conns chan net.Conn
+	quit  chan struct{}
+	once  sync.Once
+	http  *http.Server
+}
+
+// NewLoopback 创建进程内入口，建立的连接带有入口标签tag
+func NewLoopback(s iface.Server, tag string) *Loopback {
+	g := gin.New()
+	g.NoRoute(s.ServeTagged(tag))
+	l := &Loopback{
+		conns: make(chan net.Conn),
+		quit:  make(chan struct{}),
+		http:  &http.Server{Handler: g},
+	}
+	go func() {
+		_ = l.http.Serve(loopbackListener{l})
+	}()
+	return l
+}
+
+// Dial 以原始请求的参数与请求头建立到Server的websocket连接，Server按原始请求的地址识别客户端IP；
+// 握手被拒绝时返回Server回复的状态码
+func (l *Loopback) Dial(r *http.Request) (*websocket.Conn, int, error) {
+	header := http.Header{}
+	for key, values := range r.Header {
+		if loopbackSkipHeaders[key] || strings.HasPrefix(key, "Sec-Websocket-") {
+			continue
+		}
+		header[key] = values
+	}
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return l.dial(ctx, loopbackAddr(r.RemoteAddr))
+		},
+		HandshakeTimeout: 10 * time.Second,
+	}
+	ws, resp, err := dialer.DialContext(r.Context(), "ws://"+r.Host+"/?"+r.URL.RawQuery, header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		status := http.StatusBadGateway
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		return nil, status, err
+	}
+	return ws, http.StatusOK, nil
+}
+
+// Close 关闭进程内入口，已建立的连接不受影响
+func (l *Loopback) Close() error {
+	l.once.Do(func() { close(l.quit) })
+	return l.http.Close()
+}
+
+// dial 建立一对内存连接，服务端一侧的远程地址替换为remote后交给Accept
+func (l *Loopback) dial(ctx context.Context, remote net.Addr) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- &loopbackConn{Conn: server, remote: remote}:
+		return client, nil
+	case <-l.quit:
+		return nil, ErrLoopbackClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// loopbackListener 以net.Pipe建立连接的内存监听
+type loopbackListener struct {
+	l *Loopback
+}
+
+func (ll loopbackListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-ll.l.conns:
+		return conn, nil
+	case <-ll.l.quit:
+		return nil, ErrLoopbackClosed
+	}
+}
+
+func (ll loopbackListener) Close() error {
+	ll.l.once.Do(func() { close(ll.l.quit) })
+	return nil
+}
+
+func (ll loopbackListener) Addr() net.Addr {
+	return loopbackAddr("loopback")
+}
+
+// loopbackConn 替换远程地址的连接
+type loopbackConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *loopbackConn) RemoteAddr() net.Addr {
+	return c.remote
+}
+
+type loopbackAddr string
+
+func (a loopbackAddr) Network() string { return "loopback" }
+func (a loopbackAddr) String() string  { return string(a) }
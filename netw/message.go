@@ -3,7 +3,14 @@ package netw
 //Message 消息
 type Message struct {
 	ID   uint32 `json:"msgId"` //消息的ID
-	Data []byte `json:"data"` //消息的内容
+	Data []byte `json:"data"`  //消息的内容
+	Seq  uint64 `json:"seq"`   //消息的序号，0表示不带序号
+
+	ReqID uint64 `json:"reqId"` //请求ID，0表示不带请求ID
+
+	Channel uint8 `json:"channel"` //逻辑通道ID，0为默认通道
+
+	Encrypted bool `json:"-"` //消息内容是否已由连接的加密器加密，HeaderPack对应包头的FlagEncrypted
 }
 
 //NewMsgPackage 创建一个Message消息包
@@ -33,3 +40,43 @@ func (msg *Message) SetMsgID(msgID uint32) {
 func (msg *Message) SetData(data []byte) {
 	msg.Data = data
 }
+
+//GetSeq 获取消息序号
+func (msg *Message) GetSeq() uint64 {
+	return msg.Seq
+}
+
+//SetSeq 设置消息序号
+func (msg *Message) SetSeq(seq uint64) {
+	msg.Seq = seq
+}
+
+//GetReqID 获取请求ID
+func (msg *Message) GetReqID() uint64 {
+	return msg.ReqID
+}
+
+//SetReqID 设置请求ID
+func (msg *Message) SetReqID(reqID uint64) {
+	msg.ReqID = reqID
+}
+
+//GetChannel 获取逻辑通道ID
+func (msg *Message) GetChannel() uint8 {
+	return msg.Channel
+}
+
+//SetChannel 设置逻辑通道ID
+func (msg *Message) SetChannel(channel uint8) {
+	msg.Channel = channel
+}
+
+//IsEncrypted 消息内容是否已加密
+func (msg *Message) IsEncrypted() bool {
+	return msg.Encrypted
+}
+
+//SetEncrypted 设置消息内容是否已加密
+func (msg *Message) SetEncrypted(encrypted bool) {
+	msg.Encrypted = encrypted
+}
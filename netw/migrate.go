@@ -0,0 +1,104 @@
+package netw
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// MigrateNotice 迁移通知，以MigrateMsgID的JSON消息下发，客户端应携带 SessionQueryKey=Token 重连到URL
+type MigrateNotice struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"` // 会话token，未开启会话时为空
+}
+
+// Migrate 滚动升级时将全部连接迁移到target：会话元数据连同属性与离线消息写入SessionStore，
+// 下发迁移通知后断开连接，客户端在新节点重连后恢复会话；返回通知的连接数量。
+// 需设置MigrateMsgID，会话迁移需开启SessionGracePeriod并设置SessionStore
+func (s *Server) Migrate(target string) int {
+	if s.conf().MigrateMsgID == 0 {
+		zap.S().Warn("migrate without MigrateMsgID")
+		return 0
+	}
+	var conns []iface.Connection
+	s.ConnMgr.Search(func(conn iface.Connection) {
+		conns = append(conns, conn)
+	})
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		notice := MigrateNotice{URL: target}
+		if sm, ok := s.sessions.(*SessionManager); ok {
+			notice.Token = sm.prepareMigrate(conn)
+		}
+		payload, err := json.Marshal(notice)
+		if err != nil {
+			continue
+		}
+		wg.Add(1)
+		// StopWithMsg等待通知写出，并发断开
+		go func(conn iface.Connection) {
+			defer wg.Done()
+			conn.StopWithMsg(s.conf().MigrateMsgID, payload)
+		}(conn)
+	}
+	wg.Wait()
+	zap.S().Info("migrated ", len(conns), " conns to ", target)
+	return len(conns)
+}
+
+// prepareMigrate 保存连接会话的属性、连接属性与未确认消息，返回会话token，
+// 之后连接断开时不再覆盖存储中的元数据，避免与新节点的恢复冲突
+func (sm *SessionManager) prepareMigrate(conn iface.Connection) string {
+	if sm.store == nil {
+		return ""
+	}
+	sm.lock.RLock()
+	s, ok := sm.conns[conn.GetConnID()]
+	sm.lock.RUnlock()
+	if !ok {
+		return ""
+	}
+	s.lock.Lock()
+	s.migrating = true
+	if c, ok := conn.(*Connection); ok {
+		s.connProps = migratableProps(c.properties())
+	}
+	for _, msg := range conn.GetUnacked() {
+		s.buffer.push(bufferedMsg{Seq: msg.Seq, MsgID: msg.MsgID, Data: msg.Data})
+	}
+	s.lock.Unlock()
+	sm.save(s, time.Second*time.Duration(sm.conf().SessionGracePeriod))
+	return s.id
+}
+
+// migratableProps 可迁移的属性，跳过框架内部属性与无法JSON序列化的值
+func migratableProps(props map[string]interface{}) map[string]interface{} {
+	carried := make(map[string]interface{}, len(props))
+	for key, value := range props {
+		if strings.HasPrefix(key, "netw.") {
+			continue
+		}
+		if _, err := json.Marshal(value); err != nil {
+			zap.S().Debug("skip property ", key, " on migrate ", err)
+			continue
+		}
+		carried[key] = value
+	}
+	return carried
+}
+
+// properties 复制全部连接属性
+func (c *Connection) properties() map[string]interface{} {
+	c.propertyLock.Lock()
+	defer c.propertyLock.Unlock()
+	props := make(map[string]interface{}, len(c.property))
+	for key, value := range c.property {
+		props[key] = value
+	}
+	return props
+}
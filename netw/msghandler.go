@@ -1,84 +1,325 @@
 package netw
 
 import (
+	"context"
+	"fmt"
+	"runtime/debug"
 	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
 
 	"go.uber.org/zap"
 )
 
 // MsgHandle -
 type MsgHandle struct {
-	Apis           map[uint32]iface.Router // 存放每个MsgID 所对应的处理方法的map属性
-	WorkerPoolSize uint32                  // 业务工作Worker池的数量
-	TaskQueue      []chan iface.Request    // Worker负责取任务的消息队列
+	Apis           map[uint32]iface.Router                      // 存放每个MsgID 所对应的处理方法的map属性
+	versions       map[uint32][]versionRouter                   // 按协议版本区间注册的处理方法
+	WorkerPoolSize uint32                                       // 业务工作Worker池的数量
+	TaskQueue      []chan iface.Request                         // Worker负责取任务的消息队列
+	middlewares    []iface.Middleware                           // 消息处理中间件
+	groups         []iface.RouterGroup                          // 路由分组
+	groupLock      sync.RWMutex                                 // 保护groups与namespaces的锁
+	namespaces     map[string]iface.Namespace                   // 命名空间
+	panicCount     uint64                                       // 业务处理发生panic的次数
+	onHandlerPanic func(request iface.Request, err interface{}) // 业务处理panic时的Hook函数
+	pool           workerPool                                   // 弹性工作池状态
+	activeWorkers  uint32                                       // 当前运行的worker数量
+	onDeadLetter   func(letter iface.DeadLetter)                // 消息进入死信队列时的Hook函数
+	deadLetters    iface.DeadLetterStore                        // 死信队列存储
+	ranges         []rangeRouter                                // 按MsgID区间注册的路由
+	defaultRouter  iface.Router                                 // 没有任何路由匹配时的默认路由
+	retries        map[int64]*retryQueue                        // 有消息在重试中的连接
+	retryLock      sync.Mutex                                   // 保护retries的锁
+	server         *Server                                      // 所属Server，为nil时读取SetConfig设置的配置
 }
 
-// NewMsgHandle 创建MsgHandle
+// NewMsgHandle 创建MsgHandle，工作池大小等读取SetConfig设置的配置
 func NewMsgHandle() *MsgHandle {
-	return &MsgHandle{
-		Apis:           make(map[uint32]iface.Router),
-		WorkerPoolSize: config.WorkerPoolSize,
-		// 一个worker对应一个queue
-		TaskQueue: make([]chan iface.Request, config.WorkerPoolSize),
+	return newMsgHandle(nil)
+}
+
+// newMsgHandle 创建Server的MsgHandle
+func newMsgHandle(s *Server) *MsgHandle {
+	mh := &MsgHandle{
+		Apis:     make(map[uint32]iface.Router),
+		versions: make(map[uint32][]versionRouter),
+		server:   s,
+	}
+	mh.WorkerPoolSize = mh.conf().WorkerPoolSize
+	// 一个worker对应一个queue，弹性工作池按最大worker数量分配
+	mh.TaskQueue = make([]chan iface.Request, maxWorkerPoolSize(mh.conf()))
+	return mh
+}
+
+// conf MsgHandle所属Server的配置
+func (mh *MsgHandle) conf() *iface.Config {
+	if mh.server != nil {
+		return mh.server.conf()
+	}
+	return sharedConfig()
+}
+
+func (mh *MsgHandle) DoMsgHandler(request iface.Request) {
+	if req, ok := request.(*Request); ok {
+		defer req.release()
+		if conn, ok := req.conn.(*Connection); ok && req.coalesced {
+			conn.claimCoalesced(req)
+		}
+	}
+	if mh.holdRetry(request) {
+		return
+	}
+	if re := mh.dispatch(request, false); re != nil {
+		mh.startRetry(request, re)
 	}
 }
 
-func (mh MsgHandle) DoMsgHandler(request iface.Request) {
+// dispatch 依次执行中间件与处理方法，处理方法请求重试时返回可重试的错误；reserved为true时已预定限流令牌
+func (mh *MsgHandle) dispatch(request iface.Request, reserved bool) *RetryableError {
+	// 中间件与处理方法共享同一个Context
+	c := newContext(request)
+	defer c.release()
+	c.dispatched = true
+	c.reserved = reserved
+	request = c
+	defer mh.recoverHandler(request)
+	// 处理上下文随连接关闭取消，配置HandlerTimeout时到期取消
+	ctx, cancel := handlerContext(mh.conf(), request)
+	defer cancel()
+	request.SetContext(ctx)
+	// 由外到内依次包装中间件，先添加的先执行
+	handle := iface.HandlerFunc(mh.route)
+	for i := len(mh.middlewares) - 1; i >= 0; i-- {
+		handle = mh.middlewares[i](handle)
+	}
+	handle(request)
+	return c.retry
+}
+
+// handlerContext 由连接上下文派生处理消息的上下文
+func handlerContext(cfg *iface.Config, request iface.Request) (context.Context, context.CancelFunc) {
+	parent := request.GetConnection().Context()
+	if parent == nil {
+		parent = context.Background()
+	}
+	if cfg.HandlerTimeout > 0 {
+		return context.WithTimeout(parent, time.Millisecond*time.Duration(cfg.HandlerTimeout))
+	}
+	return context.WithCancel(parent)
+}
+
+// recoverHandler 捕获业务处理的panic，记录堆栈并调用OnHandlerPanic Hook函数
+func (mh *MsgHandle) recoverHandler(request iface.Request) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	atomic.AddUint64(&mh.panicCount, 1)
+	request.GetConnection().AddError()
+	request.Logger().Errorw("handler panic",
+		"err", err,
+		"stack", string(debug.Stack()),
+	)
+	mh.DeadLetter(request, iface.DeadLetterPanic, err)
+	if mh.onHandlerPanic != nil {
+		// Hook函数自身panic不能影响worker
+		defer func() {
+			if hookErr := recover(); hookErr != nil {
+				zap.S().Error("OnHandlerPanic hook panic: ", hookErr)
+			}
+		}()
+		mh.onHandlerPanic(request, err)
+	}
+}
+
+// SetOnHandlerPanic 设置业务处理panic时的Hook函数
+func (mh *MsgHandle) SetOnHandlerPanic(hookFunc func(request iface.Request, err interface{})) {
+	mh.onHandlerPanic = hookFunc
+}
+
+// PanicCount 获取业务处理发生panic的次数
+func (mh *MsgHandle) PanicCount() uint64 {
+	return atomic.LoadUint64(&mh.panicCount)
+}
+
+// route 根据MsgID执行对应的路由业务
+func (mh *MsgHandle) route(request iface.Request) {
+	handler, middlewares := mh.getRouter(request.GetMsgID(), request.GetConnection())
+	if handler == nil {
+		request.Logger().Error("api msgID = ", request.GetMsgID(), " is not FOUND!")
+		recordDrop(request.GetConnection(), iface.DropUnroutable, 1)
+		mh.DeadLetter(request, iface.DeadLetterNoHandler, nil)
+		return
+	}
+	// 执行对应处理方法，分组路由先执行分组中间件
+	start := time.Now()
 	defer func() {
-		if err := recover(); err != nil {
-			zap.S().Error("Call err: ", err)
+		cost := time.Since(start)
+		metrics.HandlerObserve(request.GetMsgID(), cost)
+		if mh.conf().HandlerTimeout > 0 && cost > time.Millisecond*time.Duration(mh.conf().HandlerTimeout) {
+			request.Logger().Warn("slow handler cost = ", cost)
 		}
 	}()
-	handler, ok := mh.Apis[request.GetMsgID()]
-	if !ok {
-		zap.S().Error("api msgID = ", request.GetMsgID(), " is not FOUND!")
-		return
+	handle := wrapRouter(handler)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handle = middlewares[i](handle)
+	}
+	handle(request)
+}
+
+// getRouter 获取MsgID对应的路由与需执行的分组中间件，优先查找连接所属命名空间的路由，
+// 其次查找协议版本对应的路由、MsgID所属的分组与单独注册的路由，最后查找区间路由与默认路由；其它命名空间的路由对连接不可见
+func (mh *MsgHandle) getRouter(msgID uint32, conn iface.Connection) (iface.Router, []iface.Middleware) {
+	if ns := mh.findNamespace(conn.GetNamespace()); ns != nil {
+		if handler, middlewares := ns.Route(msgID); handler != nil {
+			return handler, middlewares
+		}
 	}
-	// 执行对应处理方法
-	handler.PreHandle(request)
-	handler.Handle(request)
-	handler.PostHandle(request)
+	if handler := mh.findVersionRouter(msgID, conn.GetProtocolVersion()); handler != nil {
+		return handler, nil
+	}
+	if group := mh.findGroup(msgID); group != nil {
+		if handler, ok := group.GetRouter(msgID); ok {
+			return handler, group.Middlewares()
+		}
+	}
+	if handler, ok := mh.Apis[msgID]; ok {
+		return handler, nil
+	}
+	return mh.findRange(msgID), nil
+}
+
+// priority 获取消息优先级，配置优先于Router声明
+func (mh *MsgHandle) priority(request iface.Request) iface.Priority {
+	msgID := request.GetMsgID()
+	// 不同优先级队列会打乱同一连接的消息顺序
+	if mh.conf().OrderedDispatch {
+		return iface.PriorityNormal
+	}
+	if p, ok := mh.conf().MsgPriority[msgID]; ok {
+		return p
+	}
+	if handler, _ := mh.getRouter(msgID, request.GetConnection()); handler != nil {
+		if pr, ok := handler.(iface.PriorityRouter); ok {
+			return pr.Priority()
+		}
+	}
+	return iface.PriorityNormal
 }
 
-func (mh MsgHandle) AddRouter(msgID uint32, router iface.Router) {
+// wrapRouter 将Router的三个钩子方法包装为HandlerFunc
+func wrapRouter(handler iface.Router) iface.HandlerFunc {
+	return func(request iface.Request) {
+		handler.PreHandle(request)
+		handler.Handle(request)
+		handler.PostHandle(request)
+	}
+}
+
+func (mh *MsgHandle) AddRouter(msgID uint32, router iface.Router) {
+	checkMsgID(msgID)
 	// 1 判断当前msg绑定的API处理方法是否已经存在
 	if _, ok := mh.Apis[msgID]; ok {
 		panic("repeated api , msgID = " + strconv.Itoa(int(msgID)))
 	}
 	// 2 添加msg与api的绑定关系
 	mh.Apis[msgID] = router
+	metrics.RegisterMsgID(msgID)
 }
 
-func (mh MsgHandle) StartWorkerPool() {
-	// 遍历需要启动worker的数量，依此启动
-	for i := 0; i < int(mh.WorkerPoolSize); i++ {
-		// 一个worker被启动
-		// 给当前worker对应的任务队列开辟空间
-		mh.TaskQueue[i] = make(chan iface.Request, 1)
-		// 启动当前Worker，阻塞的等待对应的任务队列是否有消息传递进来
-		go mh.StartOneWorker(i, mh.TaskQueue[i])
+// checkMsgID msgID超过MaxMsgID时与DataPack的标志位重叠，拆包后会变成另一个msgID，注册时panic
+func checkMsgID(msgID uint32) {
+	if msgID > MaxMsgID {
+		panic(fmt.Sprintf("msgID = %d exceeds MaxMsgID %d", msgID, MaxMsgID))
 	}
 }
-func (mh MsgHandle) SendMsgToTaskQueue(request iface.Request) {
+
+// Use 添加消息处理中间件，需在服务启动前调用
+func (mh *MsgHandle) Use(middlewares ...iface.Middleware) {
+	mh.middlewares = append(mh.middlewares, middlewares...)
+}
+
+// Group 创建并挂载一个MsgID区间为[start, end]的路由分组
+func (mh *MsgHandle) Group(start, end uint32) iface.RouterGroup {
+	group := NewRouterGroup(start, end)
+	mh.AddGroup(group)
+	return group
+}
+
+// AddGroup 挂载路由分组，分组区间不允许重叠
+func (mh *MsgHandle) AddGroup(group iface.RouterGroup) {
+	mh.groupLock.Lock()
+	for _, g := range mh.groups {
+		if group.Start() <= g.End() && g.Start() <= group.End() {
+			mh.groupLock.Unlock()
+			panic(fmt.Sprintf("router group [%d, %d] overlaps [%d, %d]", group.Start(), group.End(), g.Start(), g.End()))
+		}
+	}
+	mh.groups = append(mh.groups, group)
+	mh.groupLock.Unlock()
+	group.CallOnAttach()
+}
+
+// RemoveGroup 卸载路由分组
+func (mh *MsgHandle) RemoveGroup(group iface.RouterGroup) {
+	mh.groupLock.Lock()
+	removed := false
+	for i, g := range mh.groups {
+		if g == group {
+			mh.groups = append(mh.groups[:i], mh.groups[i+1:]...)
+			removed = true
+			break
+		}
+	}
+	mh.groupLock.Unlock()
+	if removed {
+		group.CallOnDetach()
+	}
+}
+
+// findGroup 查找MsgID所属的路由分组
+func (mh *MsgHandle) findGroup(msgID uint32) iface.RouterGroup {
+	mh.groupLock.RLock()
+	defer mh.groupLock.RUnlock()
+	for _, g := range mh.groups {
+		if g.Contains(msgID) {
+			return g
+		}
+	}
+	return nil
+}
+
+func (mh *MsgHandle) StartWorkerPool() {
+	mh.startWorkerPool()
+}
+
+// StopWorkerPool 停止worker工作池，worker处理完已分配的任务后退出
+func (mh *MsgHandle) StopWorkerPool() {
+	mh.stopWorkerPool()
+}
+
+func (mh *MsgHandle) SendMsgToTaskQueue(request iface.Request) {
 	// 根据ConnID来分配当前的连接应该由哪个worker负责处理
 	// 轮询的平均分配法则
-	// 得到需要处理此条连接的workerID
-	workerID := uint32(request.GetConnection().GetConnID()) % mh.WorkerPoolSize
-	// 将请求消息发送给任务队列
-	mh.TaskQueue[workerID] <- request
-}
-
-// StartOneWorker 启动一个Worker工作流程
-func (mh *MsgHandle) StartOneWorker(workerID int, taskQueue chan iface.Request) {
-	zap.S().Debug("Worker ID = ", workerID, " is started.")
-	// 不断的等待队列中的消息
-	for {
-		select {
-		// 有消息则取出队列的Request，并执行绑定的业务方法
-		case request := <-taskQueue:
-			mh.DoMsgHandler(request)
+	// 得到需要处理此条连接的workerID，连接有未处理完的任务时固定在同一个worker
+	workerID := mh.pin(request.GetConnection().GetConnID())
+	// 将请求消息按优先级发送给任务队列
+	task := &queuedRequest{Request: request, enqueueAt: time.Now()}
+	switch mh.priority(request) {
+	case iface.PriorityHigh:
+		mh.pool.high[workerID] <- task
+	case iface.PriorityLow:
+		mh.pool.low[workerID] <- task
+	default:
+		if mh.pool.fair != nil {
+			mh.pool.fair[workerID].push(request.GetConnection().GetConnID(), task)
+			return
 		}
+		mh.TaskQueue[workerID] <- task
 	}
 }
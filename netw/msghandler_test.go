@@ -0,0 +1,66 @@
+package netw_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+// newTestServer 以DefaultConfig为基础创建Server，configure修改配置，测试结束时停止
+func newTestServer(t *testing.T, configure func(c *iface.Config)) iface.Server {
+	t.Helper()
+	o := netw.NewOptions()
+	if configure != nil {
+		o.Configure(configure)
+	}
+	s, err := o.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// reply 以msgID回复请求数据的处理方法
+func reply(msgID uint32) func(c *netw.Context) {
+	return func(c *netw.Context) {
+		_ = c.Conn().SendMsg(msgID, c.GetData())
+	}
+}
+
+func TestRouting(t *testing.T) {
+	s := newTestServer(t, nil)
+	s.Handle(1, reply(101))
+	s.AddRouterRange(10, 19, netw.NewContextRouter(reply(110)))
+	s.Handle(15, reply(115))
+	s.SetDefaultRouter(netw.NewContextRouter(reply(199)))
+	conn := netwtest.NewConn(s)
+	for _, tc := range []struct {
+		msgID, want uint32
+	}{
+		{1, 101},
+		{12, 110},
+		{15, 115}, // 单独注册的MsgID优先于区间
+		{42, 199},
+	} {
+		netwtest.Dispatch(s, conn, tc.msgID, []byte("ping"))
+		if out := conn.Expect(t, tc.want); string(out.Data) != "ping" {
+			t.Fatalf("msgID %d: data = %q", tc.msgID, out.Data)
+		}
+	}
+}
+
+func TestRoutingGroup(t *testing.T) {
+	s := newTestServer(t, nil)
+	group := s.Group(100, 199)
+	group.Handle(100, reply(200))
+	conn := netwtest.NewConn(s)
+	netwtest.Dispatch(s, conn, 100, nil)
+	conn.Expect(t, 200)
+	s.RemoveGroup(group)
+	netwtest.Dispatch(s, conn, 100, nil)
+	conn.ExpectNone(t, 10*time.Millisecond)
+}
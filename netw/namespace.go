@@ -0,0 +1,261 @@
+package netw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+var (
+	// NamespaceQueryKey 握手时声明命名空间的URL参数名，如 /ws?ns=game1
+	NamespaceQueryKey = "ns"
+
+	ErrUnknownNamespace = errors.New("netw: unknown namespace")
+	ErrNamespaceFull    = errors.New("netw: namespace max conn reached")
+)
+
+// NamespaceUID 命名空间内的用户ID在连接管理与离线消息中的Key，不同命名空间的相同用户ID互不影响
+func NamespaceUID(namespace, uid string) string {
+	if namespace == "" {
+		return uid
+	}
+	return namespace + ":" + uid
+}
+
+// Namespace 命名空间，连接只能路由到本命名空间与Server上注册的公共路由
+type Namespace struct {
+	name   string
+	server *Server
+	routes *RouterGroup        // 命名空间内的路由与共享中间件
+	groups []iface.RouterGroup // 命名空间内的路由分组
+	lock   sync.RWMutex        // 保护groups的锁
+	conns  int64               // 连接数量
+}
+
+// newNamespace 创建命名空间
+func newNamespace(s *Server, name string) *Namespace {
+	return &Namespace{
+		name:   name,
+		server: s,
+		routes: NewRouterGroup(0, MaxMsgID),
+	}
+}
+
+// Name 命名空间名称
+func (ns *Namespace) Name() string {
+	return ns.name
+}
+
+// AddRouter 注册只对本命名空间连接生效的路由
+func (ns *Namespace) AddRouter(msgID uint32, router iface.Router) {
+	ns.routes.AddRouter(msgID, router)
+}
+
+// Handle 注册只对本命名空间连接生效的类型化处理方法
+func (ns *Namespace) Handle(msgID uint32, fn interface{}) {
+	ns.routes.AddRouter(msgID, handlerRouter(msgID, fn))
+}
+
+// Use 添加本命名空间路由共享的中间件，在Server中间件之后、分组中间件之前执行
+func (ns *Namespace) Use(middlewares ...iface.Middleware) {
+	ns.routes.Use(middlewares...)
+}
+
+// Group 在命名空间内创建MsgID区间为[start, end]的路由分组，分组区间不允许重叠
+func (ns *Namespace) Group(start, end uint32) iface.RouterGroup {
+	group := NewRouterGroup(start, end)
+	ns.lock.Lock()
+	for _, g := range ns.groups {
+		if group.Start() <= g.End() && g.Start() <= group.End() {
+			ns.lock.Unlock()
+			panic(fmt.Sprintf("namespace %s router group [%d, %d] overlaps [%d, %d]", ns.name, start, end, g.Start(), g.End()))
+		}
+	}
+	ns.groups = append(ns.groups, group)
+	ns.lock.Unlock()
+	group.CallOnAttach()
+	return group
+}
+
+// Route 查找命名空间内的路由，优先查找MsgID所属的分组
+func (ns *Namespace) Route(msgID uint32) (iface.Router, []iface.Middleware) {
+	ns.lock.RLock()
+	groups := ns.groups
+	ns.lock.RUnlock()
+	for _, g := range groups {
+		if !g.Contains(msgID) {
+			continue
+		}
+		if handler, ok := g.GetRouter(msgID); ok {
+			shared := ns.routes.Middlewares()
+			middlewares := make([]iface.Middleware, 0, len(shared)+len(g.Middlewares()))
+			middlewares = append(middlewares, shared...)
+			return handler, append(middlewares, g.Middlewares()...)
+		}
+	}
+	if handler, ok := ns.routes.GetRouter(msgID); ok {
+		return handler, ns.routes.Middlewares()
+	}
+	return nil, nil
+}
+
+// Len 命名空间内的连接数量
+func (ns *Namespace) Len() int {
+	return int(atomic.LoadInt64(&ns.conns))
+}
+
+// Search 遍历命名空间内的连接
+func (ns *Namespace) Search(s iface.Search) {
+	ns.server.ConnMgr.Search(func(conn iface.Connection) {
+		if conn.GetNamespace() == ns.name {
+			s(conn)
+		}
+	})
+}
+
+// Broadcast 向命名空间内的全部连接发送消息
+func (ns *Namespace) Broadcast(msgID uint32, data []byte) int {
+	var conns []iface.Connection
+	ns.Search(func(conn iface.Connection) {
+		conns = append(conns, conn)
+	})
+	sent := 0
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// GetByUID 获取命名空间内用户ID绑定的全部连接
+func (ns *Namespace) GetByUID(uid string) []iface.Connection {
+	return ns.server.ConnMgr.GetByUID(NamespaceUID(ns.name, uid))
+}
+
+// SendToUID 向命名空间内用户ID的全部连接发送消息，不在线时以NamespaceUID存入离线消息
+func (ns *Namespace) SendToUID(uid string, msgID uint32, data []byte) error {
+	return ns.server.SendToUID(NamespaceUID(ns.name, uid), msgID, data)
+}
+
+// full 是否已达到NamespaceMaxConn
+func (ns *Namespace) full() bool {
+	max := ns.server.conf().NamespaceMaxConn[ns.name]
+	return max > 0 && ns.Len() >= max
+}
+
+func (ns *Namespace) connOpened() {
+	atomic.AddInt64(&ns.conns, 1)
+	metrics.NamespaceConnOpened(ns.name)
+}
+
+func (ns *Namespace) connClosed() {
+	atomic.AddInt64(&ns.conns, -1)
+	metrics.NamespaceConnClosed(ns.name)
+}
+
+// Namespace 获取或创建命名空间，需在服务启动前创建；
+// 创建任一命名空间后，握手未声明且没有DefaultNamespace、或声明了未创建的命名空间的连接被拒绝
+func (s *Server) Namespace(name string) iface.Namespace {
+	if name == "" {
+		panic("empty namespace name")
+	}
+	s.nsLock.Lock()
+	defer s.nsLock.Unlock()
+	if ns, ok := s.namespaces[name]; ok {
+		return ns
+	}
+	ns := newNamespace(s, name)
+	if s.namespaces == nil {
+		s.namespaces = make(map[string]*Namespace)
+	}
+	s.namespaces[name] = ns
+	s.msgHandler.AddNamespace(ns)
+	return ns
+}
+
+// resolveNamespace 解析握手请求所属的命名空间，未创建任何命名空间时返回nil
+func (s *Server) resolveNamespace(r *http.Request) (*Namespace, error) {
+	s.nsLock.RLock()
+	defer s.nsLock.RUnlock()
+	if len(s.namespaces) == 0 {
+		return nil, nil
+	}
+	var name string
+	if s.nsResolver != nil {
+		name = s.nsResolver(r)
+	} else {
+		name = r.URL.Query().Get(NamespaceQueryKey)
+	}
+	if name == "" {
+		name = s.conf().DefaultNamespace
+	}
+	ns, ok := s.namespaces[name]
+	if !ok {
+		return nil, ErrUnknownNamespace
+	}
+	if ns.full() {
+		return nil, ErrNamespaceFull
+	}
+	return ns, nil
+}
+
+// 设置握手时解析连接所属命名空间的函数，默认读取NamespaceQueryKey参数
+func WithNamespaceResolver(resolver iface.NamespaceResolver) Option {
+	return func(s *Server) {
+		s.nsResolver = resolver
+	}
+}
+
+// 获取连接所属的命名空间，未使用命名空间时为空
+func (c *Connection) GetNamespace() string {
+	if c.namespace == nil {
+		return ""
+	}
+	return c.namespace.name
+}
+
+// AddNamespace 挂载命名空间，同名的命名空间只能挂载一次
+func (mh *MsgHandle) AddNamespace(ns iface.Namespace) {
+	mh.groupLock.Lock()
+	defer mh.groupLock.Unlock()
+	if _, ok := mh.namespaces[ns.Name()]; ok {
+		panic("repeated namespace " + ns.Name())
+	}
+	if mh.namespaces == nil {
+		mh.namespaces = make(map[string]iface.Namespace)
+	}
+	mh.namespaces[ns.Name()] = ns
+}
+
+// findNamespace 查找已挂载的命名空间
+func (mh *MsgHandle) findNamespace(name string) iface.Namespace {
+	if name == "" {
+		return nil
+	}
+	mh.groupLock.RLock()
+	defer mh.groupLock.RUnlock()
+	return mh.namespaces[name]
+}
+
+// namespaceBucket 获取命名空间共享的令牌桶，未配置NamespaceRateLimit时为nil，调用方需持有conns锁
+func (l *RateLimiter) namespaceBucket(name string) *TokenBucket {
+	rate, ok := l.conf().NamespaceRateLimit[name]
+	if name == "" || !ok || rate.Rate <= 0 {
+		return nil
+	}
+	bucket, ok := l.namespaces[name]
+	if !ok {
+		if l.namespaces == nil {
+			l.namespaces = make(map[string]*TokenBucket)
+		}
+		bucket = newTokenBucket(l.clock(), rate.Rate, rate.Burst)
+		l.namespaces[name] = bucket
+	}
+	return bucket
+}
@@ -0,0 +1,141 @@
+package netw
+
+import (
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// 连接关闭的原因，客户端断开或读写失败时为对应的错误
+var (
+	ErrHeartbeatTimeout = errors.New("netw: heartbeat timeout")
+	ErrLifecycleTimeout = errors.New("netw: lifecycle timeout")
+	ErrSendOverflow     = errors.New("netw: send buff overflow")
+	ErrKicked           = errors.New("netw: kicked")
+	ErrServerStopped    = errors.New("netw: server stopped")
+	ErrBanned           = errors.New("netw: banned")
+	ErrFrameType        = errors.New("netw: unexpected frame type")
+	ErrCipherRequired   = errors.New("netw: cipher required")
+)
+
+// AddOnAccept 追加连接升级完成后的Hook函数，在鉴权绑定与OnConnStart之前调用
+func (s *Server) AddOnAccept(hookFunc func(conn iface.Connection)) {
+	s.hookLock.Lock()
+	s.onAccept = append(s.onAccept, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// AddOnReceiveRaw 追加收到数据包时的Hook函数，在拆包与路由之前以原始字节调用，
+// 返回错误时丢弃该数据包，可用于自定义过滤与字节级统计，data在Hook返回后会被复用
+func (s *Server) AddOnReceiveRaw(hookFunc func(conn iface.Connection, data []byte) error) {
+	s.hookLock.Lock()
+	s.onReceiveRaw = append(s.onReceiveRaw, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// AddOnSend 追加写出websocket帧之前的Hook函数，data为封包后的字节，在Hook返回后会被归还缓冲池
+func (s *Server) AddOnSend(hookFunc func(conn iface.Connection, data []byte)) {
+	s.hookLock.Lock()
+	s.onSend = append(s.onSend, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// AddOnClose 追加连接关闭之后的Hook函数，每个连接只调用一次，可通过Stats获取收发字节数
+func (s *Server) AddOnClose(hookFunc func(conn iface.Connection, reason error)) {
+	s.hookLock.Lock()
+	s.onClose = append(s.onClose, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// AddOnAuth 追加连接鉴权完成时的Hook函数，鉴权失败与重复登录被拒绝时err不为nil，
+// 握手阶段鉴权失败时连接尚未创建，不会调用
+func (s *Server) AddOnAuth(hookFunc func(conn iface.Connection, uid string, err error)) {
+	s.hookLock.Lock()
+	s.onAuth = append(s.onAuth, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// callOnAccept 调用OnAccept Hook函数
+func (s *Server) callOnAccept(conn iface.Connection) {
+	s.hookLock.RLock()
+	hooks := s.onAccept
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn)
+	}
+}
+
+// CallOnReceiveRaw 依次调用OnReceiveRaw Hook函数，返回第一个错误
+func (s *Server) CallOnReceiveRaw(conn iface.Connection, data []byte) error {
+	s.hookLock.RLock()
+	hooks := s.onReceiveRaw
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		if err := hookFunc(conn, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CallOnSend 调用OnSend Hook函数
+func (s *Server) CallOnSend(conn iface.Connection, data []byte) {
+	s.hookLock.RLock()
+	hooks := s.onSend
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn, data)
+	}
+}
+
+// CallOnClose 调用OnClose Hook函数
+func (s *Server) CallOnClose(conn iface.Connection, reason error) {
+	s.hookLock.RLock()
+	hooks := s.onClose
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn, reason)
+	}
+}
+
+// CallOnAuth 调用OnAuth Hook函数
+func (s *Server) CallOnAuth(conn iface.Connection, uid string, err error) {
+	s.hookLock.RLock()
+	hooks := s.onAuth
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn, uid, err)
+	}
+}
+
+// setCloseReason 记录连接关闭的原因，只保留第一次记录的原因
+func (c *Connection) setCloseReason(reason error) {
+	c.infoLock.Lock()
+	if c.closeReason == nil {
+		c.closeReason = reason
+	}
+	c.infoLock.Unlock()
+}
+
+// getCloseReason 连接关闭的原因，未记录时为ErrConnClosed
+func (c *Connection) getCloseReason() error {
+	c.infoLock.RLock()
+	defer c.infoLock.RUnlock()
+	if c.closeReason == nil {
+		return ErrConnClosed
+	}
+	return c.closeReason
+}
+
+// CloseConn 记录关闭原因后关闭连接，reason会传给OnClose Hook函数
+func CloseConn(conn iface.Connection, reason error) {
+	setCloseReason(conn, reason)
+	conn.Stop()
+}
+
+// setCloseReason 为netw的连接记录关闭原因，其它实现忽略
+func setCloseReason(conn iface.Connection, reason error) {
+	if c, ok := conn.(*Connection); ok {
+		c.setCloseReason(reason)
+	}
+}
@@ -0,0 +1,109 @@
+package netw
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+var ErrUIDOffline = errors.New("netw: uid offline")
+
+// MemoryOfflineStore 内存离线消息存储，仅适用于单节点
+type MemoryOfflineStore struct {
+	messages map[string][]iface.OfflineMessage
+	maxLen   int           // 每个用户保留的最大消息条数，<=0为不限制
+	ttl      time.Duration // 消息过期时间，<=0为不过期
+	lock     sync.Mutex
+}
+
+// NewMemoryOfflineStore 创建内存离线消息存储
+func NewMemoryOfflineStore(maxLen int, ttl time.Duration) *MemoryOfflineStore {
+	return &MemoryOfflineStore{
+		messages: make(map[string][]iface.OfflineMessage),
+		maxLen:   maxLen,
+		ttl:      ttl,
+	}
+}
+
+// Push 追加一条离线消息，超出容量时丢弃最旧的消息
+func (s *MemoryOfflineStore) Push(uid string, msg iface.OfflineMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msgs := s.expire(append(s.messages[uid], msg))
+	if s.maxLen > 0 && len(msgs) > s.maxLen {
+		msgs = msgs[len(msgs)-s.maxLen:]
+	}
+	s.messages[uid] = msgs
+	return nil
+}
+
+// Pop 取出并删除全部未过期的离线消息
+func (s *MemoryOfflineStore) Pop(uid string) ([]iface.OfflineMessage, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	msgs := s.expire(s.messages[uid])
+	delete(s.messages, uid)
+	return msgs, nil
+}
+
+// expire 去掉已过期的消息，消息按写入时间有序
+func (s *MemoryOfflineStore) expire(msgs []iface.OfflineMessage) []iface.OfflineMessage {
+	if s.ttl <= 0 {
+		return msgs
+	}
+	deadline := time.Now().Add(-s.ttl)
+	for i, msg := range msgs {
+		if msg.CreatedAt.After(deadline) {
+			return msgs[i:]
+		}
+	}
+	return nil
+}
+
+// SendToUID 向用户ID绑定的全部连接发送消息，用户不在线且设置了离线消息存储时暂存，登录后下发
+func (s *Server) SendToUID(uid string, msgID uint32, data []byte) error {
+	conns := s.ConnMgr.GetByUID(uid)
+	if len(conns) == 0 {
+		if s.offline == nil {
+			return ErrUIDOffline
+		}
+		// data可能是请求的缓冲，处理结束后回收复用，离线存储保留一份拷贝
+		return s.offline.Push(uid, iface.OfflineMessage{MsgID: msgID, Data: append([]byte(nil), data...), CreatedAt: time.Now()})
+	}
+	for _, conn := range conns {
+		_ = conn.SendBuffMsg(msgID, data)
+	}
+	return nil
+}
+
+// GetOfflineStore 获取离线消息存储，未设置时为nil
+func (s *Server) GetOfflineStore() iface.OfflineStore {
+	return s.offline
+}
+
+// flushOffline 下发用户离线期间暂存的消息
+func (c *Connection) flushOffline(uid string) {
+	store := c.Server.GetOfflineStore()
+	if store == nil {
+		return
+	}
+	// 命名空间内的离线消息以NamespaceUID存储
+	key := NamespaceUID(c.GetNamespace(), uid)
+	msgs, err := store.Pop(key)
+	if err != nil {
+		c.Logger().Warn("pop offline messages error ", err)
+		return
+	}
+	for i, msg := range msgs {
+		if err := c.SendBuffMsg(msg.MsgID, msg.Data); err != nil {
+			c.Logger().Warn("flush offline message error ", err)
+			// 未下发的消息放回存储，等待下次登录
+			for _, rest := range msgs[i:] {
+				_ = store.Push(key, rest)
+			}
+			return
+		}
+	}
+}
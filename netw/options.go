@@ -1,6 +1,9 @@
 package netw
 
-import "github.com/xiaomingping/game/iface"
+import (
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+)
 
 type Option func(s *Server)
 
@@ -9,4 +12,83 @@ func WithPacket(pack iface.Packet) Option {
 	return func(s *Server) {
 		s.packet = pack
 	}
-}
\ No newline at end of file
+}
+
+// 设置ConnID生成器，默认为进程内自增ID，配置SnowflakeNodeID时为雪花算法
+func WithIDGenerator(gen iface.IDGenerator) Option {
+	return func(s *Server) {
+		s.idGen = gen
+	}
+}
+
+// 设置鉴权器，连接通过鉴权前只允许路由AuthWhitelist中的MsgID，AuthMsgIDs中的消息由AuthMessage鉴权
+func WithAuthenticator(auth iface.Authenticator) Option {
+	return func(s *Server) {
+		s.authenticator = auth
+	}
+}
+
+// 设置封禁名单，默认使用内存封禁名单
+func WithBanList(banList iface.BanList) Option {
+	return func(s *Server) {
+		s.banList = banList
+	}
+}
+
+// 设置离线消息存储，设置后SendToUID在用户不在线时暂存消息，用户登录后下发
+func WithOfflineStore(store iface.OfflineStore) Option {
+	return func(s *Server) {
+		s.offline = store
+	}
+}
+
+// 设置幂等键存储，默认使用内存存储，集群部署时可使用cluster.NewRedisIdempotencyStore
+func WithIdempotencyStore(store iface.IdempotencyStore) Option {
+	return func(s *Server) {
+		s.idempotency = store
+	}
+}
+
+// 设置死信队列存储，未注册处理方法、解码失败、处理失败或panic的消息写入其中，如 NewMemoryDeadLetterQueue(1024)
+func WithDeadLetterStore(store iface.DeadLetterStore) Option {
+	return func(s *Server) {
+		s.msgHandler.SetDeadLetterStore(store)
+	}
+}
+
+// 设置会话元数据存储，会话可在网关重启后或集群内其它节点上恢复，需开启SessionGracePeriod且使用默认的会话管理
+func WithSessionStore(store iface.SessionStore, nodeID string) Option {
+	return func(s *Server) {
+		if sm, ok := s.sessions.(*SessionManager); ok {
+			sm.SetStore(store, nodeID)
+		}
+	}
+}
+
+// 设置会话管理，需同时配置SessionGracePeriod
+func WithSessionManager(sessions iface.SessionManager) Option {
+	return func(s *Server) {
+		s.sessions = sessions
+	}
+}
+
+// 设置密钥交换，需同时配置KeyExchangeMsgID，如 secure.X25519KeyExchange(secure.NewAESGCM)
+func WithKeyExchange(exchange iface.KeyExchange) Option {
+	return func(s *Server) {
+		s.keyExchange = exchange
+	}
+}
+
+// 设置消息内容编解码器，默认使用Protobuf
+func WithCodec(c iface.Codec) Option {
+	return func(s *Server) {
+		s.codec = c
+	}
+}
+
+// 设置心跳、时间轮、限流与重试使用的时钟，默认使用SetClock设置的时钟；测试中传入clock.Fake
+func WithClock(c clock.Clock) Option {
+	return func(s *Server) {
+		s.clock = c
+	}
+}
@@ -0,0 +1,77 @@
+package netw
+
+import (
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrOutboundDropped 出站拦截器返回该错误时不发送消息，发送方法返回nil
+var ErrOutboundDropped = errors.New("netw: outbound message dropped")
+
+// interceptError 出站拦截器返回的错误，发送方法原样返回
+type interceptError struct {
+	err error
+}
+
+func (e *interceptError) Error() string { return e.err.Error() }
+func (e *interceptError) Unwrap() error { return e.err }
+
+// UseOutbound 添加出站拦截器，按添加顺序执行，前一个拦截器的返回值作为后一个的输入；
+// 广播时每个连接分别执行，拦截器不应修改传入的data，需要修改时返回新的切片；
+// 会话重连后补发的消息会再次经过拦截器
+func (s *Server) UseOutbound(interceptors ...iface.OutboundInterceptor) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	s.outbound = append(s.outbound, interceptors...)
+}
+
+// InterceptOutbound 依次执行出站拦截器，返回最终发送的消息内容
+func (s *Server) InterceptOutbound(conn iface.Connection, msgID uint32, data []byte) ([]byte, error) {
+	s.hookLock.RLock()
+	interceptors := s.outbound
+	s.hookLock.RUnlock()
+	var err error
+	for _, intercept := range interceptors {
+		if data, err = intercept(conn, msgID, data); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// InterceptMsgIDs 只对msgIDs中的消息执行的出站拦截器
+func InterceptMsgIDs(intercept iface.OutboundInterceptor, msgIDs ...uint32) iface.OutboundInterceptor {
+	set := make(map[uint32]struct{}, len(msgIDs))
+	for _, msgID := range msgIDs {
+		set[msgID] = struct{}{}
+	}
+	return func(conn iface.Connection, msgID uint32, data []byte) ([]byte, error) {
+		if _, ok := set[msgID]; !ok {
+			return data, nil
+		}
+		return intercept(conn, msgID, data)
+	}
+}
+
+// intercept 封包之前执行Server的出站拦截器
+func (c *Connection) intercept(msgID uint32, data []byte) ([]byte, error) {
+	data, err := c.Server.InterceptOutbound(c, msgID, data)
+	if err != nil && err != ErrOutboundDropped {
+		return nil, &interceptError{err: err}
+	}
+	return data, err
+}
+
+// packError 封包失败时发送方法的返回值：拦截器丢弃的消息视为发送成功，拦截器返回的其它错误原样返回
+func (c *Connection) packError(msgID uint32, err error) error {
+	if err == ErrOutboundDropped {
+		return nil
+	}
+	var ie *interceptError
+	if errors.As(err, &ie) {
+		return ie.err
+	}
+	c.Logger().Error("pack error msg ID = ", msgID)
+	return errors.New("pack error msg ")
+}
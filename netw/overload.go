@@ -0,0 +1,137 @@
+package netw
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+
+	"go.uber.org/zap"
+)
+
+// cpuSampleInterval 进程CPU使用率的采样间隔
+const cpuSampleInterval = time.Second
+
+// 拒绝新连接的原因
+const (
+	rejectMaxConn    = "max_conn"
+	rejectAcceptRate = "accept_rate"
+	rejectQueueDepth = "queue_depth"
+	rejectCPU        = "cpu"
+)
+
+// overloadReply 拒绝新连接时的响应内容
+type overloadReply struct {
+	Reason     string `json:"reason"`
+	RetryAfter int    `json:"retry_after"` // 建议客户端重试的等待时间(秒)
+}
+
+// acceptLimiter 新连接接入速率限制，AcceptRate重载后重建令牌桶
+type acceptLimiter struct {
+	lock   sync.Mutex
+	rate   iface.Rate
+	bucket *TokenBucket
+}
+
+func (l *acceptLimiter) allow(c clock.Clock, rate iface.Rate) bool {
+	if rate.Rate <= 0 {
+		return true
+	}
+	l.lock.Lock()
+	if l.bucket == nil || l.rate != rate {
+		burst := rate.Burst
+		if burst <= 0 {
+			burst = int(math.Ceil(rate.Rate))
+		}
+		l.rate = rate
+		l.bucket = newTokenBucket(c, rate.Rate, burst)
+	}
+	bucket := l.bucket
+	l.lock.Unlock()
+	return bucket.Allow()
+}
+
+// queueDepth 全部worker任务队列中等待处理的消息数量
+func (s *Server) queueDepth() int {
+	depth := 0
+	for _, d := range s.msgHandler.Stats().QueueDepth {
+		depth += d
+	}
+	return depth
+}
+
+// CPUUsage 最近一次采样的进程CPU使用率，按CPU核数归一化到0~1，未配置ShedCPU时为0
+func (s *Server) CPUUsage() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&s.cpuUsage))
+}
+
+// sampleCPU 定时采样进程CPU使用率，Stop时退出
+func (s *Server) sampleCPU() {
+	lastCPU, ok := processCPUTime()
+	if !ok {
+		zap.S().Warn("process cpu time not supported, ShedCPU disabled")
+		return
+	}
+	lastWall := time.Now()
+	ticker := time.NewTicker(cpuSampleInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.quit:
+			return
+		case now := <-ticker.C:
+			cpu, _ := processCPUTime()
+			usage := float64(cpu-lastCPU) / float64(now.Sub(lastWall)) / float64(runtime.NumCPU())
+			atomic.StoreUint64(&s.cpuUsage, math.Float64bits(usage))
+			lastCPU, lastWall = cpu, now
+		}
+	}
+}
+
+// admit 检查是否接受新连接，返回拒绝原因
+func (s *Server) admit() (string, bool) {
+	if reason := s.shedReason(); reason != "" {
+		return reason, false
+	}
+	// 最后检查接入速率，被其它条件拒绝的请求不消耗令牌
+	if !s.acceptLimiter.allow(s.clock, s.conf().AcceptRate) {
+		return rejectAcceptRate, false
+	}
+	return "", true
+}
+
+// shedReason 达到连接数、队列长度或CPU上限时返回拒绝原因，未过载时为空
+func (s *Server) shedReason() string {
+	cfg := s.conf()
+	if cfg.MaxConn > 0 && s.ConnMgr.Len() >= cfg.MaxConn {
+		return rejectMaxConn
+	}
+	if cfg.ShedQueueDepth > 0 && s.queueDepth() >= cfg.ShedQueueDepth {
+		return rejectQueueDepth
+	}
+	if cfg.ShedCPU > 0 && s.CPUUsage() >= cfg.ShedCPU {
+		return rejectCPU
+	}
+	return ""
+}
+
+// rejectOverload 以503拒绝升级，响应头与内容中带有建议的重试时间retryAfter(秒)，不大于0时为5秒
+func rejectOverload(w http.ResponseWriter, reason string, retryAfter int) {
+	metrics.ConnRejected(reason)
+	if retryAfter <= 0 {
+		retryAfter = 5
+	}
+	data, _ := json.Marshal(overloadReply{Reason: reason, RetryAfter: retryAfter})
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_, _ = w.Write(data)
+}
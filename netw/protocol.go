@@ -0,0 +1,248 @@
+package netw
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/xiaomingping/game/iface"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// DescribeMsg 补充MsgID的协议描述，如 s.DescribeMsg(2001, iface.MsgDesc{Name: "RoomState", Request: &pb.RoomState{}})；
+// 可用于没有路由的服务端推送消息
+func (s *Server) DescribeMsg(msgID uint32, desc iface.MsgDesc) {
+	s.descLock.Lock()
+	defer s.descLock.Unlock()
+	if s.descs == nil {
+		s.descs = make(map[uint32]iface.MsgDesc)
+	}
+	s.descs[msgID] = desc
+}
+
+// Protocol 汇总已注册的路由、路由分组、命名空间、协议版本路由、TypeSchema与DescribeMsg生成协议描述，
+// 类型化路由的请求与响应类型自动推断，需在注册路由之后调用
+func (s *Server) Protocol() iface.Protocol {
+	p := iface.Protocol{
+		MinVersion: s.conf().MinProtocolVersion,
+		MaxVersion: s.conf().MaxProtocolVersion,
+	}
+	seen := make(map[uint32]bool)
+	add := func(msg iface.ProtocolMsg) {
+		seen[msg.MsgID] = true
+		p.Messages = append(p.Messages, msg)
+	}
+	mh, ok := s.msgHandler.(*MsgHandle)
+	if ok {
+		for msgID, router := range mh.Apis {
+			add(s.describeRoute(msgID, router))
+		}
+		for msgID, vrs := range mh.versions {
+			for _, vr := range vrs {
+				msg := s.describeRoute(msgID, vr.router)
+				msg.MinVersion, msg.MaxVersion = vr.min, vr.max
+				add(msg)
+			}
+		}
+		mh.groupLock.RLock()
+		groups := mh.groups
+		mh.groupLock.RUnlock()
+		for _, g := range groups {
+			for _, msg := range s.describeGroup(g) {
+				add(msg)
+			}
+		}
+		for _, r := range mh.ranges {
+			p.Ranges = append(p.Ranges, iface.ProtocolRange{Start: r.start, End: r.end, Name: routerName(r.router)})
+		}
+	}
+	s.nsLock.RLock()
+	namespaces := make([]*Namespace, 0, len(s.namespaces))
+	for _, ns := range s.namespaces {
+		namespaces = append(namespaces, ns)
+	}
+	s.nsLock.RUnlock()
+	for _, ns := range namespaces {
+		ns.lock.RLock()
+		groups := append([]iface.RouterGroup{ns.routes}, ns.groups...)
+		ns.lock.RUnlock()
+		for _, g := range groups {
+			for _, msg := range s.describeGroup(g) {
+				msg.Namespace = ns.name
+				add(msg)
+			}
+		}
+	}
+	// 没有路由的MsgID，如服务端推送的消息
+	s.descLock.RLock()
+	var pushes []uint32
+	for msgID := range s.descs {
+		if !seen[msgID] {
+			pushes = append(pushes, msgID)
+		}
+	}
+	s.descLock.RUnlock()
+	for _, msgID := range pushes {
+		add(s.describeRoute(msgID, nil))
+	}
+	sort.Slice(p.Messages, func(i, j int) bool {
+		a, b := p.Messages[i], p.Messages[j]
+		if a.MsgID != b.MsgID {
+			return a.MsgID < b.MsgID
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.MinVersion < b.MinVersion
+	})
+	sort.Slice(p.Ranges, func(i, j int) bool { return p.Ranges[i].Start < p.Ranges[j].Start })
+	return p
+}
+
+// describeGroup 描述路由分组内的路由，只支持netw.RouterGroup
+func (s *Server) describeGroup(group iface.RouterGroup) []iface.ProtocolMsg {
+	g, ok := group.(*RouterGroup)
+	if !ok {
+		return nil
+	}
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	msgs := make([]iface.ProtocolMsg, 0, len(g.apis))
+	for msgID, router := range g.apis {
+		msgs = append(msgs, s.describeRoute(msgID, router))
+	}
+	return msgs
+}
+
+// describeRoute 描述一个MsgID，DescribeMsg补充的信息优先于类型化路由与TypeSchema推断的类型
+func (s *Server) describeRoute(msgID uint32, router iface.Router) iface.ProtocolMsg {
+	msg := iface.ProtocolMsg{MsgID: msgID}
+	var req, resp reflect.Type
+	if tr, ok := router.(*TypedRouter); ok {
+		req, resp = tr.inType, tr.outType
+		if resp != nil {
+			msg.ResponseMsgID = ResponseMsgID(msgID)
+		}
+	}
+	if ts, ok := s.schemas.get(msgID).(*typeSchema); ok && req == nil {
+		req = ts.typ
+	}
+	s.descLock.RLock()
+	desc := s.descs[msgID]
+	s.descLock.RUnlock()
+	if desc.Request != nil {
+		req = reflect.TypeOf(desc.Request)
+	}
+	if desc.Response != nil {
+		resp = reflect.TypeOf(desc.Response)
+	}
+	if desc.ResponseMsgID != 0 {
+		msg.ResponseMsgID = desc.ResponseMsgID
+	}
+	msg.Doc = desc.Doc
+	msg.Request = DescribeType(req)
+	msg.Response = DescribeType(resp)
+	switch {
+	case desc.Name != "":
+		msg.Name = desc.Name
+	case msg.Request != nil:
+		msg.Name = shortName(msg.Request.Name)
+	case routerName(router) != "":
+		msg.Name = routerName(router)
+	default:
+		msg.Name = fmt.Sprintf("Msg%d", msgID)
+	}
+	return msg
+}
+
+// routerName 业务路由的类型名，框架内置的路由为空
+func routerName(router iface.Router) string {
+	if router == nil {
+		return ""
+	}
+	t := reflect.TypeOf(router)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.PkgPath() == reflect.TypeOf(Server{}).PkgPath() {
+		return ""
+	}
+	return t.Name()
+}
+
+// shortName 去掉包名的类型名
+func shortName(name string) string {
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// DescribeType 描述消息内容的类型，proto消息按描述符列出字段编号，其它结构体按json标签列出导出字段
+func DescribeType(t reflect.Type) *iface.ProtocolType {
+	if t == nil {
+		return nil
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if msg, ok := reflect.New(t).Interface().(proto.Message); ok {
+		return describeProto(msg.ProtoReflect().Descriptor())
+	}
+	pt := &iface.ProtocolType{Name: t.String()}
+	if t.Kind() != reflect.Struct {
+		return pt
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name := f.Name
+		if tag := strings.Split(f.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+		typ := f.Type
+		repeated := typ.Kind() == reflect.Slice && typ.Elem().Kind() != reflect.Uint8
+		if repeated {
+			typ = typ.Elem()
+		}
+		pt.Fields = append(pt.Fields, iface.ProtocolField{Name: name, Type: typ.String(), Repeated: repeated})
+	}
+	return pt
+}
+
+// describeProto 按proto描述符描述消息
+func describeProto(md protoreflect.MessageDescriptor) *iface.ProtocolType {
+	pt := &iface.ProtocolType{Name: string(md.FullName())}
+	if file := md.ParentFile(); file != nil {
+		pt.File = file.Path()
+	}
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		pt.Fields = append(pt.Fields, iface.ProtocolField{
+			Name:     string(fd.Name()),
+			Number:   int32(fd.Number()),
+			Type:     protoFieldType(fd),
+			Repeated: fd.IsList(),
+		})
+	}
+	return pt
+}
+
+// protoFieldType proto字段的类型名，消息与枚举为全名
+func protoFieldType(fd protoreflect.FieldDescriptor) string {
+	if fd.IsMap() {
+		return fmt.Sprintf("map<%s, %s>", protoFieldType(fd.MapKey()), protoFieldType(fd.MapValue()))
+	}
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return string(fd.Message().FullName())
+	case protoreflect.EnumKind:
+		return string(fd.Enum().FullName())
+	}
+	return fd.Kind().String()
+}
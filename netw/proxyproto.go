@@ -0,0 +1,268 @@
+package netw
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ProxyInfoProperty 连接属性中保存PROXY protocol信息的Key，值为*ProxyInfo
+var ProxyInfoProperty = "proxy.info"
+
+// ProxyHeaderTimeout 读取PROXY protocol头的超时时间
+var ProxyHeaderTimeout = 5 * time.Second
+
+var ErrBadProxyHeader = errors.New("netw: bad proxy protocol header")
+
+// proxyV2Signature PROXY protocol v2头的固定签名
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// PROXY protocol v2 TLV类型
+const (
+	pp2TypeAuthority = 0x02
+	pp2TypeSSL       = 0x20
+	pp2SubtypeSSLVer = 0x21
+	pp2SubtypeSSLCN  = 0x22
+	pp2ClientSSL     = 0x01
+)
+
+// ProxyInfo 四层负载均衡通过PROXY protocol传递的客户端信息
+type ProxyInfo struct {
+	Source        net.Addr // 客户端地址
+	Destination   net.Addr // 负载均衡接收连接的地址
+	TLS           bool     // 客户端与负载均衡之间是否使用TLS
+	TLSVersion    string   // TLS版本，如 TLSv1.3
+	TLSCommonName string   // 客户端证书的CN
+	Authority     string   // 客户端请求的主机名(SNI)
+}
+
+// proxyListener 解析PROXY protocol v1/v2头的监听器，连接的RemoteAddr为头中的客户端地址；
+// 设置tlsConfig时在PROXY protocol头之后进行TLS握手，Accept返回*tls.Conn
+type proxyListener struct {
+	net.Listener
+	tlsConfig *tls.Config
+	// *tls.Conn -> 其下的*proxyConn，ConnContext中取出后删除
+	tlsConns sync.Map
+}
+
+func (l *proxyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	pc := &proxyConn{Conn: conn, reader: bufio.NewReader(conn)}
+	if l.tlsConfig == nil {
+		return pc, nil
+	}
+	tc := tls.Server(pc, l.tlsConfig)
+	l.tlsConns.Store(tc, pc)
+	return tc, nil
+}
+
+// proxyConn 首次读取或获取地址时在连接自己的goroutine中解析头，不阻塞Accept
+type proxyConn struct {
+	net.Conn
+	reader *bufio.Reader
+	once   sync.Once
+	info   *ProxyInfo
+	err    error
+}
+
+func (c *proxyConn) init() {
+	c.once.Do(func() {
+		_ = c.Conn.SetReadDeadline(time.Now().Add(ProxyHeaderTimeout))
+		c.info, c.err = readProxyHeader(c.reader)
+		_ = c.Conn.SetReadDeadline(time.Time{})
+		if c.err != nil {
+			_ = c.Conn.Close()
+		}
+	})
+}
+
+func (c *proxyConn) Read(b []byte) (int, error) {
+	c.init()
+	if c.err != nil {
+		return 0, c.err
+	}
+	return c.reader.Read(b)
+}
+
+func (c *proxyConn) RemoteAddr() net.Addr {
+	c.init()
+	if c.info != nil && c.info.Source != nil {
+		return c.info.Source
+	}
+	return c.Conn.RemoteAddr()
+}
+
+func (c *proxyConn) LocalAddr() net.Addr {
+	c.init()
+	if c.info != nil && c.info.Destination != nil {
+		return c.info.Destination
+	}
+	return c.Conn.LocalAddr()
+}
+
+// readProxyHeader 按签名区分v1与v2，UNKNOWN或LOCAL命令返回空的ProxyInfo
+func readProxyHeader(r *bufio.Reader) (*ProxyInfo, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+	if sig, err := r.Peek(6); err == nil && string(sig) == "PROXY " {
+		return readProxyV1(r)
+	}
+	return nil, ErrBadProxyHeader
+}
+
+// readProxyV1 解析文本格式头，如 PROXY TCP4 1.2.3.4 5.6.7.8 1234 80\r\n
+func readProxyV1(r *bufio.Reader) (*ProxyInfo, error) {
+	var line []byte
+	for len(line) < 107 {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, b)
+		if b == '\n' {
+			break
+		}
+	}
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return nil, ErrBadProxyHeader
+	}
+	fields := strings.Fields(string(line[:len(line)-2]))
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return &ProxyInfo{}, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrBadProxyHeader
+	}
+	src, err := tcpAddr(fields[2], fields[4])
+	if err != nil {
+		return nil, err
+	}
+	dst, err := tcpAddr(fields[3], fields[5])
+	if err != nil {
+		return nil, err
+	}
+	return &ProxyInfo{Source: src, Destination: dst}, nil
+}
+
+func tcpAddr(host, port string) (*net.TCPAddr, error) {
+	ip := net.ParseIP(host)
+	p, err := strconv.ParseUint(port, 10, 16)
+	if ip == nil || err != nil {
+		return nil, ErrBadProxyHeader
+	}
+	return &net.TCPAddr{IP: ip, Port: int(p)}, nil
+}
+
+// readProxyV2 解析二进制格式头：签名 12B | 版本与命令 1B | 地址族与协议 1B | 长度 2B | 地址 | TLV
+func readProxyV2(r *bufio.Reader) (*ProxyInfo, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+	if header[12]>>4 != 2 {
+		return nil, ErrBadProxyHeader
+	}
+	body := make([]byte, binary.BigEndian.Uint16(header[14:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	info := &ProxyInfo{}
+	// LOCAL命令为负载均衡自身的健康检查
+	if header[12]&0x0f == 0 {
+		return info, nil
+	}
+	var tlvs []byte
+	switch header[13] >> 4 {
+	case 1: // IPv4
+		if len(body) < 12 {
+			return nil, ErrBadProxyHeader
+		}
+		info.Source = &net.TCPAddr{IP: net.IP(body[0:4]), Port: int(binary.BigEndian.Uint16(body[8:]))}
+		info.Destination = &net.TCPAddr{IP: net.IP(body[4:8]), Port: int(binary.BigEndian.Uint16(body[10:]))}
+		tlvs = body[12:]
+	case 2: // IPv6
+		if len(body) < 36 {
+			return nil, ErrBadProxyHeader
+		}
+		info.Source = &net.TCPAddr{IP: net.IP(body[0:16]), Port: int(binary.BigEndian.Uint16(body[32:]))}
+		info.Destination = &net.TCPAddr{IP: net.IP(body[16:32]), Port: int(binary.BigEndian.Uint16(body[34:]))}
+		tlvs = body[36:]
+	default:
+		return info, nil
+	}
+	return info, parseProxyTLVs(info, tlvs)
+}
+
+// parseProxyTLVs 解析TLV中的SNI与TLS信息
+func parseProxyTLVs(info *ProxyInfo, tlvs []byte) error {
+	for len(tlvs) > 0 {
+		if len(tlvs) < 3 {
+			return ErrBadProxyHeader
+		}
+		typ, n := tlvs[0], int(binary.BigEndian.Uint16(tlvs[1:3]))
+		if len(tlvs) < 3+n {
+			return ErrBadProxyHeader
+		}
+		value := tlvs[3 : 3+n]
+		tlvs = tlvs[3+n:]
+		switch typ {
+		case pp2TypeAuthority:
+			info.Authority = string(value)
+		case pp2TypeSSL:
+			// | client 1B | verify 4B | 子TLV |
+			if len(value) < 5 {
+				return ErrBadProxyHeader
+			}
+			info.TLS = value[0]&pp2ClientSSL != 0
+			sub := &ProxyInfo{}
+			if err := parseProxyTLVs(sub, value[5:]); err != nil {
+				return err
+			}
+			info.TLSVersion, info.TLSCommonName = sub.TLSVersion, sub.TLSCommonName
+		case pp2SubtypeSSLVer:
+			info.TLSVersion = string(value)
+		case pp2SubtypeSSLCN:
+			info.TLSCommonName = string(value)
+		}
+	}
+	return nil
+}
+
+// proxyConnKey http请求上下文中保存底层连接的Key
+type proxyConnKey struct{}
+
+// connContext 将PROXY protocol连接保存到请求上下文，握手时读取其中的TLS信息；
+// TLS监听时conn为Accept返回的*tls.Conn，由Accept记录的对应关系找到其下的连接
+func (l *proxyListener) connContext(ctx context.Context, conn net.Conn) context.Context {
+	if v, ok := l.tlsConns.Load(conn); ok {
+		l.tlsConns.Delete(conn)
+		return context.WithValue(ctx, proxyConnKey{}, v)
+	}
+	if pc, ok := conn.(*proxyConn); ok {
+		return context.WithValue(ctx, proxyConnKey{}, pc)
+	}
+	return ctx
+}
+
+// proxyInfo 获取请求所在连接的PROXY protocol信息，未开启时为nil
+func proxyInfo(ctx context.Context) *ProxyInfo {
+	if pc, ok := ctx.Value(proxyConnKey{}).(*proxyConn); ok {
+		pc.init()
+		return pc.info
+	}
+	return nil
+}
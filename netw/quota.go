@@ -0,0 +1,119 @@
+package netw
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// ErrQuotaExceeded 超过入站配额的断开阈值，作为连接的关闭原因
+var ErrQuotaExceeded = errors.New("netw: inbound quota exceeded")
+
+// quotaCounter 按半衰期衰减的累计字节数与消息数
+type quotaCounter struct {
+	bytes  float64
+	msgs   float64
+	at     time.Time
+	warned bool // 已告警，衰减到告警阈值以下后重置
+}
+
+// add 衰减到now后累计一条消息
+func (q *quotaCounter) add(now time.Time, size int, halfLife time.Duration) {
+	if !q.at.IsZero() {
+		decay := math.Exp2(-float64(now.Sub(q.at)) / float64(halfLife))
+		q.bytes *= decay
+		q.msgs *= decay
+	}
+	q.at = now
+	q.bytes += float64(size)
+	q.msgs++
+}
+
+// check 按配额检查累计值，返回需要触发的事件
+func (q *quotaCounter) check(quota iface.Quota, msgID uint32) (iface.QuotaEvent, bool) {
+	event := iface.QuotaEvent{MsgID: msgID, Bytes: q.bytes, Msgs: q.msgs}
+	if over(q.bytes, quota.KickBytes) || over(q.msgs, quota.KickMsgs) {
+		event.Kick = true
+		return event, true
+	}
+	warn := over(q.bytes, quota.WarnBytes) || over(q.msgs, quota.WarnMsgs)
+	if !warn {
+		q.warned = false
+		return event, false
+	}
+	if q.warned {
+		return event, false
+	}
+	q.warned = true
+	return event, true
+}
+
+func over(value float64, limit int64) bool {
+	return limit > 0 && value > float64(limit)
+}
+
+// quotaHalfLife 入站配额的衰减半衰期
+func quotaHalfLife(cfg *iface.Config) time.Duration {
+	if cfg.QuotaHalfLife > 0 {
+		return time.Second * time.Duration(cfg.QuotaHalfLife)
+	}
+	return time.Minute
+}
+
+// checkQuota 在读goroutine中累计收到的消息，超过告警阈值时调用OnQuota Hook函数，超过断开阈值时返回false
+func (c *Connection) checkQuota(msgID uint32, size int) bool {
+	if c.conf().InboundQuota == (iface.Quota{}) && len(c.conf().MsgQuota) == 0 {
+		return true
+	}
+	now := clockOf(c.Server).Now()
+	halfLife := quotaHalfLife(c.conf())
+	c.quota.add(now, size, halfLife)
+	if event, ok := c.quota.check(c.conf().InboundQuota, 0); ok && !c.raiseQuota(event) {
+		return false
+	}
+	quota, ok := c.conf().MsgQuota[msgID]
+	if !ok {
+		return true
+	}
+	if c.msgQuota == nil {
+		c.msgQuota = make(map[uint32]*quotaCounter)
+	}
+	counter, ok := c.msgQuota[msgID]
+	if !ok {
+		counter = &quotaCounter{}
+		c.msgQuota[msgID] = counter
+	}
+	counter.add(now, size, halfLife)
+	if event, ok := counter.check(quota, msgID); ok && !c.raiseQuota(event) {
+		return false
+	}
+	return true
+}
+
+// raiseQuota 调用OnQuota Hook函数，超过断开阈值时返回false
+func (c *Connection) raiseQuota(event iface.QuotaEvent) bool {
+	metrics.QuotaExceeded(event.Kick)
+	c.Logger().Warn("inbound quota exceeded msgID = ", event.MsgID, " bytes = ", int64(event.Bytes), " msgs = ", int64(event.Msgs), " kick = ", event.Kick)
+	c.Server.CallOnQuota(c, event)
+	return !event.Kick
+}
+
+// AddOnQuota 追加连接超过入站配额时的Hook函数，每次越过告警阈值调用一次，超过断开阈值时调用后断开连接
+func (s *Server) AddOnQuota(hookFunc func(conn iface.Connection, event iface.QuotaEvent)) {
+	s.hookLock.Lock()
+	s.onQuota = append(s.onQuota, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// CallOnQuota 调用OnQuota Hook函数
+func (s *Server) CallOnQuota(conn iface.Connection, event iface.QuotaEvent) {
+	s.hookLock.RLock()
+	hooks := s.onQuota
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn, event)
+	}
+}
@@ -0,0 +1,54 @@
+package netw
+
+import (
+	"fmt"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// rangeRouter MsgID区间[start, end]共用的路由
+type rangeRouter struct {
+	start  uint32
+	end    uint32
+	router iface.Router
+}
+
+// AddRouterRange 为MsgID区间[start, end]注册共用的路由，如网关将整段MsgID转发到后端服务，
+// 区间之间不允许重叠；单独注册的MsgID与路由分组优先于区间路由，需在服务启动前调用
+func (mh *MsgHandle) AddRouterRange(start, end uint32, router iface.Router) {
+	if start > end {
+		panic(fmt.Sprintf("invalid router range [%d, %d]", start, end))
+	}
+	checkMsgID(end)
+	for _, r := range mh.ranges {
+		if start <= r.end && r.start <= end {
+			panic(fmt.Sprintf("router range [%d, %d] overlaps [%d, %d]", start, end, r.start, r.end))
+		}
+	}
+	mh.ranges = append(mh.ranges, rangeRouter{start: start, end: end, router: router})
+}
+
+// SetDefault 设置没有任何路由匹配时的默认路由，设置后未注册的MsgID不再写入死信队列，需在服务启动前调用
+func (mh *MsgHandle) SetDefault(router iface.Router) {
+	mh.defaultRouter = router
+}
+
+// findRange 查找MsgID所属区间的路由，未匹配时返回默认路由
+func (mh *MsgHandle) findRange(msgID uint32) iface.Router {
+	for _, r := range mh.ranges {
+		if r.start <= msgID && msgID <= r.end {
+			return r.router
+		}
+	}
+	return mh.defaultRouter
+}
+
+// AddRouterRange 为MsgID区间[start, end]注册共用的路由
+func (s *Server) AddRouterRange(start, end uint32, router iface.Router) {
+	s.msgHandler.AddRouterRange(start, end, router)
+}
+
+// SetDefaultRouter 设置没有任何路由匹配时的默认路由
+func (s *Server) SetDefaultRouter(router iface.Router) {
+	s.msgHandler.SetDefault(router)
+}
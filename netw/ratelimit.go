@@ -0,0 +1,268 @@
+package netw
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// rateLimitProperty 连接属性中保存限流状态的Key
+const rateLimitProperty = "netw.ratelimit"
+
+// TokenBucket 令牌桶
+type TokenBucket struct {
+	rate   float64 // 每秒生成的令牌数
+	burst  float64 // 桶容量
+	tokens float64 // 当前令牌数
+	last   time.Time
+	clock  clock.Clock
+	lock   sync.Mutex
+}
+
+// NewTokenBucket 创建令牌桶，初始为满桶
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return newTokenBucket(clk, rate, burst)
+}
+
+// newTokenBucket 创建按c计时的令牌桶
+func newTokenBucket(c clock.Clock, rate float64, burst int) *TokenBucket {
+	if burst <= 0 {
+		burst = 1
+	}
+	return &TokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   c.Now(),
+		clock:  c,
+	}
+}
+
+// refill 按流逝时间补充令牌，调用方需持有锁
+func (b *TokenBucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+}
+
+// Allow 尝试取一个令牌
+func (b *TokenBucket) Allow() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(b.clock.Now())
+	if b.tokens >= 1 {
+		b.tokens--
+		return true
+	}
+	return false
+}
+
+// Reserve 预定一个令牌，返回需要等待的时间
+func (b *TokenBucket) Reserve() time.Duration {
+	return b.ReserveN(1)
+}
+
+// ReserveN 预定n个令牌，令牌不足时记为欠账，返回需要等待的时间
+func (b *TokenBucket) ReserveN(n float64) time.Duration {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.refill(b.clock.Now())
+	b.tokens -= n
+	if b.tokens >= 0 || b.rate <= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// connRateLimit 单个连接的限流状态
+type connRateLimit struct {
+	conn  *TokenBucket
+	msgs  map[uint32]*TokenBucket
+	lock  sync.Mutex
+	gen   uint64 // 创建时限流器的配置版本
+	clock clock.Clock
+	// 连接所属命名空间共享的令牌桶
+	namespace *TokenBucket
+}
+
+// msgBucket 获取连接内MsgID对应的令牌桶
+func (l *connRateLimit) msgBucket(msgID uint32, rate iface.Rate) *TokenBucket {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	bucket, ok := l.msgs[msgID]
+	if !ok {
+		bucket = newTokenBucket(l.clock, rate.Rate, rate.Burst)
+		l.msgs[msgID] = bucket
+	}
+	return bucket
+}
+
+// RateLimiter 限流器，支持全局、命名空间、单连接、单连接内单个MsgID四个维度
+type RateLimiter struct {
+	global     *TokenBucket            // 全局令牌桶
+	namespaces map[string]*TokenBucket // 各命名空间共享的令牌桶
+	conns      sync.Mutex              // 保护global、namespaces与连接限流状态创建的锁
+	gen        uint64                  // 配置版本，重载限流配置后递增，旧的连接限流状态随之重建
+	onLimited  func(request iface.Request, scope iface.RateLimitScope)
+	server     *Server // 所属Server，为nil时读取SetConfig设置的配置
+}
+
+// NewRateLimiter 创建限流器，限流速率读取SetConfig设置的配置
+func NewRateLimiter() *RateLimiter {
+	return &RateLimiter{}
+}
+
+// conf 限流器所属Server的配置
+func (l *RateLimiter) conf() *iface.Config {
+	if l.server != nil {
+		return l.server.conf()
+	}
+	return sharedConfig()
+}
+
+// clock 限流器所属Server的时钟
+func (l *RateLimiter) clock() clock.Clock {
+	if l.server != nil {
+		return l.server.clock
+	}
+	return clk
+}
+
+// rateLimitEnabled 是否配置了任一维度的限流
+func rateLimitEnabled(cfg *iface.Config) bool {
+	return cfg.GlobalRateLimit.Rate > 0 || cfg.ConnRateLimit.Rate > 0 || len(cfg.MsgRateLimit) > 0 ||
+		len(cfg.NamespaceRateLimit) > 0
+}
+
+// SetOnLimited 设置触发限流时的Hook函数
+func (l *RateLimiter) SetOnLimited(hookFunc func(request iface.Request, scope iface.RateLimitScope)) {
+	l.onLimited = hookFunc
+}
+
+// reset 限流配置重载后丢弃已创建的令牌桶，下次使用时按新配置重建
+func (l *RateLimiter) reset() {
+	l.conns.Lock()
+	l.global = nil
+	l.namespaces = nil
+	l.gen++
+	l.conns.Unlock()
+}
+
+// connLimit 获取连接的限流状态，保存在连接属性中随连接一起释放
+func (l *RateLimiter) connLimit(conn iface.Connection) *connRateLimit {
+	l.conns.Lock()
+	defer l.conns.Unlock()
+	cfg := l.conf()
+	if l.global == nil && cfg.GlobalRateLimit.Rate > 0 {
+		l.global = newTokenBucket(l.clock(), cfg.GlobalRateLimit.Rate, cfg.GlobalRateLimit.Burst)
+	}
+	if v, err := conn.GetProperty(rateLimitProperty); err == nil && v.(*connRateLimit).gen == l.gen {
+		return v.(*connRateLimit)
+	}
+	limit := &connRateLimit{msgs: make(map[uint32]*TokenBucket), gen: l.gen, clock: l.clock(), namespace: l.namespaceBucket(conn.GetNamespace())}
+	if cfg.ConnRateLimit.Rate > 0 {
+		limit.conn = newTokenBucket(l.clock(), cfg.ConnRateLimit.Rate, cfg.ConnRateLimit.Burst)
+	}
+	conn.SetProperty(rateLimitProperty, limit)
+	return limit
+}
+
+// narrowScopes 由小到大的限流维度，多个维度同时不足时报告范围最小的维度
+var narrowScopes = [...]iface.RateLimitScope{iface.RateLimitMsg, iface.RateLimitConn, iface.RateLimitNamespace, iface.RateLimitGlobal}
+
+// take 检查各维度的令牌桶，返回触发限流的维度和需要等待的时间
+func (l *RateLimiter) take(request iface.Request) (iface.RateLimitScope, time.Duration, bool) {
+	var buckets [4]*TokenBucket
+	limit := l.connLimit(request.GetConnection())
+	buckets[iface.RateLimitGlobal] = l.global
+	buckets[iface.RateLimitNamespace] = limit.namespace
+	buckets[iface.RateLimitConn] = limit.conn
+	cfg := l.conf()
+	if rate, ok := cfg.MsgRateLimit[request.GetMsgID()]; ok && rate.Rate > 0 {
+		buckets[iface.RateLimitMsg] = limit.msgBucket(request.GetMsgID(), rate)
+	}
+	return takeAll(buckets, l.clock().Now(), cfg.RateLimitAction == iface.RateLimitDelay)
+}
+
+// takeAll 先检查全部维度再统一扣减令牌，任一维度不足时不扣减其它维度，已被限流的连接不会消耗全局令牌；
+// delay为true时全部维度都预定一个令牌，返回等待最久的维度与时间。令牌桶按维度顺序加锁，避免死锁
+func takeAll(buckets [4]*TokenBucket, now time.Time, delay bool) (iface.RateLimitScope, time.Duration, bool) {
+	for _, bucket := range buckets {
+		if bucket != nil {
+			bucket.lock.Lock()
+			defer bucket.lock.Unlock()
+			bucket.refill(now)
+		}
+	}
+	if !delay {
+		for _, scope := range narrowScopes {
+			if bucket := buckets[scope]; bucket != nil && bucket.tokens < 1 {
+				return scope, 0, false
+			}
+		}
+		for _, bucket := range buckets {
+			if bucket != nil {
+				bucket.tokens--
+			}
+		}
+		return 0, 0, true
+	}
+	var limited iface.RateLimitScope
+	var wait time.Duration
+	for _, scope := range narrowScopes {
+		bucket := buckets[scope]
+		if bucket == nil {
+			continue
+		}
+		bucket.tokens--
+		if bucket.tokens >= 0 || bucket.rate <= 0 {
+			continue
+		}
+		if d := time.Duration(-bucket.tokens / bucket.rate * float64(time.Second)); d > wait {
+			limited, wait = scope, d
+		}
+	}
+	return limited, wait, wait == 0
+}
+
+// Middleware 限流中间件
+func (l *RateLimiter) Middleware() iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			if !rateLimitEnabled(l.conf()) || ContextOf(request).reserved {
+				next(request)
+				return
+			}
+			scope, wait, ok := l.take(request)
+			if ok {
+				next(request)
+				return
+			}
+			if l.onLimited != nil {
+				l.onLimited(request, scope)
+			}
+			switch l.conf().RateLimitAction {
+			case iface.RateLimitDelay:
+				// 令牌已预定，等待期间不占用worker，连接之后的消息排在本条之后
+				if !ContextOf(request).delay(wait) {
+					l.clock().Sleep(wait)
+					next(request)
+				}
+			case iface.RateLimitKick:
+				zap.S().Warn("rate limited, kick ConnID = ", request.GetConnection().GetConnID(), " msgID = ", request.GetMsgID())
+				request.GetConnection().Stop()
+			case iface.RateLimitWarn:
+				next(request)
+			default:
+				recordDrop(request.GetConnection(), iface.DropRateLimited, 1)
+				zap.S().Debug("rate limited, drop ConnID = ", request.GetConnection().GetConnID(), " msgID = ", request.GetMsgID())
+			}
+		}
+	}
+}
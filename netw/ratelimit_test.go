@@ -0,0 +1,85 @@
+package netw_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+// newLimitedServer 创建按fake计时、以configure配置限流的Server，返回处理次数与触发限流的维度
+func newLimitedServer(t *testing.T, fake *clock.Fake, configure func(c *iface.Config)) (iface.Server, *int, *[]iface.RateLimitScope) {
+	t.Helper()
+	s, err := netw.NewOptions().Configure(configure).With(netw.WithClock(fake)).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	handled := new(int)
+	var limited []iface.RateLimitScope
+	s.Handle(1, func(c *netw.Context) { *handled++ })
+	s.SetOnRateLimited(func(request iface.Request, scope iface.RateLimitScope) {
+		limited = append(limited, scope)
+	})
+	return s, handled, &limited
+}
+
+// dispatchN 同步处理n条消息，返回其中被处理的数量
+func dispatchN(s iface.Server, conn iface.Connection, handled *int, n int) int {
+	before := *handled
+	for i := 0; i < n; i++ {
+		netwtest.Dispatch(s, conn, 1, nil)
+	}
+	return *handled - before
+}
+
+func TestRateLimitRefillAndBurst(t *testing.T) {
+	fake := clock.NewFake(time.Time{})
+	s, handled, limited := newLimitedServer(t, fake, func(c *iface.Config) {
+		c.ConnRateLimit = iface.Rate{Rate: 2, Burst: 3}
+	})
+	conn := netwtest.NewConn(s)
+	// 初始为满桶，突发3条
+	if n := dispatchN(s, conn, handled, 4); n != 3 {
+		t.Fatalf("burst handled %d, want 3", n)
+	}
+	if len(*limited) != 1 || (*limited)[0] != iface.RateLimitConn {
+		t.Fatalf("limited scopes = %v", *limited)
+	}
+	// 每秒2个令牌，500ms补充1个
+	fake.Advance(500 * time.Millisecond)
+	if n := dispatchN(s, conn, handled, 2); n != 1 {
+		t.Fatalf("after 500ms handled %d, want 1", n)
+	}
+	// 长时间空闲后令牌不超过桶容量
+	fake.Advance(time.Minute)
+	if n := dispatchN(s, conn, handled, 5); n != 3 {
+		t.Fatalf("after idle handled %d, want 3", n)
+	}
+}
+
+func TestRateLimitLimitedConnKeepsGlobalTokens(t *testing.T) {
+	fake := clock.NewFake(time.Time{})
+	s, handled, limited := newLimitedServer(t, fake, func(c *iface.Config) {
+		c.GlobalRateLimit = iface.Rate{Rate: 1, Burst: 5}
+		c.ConnRateLimit = iface.Rate{Rate: 1, Burst: 2}
+	})
+	a, b, c := netwtest.NewConn(s), netwtest.NewConn(s), netwtest.NewConn(s)
+	// a被单连接限流的消息不消耗全局令牌
+	if n := dispatchN(s, a, handled, 4); n != 2 {
+		t.Fatalf("conn a handled %d, want 2", n)
+	}
+	if n := dispatchN(s, b, handled, 2); n != 2 {
+		t.Fatalf("conn b handled %d, want 2", n)
+	}
+	*limited = nil
+	if n := dispatchN(s, c, handled, 2); n != 1 {
+		t.Fatalf("conn c handled %d, want 1", n)
+	}
+	if len(*limited) != 1 || (*limited)[0] != iface.RateLimitGlobal {
+		t.Fatalf("limited scopes = %v", *limited)
+	}
+}
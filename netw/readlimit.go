@@ -0,0 +1,45 @@
+package netw
+
+import (
+	"errors"
+	"net"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrReadTimeout 超过ReadTimeout未读完一条消息，作为连接的关闭原因
+var ErrReadTimeout = errors.New("netw: read timeout")
+
+// readLimit 单个websocket消息允许的最大字节数
+func readLimit(cfg *iface.Config) int {
+	if cfg.ReadLimit > 0 {
+		return cfg.ReadLimit
+	}
+	return cfg.MaxPacketSize
+}
+
+// handshakeTimeout 读取请求头与升级握手的超时时间，为0时不限制
+func handshakeTimeout(cfg *iface.Config) time.Duration {
+	if cfg.HandshakeTimeout < 0 {
+		return 0
+	}
+	if cfg.HandshakeTimeout == 0 {
+		return 10 * time.Second
+	}
+	return time.Second * time.Duration(cfg.HandshakeTimeout)
+}
+
+// extendReadDeadline 开始读取消息或收到控制帧时重置读超时，逐字节缓慢发送的客户端无法一直占用读goroutine
+func (c *Connection) extendReadDeadline() error {
+	if c.conf().ReadTimeout <= 0 {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(time.Now().Add(time.Second * time.Duration(c.conf().ReadTimeout)))
+}
+
+// isTimeout 是否为读写超时错误
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
@@ -0,0 +1,86 @@
+package netw
+
+import (
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// 设置握手阶段按客户端真实IP补充连接属性的Hook函数，如写入地区与ASN，返回错误时拒绝连接
+func WithIPEnricher(enricher iface.IPEnricher) Option {
+	return func(s *Server) {
+		s.ipEnricher = enricher
+	}
+}
+
+// trusted IP是否属于TrustedProxies
+func trusted(cfg *iface.Config, ip net.IP) bool {
+	for _, proxy := range cfg.TrustedProxies {
+		if strings.Contains(proxy, "/") {
+			if _, cidr, err := net.ParseCIDR(proxy); err == nil && cidr.Contains(ip) {
+				return true
+			}
+		} else if proxyIP := net.ParseIP(proxy); proxyIP != nil && proxyIP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP 获取客户端真实IP：直连地址属于TrustedProxies时，
+// 依次解析RealIPHeaders，X-Forwarded-For从右向左跳过可信代理取第一个地址；读取SetConfig设置的配置
+func ClientIP(r *http.Request) net.IP {
+	return clientIP(sharedConfig(), r)
+}
+
+// clientIP 按cfg中的TrustedProxies与RealIPHeaders获取客户端真实IP
+func clientIP(cfg *iface.Config, r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote := net.ParseIP(host)
+	if remote == nil || !trusted(cfg, remote) {
+		return remote
+	}
+	headers := cfg.RealIPHeaders
+	if len(headers) == 0 {
+		headers = []string{"X-Forwarded-For", "X-Real-IP"}
+	}
+	for _, header := range headers {
+		values := strings.Split(r.Header.Get(header), ",")
+		for i := len(values) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(values[i]))
+			if ip == nil {
+				break
+			}
+			if !trusted(cfg, ip) || i == 0 {
+				return ip
+			}
+		}
+	}
+	return remote
+}
+
+// realAddr 客户端真实地址，与直连地址相同时保留端口
+func realAddr(ip net.IP, conn net.Addr) net.Addr {
+	if ip == nil {
+		return conn
+	}
+	if tcp, ok := conn.(*net.TCPAddr); ok && tcp.IP.Equal(ip) {
+		return conn
+	}
+	return &net.TCPAddr{IP: ip}
+}
+
+// setRemoteAddr 设置客户端真实地址，需在Start之前调用
+func (c *Connection) setRemoteAddr(addr net.Addr) {
+	c.infoLock.Lock()
+	c.remoteAddr = addr
+	c.logger = zap.S().With("connID", c.ConnID, "remoteAddr", addr.String())
+	c.infoLock.Unlock()
+}
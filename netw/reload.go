@@ -0,0 +1,153 @@
+package netw
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/viper"
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LogLevel 可热更新的日志级别，创建zap日志时使用，如 zap.Config{Level: netw.LogLevel}
+var LogLevel = zap.NewAtomicLevel()
+
+// LoadConfig 读取配置文件，支持viper支持的json、yaml、toml等格式，字段名与iface.Config一致
+func LoadConfig(path string) (*iface.Config, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+	return unmarshalConfig(v)
+}
+
+func unmarshalConfig(v *viper.Viper) (*iface.Config, error) {
+	next := &iface.Config{}
+	if err := v.Unmarshal(next); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// ReloadConfig 以next中可热更新的字段更新配置，更新后的配置校验失败时保持原配置，不影响已建立的连接：
+// 心跳、缓冲长度与生命周期超时对之后的连接或下一次检测生效，限流令牌桶按新配置重建，
+// 工作池在启动时的worker上限内调整，日志级别立即生效；其余字段需重启后生效
+func (s *Server) ReloadConfig(next *iface.Config) {
+	s.reloadLock.Lock()
+	defer s.reloadLock.Unlock()
+	// 复制后整体替换，读取方看到的始终是完整的一份配置
+	cfg := *s.conf()
+	cfg.PingTime = next.PingTime
+	cfg.MaxConn = next.MaxConn
+	cfg.AcceptRate = next.AcceptRate
+	cfg.ShedQueueDepth = next.ShedQueueDepth
+	cfg.ShedCPU = next.ShedCPU
+	cfg.RetryAfter = next.RetryAfter
+	cfg.MaxMsgChanLen = next.MaxMsgChanLen
+	cfg.SendBuffTimeout = next.SendBuffTimeout
+	cfg.OverflowPolicy = next.OverflowPolicy
+	cfg.WorkerPoolSize = next.WorkerPoolSize
+	cfg.MaxWorkerPoolSize = next.MaxWorkerPoolSize
+	cfg.WorkerScaleThreshold = next.WorkerScaleThreshold
+	cfg.WorkerIdleTimeout = next.WorkerIdleTimeout
+	cfg.GlobalRateLimit = next.GlobalRateLimit
+	cfg.ConnRateLimit = next.ConnRateLimit
+	cfg.MsgRateLimit = next.MsgRateLimit
+	cfg.RateLimitAction = next.RateLimitAction
+	cfg.NamespaceRateLimit = next.NamespaceRateLimit
+	cfg.NamespaceMaxConn = next.NamespaceMaxConn
+	cfg.IdempotentMsgIDs = next.IdempotentMsgIDs
+	cfg.IdempotencyWindow = next.IdempotencyWindow
+	cfg.CoalesceMsgIDs = next.CoalesceMsgIDs
+	cfg.InboundQuota = next.InboundQuota
+	cfg.MsgQuota = next.MsgQuota
+	cfg.QuotaHalfLife = next.QuotaHalfLife
+	cfg.Chaos = next.Chaos
+	cfg.ChaosRatio = next.ChaosRatio
+	cfg.FairQuantum = next.FairQuantum
+	cfg.DropAlertWindow = next.DropAlertWindow
+	cfg.DropAlertRate = next.DropAlertRate
+	cfg.ConnDropAlertRate = next.ConnDropAlertRate
+	cfg.AuthTimeout = next.AuthTimeout
+	cfg.IdleTimeout = next.IdleTimeout
+	cfg.MaxSessionDuration = next.MaxSessionDuration
+	cfg.ReadTimeout = next.ReadTimeout
+	cfg.CloseTimeout = next.CloseTimeout
+	cfg.RetryMax = next.RetryMax
+	cfg.RetryBackoff = next.RetryBackoff
+	cfg.RetryMaxBackoff = next.RetryMaxBackoff
+	cfg.RetryBacklog = next.RetryBacklog
+	cfg.LogLevel = next.LogLevel
+	if err := ValidateConfig(&cfg); err != nil {
+		zap.S().Error("config reload rejected ", err)
+		return
+	}
+	s.config.Store(&cfg)
+
+	s.rateLimiter.reset()
+	if cfg.WorkerPoolSize > 0 {
+		s.msgHandler.SetWorkerBounds(cfg.WorkerPoolSize, maxWorkerPoolSize(&cfg))
+	}
+	applyLogLevel(cfg.LogLevel)
+	zap.S().Info("config reloaded")
+}
+
+// WatchConfig 监听配置文件变化与SIGHUP信号，触发时重新读取并调用ReloadConfig，Stop时停止
+func (s *Server) WatchConfig(path string) error {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	reload := func() {
+		next, err := unmarshalConfig(v)
+		if err != nil {
+			zap.S().Error("reload config error ", err)
+			return
+		}
+		s.ReloadConfig(next)
+	}
+	v.OnConfigChange(func(e fsnotify.Event) {
+		zap.S().Info("config file changed ", e.Name)
+		reload()
+	})
+	v.WatchConfig()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			select {
+			case <-s.quit:
+				return
+			case <-signals:
+				zap.S().Info("SIGHUP received, reload config ", path)
+				if err := v.ReadInConfig(); err != nil {
+					zap.S().Error("reload config error ", err)
+					continue
+				}
+				reload()
+			}
+		}
+	}()
+	return nil
+}
+
+// applyLogLevel 设置LogLevel，level为空或无法识别时保持不变
+func applyLogLevel(level string) {
+	if level == "" {
+		return
+	}
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		zap.S().Warn("unknown log level ", level)
+		return
+	}
+	LogLevel.SetLevel(l)
+}
@@ -1,11 +1,85 @@
 package netw
 
-import "github.com/xiaomingping/game/iface"
+import (
+	"context"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
 
 //Request 请求
 type Request struct {
 	conn iface.Connection //已经和客户端建立好的 链接
 	msg  iface.Message    //客户端请求的数据
+	buf  []byte           //读取消息时从缓冲池获取的缓冲，处理完成后归还
+	pool bool             //是否来自请求对象池
+	ctx  context.Context  //处理消息的上下文，为nil时使用连接的上下文
+
+	coalesced bool //是否为CoalesceMsgIDs中排队的消息，开始处理前可被更新的消息替换
+}
+
+var (
+	requestPool = sync.Pool{New: func() interface{} { return &Request{} }}
+	messagePool = sync.Pool{New: func() interface{} { return &Message{} }}
+)
+
+//NewRequest 创建请求，可用于测试处理方法或在读goroutine之外投递消息
+func NewRequest(conn iface.Connection, msg iface.Message) iface.Request {
+	return &Request{conn: conn, msg: msg}
+}
+
+//newPoolRequest 从对象池获取请求，处理完成后由release回收
+func newPoolRequest(conn iface.Connection, msg iface.Message, buf []byte) *Request {
+	r := requestPool.Get().(*Request)
+	r.conn, r.msg, r.buf, r.pool = conn, msg, buf, true
+	return r
+}
+
+//newPoolMessage 从对象池获取消息，用于拆包
+func newPoolMessage() *Message {
+	msg := messagePool.Get().(*Message)
+	*msg = Message{}
+	return msg
+}
+
+//release 消息处理完成后归还读缓冲，并回收请求与消息对象
+func (r *Request) release() {
+	if !r.pool {
+		return
+	}
+	PutBuffer(r.buf)
+	if msg, ok := r.msg.(*Message); ok {
+		msg.Data = nil
+		messagePool.Put(msg)
+	}
+	*r = Request{}
+	requestPool.Put(r)
+}
+
+//Copy 复制请求，复制得到的请求不会被回收
+func (r *Request) Copy() iface.Request {
+	data := make([]byte, len(r.GetData()))
+	copy(data, r.GetData())
+	msg := NewMsgPackage(r.GetMsgID(), data)
+	msg.SetSeq(r.msg.GetSeq())
+	msg.SetReqID(r.msg.GetReqID())
+	msg.SetChannel(r.msg.GetChannel())
+	return &Request{conn: r.conn, msg: msg}
+}
+
+//Context 处理消息的上下文，处理方法之外持有的请求返回连接的上下文
+func (r *Request) Context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return r.conn.Context()
+}
+
+//SetContext 替换处理消息的上下文
+func (r *Request) SetContext(ctx context.Context) {
+	r.ctx = ctx
 }
 
 //GetConnection 获取请求连接信息
@@ -22,3 +96,60 @@ func (r *Request) GetData() []byte {
 func (r *Request) GetMsgID() uint32 {
 	return r.msg.GetMsgID()
 }
+
+//Logger 获取携带连接信息与msgID的日志
+func (r *Request) Logger() *zap.SugaredLogger {
+	return r.conn.Logger().With("msgID", r.GetMsgID())
+}
+
+//Bind 使用编解码器将请求数据解码到v
+func (r *Request) Bind(v interface{}) error {
+	return r.conn.Codec().Unmarshal(r.GetData(), v)
+}
+
+//GetReqID 获取客户端请求ID
+func (r *Request) GetReqID() uint64 {
+	return r.msg.GetReqID()
+}
+
+//Reply 向请求连接回复消息，带回客户端请求ID，请求属于逻辑通道时在同一通道回复
+func (r *Request) Reply(msgID uint32, data []byte) error {
+	if channel := r.GetChannel(); channel != 0 {
+		return r.conn.SendChannelMsg(channel, r.GetReqID(), msgID, data)
+	}
+	return r.conn.SendReqMsg(r.GetReqID(), msgID, data)
+}
+
+//ReplyObj 使用编解码器序列化后回复
+func (r *Request) ReplyObj(msgID uint32, v interface{}) error {
+	data, err := r.conn.Codec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return r.Reply(msgID, data)
+}
+
+//ReplyError 以ErrorMsgID向请求连接回复标准错误响应ErrorFrame
+func (r *Request) ReplyError(code int32, msg string) error {
+	return r.Reply(configOf(r.conn.GetServer()).ErrorMsgID, EncodeErrorFrame(ErrorFrame{
+		MsgID:   r.GetMsgID(),
+		Code:    code,
+		ReqID:   r.GetReqID(),
+		Message: msg,
+	}))
+}
+
+//Fail 以错误码表中注册的错误信息回复错误
+func (r *Request) Fail(code int32) error {
+	return r.ReplyError(code, ErrorMessage(code))
+}
+
+//SetProperty 设置请求连接的属性
+func (r *Request) SetProperty(key string, value interface{}) {
+	r.conn.SetProperty(key, value)
+}
+
+//GetProperty 获取请求连接的属性
+func (r *Request) GetProperty(key string) (interface{}, error) {
+	return r.conn.GetProperty(key)
+}
@@ -0,0 +1,208 @@
+package netw
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// RetryableError 处理方法返回的可重试错误，如数据库连接闪断，框架按退避间隔重新处理该消息
+type RetryableError struct {
+	Err     error
+	After   time.Duration // 下一次重试前等待的最短时间，0时使用退避间隔
+	delayed bool          // 限流延迟处理，等待After后不经过限流再处理一次，不计入重试次数
+}
+
+// errRateDelayed 限流延迟处理的消息
+var errRateDelayed = errors.New("netw: rate limit delayed")
+
+func (e *RetryableError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable 包装为可重试的错误，err为nil时返回nil
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// RetryAfter 包装为可重试的错误，至少等待after后重试
+func RetryAfter(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err, After: after}
+}
+
+// IsRetryable 错误链中是否包含可重试的错误
+func IsRetryable(err error) bool {
+	var re *RetryableError
+	return errors.As(err, &re)
+}
+
+// retryQueue 连接重试中的消息与之后暂存的消息
+type retryQueue struct {
+	held []iface.Request
+}
+
+// retryMax 最大重试次数，小于0时不重试
+func retryMax(cfg *iface.Config) int {
+	if cfg.RetryMax == 0 {
+		return 3
+	}
+	return cfg.RetryMax
+}
+
+// retryBacklog 连接重试期间最多暂存的消息数量
+func retryBacklog(cfg *iface.Config) int {
+	if cfg.RetryBacklog > 0 {
+		return cfg.RetryBacklog
+	}
+	return 64
+}
+
+// retryBackoff 第attempt次重试前等待的时间
+func retryBackoff(cfg *iface.Config, attempt int, re *RetryableError) time.Duration {
+	backoff, max := 100*time.Millisecond, 5*time.Second
+	if cfg.RetryBackoff > 0 {
+		backoff = time.Millisecond * time.Duration(cfg.RetryBackoff)
+	}
+	if cfg.RetryMaxBackoff > 0 {
+		max = time.Millisecond * time.Duration(cfg.RetryMaxBackoff)
+	}
+	for i := 1; i < attempt && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	if re.After > backoff {
+		backoff = re.After
+	}
+	return backoff
+}
+
+// Retry 在处理方法中请求稍后重新处理本条消息，不回复错误；
+// 消息不是由框架分发或已关闭重试时返回false，调用方需自行回复错误
+func (c *Context) Retry(err error) bool {
+	if !c.dispatched || retryMax(configOf(c.Server())) < 0 {
+		return false
+	}
+	var re *RetryableError
+	if !errors.As(err, &re) {
+		re = &RetryableError{Err: err}
+	}
+	c.retry = re
+	return true
+}
+
+// delay 限流令牌已预定，等待wait后再处理本条消息，期间同一连接之后的消息暂存等待；
+// 消息不是由框架分发时返回false
+func (c *Context) delay(wait time.Duration) bool {
+	if !c.dispatched {
+		return false
+	}
+	c.retry = &RetryableError{Err: errRateDelayed, After: wait, delayed: true}
+	return true
+}
+
+// holdRetry 连接有消息在重试中时暂存之后的消息，保证处理顺序
+func (mh *MsgHandle) holdRetry(request iface.Request) bool {
+	connID := request.GetConnection().GetConnID()
+	mh.retryLock.Lock()
+	defer mh.retryLock.Unlock()
+	q, ok := mh.retries[connID]
+	if !ok {
+		return false
+	}
+	if len(q.held) >= retryBacklog(mh.conf()) {
+		recordDrop(request.GetConnection(), iface.DropRetryOverflow, 1)
+		request.Logger().Warn("retry backlog full, drop msgID = ", request.GetMsgID())
+		return true
+	}
+	q.held = append(q.held, request.Copy())
+	return true
+}
+
+// startRetry 进入连接的重试状态，在单独的goroutine中重试并按顺序处理暂存的消息
+func (mh *MsgHandle) startRetry(request iface.Request, re *RetryableError) {
+	connID := request.GetConnection().GetConnID()
+	request = request.Copy()
+	mh.retryLock.Lock()
+	defer mh.retryLock.Unlock()
+	if q, ok := mh.retries[connID]; ok {
+		q.held = append(q.held, request)
+		return
+	}
+	q := &retryQueue{}
+	if mh.retries == nil {
+		mh.retries = make(map[int64]*retryQueue)
+	}
+	mh.retries[connID] = q
+	go mh.runRetry(connID, q, request, re)
+}
+
+// runRetry 重试失败的消息，之后依次处理暂存的消息，暂存为空时退出重试状态；连接关闭时丢弃
+func (mh *MsgHandle) runRetry(connID int64, q *retryQueue, request iface.Request, re *RetryableError) {
+	done := request.GetConnection().Context().Done()
+	for {
+		for attempt := 1; re != nil; {
+			delayed := re.delayed
+			if !delayed && attempt > retryMax(mh.conf()) {
+				request.Logger().Warn("retry exhausted msgID = ", request.GetMsgID(), " err = ", re.Err)
+				mh.DeadLetter(request, iface.DeadLetterRetry, re.Err)
+				code := ErrCodeUnknown
+				if ce, ok := re.Err.(codeError); ok {
+					code = ce.Code()
+				}
+				_ = request.ReplyError(code, re.Err.Error())
+				break
+			}
+			wait := re.After
+			if !delayed {
+				wait = retryBackoff(mh.conf(), attempt, re)
+				attempt++
+			}
+			timer := clockOf(request.GetConnection().GetServer()).NewTimer(wait)
+			select {
+			case <-timer.C():
+			case <-done:
+				timer.Stop()
+				mh.endRetry(connID)
+				return
+			}
+			request.Logger().Debug("retry msgID = ", request.GetMsgID(), " delayed = ", delayed)
+			re = mh.dispatch(request, delayed)
+		}
+		select {
+		case <-done:
+			mh.endRetry(connID)
+			return
+		default:
+		}
+		mh.retryLock.Lock()
+		if len(q.held) == 0 {
+			delete(mh.retries, connID)
+			mh.retryLock.Unlock()
+			return
+		}
+		request = q.held[0]
+		q.held = q.held[1:]
+		mh.retryLock.Unlock()
+		re = mh.dispatch(request, false)
+	}
+}
+
+// endRetry 退出连接的重试状态，丢弃暂存的消息
+func (mh *MsgHandle) endRetry(connID int64) {
+	mh.retryLock.Lock()
+	defer mh.retryLock.Unlock()
+	delete(mh.retries, connID)
+}
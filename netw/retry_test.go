@@ -0,0 +1,58 @@
+package netw_test
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+func TestRetryKeepsOrder(t *testing.T) {
+	s := newTestServer(t, func(c *iface.Config) {
+		c.RetryBackoff = 1
+		c.RetryMaxBackoff = 5
+	})
+	var attempts int32
+	s.Handle(1, func(c *netw.Context) {
+		if atomic.AddInt32(&attempts, 1) <= 2 {
+			c.Retry(errors.New("db unavailable"))
+			return
+		}
+		_ = c.Conn().SendMsg(101, nil)
+	})
+	s.Handle(2, reply(102))
+	conn := netwtest.NewConn(s)
+	netwtest.Dispatch(s, conn, 1, nil)
+	// 重试期间之后的消息暂存，重试成功后才处理
+	netwtest.Dispatch(s, conn, 2, nil)
+	conn.Expect(t, 101)
+	conn.Expect(t, 102)
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+}
+
+func TestRetryExhausted(t *testing.T) {
+	s := newTestServer(t, func(c *iface.Config) {
+		c.RetryMax = 2
+		c.RetryBackoff = 1
+		c.ErrorMsgID = 500
+	})
+	var attempts int32
+	s.Handle(1, func(c *netw.Context) {
+		atomic.AddInt32(&attempts, 1)
+		c.Retry(errors.New("db unavailable"))
+	})
+	conn := netwtest.NewConn(s)
+	netwtest.Dispatch(s, conn, 1, nil)
+	if frame := conn.ExpectError(t, 500); frame.MsgID != 1 {
+		t.Fatalf("error frame msgID = %d", frame.MsgID)
+	}
+	// 首次处理与两次重试
+	if n := atomic.LoadInt32(&attempts); n != 3 {
+		t.Fatalf("attempts = %d, want 3", n)
+	}
+}
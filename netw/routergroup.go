@@ -0,0 +1,113 @@
+package netw
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// RouterGroup 路由分组
+type RouterGroup struct {
+	start       uint32
+	end         uint32
+	apis        map[uint32]iface.Router // 分组内MsgID对应的处理方法
+	middlewares []iface.Middleware      // 分组共享的中间件
+	onAttach    func(iface.RouterGroup) // 分组挂载时的Hook函数
+	onDetach    func(iface.RouterGroup) // 分组卸载时的Hook函数
+	lock        sync.RWMutex
+}
+
+// NewRouterGroup 创建一个MsgID区间为[start, end]的路由分组
+func NewRouterGroup(start, end uint32) *RouterGroup {
+	if start > end {
+		panic(fmt.Sprintf("invalid router group range [%d, %d]", start, end))
+	}
+	checkMsgID(end)
+	return &RouterGroup{
+		start: start,
+		end:   end,
+		apis:  make(map[uint32]iface.Router),
+	}
+}
+
+// Start 分组起始MsgID
+func (g *RouterGroup) Start() uint32 {
+	return g.start
+}
+
+// End 分组结束MsgID
+func (g *RouterGroup) End() uint32 {
+	return g.end
+}
+
+// Contains MsgID是否属于该分组
+func (g *RouterGroup) Contains(msgID uint32) bool {
+	return msgID >= g.start && msgID <= g.end
+}
+
+// Use 添加分组中间件
+func (g *RouterGroup) Use(middlewares ...iface.Middleware) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.middlewares = append(g.middlewares, middlewares...)
+}
+
+// Handle 在分组内注册类型化处理方法
+func (g *RouterGroup) Handle(msgID uint32, fn interface{}) {
+	g.AddRouter(msgID, handlerRouter(msgID, fn))
+}
+
+// AddRouter 在分组内注册路由，MsgID必须在分组区间内
+func (g *RouterGroup) AddRouter(msgID uint32, router iface.Router) {
+	if !g.Contains(msgID) {
+		panic(fmt.Sprintf("msgID = %d out of router group range [%d, %d]", msgID, g.start, g.end))
+	}
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if _, ok := g.apis[msgID]; ok {
+		panic(fmt.Sprintf("repeated api , msgID = %d", msgID))
+	}
+	g.apis[msgID] = router
+	metrics.RegisterMsgID(msgID)
+}
+
+// GetRouter 获取分组内的路由
+func (g *RouterGroup) GetRouter(msgID uint32) (iface.Router, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	router, ok := g.apis[msgID]
+	return router, ok
+}
+
+// Middlewares 获取分组中间件
+func (g *RouterGroup) Middlewares() []iface.Middleware {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return g.middlewares
+}
+
+// SetOnAttach 设置分组挂载时的Hook函数
+func (g *RouterGroup) SetOnAttach(hookFunc func(iface.RouterGroup)) {
+	g.onAttach = hookFunc
+}
+
+// SetOnDetach 设置分组卸载时的Hook函数
+func (g *RouterGroup) SetOnDetach(hookFunc func(iface.RouterGroup)) {
+	g.onDetach = hookFunc
+}
+
+// CallOnAttach 调用分组挂载Hook函数
+func (g *RouterGroup) CallOnAttach() {
+	if g.onAttach != nil {
+		g.onAttach(g)
+	}
+}
+
+// CallOnDetach 调用分组卸载Hook函数
+func (g *RouterGroup) CallOnDetach() {
+	if g.onDetach != nil {
+		g.onDetach(g)
+	}
+}
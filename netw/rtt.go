@@ -0,0 +1,101 @@
+package netw
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+// rttProbeLen 往返延迟探测的内容长度，8字节小端序的发送时间(UnixNano)
+const rttProbeLen = 8
+
+// newRTTProbe 记录发送时间并生成探测内容，回复之前再次探测时以新的发送时间为准
+func (c *Connection) newRTTProbe() []byte {
+	now := time.Now().UnixNano()
+	atomic.StoreInt64(&c.rttProbe, now)
+	probe := make([]byte, rttProbeLen)
+	binary.LittleEndian.PutUint64(probe, uint64(now))
+	return probe
+}
+
+// observeRTT 按客户端回复的探测内容更新往返延迟，只接受最近一次发出的探测，客户端无法伪造更低的延迟；
+// 与TCP的SRTT相同，平滑值取7/8的旧值与1/8的新样本
+func (c *Connection) observeRTT(data []byte) {
+	if len(data) != rttProbeLen {
+		return
+	}
+	sent := int64(binary.LittleEndian.Uint64(data))
+	if sent == 0 || !atomic.CompareAndSwapInt64(&c.rttProbe, sent, 0) {
+		return
+	}
+	sample := time.Now().UnixNano() - sent
+	if sample < 0 {
+		return
+	}
+	srtt := atomic.LoadInt64(&c.srtt)
+	rttvar := atomic.LoadInt64(&c.rttvar)
+	if srtt == 0 {
+		srtt, rttvar = sample, sample/2
+	} else {
+		diff := srtt - sample
+		if diff < 0 {
+			diff = -diff
+		}
+		rttvar = (3*rttvar + diff) / 4
+		srtt = (7*srtt + sample) / 8
+	}
+	atomic.StoreInt64(&c.srtt, srtt)
+	atomic.StoreInt64(&c.rttvar, rttvar)
+	metrics.RTT(time.Duration(sample))
+	c.Server.CallOnLatency(c, time.Duration(srtt))
+}
+
+// Latency 平滑后的往返延迟，未测量时为0
+func (c *Connection) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.srtt))
+}
+
+// LatencyJitter 往返延迟的平均偏差，可用于估计延迟补偿的上限
+func (c *Connection) LatencyJitter() time.Duration {
+	return time.Duration(atomic.LoadInt64(&c.rttvar))
+}
+
+// scheduleRTTProbe 业务心跳时在pingInterval后以RTTMsgID发送下一个探测，连接关闭后停止
+func (c *Connection) scheduleRTTProbe() {
+	c.timers.AddTimer(pingInterval(c.conf()), func() {
+		go c.probeRTT()
+	})
+}
+
+func (c *Connection) probeRTT() {
+	c.RLock()
+	closed := c.isClosed
+	c.RUnlock()
+	if closed {
+		return
+	}
+	if err := c.SendBuffMsg(c.conf().RTTMsgID, c.newRTTProbe()); err != nil {
+		c.Logger().Debug("send rtt probe error ", err)
+	}
+	c.scheduleRTTProbe()
+}
+
+// AddOnLatency 追加测量到往返延迟时的Hook函数，在读goroutine中调用，rtt为平滑后的值
+func (s *Server) AddOnLatency(hookFunc func(conn iface.Connection, rtt time.Duration)) {
+	s.hookLock.Lock()
+	s.onLatency = append(s.onLatency, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// CallOnLatency 调用OnLatency Hook函数
+func (s *Server) CallOnLatency(conn iface.Connection, rtt time.Duration) {
+	s.hookLock.RLock()
+	hooks := s.onLatency
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		hookFunc(conn, rtt)
+	}
+}
@@ -0,0 +1,115 @@
+package netw
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/timerwheel"
+
+	"go.uber.org/zap"
+)
+
+// scheduledTask 周期任务
+type scheduledTask struct {
+	interval time.Duration
+	fn       func()
+	timerID  timerwheel.TimerID // 当前等待触发的定时器ID
+}
+
+// scheduler 服务器级周期任务调度，基于时间轮定时器，Stop时取消全部任务并等待执行中的任务结束
+type scheduler struct {
+	timers *timerwheel.TimerWheel // 所属Server的时间轮
+	tasks  map[uint32]*scheduledTask
+	idGen  uint32
+	closed bool
+	wg     sync.WaitGroup
+	lock   sync.Mutex
+}
+
+func newScheduler() *scheduler {
+	return &scheduler{tasks: make(map[uint32]*scheduledTask)}
+}
+
+// schedule 添加周期任务，返回任务ID
+func (s *scheduler) schedule(interval time.Duration, fn func()) uint32 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return 0
+	}
+	s.idGen++
+	task := &scheduledTask{interval: interval, fn: fn}
+	s.tasks[s.idGen] = task
+	s.arm(s.idGen, task)
+	return s.idGen
+}
+
+// arm 为任务创建下一次触发的定时器，调用方需持有锁
+func (s *scheduler) arm(id uint32, task *scheduledTask) {
+	task.timerID = s.timers.AddTimer(task.interval, func() {
+		go s.run(id)
+	})
+}
+
+// run 执行任务并重新计时
+func (s *scheduler) run(id uint32) {
+	s.lock.Lock()
+	task, ok := s.tasks[id]
+	if !ok || s.closed {
+		s.lock.Unlock()
+		return
+	}
+	s.wg.Add(1)
+	s.lock.Unlock()
+	func() {
+		defer s.wg.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				zap.S().Error("scheduled task panic: ", err)
+			}
+		}()
+		task.fn()
+	}()
+	s.lock.Lock()
+	if _, ok := s.tasks[id]; ok && !s.closed {
+		s.arm(id, task)
+	}
+	s.lock.Unlock()
+}
+
+// unschedule 取消周期任务
+func (s *scheduler) unschedule(id uint32) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if task, ok := s.tasks[id]; ok {
+		s.timers.CancelTimer(task.timerID)
+		delete(s.tasks, id)
+	}
+}
+
+// stop 取消全部任务并等待执行中的任务结束
+func (s *scheduler) stop() {
+	s.lock.Lock()
+	s.closed = true
+	for id, task := range s.tasks {
+		s.timers.CancelTimer(task.timerID)
+		delete(s.tasks, id)
+	}
+	s.lock.Unlock()
+	s.wg.Wait()
+}
+
+// SendMsgAfter 延迟d后以SendBuffMsg发送消息，连接已关闭时不再发送，返回的定时器ID可用Server的TimerWheel().CancelTimer取消
+func (c *Connection) SendMsgAfter(d time.Duration, msgID uint32, data []byte) timerwheel.TimerID {
+	// 调用方的data在触发前可能被复用
+	buf := make([]byte, len(data))
+	copy(buf, data)
+	return c.Server.TimerWheel().AddTimer(d, func() {
+		// SendBuffMsg在缓冲已满时会等待，不能阻塞时间轮
+		go func() {
+			if err := c.SendBuffMsg(msgID, buf); err != nil {
+				c.Logger().Debug("send msg after error ", err)
+			}
+		}()
+	})
+}
@@ -0,0 +1,106 @@
+package netw
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+
+	"google.golang.org/protobuf/proto"
+)
+
+var ErrUnknownFields = errors.New("netw: payload has unknown fields")
+
+// validator 自带校验方法的消息类型，如protoc-gen-validate生成的代码
+type validator interface {
+	Validate() error
+}
+
+// typeSchema 按消息类型校验，使用连接的编解码器解码
+type typeSchema struct {
+	typ reflect.Type
+}
+
+// TypeSchema 以v的类型校验消息内容，v需为指针，如 &pb.LoginReq{}；
+// 解码失败时不通过，proto消息还会拒绝未知字段与缺失的required字段，实现了Validate() error的类型会调用该方法
+func TypeSchema(v interface{}) iface.Schema {
+	t := reflect.TypeOf(v)
+	if t == nil || t.Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("schema type must be a pointer, got %T", v))
+	}
+	return &typeSchema{typ: t.Elem()}
+}
+
+// Validate 解码后校验请求数据
+func (ts *typeSchema) Validate(request iface.Request) error {
+	v := reflect.New(ts.typ).Interface()
+	if err := request.Bind(v); err != nil {
+		return err
+	}
+	if msg, ok := v.(proto.Message); ok {
+		// 未知字段一般意味着客户端与服务端的协议版本不一致
+		if len(msg.ProtoReflect().GetUnknown()) > 0 {
+			return ErrUnknownFields
+		}
+		if err := proto.CheckInitialized(msg); err != nil {
+			return err
+		}
+	}
+	if val, ok := v.(validator); ok {
+		return val.Validate()
+	}
+	return nil
+}
+
+// schemaRegistry MsgID对应的消息内容校验
+type schemaRegistry struct {
+	schemas map[uint32]iface.Schema
+	lock    sync.RWMutex
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{schemas: make(map[uint32]iface.Schema)}
+}
+
+func (r *schemaRegistry) get(msgID uint32) iface.Schema {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.schemas[msgID]
+}
+
+// RegisterSchema 为MsgID注册消息内容校验，校验失败按SchemaAction处理，如 s.RegisterSchema(1, netw.TypeSchema(&pb.LoginReq{}))
+func (s *Server) RegisterSchema(msgID uint32, schema iface.Schema) {
+	s.schemas.lock.Lock()
+	defer s.schemas.lock.Unlock()
+	s.schemas.schemas[msgID] = schema
+}
+
+// schemaMiddleware 消息内容校验中间件，未注册校验的MsgID直接放行
+func (s *Server) schemaMiddleware(next iface.HandlerFunc) iface.HandlerFunc {
+	return func(request iface.Request) {
+		schema := s.schemas.get(request.GetMsgID())
+		if schema == nil {
+			next(request)
+			return
+		}
+		err := schema.Validate(request)
+		if err == nil {
+			next(request)
+			return
+		}
+		request.Logger().Warn("schema validate error ", err)
+		request.GetConnection().AddError()
+		switch s.conf().SchemaAction {
+		case iface.SchemaLog:
+			next(request)
+		case iface.SchemaKick:
+			s.msgHandler.DeadLetter(request, iface.DeadLetterBadRequest, err)
+			request.GetConnection().Stop()
+		default:
+			s.msgHandler.DeadLetter(request, iface.DeadLetterBadRequest, err)
+			_ = request.ReplyError(ErrCodeBadRequest, err.Error())
+		}
+	}
+}
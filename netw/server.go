@@ -1,10 +1,19 @@
 package netw
 
 import (
+	"github.com/xiaomingping/game/admin"
+	"github.com/xiaomingping/game/bridge"
+	"github.com/xiaomingping/game/clock"
+	"github.com/xiaomingping/game/codec"
 	"github.com/xiaomingping/game/iface"
-	"github.com/xiaomingping/ztimer"
+	"github.com/xiaomingping/game/metrics"
+	"github.com/xiaomingping/game/timerwheel"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"go.uber.org/zap"
 
@@ -13,6 +22,7 @@ import (
 )
 
 var (
+	// Upgrader 默认的websocket升级参数，NewServer时复制一份，可通过WithUpgrader等Option按Server设置
 	Upgrader = websocket.Upgrader{
 		ReadBufferSize:    4096,
 		WriteBufferSize:   4096,
@@ -21,36 +31,218 @@ var (
 			return true
 		},
 	}
-	GlobalServer iface.Server
-	ZTimer       = ztimer.NewAutoExecTimerScheduler()
+	// CodecQueryKey 握手时用于协商编解码器的URL参数名，如 /ws?codec=json
+	CodecQueryKey = "codec"
 )
 
 // Server 接口实现，定义一个Server服务类
 type Server struct {
-	sesIDGen int64 // 记录已经生成的会话ID流水号
+	idGen iface.IDGenerator // ConnID生成器
 	// 当前Server的消息管理模块，用来绑定MsgID和对应的处理方法
 	msgHandler iface.MsgHandle
 	// 当前Server的链接管理器
 	ConnMgr iface.ConnManager
-	// 该Server的连接创建时Hook函数
-	OnConnStart func(conn iface.Connection)
-	// 该Server的连接断开时的Hook函数
-	OnConnStop func(conn iface.Connection)
-	packet     iface.Packet
+	// 该Server的连接创建时Hook函数链
+	onConnStart []func(conn iface.Connection) error
+	// 该Server的连接断开时Hook函数链
+	onConnStop []func(conn iface.Connection)
+	// 该Server启动、重启与停止时的Hook函数链
+	onStart   []func() error
+	onRestart []func()
+	onStop    []func()
+	// 连接收发与关闭的底层Hook函数链
+	onAccept     []func(conn iface.Connection)
+	onReceiveRaw []func(conn iface.Connection, data []byte) error
+	onSend       []func(conn iface.Connection, data []byte)
+	onClose      []func(conn iface.Connection, reason error)
+	onAuth       []func(conn iface.Connection, uid string, err error)
+	onQuota      []func(conn iface.Connection, event iface.QuotaEvent)
+	onLatency    []func(conn iface.Connection, rtt time.Duration)
+	onDropAlert  []func(alert iface.DropAlert)
+	// 出站拦截器
+	outbound []iface.OutboundInterceptor
+	// 保护Hook函数链的锁
+	hookLock sync.RWMutex
+	packet   iface.Packet
+	// 消息内容编解码器
+	codec iface.Codec
+	// 限流器
+	rateLimiter *RateLimiter
+	// 鉴权器
+	authenticator iface.Authenticator
+	// 消息内容校验
+	schemas *schemaRegistry
+	// DescribeMsg补充的协议描述
+	descs    map[uint32]iface.MsgDesc
+	descLock sync.RWMutex
+	// 封禁名单
+	banList iface.BanList
+	// 离线消息存储，未设置时为nil
+	offline iface.OfflineStore
+	// 会话管理，未开启会话重连时为nil
+	sessions iface.SessionManager
+	// 管理后台，未配置AdminAddr时为nil
+	admin *admin.Server
+	// gRPC推送服务，未配置BridgeAddr时为nil
+	bridge *bridge.Server
+	// 是否拒绝新连接，1为拒绝
+	rejectConn int32
+	// 收到超长数据包时的Hook函数
+	OnOversizedPacket func(conn iface.Connection, size int)
+	// 各生命周期超时阶段的Hook函数
+	onLifecycleTimeout map[iface.TimeoutStage]func(conn iface.Connection)
+	// 同一用户ID重复登录时的Hook函数
+	onDuplicateLogin func(old, new iface.Connection)
+	// 密钥交换
+	keyExchange iface.KeyExchange
+	// 幂等键存储
+	idempotency iface.IdempotencyStore
+	// websocket帧类型对应的封包格式与编解码器
+	frameFormats map[int]*iface.FrameFormat
+	// 周期任务调度
+	scheduler *scheduler
+	// 当前配置，热更新时复制后整体替换
+	config atomic.Value // *iface.Config
+	// 心跳、时间轮、限流与重试使用的时钟
+	clock clock.Clock
+	// 心跳检测、延迟发送与周期任务共用的时间轮
+	timers *timerwheel.TimerWheel
+	// websocket升级参数
+	upgrader websocket.Upgrader
+	// websocket升级阶段的Hook函数
+	upgradeHooks []iface.UpgradeHook
+	// 按客户端真实IP补充连接属性的Hook函数
+	ipEnricher iface.IPEnricher
+	// 命名空间与握手时解析命名空间的函数
+	namespaces map[string]*Namespace
+	nsResolver iface.NamespaceResolver
+	nsLock     sync.RWMutex
+	// 已启动的监听入口
+	listeners    []*http.Server
+	listenerLock sync.Mutex
+	restartLock  sync.Mutex
+	// 串行化并发的热更新，避免后完成的更新覆盖先完成的更新
+	reloadLock sync.Mutex
+	// 监听入口上的普通HTTP路由与静态文件目录
+	httpRoutes []httpRoute
+	staticRoot string
+	// 仍在服务的监听入口数量，入口异常退出时小于listeners的数量
+	serving int32
+	// 健康检查与HealthAddr上的健康检查服务
+	healthChecks []healthCheck
+	health       *http.Server
+	// 全部连接共享的出站带宽令牌桶
+	bandwidth *TokenBucket
+	// 新连接接入速率限制
+	acceptLimiter acceptLimiter
+	// 最近一次采样的进程CPU使用率，float64的位表示
+	cpuUsage uint64
+	// 服务启动以来各原因丢失的消息总数
+	drops [dropReasons]uint64
+	// Stop时关闭，通知后台goroutine退出
+	quit     chan struct{}
+	stopOnce sync.Once
+	// Stop完成时关闭
+	stopped     chan struct{}
+	stoppedOnce sync.Once
 }
 
-// NewServer 创建一个服务器句柄
+// NewServer 创建一个服务器句柄，以SetConfig设置的配置的副本为初始配置，未调用SetConfig时使用DefaultConfig；
+// 需要校验配置时使用Options.Build
 func NewServer(opt ...Option) iface.Server {
+	cfg := DefaultConfig()
+	if c := sharedConfig(); c != nil {
+		*cfg = *c
+	}
+	if err := ValidateConfig(cfg); err != nil {
+		zap.S().Warn(err)
+	}
+	return newServer(cfg, opt...)
+}
+
+// newServer 以cfg为配置创建服务器，cfg归Server所有，调用方不能再修改
+func newServer(cfg *iface.Config, opt ...Option) *Server {
 	s := &Server{
-		msgHandler: NewMsgHandle(),
-		ConnMgr:    NewConnManager(),
-		packet:     NewDataPack(),
+		clock:     clk,
+		codec:     codec.NewProtoCodec(),
+		banList:   NewMemoryBanList(),
+		schemas:   newSchemaRegistry(),
+		upgrader:  Upgrader,
+		quit:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+		packet:    NewLimitDataPack(cfg.CompressThreshold, cfg.MaxPacketSize),
+		ConnMgr:   newConnManager(cfg.ConnShards),
+		scheduler: newScheduler(),
+
+		onLifecycleTimeout: make(map[iface.TimeoutStage]func(conn iface.Connection)),
+	}
+	s.config.Store(cfg)
+	s.msgHandler = newMsgHandle(s)
+	s.idempotency = NewMemoryIdempotencyStore()
+	s.idGen = NewSequenceIDGenerator()
+	if cfg.SnowflakeNodeID > 0 {
+		sf, err := NewSnowflake(cfg.SnowflakeNodeID)
+		if err != nil {
+			panic(err)
+		}
+		s.idGen = sf
+	}
+	if cfg.SessionGracePeriod > 0 {
+		s.sessions = NewSessionManager()
 	}
 	for _, option := range opt {
 		option(s)
 	}
+	// 时钟由Option确定后再创建时间轮与令牌桶
+	s.timers = newTimerWheel(s.clock)
+	s.scheduler.timers = s.timers
+	s.bandwidth = newBandwidthBucket(s.clock, cfg.GlobalBandwidth)
+	if sm, ok := s.sessions.(*SessionManager); ok && sm.server == nil {
+		sm.server = s
+	}
+	if m, ok := s.idempotency.(*MemoryIdempotencyStore); ok {
+		m.SetClock(s.clock)
+	}
+	if s.upgrader.HandshakeTimeout == 0 {
+		s.upgrader.HandshakeTimeout = handshakeTimeout(cfg)
+	}
+	applyLogLevel(cfg.LogLevel)
+	if cfg.ShedCPU > 0 {
+		go s.sampleCPU()
+	}
+	go s.watchDrops()
+	// 限流中间件最先执行，未配置限流时直接放行
+	s.rateLimiter = NewRateLimiter()
+	s.rateLimiter.server = s
+	s.Use(s.rateLimiter.Middleware())
+	s.Use(s.authMiddleware)
+	s.Use(s.schemaMiddleware)
+	s.Use(s.idempotencyMiddleware)
 	s.msgHandler.StartWorkerPool()
-	GlobalServer = s
+	metrics.RegisterQueueDepth(func() float64 {
+		return float64(s.queueDepth())
+	})
+	if cfg.AdminAddr != "" {
+		s.admin = admin.NewServer(s, cfg.AdminAddr, cfg.AdminToken)
+		s.admin.Start()
+	}
+	if cfg.BridgeAddr != "" {
+		var opts []bridge.Option
+		if cfg.BridgeCertFile != "" && cfg.BridgeKeyFile != "" {
+			tlsConfig, err := bridge.LoadTLS(cfg.BridgeCertFile, cfg.BridgeKeyFile, cfg.BridgeClientCAFile)
+			if err != nil {
+				zap.S().Error("bridge tls error ", err)
+			} else {
+				opts = append(opts, bridge.WithTLS(tlsConfig))
+			}
+		}
+		s.bridge = bridge.NewServer(s, cfg.BridgeAddr, cfg.BridgeToken, opts...)
+		s.bridge.Start()
+	}
+	s.registerHealthChecks()
+	if cfg.HealthAddr != "" {
+		s.startHealthServer()
+	}
 	return s
 }
 
@@ -63,15 +255,116 @@ func (s *Server) Start(c *gin.Context) {
 		err      error
 		wsSocket *websocket.Conn
 	)
-	if wsSocket, err = Upgrader.Upgrade(c.Writer, c.Request, nil); err != nil {
+	// 维护期间拒绝新连接
+	if !s.IsAccepting() {
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+	// 过载保护
+	if reason, ok := s.admit(); !ok {
+		zap.S().Debug("overload reject reason = ", reason)
+		rejectOverload(c.Writer, reason, s.conf().RetryAfter)
+		c.Abort()
+		return
+	}
+	// 封禁IP拒绝连接
+	clientIP := clientIP(s.conf(), c.Request)
+	ip := clientIP.String()
+	if s.banList.IsBanned(BanIPKey(ip)) {
+		zap.S().Info("banned ip reject ", ip)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	// 升级阶段Hook，校验请求并收集连接属性
+	props, err := s.runUpgradeHooks(c.Request)
+	if err == nil && s.ipEnricher != nil {
+		err = s.ipEnricher(clientIP, props)
+	}
+	if err != nil {
+		zap.S().Warn("upgrade hook reject ", ip, " err = ", err)
+		c.AbortWithStatus(http.StatusForbidden)
+		return
+	}
+	// 握手阶段鉴权
+	var uid string
+	if s.authenticator != nil {
+		if uid, err = s.authenticator.AuthHandshake(c.Request); err != nil {
+			zap.S().Warn("auth handshake failed ", ip, " err = ", err)
+			c.AbortWithStatus(http.StatusUnauthorized)
+			return
+		}
+		if uid != "" && s.banList.IsBanned(BanUIDKey(uid)) {
+			zap.S().Info("banned uid reject ", uid)
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+	}
+	// 协商协议版本，过旧的客户端需强制更新
+	version, err := negotiateVersion(s.conf(), c.Request)
+	if err != nil {
+		zap.S().Info("unsupported protocol version reject ", c.Query(ProtocolQueryKey))
+		c.AbortWithStatus(http.StatusUpgradeRequired)
+		return
+	}
+	// 解析连接所属的命名空间
+	ns, err := s.resolveNamespace(c.Request)
+	if err != nil {
+		zap.S().Info("namespace reject ", ip, " err = ", err)
+		if err == ErrNamespaceFull {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+		} else {
+			c.AbortWithStatus(http.StatusForbidden)
+		}
+		return
+	}
+	header := http.Header{}
+	header.Set(ProtocolHeader, strconv.FormatUint(uint64(version), 10))
+	if wsSocket, err = s.upgrader.Upgrade(c.Writer, c.Request, header); err != nil {
 		return
 	}
-	if s.ConnMgr.Len() >= config.MaxConn {
+	// 并发升级可能在检查之后超出MaxConn
+	if s.conf().MaxConn > 0 && s.ConnMgr.Len() >= s.conf().MaxConn {
+		metrics.ConnRejected(rejectMaxConn)
 		wsSocket.Close()
 		return
 	}
+	metrics.ConnAccepted()
 	// 处理该新连接请求的 业务 方法， 此时应该有 handler 和 conn是绑定的
-	dealConn := NewConnection(s, wsSocket, atomic.AddInt64(&s.sesIDGen, 1), s.msgHandler)
+	dealConn := NewConnection(s, wsSocket, s.idGen.NextID(), s.msgHandler)
+	dealConn.setRemoteAddr(realAddr(clientIP, wsSocket.RemoteAddr()))
+	dealConn.listenerTag = c.GetString(listenerTagKey)
+	dealConn.protocolVersion = version
+	dealConn.serverBandwidth = s.bandwidth
+	if ns != nil {
+		dealConn.namespace = ns
+		ns.connOpened()
+	}
+	for key, value := range props {
+		dealConn.SetProperty(key, value)
+	}
+	if info := proxyInfo(c.Request.Context()); info != nil {
+		dealConn.SetProperty(ProxyInfoProperty, info)
+	}
+	captureClientInfo(c.Request, dealConn)
+	// 按照握手参数协商编解码器
+	if name := c.Query(CodecQueryKey); name != "" {
+		if cc, ok := codec.Get(name); ok {
+			dealConn.SetCodec(cc)
+		} else {
+			zap.S().Warn("unknown codec ", name, ", use default ", s.codec.Name())
+		}
+	}
+	s.callOnAccept(dealConn)
+	if uid != "" {
+		if err := dealConn.SetAuthenticated(uid); err != nil {
+			zap.S().Info("duplicate login reject ", uid)
+			dealConn.rejectBeforeStart(s.conf().DuplicateLoginMsgID, RejectedReason)
+			return
+		}
+	}
+	if s.sessions != nil {
+		dealConn.SetProperty(sessionTokenProperty, c.Query(SessionQueryKey))
+	}
 	// 启动当前链接的处理业务
 	dealConn.Start()
 }
@@ -79,8 +372,33 @@ func (s *Server) Start(c *gin.Context) {
 // Stop 停止服务
 func (s *Server) Stop() {
 	zap.S().Info("[STOP] server...")
+	s.stopOnce.Do(func() { close(s.quit) })
+	// 关闭监听入口，不再接受新连接
+	s.closeListeners()
+	// 先停止周期任务，避免任务在清理连接期间继续发送
+	s.scheduler.stop()
+	s.hookLock.RLock()
+	onStop := s.onStop
+	s.hookLock.RUnlock()
+	for i := len(onStop) - 1; i >= 0; i-- {
+		onStop[i]()
+	}
 	// 将其他需要清理的连接信息或者其他信息 也要一并停止或者清理
 	s.ConnMgr.ClearConn()
+	// 连接清理后停止工作池，worker处理完已分配的任务后退出
+	s.msgHandler.StopWorkerPool()
+	if s.admin != nil {
+		s.admin.Stop()
+	}
+	if s.bridge != nil {
+		s.bridge.Stop()
+	}
+	// 健康检查服务最后关闭，停止期间就绪检查失败
+	if s.health != nil {
+		s.stopHealthServer()
+	}
+	s.timers.Stop()
+	s.stoppedOnce.Do(func() { close(s.stopped) })
 }
 
 // Serve 运行服务
@@ -94,35 +412,269 @@ func (s *Server) AddRouter(msgID uint32, router iface.Router) {
 	s.msgHandler.AddRouter(msgID, router)
 }
 
+// Handle 注册类型化处理方法，如 func(iface.Request, *LoginReq) (*LoginResp, error)，
+// 响应以ResponseMsgID(msgID)下发，返回错误时以ReplyError下发；也可以是 func(*netw.Context)
+func (s *Server) Handle(msgID uint32, fn interface{}) {
+	s.msgHandler.AddRouter(msgID, handlerRouter(msgID, fn))
+}
+
+// Use 添加消息处理中间件，如鉴权、日志、限流等
+func (s *Server) Use(middlewares ...iface.Middleware) {
+	s.msgHandler.Use(middlewares...)
+}
+
+// Group 创建MsgID区间为[start, end]的路由分组，分组可共享中间件
+func (s *Server) Group(start, end uint32) iface.RouterGroup {
+	return s.msgHandler.Group(start, end)
+}
+
+// AddGroup 挂载路由分组
+func (s *Server) AddGroup(group iface.RouterGroup) {
+	s.msgHandler.AddGroup(group)
+}
+
+// RemoveGroup 卸载路由分组
+func (s *Server) RemoveGroup(group iface.RouterGroup) {
+	s.msgHandler.RemoveGroup(group)
+}
+
+// SetAccepting 设置是否接受新连接
+func (s *Server) SetAccepting(accept bool) {
+	var reject int32
+	if !accept {
+		reject = 1
+	}
+	atomic.StoreInt32(&s.rejectConn, reject)
+}
+
+// IsAccepting 是否接受新连接
+func (s *Server) IsAccepting() bool {
+	return atomic.LoadInt32(&s.rejectConn) == 0
+}
+
+// Broadcast 向全部在线链接发送消息，返回发送成功的链接数量
+func (s *Server) Broadcast(msgID uint32, data []byte) int {
+	var conns []iface.Connection
+	s.ConnMgr.Search(func(conn iface.Connection) {
+		conns = append(conns, conn)
+	})
+	sent := 0
+	for _, conn := range conns {
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Schedule 添加周期任务，每隔interval执行一次fn，服务停止时取消并等待执行中的任务
+func (s *Server) Schedule(interval time.Duration, fn func()) uint32 {
+	return s.scheduler.schedule(interval, fn)
+}
+
+// Unschedule 取消周期任务
+func (s *Server) Unschedule(id uint32) {
+	s.scheduler.unschedule(id)
+}
+
+// GetBanList 得到封禁名单
+func (s *Server) GetBanList() iface.BanList {
+	return s.banList
+}
+
+// BanIP 封禁IP并踢掉该IP的在线链接，ttl<=0为永久封禁
+func (s *Server) BanIP(ip string, ttl time.Duration, reason string, msgID uint32) {
+	s.banList.Ban(BanIPKey(ip), ttl)
+	s.kickWhere(func(conn iface.Connection) bool {
+		host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+		return host == ip
+	}, reason, msgID)
+}
+
+// BanUID 封禁用户ID并踢掉该用户的在线链接，ttl<=0为永久封禁
+func (s *Server) BanUID(uid string, ttl time.Duration, reason string, msgID uint32) {
+	s.banList.Ban(BanUIDKey(uid), ttl)
+	s.kickWhere(func(conn iface.Connection) bool {
+		return conn.GetUID() == uid
+	}, reason, msgID)
+}
+
+// kickWhere 踢掉满足条件的在线链接，各链接同时发送踢出原因，写阻塞的链接不会拖慢其它链接
+func (s *Server) kickWhere(match func(iface.Connection) bool, reason string, msgID uint32) {
+	var connIDs []int64
+	s.ConnMgr.Search(func(conn iface.Connection) {
+		if match(conn) {
+			connIDs = append(connIDs, conn.GetConnID())
+		}
+	})
+	var wg sync.WaitGroup
+	for _, connID := range connIDs {
+		wg.Add(1)
+		go func(connID int64) {
+			defer wg.Done()
+			_ = s.ConnMgr.Kick(connID, reason, msgID)
+		}(connID)
+	}
+	wg.Wait()
+}
+
 // GetConnMgr 得到链接管理
 func (s *Server) GetConnMgr() iface.ConnManager {
 	return s.ConnMgr
 }
 
-// SetOnConnStart 设置该Server的连接创建时Hook函数
+// AddOnConnStart 追加连接创建时的Hook函数，按追加顺序调用，返回错误时拒绝该连接且不再调用后续Hook
+func (s *Server) AddOnConnStart(hookFunc func(iface.Connection) error) {
+	s.hookLock.Lock()
+	s.onConnStart = append(s.onConnStart, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// AddOnConnStop 追加连接断开时的Hook函数，按追加顺序的逆序调用，被拒绝的连接同样会调用
+func (s *Server) AddOnConnStop(hookFunc func(iface.Connection)) {
+	s.hookLock.Lock()
+	s.onConnStop = append(s.onConnStop, hookFunc)
+	s.hookLock.Unlock()
+}
+
+// SetOnConnStart 追加不会拒绝连接的OnConnStart Hook函数
 func (s *Server) SetOnConnStart(hookFunc func(iface.Connection)) {
-	s.OnConnStart = hookFunc
+	s.AddOnConnStart(func(conn iface.Connection) error {
+		hookFunc(conn)
+		return nil
+	})
 }
 
-// SetOnConnStop 设置该Server的连接断开时的Hook函数
+// SetOnConnStop 同AddOnConnStop
 func (s *Server) SetOnConnStop(hookFunc func(iface.Connection)) {
-	s.OnConnStop = hookFunc
+	s.AddOnConnStop(hookFunc)
+}
+
+// SetOnOversizedPacket 设置收到超长数据包时的Hook函数，调用后连接会被断开
+func (s *Server) SetOnOversizedPacket(hookFunc func(conn iface.Connection, size int)) {
+	s.OnOversizedPacket = hookFunc
+}
+
+// CallOnOversizedPacket 调用OnOversizedPacket Hook函数
+func (s *Server) CallOnOversizedPacket(conn iface.Connection, size int) {
+	if s.OnOversizedPacket != nil {
+		s.OnOversizedPacket(conn, size)
+	}
+}
+
+// SetOnLifecycleTimeout 设置连接生命周期超时阶段的Hook函数，调用后连接会被断开
+func (s *Server) SetOnLifecycleTimeout(stage iface.TimeoutStage, hookFunc func(conn iface.Connection)) {
+	s.onLifecycleTimeout[stage] = hookFunc
 }
 
-// CallOnConnStart 调用连接OnConnStart Hook函数
-func (s *Server) CallOnConnStart(conn iface.Connection) {
-	if s.OnConnStart != nil {
-		s.OnConnStart(conn)
+// CallOnLifecycleTimeout 调用对应阶段的OnLifecycleTimeout Hook函数
+func (s *Server) CallOnLifecycleTimeout(conn iface.Connection, stage iface.TimeoutStage) {
+	if hookFunc := s.onLifecycleTimeout[stage]; hookFunc != nil {
+		hookFunc(conn)
 	}
 }
 
-// CallOnConnStop 调用连接OnConnStop Hook函数
+// SetOnDuplicateLogin 设置同一用户ID重复登录时的Hook函数，DuplicateKickOld时在旧连接断开前调用
+func (s *Server) SetOnDuplicateLogin(hookFunc func(old, new iface.Connection)) {
+	s.onDuplicateLogin = hookFunc
+}
+
+// CallOnDuplicateLogin 调用OnDuplicateLogin Hook函数
+func (s *Server) CallOnDuplicateLogin(old, new iface.Connection) {
+	if s.onDuplicateLogin != nil {
+		s.onDuplicateLogin(old, new)
+	}
+}
+
+// SetOnHandlerPanic 设置业务处理panic时的Hook函数
+func (s *Server) SetOnHandlerPanic(hookFunc func(request iface.Request, err interface{})) {
+	s.msgHandler.SetOnHandlerPanic(hookFunc)
+}
+
+// SetOnDeadLetter 设置消息进入死信队列时的Hook函数，可用于排查客户端与服务端协议版本不一致
+func (s *Server) SetOnDeadLetter(hookFunc func(letter iface.DeadLetter)) {
+	s.msgHandler.SetOnDeadLetter(hookFunc)
+}
+
+// SetOnRateLimited 设置触发限流时的Hook函数
+func (s *Server) SetOnRateLimited(hookFunc func(request iface.Request, scope iface.RateLimitScope)) {
+	s.rateLimiter.SetOnLimited(hookFunc)
+}
+
+// GetMsgHandler 得到消息管理
+func (s *Server) GetMsgHandler() iface.MsgHandle {
+	return s.msgHandler
+}
+
+// GetSessionMgr 得到会话管理，未开启会话重连时为nil
+func (s *Server) GetSessionMgr() iface.SessionManager {
+	return s.sessions
+}
+
+// AddOnStop 追加Server停止时的Hook函数，在停止周期任务之后、断开全部连接之前逆序调用
+func (s *Server) AddOnStop(hookFunc func()) {
+	s.hookLock.Lock()
+	defer s.hookLock.Unlock()
+	s.onStop = append(s.onStop, hookFunc)
+}
+
+// CallOnConnStart 依次调用OnConnStart Hook函数，返回第一个错误
+func (s *Server) CallOnConnStart(conn iface.Connection) error {
+	// 绑定或恢复会话
+	if s.sessions != nil {
+		token, _ := conn.GetProperty(sessionTokenProperty)
+		conn.RemoveProperty(sessionTokenProperty)
+		tokenStr, _ := token.(string)
+		session := s.sessions.Bind(conn, tokenStr)
+		if session.ID() != tokenStr && s.conf().SessionMsgID != 0 {
+			_ = conn.SendMsg(s.conf().SessionMsgID, []byte(session.ID()))
+		}
+	}
+	s.hookLock.RLock()
+	hooks := s.onConnStart
+	s.hookLock.RUnlock()
+	for _, hookFunc := range hooks {
+		if err := hookFunc(conn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rebindSession 连接鉴权后恢复等待鉴权的会话，改为绑定新会话时下发会话token
+func (s *Server) rebindSession(conn iface.Connection) {
+	if s.sessions == nil {
+		return
+	}
+	session, resumed := s.sessions.Rebind(conn)
+	if session != nil && !resumed && s.conf().SessionMsgID != 0 {
+		_ = conn.SendMsg(s.conf().SessionMsgID, []byte(session.ID()))
+	}
+}
+
+// CallOnConnStop 逆序调用OnConnStop Hook函数，后注册的模块先清理
 func (s *Server) CallOnConnStop(conn iface.Connection) {
-	if s.OnConnStop != nil {
-		s.OnConnStop(conn)
+	if s.sessions != nil {
+		s.sessions.Unbind(conn)
+	}
+	s.hookLock.RLock()
+	hooks := s.onConnStop
+	s.hookLock.RUnlock()
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](conn)
 	}
 }
 
 func (s *Server) Packet() iface.Packet {
 	return s.packet
 }
+
+// GetKeyExchange 获取密钥交换函数
+func (s *Server) GetKeyExchange() iface.KeyExchange {
+	return s.keyExchange
+}
+
+// Codec 获取消息内容编解码器
+func (s *Server) Codec() iface.Codec {
+	return s.codec
+}
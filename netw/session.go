@@ -0,0 +1,533 @@
+package netw
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// SessionQueryKey 重连时携带会话token的URL参数名，如 /ws?session=xxx
+	SessionQueryKey = "session"
+	// sessionTokenProperty 连接属性中保存会话token的Key
+	sessionTokenProperty = "netw.session_token"
+)
+
+// bufferedMsg 离线缓冲中的消息
+type bufferedMsg struct {
+	Seq   uint64
+	MsgID uint32
+	Data  []byte
+}
+
+// ringBuffer 固定容量的环形缓冲，写满后覆盖最旧的消息
+type ringBuffer struct {
+	items []bufferedMsg
+	start int
+	size  int
+}
+
+func newRingBuffer(capacity int) *ringBuffer {
+	if capacity <= 0 {
+		capacity = 256
+	}
+	return &ringBuffer{items: make([]bufferedMsg, capacity)}
+}
+
+// push 写入消息的拷贝，调用方的data可能在之后被回收复用；返回是否覆盖了最旧的消息
+func (r *ringBuffer) push(msg bufferedMsg) bool {
+	msg.Data = append([]byte(nil), msg.Data...)
+	end := (r.start + r.size) % len(r.items)
+	r.items[end] = msg
+	if r.size < len(r.items) {
+		r.size++
+		return false
+	}
+	r.start = (r.start + 1) % len(r.items)
+	return true
+}
+
+// drain 按序号顺序取出全部消息并清空
+func (r *ringBuffer) drain() []bufferedMsg {
+	msgs := r.snapshot()
+	r.start, r.size = 0, 0
+	return msgs
+}
+
+// snapshot 按序号顺序复制全部消息
+func (r *ringBuffer) snapshot() []bufferedMsg {
+	msgs := make([]bufferedMsg, 0, r.size)
+	for i := 0; i < r.size; i++ {
+		msgs = append(msgs, r.items[(r.start+i)%len(r.items)])
+	}
+	return msgs
+}
+
+// Session 会话
+type Session struct {
+	id       string
+	uid      string
+	conn     iface.Connection
+	seq      uint64      // 消息序号
+	buffer   *ringBuffer // 离线期间的消息缓冲
+	expire   *time.Timer // 宽限期定时器
+	login    time.Time   // 会话创建时间
+	property map[string]interface{}
+	lock     sync.RWMutex
+
+	namespace string // 会话所属的命名空间，不同命名空间的连接不能恢复
+
+	migrating bool                   // 已保存迁移数据，断开时不再覆盖存储
+	connProps map[string]interface{} // 迁移携带的连接属性，恢复后写入新连接
+}
+
+// ID 会话token
+func (s *Session) ID() string {
+	return s.id
+}
+
+// GetUID 会话绑定的用户ID
+func (s *Session) GetUID() string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.uid
+}
+
+// GetConnection 当前绑定的连接，离线时为nil
+func (s *Session) GetConnection() iface.Connection {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.conn
+}
+
+// IsOnline 是否在线
+func (s *Session) IsOnline() bool {
+	return s.GetConnection() != nil
+}
+
+// SendMsg 在线时直接发送，离线或连接正在关闭时写入缓冲，重连后补发
+func (s *Session) SendMsg(msgID uint32, data []byte) error {
+	for {
+		s.lock.Lock()
+		conn := s.conn
+		if conn == nil || connClosed(conn) {
+			s.bufferMsg(conn, msgID, data)
+			s.lock.Unlock()
+			return nil
+		}
+		s.lock.Unlock()
+		err := conn.SendMsg(msgID, data)
+		if err == nil || !connClosed(conn) {
+			return err
+		}
+		// 发送期间连接关闭，按会话当前的连接重新处理
+	}
+}
+
+// connClosed 连接是否已关闭或正在关闭
+func connClosed(conn iface.Connection) bool {
+	if c, ok := conn.(*Connection); ok {
+		c.RLock()
+		defer c.RUnlock()
+		return c.isClosed
+	}
+	select {
+	case <-conn.Context().Done():
+		return true
+	default:
+		return false
+	}
+}
+
+// bufferMsg 写入离线缓冲，序号接在连接已分配的序号之后，调用方需持有锁
+func (s *Session) bufferMsg(conn iface.Connection, msgID uint32, data []byte) {
+	s.syncSeq(conn)
+	s.seq++
+	if s.buffer.push(bufferedMsg{Seq: s.seq, MsgID: msgID, Data: data}) {
+		zap.S().Warn("session buffer full, oldest msg dropped, session = ", s.id)
+	}
+}
+
+// syncSeq 会话序号不小于连接已分配的序号，调用方需持有锁
+func (s *Session) syncSeq(conn iface.Connection) {
+	if c, ok := conn.(*Connection); ok {
+		if seq := c.lastSeq(); seq > s.seq {
+			s.seq = seq
+		}
+	}
+}
+
+// SetProperty 设置会话属性
+func (s *Session) SetProperty(key string, value interface{}) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.property == nil {
+		s.property = make(map[string]interface{})
+	}
+	s.property[key] = value
+}
+
+// GetProperty 获取会话属性
+func (s *Session) GetProperty(key string) (interface{}, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if value, ok := s.property[key]; ok {
+		return value, nil
+	}
+	return nil, errors.New("no property found")
+}
+
+// RemoveProperty 移除会话属性
+func (s *Session) RemoveProperty(key string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	delete(s.property, key)
+}
+
+// SessionManager 会话管理模块
+type SessionManager struct {
+	sessions map[string]*Session // token对应的会话
+	conns    map[int64]*Session  // ConnID对应的会话
+	onExpire func(iface.Session)
+	lock     sync.RWMutex
+	store    iface.SessionStore // 会话元数据存储，为nil时会话只保存在当前节点内存中
+	nodeID   string
+	server   *Server          // 所属Server，为nil时读取SetConfig设置的配置
+	pending  map[int64]string // 等待连接鉴权后由Rebind恢复的会话token
+}
+
+// NewSessionManager 创建会话管理
+func NewSessionManager() *SessionManager {
+	return &SessionManager{
+		sessions: make(map[string]*Session),
+		conns:    make(map[int64]*Session),
+		pending:  make(map[int64]string),
+	}
+}
+
+// conf 会话管理所属Server的配置
+func (sm *SessionManager) conf() *iface.Config {
+	if sm.server != nil {
+		return sm.server.conf()
+	}
+	return sharedConfig()
+}
+
+// SetStore 设置会话元数据存储，本节点内存中不存在的token会从存储中恢复会话，离线缓冲只在Migrate时随会话迁移
+func (sm *SessionManager) SetStore(store iface.SessionStore, nodeID string) {
+	sm.store = store
+	sm.nodeID = nodeID
+}
+
+// load 从存储中读取token对应的会话
+func (sm *SessionManager) load(token string) (*Session, bool) {
+	if sm.store == nil || token == "" {
+		return nil, false
+	}
+	info, ok, err := sm.loadInfo(token)
+	if err != nil {
+		zap.S().Warn("load session error ", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	s := &Session{
+		id:        info.Token,
+		uid:       info.UID,
+		namespace: info.Namespace,
+		login:     info.LoginTime,
+		buffer:    newRingBuffer(sm.conf().SessionBufferSize),
+		property:  info.Properties,
+		connProps: info.ConnProperties,
+	}
+	for _, msg := range info.Pending {
+		s.buffer.push(bufferedMsg{Seq: msg.Seq, MsgID: msg.MsgID, Data: msg.Data})
+	}
+	return s, true
+}
+
+func (sm *SessionManager) loadInfo(token string) (iface.SessionInfo, bool, error) {
+	if sm.store == nil {
+		return iface.SessionInfo{}, false, nil
+	}
+	return sm.store.Load(token)
+}
+
+// save 保存会话元数据
+func (sm *SessionManager) save(s *Session, ttl time.Duration) {
+	if sm.store == nil {
+		return
+	}
+	s.lock.RLock()
+	info := iface.SessionInfo{
+		Token:     s.id,
+		UID:       s.uid,
+		Namespace: s.namespace,
+		NodeID:    sm.nodeID,
+		LoginTime: s.login,
+		LastSeen:  time.Now(),
+	}
+	if s.migrating {
+		info.Properties = s.property
+		info.ConnProperties = s.connProps
+		for _, msg := range s.buffer.snapshot() {
+			info.Pending = append(info.Pending, iface.OutboundMsg{Seq: msg.Seq, MsgID: msg.MsgID, Data: msg.Data})
+		}
+	}
+	s.lock.RUnlock()
+	if err := sm.store.Save(info, ttl); err != nil {
+		zap.S().Warn("save session error ", err)
+	}
+}
+
+// sessionStoreTTL 在线会话元数据的过期时间
+func sessionStoreTTL(cfg *iface.Config) time.Duration {
+	if cfg.SessionStoreTTL > 0 {
+		return time.Second * time.Duration(cfg.SessionStoreTTL)
+	}
+	return 24 * time.Hour
+}
+
+// newSessionToken 生成随机会话token
+func newSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Get 利用token获取会话
+func (sm *SessionManager) Get(token string) (iface.Session, bool) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	s, ok := sm.sessions[token]
+	return s, ok
+}
+
+// GetByConn 获取连接绑定的会话
+func (sm *SessionManager) GetByConn(conn iface.Connection) (iface.Session, bool) {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	s, ok := sm.conns[conn.GetConnID()]
+	return s, ok
+}
+
+// Bind 连接绑定会话，token对应的会话处于宽限期内时恢复会话并补发离线消息；
+// 已绑定用户的会话在连接鉴权之前不恢复，返回该会话但不绑定，鉴权后由Rebind校验用户ID并恢复
+func (sm *SessionManager) Bind(conn iface.Connection, token string) iface.Session {
+	sm.lock.RLock()
+	_, local := sm.sessions[token]
+	sm.lock.RUnlock()
+	// 网关重启或在其它节点上创建的会话
+	var restored *Session
+	if !local {
+		restored, _ = sm.load(token)
+	}
+	sm.lock.Lock()
+	s, ok := sm.sessions[token]
+	if !ok && restored != nil {
+		s, ok = restored, true
+		sm.sessions[s.id] = s
+		zap.S().Debug("session restored from store ", s.id)
+	}
+	// 其它命名空间的会话不能恢复，视为新会话
+	if ok && s.namespace != conn.GetNamespace() {
+		zap.S().Info("session namespace mismatch ", s.id, " ConnID = ", conn.GetConnID())
+		ok = false
+	}
+	// 已绑定用户的会话只能由同一用户恢复，防止持有token的其它用户接管
+	if ok && s.GetUID() != "" && s.GetUID() != conn.GetUID() {
+		// 通过AuthMsgIDs鉴权的连接在握手时还没有用户ID，等待鉴权
+		if conn.GetUID() == "" {
+			sm.pending[conn.GetConnID()] = s.id
+			sm.lock.Unlock()
+			return s
+		}
+		zap.S().Warn("session uid mismatch ", s.id, " ConnID = ", conn.GetConnID())
+		ok = false
+	}
+	if !ok {
+		s = sm.newSession(conn)
+	}
+	sm.conns[conn.GetConnID()] = s
+	sm.lock.Unlock()
+	sm.attach(conn, s, ok)
+	return s
+}
+
+// Rebind 连接鉴权后恢复Bind时等待鉴权的会话，用户ID不一致或会话已过期时绑定新会话，resumed为false；
+// 连接没有等待鉴权的会话时为已绑定的会话记录用户ID，返回nil
+func (sm *SessionManager) Rebind(conn iface.Connection) (session iface.Session, resumed bool) {
+	sm.lock.Lock()
+	token, ok := sm.pending[conn.GetConnID()]
+	if !ok {
+		s := sm.conns[conn.GetConnID()]
+		sm.lock.Unlock()
+		if s != nil {
+			s.lock.Lock()
+			if s.uid == "" {
+				s.uid = conn.GetUID()
+			}
+			s.lock.Unlock()
+			sm.save(s, sessionStoreTTL(sm.conf()))
+		}
+		return nil, false
+	}
+	delete(sm.pending, conn.GetConnID())
+	s, ok := sm.sessions[token]
+	if ok && s.GetUID() != conn.GetUID() {
+		zap.S().Warn("session uid mismatch ", s.id, " ConnID = ", conn.GetConnID())
+		ok = false
+	}
+	if !ok {
+		s = sm.newSession(conn)
+	}
+	sm.conns[conn.GetConnID()] = s
+	sm.lock.Unlock()
+	sm.attach(conn, s, ok)
+	return s, ok
+}
+
+// newSession 创建并登记连接的新会话，调用方需持有锁
+func (sm *SessionManager) newSession(conn iface.Connection) *Session {
+	s := &Session{
+		id:     newSessionToken(),
+		buffer: newRingBuffer(sm.conf().SessionBufferSize),
+		login:  time.Now(),
+	}
+	s.namespace = conn.GetNamespace()
+	sm.sessions[s.id] = s
+	return s
+}
+
+// attach 连接接管会话，resumed为true时解绑旧连接并补发离线消息
+func (sm *SessionManager) attach(conn iface.Connection, s *Session, resumed bool) {
+	s.lock.Lock()
+	if s.expire != nil {
+		s.expire.Stop()
+		s.expire = nil
+	}
+	// 旧连接仍在线时(客户端未感知断线就重连)，解绑旧连接
+	old := s.conn
+	s.conn = conn
+	if uid := conn.GetUID(); uid != "" {
+		s.uid = uid
+	}
+	buffered := s.buffer.drain()
+	sort.SliceStable(buffered, func(i, j int) bool { return buffered[i].Seq < buffered[j].Seq })
+	// 新连接的序号接在会话已分配的序号之后
+	if c, ok := conn.(*Connection); ok {
+		c.advanceSeq(s.seq)
+	}
+	// 迁移恢复的会话写回连接属性
+	connProps := s.connProps
+	s.connProps, s.migrating = nil, false
+	s.lock.Unlock()
+	for key, value := range connProps {
+		conn.SetProperty(key, value)
+	}
+
+	if old != nil && old != conn {
+		sm.lock.Lock()
+		delete(sm.conns, old.GetConnID())
+		sm.lock.Unlock()
+		old.Stop()
+	}
+	if resumed {
+		zap.S().Debug("session resumed ", s.id, " ConnID = ", conn.GetConnID(), " buffered = ", len(buffered))
+	}
+	sm.save(s, sessionStoreTTL(sm.conf()))
+	for _, msg := range buffered {
+		if err := replay(conn, msg); err != nil {
+			zap.S().Error("session replay error ", err)
+			break
+		}
+	}
+}
+
+// replay 补发离线消息，保留消息原有的序号
+func replay(conn iface.Connection, msg bufferedMsg) error {
+	if c, ok := conn.(*Connection); ok {
+		return c.sendWith(msg.Seq, msg.MsgID, msg.Data, c.GetCipher())
+	}
+	return conn.SendMsg(msg.MsgID, msg.Data)
+}
+
+// Unbind 连接断开，会话进入宽限期，宽限期结束后销毁
+func (sm *SessionManager) Unbind(conn iface.Connection) {
+	sm.lock.Lock()
+	delete(sm.pending, conn.GetConnID())
+	s, ok := sm.conns[conn.GetConnID()]
+	if ok {
+		delete(sm.conns, conn.GetConnID())
+	}
+	sm.lock.Unlock()
+	if !ok {
+		return
+	}
+	s.lock.Lock()
+	if s.conn != conn {
+		s.lock.Unlock()
+		return
+	}
+	s.conn = nil
+	s.syncSeq(conn)
+	// 未被确认的消息放入离线缓冲，重连后重新发送
+	for _, msg := range conn.GetUnacked() {
+		s.buffer.push(bufferedMsg{Seq: msg.Seq, MsgID: msg.MsgID, Data: msg.Data})
+	}
+	grace := time.Second * time.Duration(sm.conf().SessionGracePeriod)
+	s.expire = time.AfterFunc(grace, func() {
+		sm.expire(s)
+	})
+	migrating := s.migrating
+	s.lock.Unlock()
+	// 宽限期内可在任意节点重连，迁移中的会话已在迁移前保存
+	if !migrating {
+		sm.save(s, grace)
+	}
+}
+
+// expire 宽限期结束仍未重连，销毁会话
+func (sm *SessionManager) expire(s *Session) {
+	s.lock.RLock()
+	online := s.conn != nil
+	s.lock.RUnlock()
+	if online {
+		return
+	}
+	sm.lock.Lock()
+	delete(sm.sessions, s.id)
+	sm.lock.Unlock()
+	// 会话已在其它节点恢复时保留存储中的元数据
+	if info, ok, err := sm.loadInfo(s.id); err == nil && ok && info.NodeID == sm.nodeID {
+		if err := sm.store.Delete(s.id); err != nil {
+			zap.S().Warn("delete session error ", err)
+		}
+	}
+	zap.S().Debug("session expired ", s.id)
+	if sm.onExpire != nil {
+		sm.onExpire(s)
+	}
+}
+
+// Len 获取会话数量
+func (sm *SessionManager) Len() int {
+	sm.lock.RLock()
+	defer sm.lock.RUnlock()
+	return len(sm.sessions)
+}
+
+// SetOnSessionExpire 设置会话宽限期结束被销毁时的Hook函数
+func (sm *SessionManager) SetOnSessionExpire(hookFunc func(iface.Session)) {
+	sm.onExpire = hookFunc
+}
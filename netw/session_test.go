@@ -0,0 +1,96 @@
+package netw_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/netwtest"
+)
+
+// messageAuth 以消息内容为用户ID的消息鉴权
+type messageAuth struct{}
+
+func (messageAuth) AuthHandshake(r *http.Request) (string, error) { return "", nil }
+
+func (messageAuth) AuthMessage(request iface.Request) (string, error) {
+	return string(request.GetData()), nil
+}
+
+// waitOffline 等待会话的连接断开
+func waitOffline(t *testing.T, session iface.Session) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for session.IsOnline() {
+		if time.Now().After(deadline) {
+			t.Fatal("session still online")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSessionResumeAfterMessageAuth(t *testing.T) {
+	s, err := netw.NewOptions().Configure(func(c *iface.Config) {
+		c.SessionGracePeriod = 30
+		c.SessionMsgID = 900
+		c.AuthMsgIDs = []uint32{1}
+	}).With(netw.WithAuthenticator(messageAuth{})).Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Stop)
+	s.Handle(1, reply(101))
+	tr := netwtest.NewServerTransport(s)
+	t.Cleanup(func() { _ = tr.Close() })
+
+	c1, err := tr.Dial("/ws", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := string(c1.Expect(t, 900).GetData())
+	if err := c1.Send(1, []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	c1.Expect(t, 101)
+	session, ok := s.GetSessionMgr().Get(token)
+	if !ok || session.GetUID() != "alice" {
+		t.Fatalf("session = %v, ok = %v", session, ok)
+	}
+	_ = c1.Close()
+	waitOffline(t, session)
+	_ = session.SendMsg(200, []byte("missed"))
+
+	// 同一用户鉴权后恢复会话，不下发新token，补发离线消息
+	c2, err := tr.Dial("/ws?"+netw.SessionQueryKey+"="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c2.Send(1, []byte("alice")); err != nil {
+		t.Fatal(err)
+	}
+	if msg := c2.Expect(t, 200); string(msg.GetData()) != "missed" {
+		t.Fatalf("replayed data = %q", msg.GetData())
+	}
+	c2.Expect(t, 101)
+	_ = c2.Close()
+	waitOffline(t, session)
+
+	// 其它用户持有token时不能接管会话，绑定新会话
+	c3, err := tr.Dial("/ws?"+netw.SessionQueryKey+"="+token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c3.Close()
+	if err := c3.Send(1, []byte("bob")); err != nil {
+		t.Fatal(err)
+	}
+	if fresh := string(c3.Expect(t, 900).GetData()); fresh == token {
+		t.Fatal("session taken over by another uid")
+	}
+	c3.Expect(t, 101)
+	if session.IsOnline() {
+		t.Fatal("original session resumed by another uid")
+	}
+}
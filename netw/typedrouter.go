@@ -0,0 +1,98 @@
+package netw
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrCodeUnknown 处理方法返回的错误未实现Code()时回复的错误码
+const ErrCodeUnknown int32 = 1
+
+// ErrCodeBadRequest 请求数据解码失败时回复的错误码
+const ErrCodeBadRequest int32 = 2
+
+// ResponseMsgID 类型化路由的响应MsgID，默认为请求MsgID+1
+var ResponseMsgID = func(msgID uint32) uint32 {
+	return msgID + 1
+}
+
+var (
+	requestType = reflect.TypeOf((*iface.Request)(nil)).Elem()
+	contextType = reflect.TypeOf((*Context)(nil))
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// codeError 带错误码的错误
+type codeError interface {
+	Code() int32
+}
+
+// TypedRouter 类型化路由，自动解码请求并编码响应，
+// 处理方法形如 func(iface.Request, *LoginReq) (*LoginResp, error) 或 func(iface.Request, *LoginReq) error，
+// 第一个参数也可以是 *netw.Context；返回Retryable包装的错误时不回复，稍后重新处理
+type TypedRouter struct {
+	BaseRouter
+	msgID   uint32
+	fn      reflect.Value
+	inType  reflect.Type
+	outType reflect.Type // 响应类型，只返回error时为nil
+	context bool         // 第一个参数是否为*Context
+}
+
+// NewTypedRouter 创建类型化路由，处理方法签名不合法时panic
+func NewTypedRouter(msgID uint32, fn interface{}) *TypedRouter {
+	v := reflect.ValueOf(fn)
+	t := v.Type()
+	if t.Kind() != reflect.Func || t.NumIn() != 2 || (t.In(0) != requestType && t.In(0) != contextType) || t.In(1).Kind() != reflect.Ptr {
+		panic(fmt.Sprintf("msgID = %d typed handler must be func(iface.Request, *Req) (*Resp, error), got %s", msgID, t))
+	}
+	if (t.NumOut() != 1 && t.NumOut() != 2) || t.Out(t.NumOut()-1) != errorType {
+		panic(fmt.Sprintf("msgID = %d typed handler must return (*Resp, error) or error, got %s", msgID, t))
+	}
+	tr := &TypedRouter{msgID: msgID, fn: v, inType: t.In(1).Elem(), context: t.In(0) == contextType}
+	if t.NumOut() == 2 {
+		tr.outType = t.Out(0)
+	}
+	return tr
+}
+
+// Handle 解码请求，调用处理方法后以ResponseMsgID回复响应或错误
+func (tr *TypedRouter) Handle(request iface.Request) {
+	in := reflect.New(tr.inType)
+	if err := request.Bind(in.Interface()); err != nil {
+		request.Logger().Warn("bind request error ", err)
+		request.GetConnection().GetServer().GetMsgHandler().DeadLetter(request, iface.DeadLetterBadRequest, err)
+		_ = request.ReplyError(ErrCodeBadRequest, err.Error())
+		return
+	}
+	first := reflect.ValueOf(request)
+	if tr.context {
+		first = reflect.ValueOf(ContextOf(request))
+	}
+	out := tr.fn.Call([]reflect.Value{first, in})
+	if errV := out[len(out)-1]; !errV.IsNil() {
+		err := errV.Interface().(error)
+		if IsRetryable(err) && ContextOf(request).Retry(err) {
+			return
+		}
+		code := ErrCodeUnknown
+		if ce, ok := err.(codeError); ok {
+			code = ce.Code()
+		} else {
+			// 带错误码的错误属于业务正常返回，未带错误码的视为处理失败写入死信队列
+			request.GetConnection().GetServer().GetMsgHandler().DeadLetter(request, iface.DeadLetterError, err)
+		}
+		_ = request.ReplyError(code, err.Error())
+		return
+	}
+	if len(out) == 1 {
+		return
+	}
+	if resp := out[0]; resp.Kind() != reflect.Ptr || !resp.IsNil() {
+		if err := request.ReplyObj(ResponseMsgID(tr.msgID), resp.Interface()); err != nil {
+			request.Logger().Error("reply error ", err)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package netw
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+var (
+	ErrMissingQuery        = errors.New("netw: missing query parameter")
+	ErrMissingCookie       = errors.New("netw: missing cookie")
+	ErrHeaderMismatch      = errors.New("netw: header mismatch")
+	ErrUnsupportedProtocol = errors.New("netw: unsupported subprotocol")
+)
+
+// 设置websocket升级参数，默认使用Upgrader，需在WithCheckOrigin与WithSubprotocols之前
+func WithUpgrader(upgrader websocket.Upgrader) Option {
+	return func(s *Server) {
+		s.upgrader = upgrader
+	}
+}
+
+// 设置Origin校验，返回false时拒绝连接，默认允许全部Origin
+func WithCheckOrigin(checkOrigin func(r *http.Request) bool) Option {
+	return func(s *Server) {
+		s.upgrader.CheckOrigin = checkOrigin
+	}
+}
+
+// 设置支持的子协议，客户端未提供其中任一子协议时拒绝连接
+func WithSubprotocols(protocols ...string) Option {
+	return func(s *Server) {
+		s.upgrader.Subprotocols = protocols
+		s.upgradeHooks = append(s.upgradeHooks, requireSubprotocol(protocols))
+	}
+}
+
+// 追加websocket升级阶段的Hook函数
+func WithUpgradeHook(hooks ...iface.UpgradeHook) Option {
+	return func(s *Server) {
+		s.upgradeHooks = append(s.upgradeHooks, hooks...)
+	}
+}
+
+// QueryProperty 将URL参数param的值保存为连接属性key，required为true时缺少参数则拒绝连接
+func QueryProperty(param, key string, required bool) iface.UpgradeHook {
+	return func(r *http.Request, props map[string]interface{}) error {
+		value := r.URL.Query().Get(param)
+		if value == "" {
+			if required {
+				return ErrMissingQuery
+			}
+			return nil
+		}
+		props[key] = value
+		return nil
+	}
+}
+
+// CookieProperty 将Cookie name的值保存为连接属性key，required为true时缺少Cookie则拒绝连接
+func CookieProperty(name, key string, required bool) iface.UpgradeHook {
+	return func(r *http.Request, props map[string]interface{}) error {
+		cookie, err := r.Cookie(name)
+		if err != nil || cookie.Value == "" {
+			if required {
+				return ErrMissingCookie
+			}
+			return nil
+		}
+		props[key] = cookie.Value
+		return nil
+	}
+}
+
+// RequireHeader 请求头name的值需为values之一，values为空时只要求请求头存在
+func RequireHeader(name string, values ...string) iface.UpgradeHook {
+	return func(r *http.Request, props map[string]interface{}) error {
+		got := r.Header.Get(name)
+		if got == "" {
+			return ErrHeaderMismatch
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		for _, v := range values {
+			if v == got {
+				return nil
+			}
+		}
+		return ErrHeaderMismatch
+	}
+}
+
+// requireSubprotocol 客户端提供的子协议中需包含protocols之一
+func requireSubprotocol(protocols []string) iface.UpgradeHook {
+	return func(r *http.Request, props map[string]interface{}) error {
+		for _, offered := range websocket.Subprotocols(r) {
+			for _, p := range protocols {
+				if offered == p {
+					return nil
+				}
+			}
+		}
+		return ErrUnsupportedProtocol
+	}
+}
+
+// runUpgradeHooks 依次执行升级Hook，返回需要设置的连接属性
+func (s *Server) runUpgradeHooks(r *http.Request) (map[string]interface{}, error) {
+	if len(s.upgradeHooks) == 0 {
+		return nil, nil
+	}
+	props := make(map[string]interface{})
+	for _, hook := range s.upgradeHooks {
+		if err := hook(r, props); err != nil {
+			return nil, err
+		}
+	}
+	return props, nil
+}
@@ -0,0 +1,84 @@
+package netw
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+)
+
+// ErrInvalidConfig 配置校验失败，错误信息中列出全部不合法的字段
+var ErrInvalidConfig = errors.New("netw: invalid config")
+
+// DefaultConfig 可直接使用的默认配置：二进制消息、30秒业务心跳、按CPU核数启动工作池
+func DefaultConfig() *iface.Config {
+	return &iface.Config{
+		PingTime:         30,
+		MessageType:      websocket.BinaryMessage,
+		WorkerPoolSize:   uint32(runtime.NumCPU()),
+		MaxWorkerTaskLen: 1024,
+		MaxMsgChanLen:    1024,
+	}
+}
+
+// ValidateConfig 校验配置的必填字段、取值范围与相互依赖的字段
+func ValidateConfig(c *iface.Config) error {
+	if c == nil {
+		return fmt.Errorf("%w: config is nil", ErrInvalidConfig)
+	}
+	var problems []string
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+	check(c.PingTime > 0, "PingTime must be > 0, got %d", c.PingTime)
+	check(c.MessageType == websocket.TextMessage || c.MessageType == websocket.BinaryMessage,
+		"MessageType must be %d(text) or %d(binary), got %d", websocket.TextMessage, websocket.BinaryMessage, c.MessageType)
+	check(c.HeartbeatMode == iface.HeartbeatMessage || c.HeartbeatMode == iface.HeartbeatPingPong,
+		"HeartbeatMode unknown %d", c.HeartbeatMode)
+	check(c.PingInterval >= 0, "PingInterval must be >= 0, got %d", c.PingInterval)
+	check(c.MaxConn >= 0, "MaxConn must be >= 0, got %d", c.MaxConn)
+	check(c.ConnShards >= 0, "ConnShards must be >= 0, got %d", c.ConnShards)
+	check(c.SnowflakeNodeID >= 0 && c.SnowflakeNodeID <= 1023, "SnowflakeNodeID must be in [0, 1023], got %d", c.SnowflakeNodeID)
+	check(c.CompressionLevel >= -2 && c.CompressionLevel <= 9, "CompressionLevel must be in [-2, 9], got %d", c.CompressionLevel)
+	check(c.MaxMsgChanLen >= 0, "MaxMsgChanLen must be >= 0, got %d", c.MaxMsgChanLen)
+	check(c.WriteBatchSize <= 1 || c.BatchMsgID != 0, "WriteBatchSize %d requires BatchMsgID", c.WriteBatchSize)
+	check(c.MaxWorkerPoolSize == 0 || c.MaxWorkerPoolSize >= c.WorkerPoolSize,
+		"MaxWorkerPoolSize %d must be >= WorkerPoolSize %d", c.MaxWorkerPoolSize, c.WorkerPoolSize)
+	check(c.BackpressureHigh >= 0 && c.BackpressureHigh <= 1, "BackpressureHigh must be in [0, 1], got %v", c.BackpressureHigh)
+	check(c.BackpressureLow >= 0 && (c.BackpressureHigh == 0 || c.BackpressureLow < c.BackpressureHigh),
+		"BackpressureLow %v must be in [0, BackpressureHigh %v)", c.BackpressureLow, c.BackpressureHigh)
+	check(c.ShedCPU >= 0 && c.ShedCPU <= 1, "ShedCPU must be in [0, 1], got %v", c.ShedCPU)
+	for name, rate := range map[string]iface.Rate{
+		"GlobalRateLimit": c.GlobalRateLimit,
+		"ConnRateLimit":   c.ConnRateLimit,
+		"GlobalBandwidth": c.GlobalBandwidth,
+		"ConnBandwidth":   c.ConnBandwidth,
+		"AcceptRate":      c.AcceptRate,
+	} {
+		check(rate.Rate >= 0 && rate.Burst >= 0, "%s must not be negative, got %+v", name, rate)
+	}
+	check(c.MaxProtocolVersion == 0 || c.MinProtocolVersion <= c.MaxProtocolVersion,
+		"MinProtocolVersion %d must be <= MaxProtocolVersion %d", c.MinProtocolVersion, c.MaxProtocolVersion)
+	check(!c.EnableAck || c.AckMsgID != 0, "EnableAck requires AckMsgID")
+	check(c.SessionGracePeriod >= 0, "SessionGracePeriod must be >= 0, got %d", c.SessionGracePeriod)
+	check(c.ChaosRatio >= 0 && c.ChaosRatio <= 1, "ChaosRatio must be in [0, 1], got %v", c.ChaosRatio)
+	if err := c.Chaos.Validate(); err != nil {
+		check(false, "Chaos %v", err)
+	}
+	addrs := make(map[string]bool, len(c.Listeners))
+	for i, l := range c.Listeners {
+		check(l.Addr != "", "Listeners[%d].Addr is empty", i)
+		check((l.CertFile == "") == (l.KeyFile == ""), "Listeners[%d] requires both CertFile and KeyFile", i)
+		check(l.Addr == "" || !addrs[l.Addr], "Listeners[%d].Addr %s is duplicated", i, l.Addr)
+		addrs[l.Addr] = true
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package netw
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/metrics"
+)
+
+var (
+	// ProtocolQueryKey 握手时客户端声明协议版本的URL参数名，如 /ws?proto=3
+	ProtocolQueryKey = "proto"
+	// ProtocolHeader 握手响应中回复协商后协议版本的响应头
+	ProtocolHeader = "X-Protocol-Version"
+
+	ErrProtocolVersion = errors.New("netw: unsupported protocol version")
+)
+
+// negotiateVersion 按MinProtocolVersion与MaxProtocolVersion校验客户端声明的协议版本，
+// 未声明时视为MinProtocolVersion，用于兼容不带版本号的旧客户端
+func negotiateVersion(cfg *iface.Config, r *http.Request) (uint32, error) {
+	version := cfg.MinProtocolVersion
+	if v := r.URL.Query().Get(ProtocolQueryKey); v != "" {
+		n, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return 0, ErrProtocolVersion
+		}
+		version = uint32(n)
+	}
+	if version < cfg.MinProtocolVersion || (cfg.MaxProtocolVersion > 0 && version > cfg.MaxProtocolVersion) {
+		return 0, ErrProtocolVersion
+	}
+	return version, nil
+}
+
+// 设置连接协商后的协议版本
+func (c *Connection) SetProtocolVersion(version uint32) {
+	atomic.StoreUint32(&c.protocolVersion, version)
+}
+
+// 获取连接协商后的协议版本
+func (c *Connection) GetProtocolVersion() uint32 {
+	return atomic.LoadUint32(&c.protocolVersion)
+}
+
+// versionRouter 只处理协议版本在[min, max]内的连接消息的路由，max为0时不限制上限
+type versionRouter struct {
+	min, max uint32
+	router   iface.Router
+}
+
+func (vr versionRouter) match(version uint32) bool {
+	return version >= vr.min && (vr.max == 0 || version <= vr.max)
+}
+
+// AddVersionRouter 为协议版本在[min, max]内的连接注册MsgID的处理方法，max为0时不限制上限；
+// 优先于AddRouter注册的处理方法，同一MsgID的版本区间不能重叠
+func (mh *MsgHandle) AddVersionRouter(msgID uint32, min, max uint32, router iface.Router) {
+	if max != 0 && max < min {
+		panic(fmt.Sprintf("msgID = %d invalid version range [%d, %d]", msgID, min, max))
+	}
+	checkMsgID(msgID)
+	for _, vr := range mh.versions[msgID] {
+		if (max == 0 || vr.min <= max) && (vr.max == 0 || min <= vr.max) {
+			panic(fmt.Sprintf("msgID = %d version range [%d, %d] overlaps [%d, %d]", msgID, min, max, vr.min, vr.max))
+		}
+	}
+	mh.versions[msgID] = append(mh.versions[msgID], versionRouter{min: min, max: max, router: router})
+	metrics.RegisterMsgID(msgID)
+}
+
+// findVersionRouter 获取协议版本对应的路由
+func (mh *MsgHandle) findVersionRouter(msgID uint32, version uint32) iface.Router {
+	for _, vr := range mh.versions[msgID] {
+		if vr.match(version) {
+			return vr.router
+		}
+	}
+	return nil
+}
+
+// AddVersionRouter 为协议版本在[min, max]内的连接注册路由，用于新旧客户端共存期间处理不同的协议格式
+func (s *Server) AddVersionRouter(msgID uint32, min, max uint32, router iface.Router) {
+	s.msgHandler.AddVersionRouter(msgID, min, max, router)
+}
+
+// HandleVersion 为协议版本在[min, max]内的连接注册类型化处理方法
+func (s *Server) HandleVersion(msgID uint32, min, max uint32, fn interface{}) {
+	s.msgHandler.AddVersionRouter(msgID, min, max, handlerRouter(msgID, fn))
+}
@@ -0,0 +1,387 @@
+package netw
+
+import (
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// queuedRequest 进入任务队列的请求，记录入队时间用于统计排队延迟
+type queuedRequest struct {
+	iface.Request
+	enqueueAt time.Time
+}
+
+// workerPin 连接固定到的worker与已分配尚未处理完的任务数
+type workerPin struct {
+	worker  uint32
+	pending int
+}
+
+// workerPool 弹性工作池状态
+type workerPool struct {
+	lock       sync.Mutex
+	high       []chan iface.Request // 每个worker的高优先级任务队列
+	low        []chan iface.Request // 每个worker的低优先级任务队列
+	fair       []*fairQueue         // 开启FairDispatch时每个worker的普通优先级公平队列
+	quit       []chan struct{}      // 每个worker的退出信号
+	stop       chan struct{}        // 工作池停止信号，关闭后弹性伸缩的监控goroutine退出
+	lastActive []int64              // 每个worker最后一次处理任务的时间(纳秒)
+	handled    uint64               // 已处理的任务数量
+	waitTotal  int64                // 任务排队总耗时(纳秒)
+	handleCost int64                // 任务处理总耗时(纳秒)
+	max        int                  // 弹性伸缩的最大worker数量，不超过队列数量
+	elastic    bool                 // 是否开启了弹性伸缩
+	pins       map[int64]*workerPin // 有未处理完任务的连接固定到的worker
+	pinned     []int                // 每个worker固定的连接数量
+	pinLock    sync.Mutex           // 保护pins、pinned与缩容时activeWorkers的锁
+}
+
+// maxWorkerPoolSize 工作池最大worker数量
+func maxWorkerPoolSize(cfg *iface.Config) uint32 {
+	if cfg.MaxWorkerPoolSize > cfg.WorkerPoolSize {
+		return cfg.MaxWorkerPoolSize
+	}
+	return cfg.WorkerPoolSize
+}
+
+// maxWorkerTaskLen 每个worker对应的任务队列长度
+func maxWorkerTaskLen(cfg *iface.Config) uint32 {
+	if cfg.MaxWorkerTaskLen > 0 {
+		return cfg.MaxWorkerTaskLen
+	}
+	return 1
+}
+
+// startWorkerPool 启动最小数量的worker，开启弹性伸缩时启动监控goroutine
+func (mh *MsgHandle) startWorkerPool() {
+	size := maxWorkerPoolSize(mh.conf())
+	mh.pool.stop = make(chan struct{})
+	mh.pool.quit = make([]chan struct{}, size)
+	mh.pool.lastActive = make([]int64, size)
+	mh.pool.high = make([]chan iface.Request, size)
+	mh.pool.low = make([]chan iface.Request, size)
+	mh.pool.pins = make(map[int64]*workerPin)
+	mh.pool.pinned = make([]int, size)
+	// 给全部worker对应的任务队列开辟空间，TaskQueue为普通优先级队列
+	for i := 0; i < int(size); i++ {
+		mh.TaskQueue[i] = make(chan iface.Request, maxWorkerTaskLen(mh.conf()))
+		mh.pool.high[i] = make(chan iface.Request, maxWorkerTaskLen(mh.conf()))
+		mh.pool.low[i] = make(chan iface.Request, maxWorkerTaskLen(mh.conf()))
+	}
+	// 公平调度时普通优先级任务在公平队列中排队，TaskQueue不带缓冲
+	if mh.conf().FairDispatch {
+		mh.pool.fair = make([]*fairQueue, size)
+		for i := 0; i < int(size); i++ {
+			mh.TaskQueue[i] = make(chan iface.Request)
+			mh.pool.fair[i] = newFairQueue(mh.conf)
+			go mh.pumpFair(i)
+		}
+	}
+	// 保证消息顺序时worker数量固定为最大值，ConnID与worker的对应关系不变
+	if mh.conf().OrderedDispatch {
+		for i := 0; i < int(size); i++ {
+			mh.startWorker(i)
+		}
+		return
+	}
+	// 遍历需要启动worker的数量，依此启动
+	for i := 0; i < int(mh.WorkerPoolSize); i++ {
+		mh.startWorker(i)
+	}
+	if size > mh.WorkerPoolSize && mh.WorkerPoolSize > 0 {
+		mh.pool.max = int(size)
+		mh.pool.elastic = true
+		go mh.autoScale()
+	}
+}
+
+// stopWorkerPool 停止工作池，通知全部worker处理完已分配的任务后退出，调用多次只生效一次
+func (mh *MsgHandle) stopWorkerPool() {
+	mh.pool.lock.Lock()
+	defer mh.pool.lock.Unlock()
+	if mh.pool.stop == nil || mh.poolStopped() {
+		return
+	}
+	close(mh.pool.stop)
+	for i := 0; i < int(atomic.LoadUint32(&mh.activeWorkers)); i++ {
+		close(mh.pool.quit[i])
+	}
+	for _, q := range mh.pool.fair {
+		q.close()
+	}
+}
+
+// poolStopped 工作池是否已停止，调用方需持有pool.lock
+func (mh *MsgHandle) poolStopped() bool {
+	select {
+	case <-mh.pool.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// startWorker 启动一个worker，阻塞的等待对应的任务队列是否有消息传递进来
+func (mh *MsgHandle) startWorker(workerID int) {
+	mh.pool.quit[workerID] = make(chan struct{})
+	atomic.StoreInt64(&mh.pool.lastActive[workerID], time.Now().UnixNano())
+	atomic.AddUint32(&mh.activeWorkers, 1)
+	go mh.StartOneWorker(workerID, mh.TaskQueue[workerID])
+}
+
+// StartOneWorker 启动一个Worker工作流程
+func (mh *MsgHandle) StartOneWorker(workerID int, taskQueue chan iface.Request) {
+	zap.S().Debug("Worker ID = ", workerID, " is started.")
+	// worker异常退出时重新启动，保证工作池数量不变
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Errorw("worker panic, restart", "workerID", workerID, "err", err, "stack", string(debug.Stack()))
+			go mh.StartOneWorker(workerID, taskQueue)
+		}
+	}()
+	quit := mh.quitChan(workerID)
+	high, low := mh.pool.high[workerID], mh.pool.low[workerID]
+	// 不断的等待队列中的消息，有消息则按优先级取出队列的Request，并执行绑定的业务方法
+	for {
+		request, ok := nextTask(high, taskQueue, low, quit)
+		if !ok {
+			break
+		}
+		mh.doTask(workerID, request)
+	}
+	// 缩容退出前处理完已分配到该worker的任务
+	for {
+		timeout := make(chan struct{})
+		timer := time.AfterFunc(100*time.Millisecond, func() { close(timeout) })
+		request, ok := nextTask(high, taskQueue, low, timeout)
+		timer.Stop()
+		if !ok {
+			zap.S().Debug("Worker ID = ", workerID, " is stopped.")
+			return
+		}
+		mh.doTask(workerID, request)
+	}
+}
+
+// nextTask 按高、普通、低的优先级顺序取出下一个任务，done关闭时返回false
+func nextTask(high, normal, low chan iface.Request, done <-chan struct{}) (iface.Request, bool) {
+	select {
+	case request := <-high:
+		return request, true
+	default:
+	}
+	select {
+	case request := <-high:
+		return request, true
+	case request := <-normal:
+		return request, true
+	default:
+	}
+	select {
+	case request := <-high:
+		return request, true
+	case request := <-normal:
+		return request, true
+	case request := <-low:
+		return request, true
+	case <-done:
+		return nil, false
+	}
+}
+
+// quitChan 获取worker的退出信号
+func (mh *MsgHandle) quitChan(workerID int) chan struct{} {
+	mh.pool.lock.Lock()
+	defer mh.pool.lock.Unlock()
+	if mh.pool.quit == nil {
+		return nil
+	}
+	return mh.pool.quit[workerID]
+}
+
+// pin 分配处理连接任务的worker：连接还有未处理完的任务时沿用之前的worker，
+// 弹性伸缩改变worker数量后同一连接的任务也不会同时在两个worker中处理
+func (mh *MsgHandle) pin(connID int64) uint32 {
+	mh.pool.pinLock.Lock()
+	defer mh.pool.pinLock.Unlock()
+	p, ok := mh.pool.pins[connID]
+	if !ok {
+		p = &workerPin{worker: workerIndex(connID, atomic.LoadUint32(&mh.activeWorkers))}
+		mh.pool.pins[connID] = p
+		mh.pool.pinned[p.worker]++
+	}
+	p.pending++
+	return p.worker
+}
+
+// unpin 连接的一个任务处理完成，没有未处理完的任务时解除固定
+func (mh *MsgHandle) unpin(connID int64) {
+	mh.pool.pinLock.Lock()
+	defer mh.pool.pinLock.Unlock()
+	p, ok := mh.pool.pins[connID]
+	if !ok {
+		return
+	}
+	if p.pending--; p.pending <= 0 {
+		delete(mh.pool.pins, connID)
+		mh.pool.pinned[p.worker]--
+	}
+}
+
+// workerOf 连接当前对应的worker
+func (mh *MsgHandle) workerOf(connID int64, workers uint32) uint32 {
+	mh.pool.pinLock.Lock()
+	defer mh.pool.pinLock.Unlock()
+	if p, ok := mh.pool.pins[connID]; ok {
+		return p.worker
+	}
+	return workerIndex(connID, workers)
+}
+
+// retireWorker 减少一个worker，最后一个worker仍有固定的连接时返回false，
+// 减少后新任务不会再分配到该worker，其队列不会再有任务写入
+func (mh *MsgHandle) retireWorker(last int) bool {
+	mh.pool.pinLock.Lock()
+	defer mh.pool.pinLock.Unlock()
+	if mh.pool.pinned[last] > 0 {
+		return false
+	}
+	atomic.AddUint32(&mh.activeWorkers, ^uint32(0))
+	return true
+}
+
+// doTask 执行任务并统计排队与处理耗时
+func (mh *MsgHandle) doTask(workerID int, request iface.Request) {
+	start := time.Now()
+	if qr, ok := request.(*queuedRequest); ok {
+		atomic.AddInt64(&mh.pool.waitTotal, int64(start.Sub(qr.enqueueAt)))
+		request = qr.Request
+	}
+	// 处理完成后请求可能已被回收，提前取出ConnID
+	connID := request.GetConnection().GetConnID()
+	defer mh.unpin(connID)
+	mh.DoMsgHandler(request)
+	end := time.Now()
+	atomic.AddInt64(&mh.pool.handleCost, int64(end.Sub(start)))
+	atomic.AddUint64(&mh.pool.handled, 1)
+	atomic.StoreInt64(&mh.pool.lastActive[workerID], end.UnixNano())
+}
+
+// SetWorkerBounds 运行时调整弹性工作池的最小与最大worker数量，最大不超过启动时的worker上限；
+// 未开启弹性伸缩时worker数量固定，返回false
+func (mh *MsgHandle) SetWorkerBounds(min, max uint32) bool {
+	mh.pool.lock.Lock()
+	defer mh.pool.lock.Unlock()
+	if !mh.pool.elastic || mh.poolStopped() {
+		return false
+	}
+	if max == 0 || int(max) > len(mh.TaskQueue) {
+		max = uint32(len(mh.TaskQueue))
+	}
+	if min == 0 {
+		min = 1
+	}
+	if min > max {
+		min = max
+	}
+	atomic.StoreUint32(&mh.WorkerPoolSize, min)
+	mh.pool.max = int(max)
+	// 最小数量增大时立即补足worker，减小时由autoScale按空闲时间缩容
+	for active := int(atomic.LoadUint32(&mh.activeWorkers)); active < int(min); active++ {
+		mh.startWorker(active)
+	}
+	zap.S().Info("worker pool bounds min = ", min, " max = ", max)
+	return true
+}
+
+// autoScale 按队列长度扩容，按空闲时间缩容，阈值每次检测时重新读取配置；
+// 已固定到worker的连接不随扩容迁移，新增的worker只分配给之后没有排队任务的连接
+func (mh *MsgHandle) autoScale() {
+	interval := time.Second
+	if mh.conf().WorkerScaleInterval > 0 {
+		interval = time.Millisecond * time.Duration(mh.conf().WorkerScaleInterval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-mh.pool.stop:
+			return
+		}
+		threshold := mh.conf().WorkerScaleThreshold
+		if threshold <= 0 {
+			threshold = int(maxWorkerTaskLen(mh.conf()))
+		}
+		idleTimeout := time.Minute
+		if mh.conf().WorkerIdleTimeout > 0 {
+			idleTimeout = time.Second * time.Duration(mh.conf().WorkerIdleTimeout)
+		}
+		min := int(atomic.LoadUint32(&mh.WorkerPoolSize))
+		mh.pool.lock.Lock()
+		// 停止后worker的退出信号已关闭，不再伸缩
+		if mh.poolStopped() {
+			mh.pool.lock.Unlock()
+			return
+		}
+		active := int(atomic.LoadUint32(&mh.activeWorkers))
+		deepest := 0
+		for i := 0; i < active; i++ {
+			if depth := mh.queueDepth(i); depth > deepest {
+				deepest = depth
+			}
+		}
+		last := active - 1
+		idle := time.Since(time.Unix(0, atomic.LoadInt64(&mh.pool.lastActive[last])))
+		switch {
+		case deepest >= threshold && active < mh.pool.max:
+			// 任一worker的队列长度超过阈值，扩容一个worker
+			mh.startWorker(active)
+			zap.S().Info("worker pool scale up, workers = ", active+1)
+		case active > mh.pool.max && mh.queueDepth(last) == 0,
+			active > min && mh.queueDepth(last) == 0 && idle > idleTimeout:
+			// 超过最大数量或最后一个worker空闲超时，缩容；仍有连接固定在该worker时等待下次检测
+			if !mh.retireWorker(last) {
+				break
+			}
+			close(mh.pool.quit[last])
+			zap.S().Info("worker pool scale down, workers = ", active-1)
+		}
+		mh.pool.lock.Unlock()
+	}
+}
+
+// queueDepth worker全部优先级队列中的任务数量
+func (mh *MsgHandle) queueDepth(workerID int) int {
+	depth := len(mh.pool.high[workerID]) + len(mh.TaskQueue[workerID]) + len(mh.pool.low[workerID])
+	if mh.pool.fair != nil {
+		depth += mh.pool.fair[workerID].Len()
+	}
+	return depth
+}
+
+// Stats 获取工作池统计信息
+func (mh *MsgHandle) Stats() iface.WorkerPoolStats {
+	active := int(atomic.LoadUint32(&mh.activeWorkers))
+	stats := iface.WorkerPoolStats{
+		Workers:    active,
+		MinWorkers: int(atomic.LoadUint32(&mh.WorkerPoolSize)),
+		MaxWorkers: len(mh.TaskQueue),
+		QueueDepth: make([]int, 0, active),
+		Handled:    atomic.LoadUint64(&mh.pool.handled),
+	}
+	for i := 0; i < active; i++ {
+		stats.QueueDepth = append(stats.QueueDepth, mh.queueDepth(i))
+	}
+	if stats.Handled > 0 {
+		stats.AvgWait = time.Duration(atomic.LoadInt64(&mh.pool.waitTotal) / int64(stats.Handled))
+		stats.AvgHandle = time.Duration(atomic.LoadInt64(&mh.pool.handleCost) / int64(stats.Handled))
+	}
+	return stats
+}
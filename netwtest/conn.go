@@ -0,0 +1,457 @@
+package netwtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/codec"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+	"github.com/xiaomingping/game/timerwheel"
+
+	"go.uber.org/zap"
+)
+
+var ErrTimeout = errors.New("netwtest: timeout waiting for outbound msg")
+
+// Outbound 伪造连接记录的一条出站消息
+type Outbound struct {
+	MsgID       uint32
+	ReqID       uint64
+	Data        []byte
+	Buffered    bool  // 是否通过SendBuffMsg发送
+	MessageType int   // SendFrame指定的帧类型，其余为0
+	Channel     uint8 // SendChannelMsg指定的逻辑通道，其余为0
+}
+
+// Conn 实现iface.Connection的伪造连接，出站消息记录在内存中而不写入socket，用于处理方法的单元测试
+type Conn struct {
+	ID       int64
+	Server   iface.Server // GetServer返回值，可以为nil
+	Addr     net.Addr
+	Tag      string
+	NS       string
+	OnCall   func(msgID uint32, data []byte) ([]byte, error) // Call的应答，为nil时Call返回错误
+	RTT      time.Duration                                   // Latency的返回值，用于测试延迟补偿逻辑
+	outbound chan Outbound
+	sent     []Outbound
+
+	codec       iface.Codec
+	cipher      iface.Cipher
+	chaos       iface.Chaos
+	uid         string
+	version     uint32
+	messageType int
+	ping        bool
+	heartbeat   time.Time
+	start       time.Time
+	errors      uint64
+	property    map[string]interface{}
+	ctx         context.Context
+	cancel      context.CancelFunc
+	closed      bool
+	closeCode   int
+	closeText   string
+	lock        sync.RWMutex
+	goroutines  sync.WaitGroup
+}
+
+var connIDGen int64
+
+var _ iface.Connection = (*Conn)(nil)
+
+// NewConn 创建伪造连接，s为nil时GetServer返回nil，依赖Server的处理方法需传入netw.NewServer创建的Server
+func NewConn(s iface.Server) *Conn {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Conn{
+		ID:       atomic.AddInt64(&connIDGen, 1),
+		Server:   s,
+		Addr:     &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 10000},
+		outbound: make(chan Outbound, 1024),
+		codec:    codec.NewProtoCodec(),
+		start:    time.Now(),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// record 记录出站消息，Server不为nil时先执行其出站拦截器
+func (c *Conn) record(out Outbound) error {
+	if c.Server != nil {
+		data, err := c.Server.InterceptOutbound(c, out.MsgID, out.Data)
+		if err == netw.ErrOutboundDropped {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		out.Data = data
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return errors.New("connection closed when send msg")
+	}
+	c.sent = append(c.sent, out)
+	select {
+	case c.outbound <- out:
+	default:
+	}
+	return nil
+}
+
+// Sent 已发送的全部出站消息
+func (c *Conn) Sent() []Outbound {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return append([]Outbound(nil), c.sent...)
+}
+
+// Reset 清空已记录的出站消息
+func (c *Conn) Reset() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.sent = nil
+	for len(c.outbound) > 0 {
+		<-c.outbound
+	}
+}
+
+// Next 等待下一条出站消息，超过timeout返回ErrTimeout
+func (c *Conn) Next(timeout time.Duration) (Outbound, error) {
+	select {
+	case out := <-c.outbound:
+		return out, nil
+	case <-time.After(timeout):
+		return Outbound{}, ErrTimeout
+	}
+}
+
+// Expect 断言下一条出站消息(1秒内)的MsgID为msgID
+func (c *Conn) Expect(t testing.TB, msgID uint32) Outbound {
+	t.Helper()
+	out, err := c.Next(time.Second)
+	if err != nil {
+		t.Fatalf("expect msgID = %d: %v", msgID, err)
+	}
+	if out.MsgID != msgID {
+		t.Fatalf("expect msgID = %d, got %d", msgID, out.MsgID)
+	}
+	return out
+}
+
+// ExpectObj 断言下一条出站消息的MsgID为msgID，并使用连接的编解码器解码到v
+func (c *Conn) ExpectObj(t testing.TB, msgID uint32, v interface{}) {
+	t.Helper()
+	out := c.Expect(t, msgID)
+	if err := c.Codec().Unmarshal(out.Data, v); err != nil {
+		t.Fatalf("unmarshal msgID = %d: %v", msgID, err)
+	}
+}
+
+// ExpectError 断言下一条出站消息为ErrorMsgID的错误响应，返回解码后的错误
+func (c *Conn) ExpectError(t testing.TB, errorMsgID uint32) netw.ErrorFrame {
+	t.Helper()
+	return netw.DecodeErrorFrame(c.Expect(t, errorMsgID).Data)
+}
+
+// ExpectNone 断言wait时间内没有新的出站消息
+func (c *Conn) ExpectNone(t testing.TB, wait time.Duration) {
+	t.Helper()
+	if out, err := c.Next(wait); err == nil {
+		t.Fatalf("unexpected outbound msgID = %d", out.MsgID)
+	}
+}
+
+// 以下为iface.Connection的实现，Start与心跳检测为空操作
+
+func (c *Conn) Start() {}
+
+func (c *Conn) Stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.closed {
+		c.closed = true
+		c.cancel()
+	}
+}
+
+// IsClosed 是否已被Stop
+func (c *Conn) IsClosed() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.closed
+}
+
+func (c *Conn) StopWithMsg(msgID uint32, data []byte) {
+	_ = c.SendMsg(msgID, data)
+	c.Stop()
+}
+
+// Close 记录关闭码与原因后停止连接，可通过Stats获取
+func (c *Conn) Close(code int, reason string) error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return netw.ErrConnClosed
+	}
+	c.closeCode, c.closeText = code, reason
+	c.lock.Unlock()
+	c.Stop()
+	return nil
+}
+
+func (c *Conn) Context() context.Context { return c.ctx }
+
+func (c *Conn) Go(fn func(ctx context.Context)) {
+	c.goroutines.Add(1)
+	go func() {
+		defer c.goroutines.Done()
+		fn(c.ctx)
+	}()
+}
+
+// Wait 等待Go启动的goroutine全部退出
+func (c *Conn) Wait() {
+	c.goroutines.Wait()
+}
+
+func (c *Conn) GetConnection() *websocket.Conn { return nil }
+
+func (c *Conn) GetConnID() int64 { return c.ID }
+
+func (c *Conn) Codec() iface.Codec {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.codec
+}
+
+func (c *Conn) SetCodec(codec iface.Codec) {
+	c.lock.Lock()
+	c.codec = codec
+	c.lock.Unlock()
+}
+
+func (c *Conn) RemoteAddr() net.Addr { return c.Addr }
+
+func (c *Conn) SendMsg(msgID uint32, data []byte) error {
+	return c.record(Outbound{MsgID: msgID, Data: data})
+}
+
+func (c *Conn) SendObj(msgID uint32, v interface{}) error {
+	data, err := c.Codec().Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.SendMsg(msgID, data)
+}
+
+func (c *Conn) SendBuffMsg(msgID uint32, data []byte) error {
+	return c.record(Outbound{MsgID: msgID, Data: data, Buffered: true})
+}
+
+func (c *Conn) GetDropCount() uint64 { return 0 }
+
+func (c *Conn) Ack(seq uint64) {}
+
+func (c *Conn) GetUnacked() []iface.OutboundMsg { return nil }
+
+func (c *Conn) SetPing() {
+	c.lock.Lock()
+	c.ping, c.heartbeat = true, time.Now()
+	c.lock.Unlock()
+}
+
+func (c *Conn) GetPing() bool {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.ping
+}
+
+func (c *Conn) RemovePing() {
+	c.lock.Lock()
+	c.ping = false
+	c.lock.Unlock()
+}
+
+func (c *Conn) IsHeartbeatTimeout() {}
+
+func (c *Conn) GetHeartbeatTime() time.Time {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.heartbeat
+}
+
+func (c *Conn) GetStartTime() time.Time { return c.start }
+
+func (c *Conn) Stats() iface.ConnStats {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return iface.ConnStats{
+		MsgsOut:   uint64(len(c.sent)),
+		CreatedAt: c.start,
+		Errors:    atomic.LoadUint64(&c.errors),
+		Latency:   c.RTT,
+		CloseCode: c.closeCode,
+		CloseText: c.closeText,
+	}
+}
+
+func (c *Conn) Latency() time.Duration { return c.RTT }
+
+func (c *Conn) AddError() { atomic.AddUint64(&c.errors, 1) }
+
+func (c *Conn) SendReqMsg(reqID uint64, msgID uint32, data []byte) error {
+	return c.record(Outbound{MsgID: msgID, ReqID: reqID, Data: data})
+}
+
+func (c *Conn) SendChannelMsg(channel uint8, reqID uint64, msgID uint32, data []byte) error {
+	return c.record(Outbound{MsgID: msgID, ReqID: reqID, Data: data, Channel: channel})
+}
+
+// Call 记录请求后以OnCall的返回值作为客户端响应
+func (c *Conn) Call(ctx context.Context, msgID uint32, req, resp interface{}) error {
+	data, err := c.Codec().Marshal(req)
+	if err != nil {
+		return err
+	}
+	if err := c.record(Outbound{MsgID: msgID, Data: data}); err != nil {
+		return err
+	}
+	if c.OnCall == nil {
+		return errors.New("netwtest: OnCall not set")
+	}
+	reply, err := c.OnCall(msgID, data)
+	if err != nil {
+		return err
+	}
+	if resp == nil {
+		return nil
+	}
+	return c.Codec().Unmarshal(reply, resp)
+}
+
+// timers Server为nil时SendMsgAfter使用的时间轮
+var timers = timerwheel.New(10*time.Millisecond, 256)
+
+func (c *Conn) SendMsgAfter(d time.Duration, msgID uint32, data []byte) timerwheel.TimerID {
+	tw := timers
+	if c.Server != nil {
+		tw = c.Server.TimerWheel()
+	}
+	return tw.AddTimer(d, func() {
+		_ = c.SendMsg(msgID, data)
+	})
+}
+
+func (c *Conn) GetMessageType() int {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if c.messageType == 0 {
+		return websocket.BinaryMessage
+	}
+	return c.messageType
+}
+
+func (c *Conn) SetMessageType(messageType int) {
+	c.lock.Lock()
+	c.messageType = messageType
+	c.lock.Unlock()
+}
+
+func (c *Conn) SendFrame(messageType int, msgID uint32, data []byte) error {
+	return c.record(Outbound{MsgID: msgID, Data: data, MessageType: messageType})
+}
+
+func (c *Conn) GetServer() iface.Server { return c.Server }
+
+func (c *Conn) GetListenerTag() string { return c.Tag }
+
+func (c *Conn) GetNamespace() string { return c.NS }
+
+func (c *Conn) SetProtocolVersion(version uint32) {
+	c.lock.Lock()
+	c.version = version
+	c.lock.Unlock()
+}
+
+func (c *Conn) GetProtocolVersion() uint32 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.version
+}
+
+// SetAuthenticated 设置鉴权状态，不经过Server的重复登录处理
+func (c *Conn) SetAuthenticated(uid string) error {
+	c.lock.Lock()
+	c.uid = uid
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Conn) IsAuthenticated() bool { return c.GetUID() != "" }
+
+func (c *Conn) GetUID() string {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.uid
+}
+
+func (c *Conn) Logger() *zap.SugaredLogger {
+	return zap.S().With("connID", c.ID)
+}
+
+func (c *Conn) SetCipher(cipher iface.Cipher) {
+	c.lock.Lock()
+	c.cipher = cipher
+	c.lock.Unlock()
+}
+
+func (c *Conn) GetCipher() iface.Cipher {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cipher
+}
+
+// SetChaos 只记录设置的值，内存连接不注入故障
+func (c *Conn) SetChaos(chaos iface.Chaos) {
+	c.lock.Lock()
+	c.chaos = chaos
+	c.lock.Unlock()
+}
+
+func (c *Conn) GetChaos() iface.Chaos {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.chaos
+}
+
+func (c *Conn) SetProperty(key string, value interface{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.property == nil {
+		c.property = make(map[string]interface{})
+	}
+	c.property[key] = value
+}
+
+func (c *Conn) GetProperty(key string) (interface{}, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	if value, ok := c.property[key]; ok {
+		return value, nil
+	}
+	return nil, errors.New("no property found")
+}
+
+func (c *Conn) RemoveProperty(key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.property, key)
+}
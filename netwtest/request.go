@@ -0,0 +1,39 @@
+package netwtest
+
+import (
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+)
+
+// NewRequest 创建conn上msgID与data的请求
+func NewRequest(conn iface.Connection, msgID uint32, data []byte) iface.Request {
+	return netw.NewRequest(conn, netw.NewMsgPackage(msgID, data))
+}
+
+// NewReqRequest 创建带客户端请求ID的请求，回复时带回reqID
+func NewReqRequest(conn iface.Connection, reqID uint64, msgID uint32, data []byte) iface.Request {
+	msg := netw.NewMsgPackage(msgID, data)
+	msg.SetReqID(reqID)
+	return netw.NewRequest(conn, msg)
+}
+
+// NewObjRequest 使用连接的编解码器序列化v后创建请求
+func NewObjRequest(conn iface.Connection, msgID uint32, v interface{}) (iface.Request, error) {
+	data, err := conn.Codec().Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return NewRequest(conn, msgID, data), nil
+}
+
+// Handle 依次调用路由的PreHandle、Handle与PostHandle，不经过中间件
+func Handle(router iface.Router, request iface.Request) {
+	router.PreHandle(request)
+	router.Handle(request)
+	router.PostHandle(request)
+}
+
+// Dispatch 经由Server的中间件与路由同步处理一条消息，与读goroutine投递的处理过程一致
+func Dispatch(s iface.Server, conn iface.Connection, msgID uint32, data []byte) {
+	s.GetMsgHandler().DoMsgHandler(NewRequest(conn, msgID, data))
+}
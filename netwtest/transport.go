@@ -0,0 +1,203 @@
+package netwtest
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/codec"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+)
+
+var ErrListenerClosed = errors.New("netwtest: listener closed")
+
+// pipeListener 以net.Pipe建立连接的内存监听
+type pipeListener struct {
+	conns chan net.Conn
+	quit  chan struct{}
+	once  sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), quit: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.quit:
+		return nil, ErrListenerClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.once.Do(func() { close(l.quit) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial 建立一对内存连接，服务端一侧交给Accept
+func (l *pipeListener) dial(ctx context.Context) (net.Conn, error) {
+	server, client := net.Pipe()
+	select {
+	case l.conns <- server:
+		return client, nil
+	case <-l.quit:
+		return nil, ErrListenerClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// Transport 内存传输，HTTP服务与WebSocket客户端之间通过net.Pipe连接，不占用端口
+type Transport struct {
+	listener *pipeListener
+	server   *http.Server
+}
+
+// NewTransport 在内存传输上启动handler
+func NewTransport(handler http.Handler) *Transport {
+	t := &Transport{listener: newPipeListener(), server: &http.Server{Handler: handler}}
+	go func() {
+		_ = t.server.Serve(t.listener)
+	}()
+	return t
+}
+
+// NewServerTransport 在内存传输上启动Server，任意路径的请求都交给Server.Start
+func NewServerTransport(s iface.Server) *Transport {
+	g := gin.New()
+	g.NoRoute(s.Start)
+	return NewTransport(g)
+}
+
+// Close 关闭内存传输
+func (t *Transport) Close() error {
+	return t.server.Close()
+}
+
+// Dial 建立WebSocket连接，target为请求路径与参数，如 /ws?token=xxx
+func (t *Transport) Dial(target string, header http.Header) (*Client, error) {
+	dialer := websocket.Dialer{
+		NetDialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return t.listener.dial(ctx)
+		},
+		HandshakeTimeout: 5 * time.Second,
+	}
+	ws, resp, err := dialer.Dial("ws://pipe"+target, header)
+	if resp != nil && resp.Body != nil {
+		_ = resp.Body.Close()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		Conn:        ws,
+		Packet:      netw.NewDataPack(),
+		Codec:       codec.NewProtoCodec(),
+		MessageType: websocket.BinaryMessage,
+	}, nil
+}
+
+// Client 内存传输上的测试客户端，按Packet封包发送并拆包接收
+type Client struct {
+	Conn        *websocket.Conn
+	Packet      iface.Packet
+	Codec       iface.Codec
+	MessageType int
+}
+
+// Send 发送消息
+func (c *Client) Send(msgID uint32, data []byte) error {
+	return c.SendReq(0, msgID, data)
+}
+
+// SendReq 发送带请求ID的消息
+func (c *Client) SendReq(reqID uint64, msgID uint32, data []byte) error {
+	return c.SendChannel(0, reqID, msgID, data)
+}
+
+// SendChannel 以逻辑通道发送带请求ID的消息
+func (c *Client) SendChannel(channel uint8, reqID uint64, msgID uint32, data []byte) error {
+	msg := netw.NewMsgPackage(msgID, data)
+	msg.SetReqID(reqID)
+	msg.SetChannel(channel)
+	packed, err := c.Packet.Pack(msg)
+	if err != nil {
+		return err
+	}
+	return c.Conn.WriteMessage(c.MessageType, packed)
+}
+
+// SendObj 使用Codec序列化后发送
+func (c *Client) SendObj(msgID uint32, v interface{}) error {
+	data, err := c.Codec.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return c.Send(msgID, data)
+}
+
+// Recv 接收一条消息，超过timeout返回错误；写合并帧不拆分
+func (c *Client) Recv(timeout time.Duration) (iface.Message, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	_, data, err := c.Conn.ReadMessage()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := c.Packet.Unpack(data)
+	if err != nil {
+		return nil, err
+	}
+	// 拆包结果可能引用data，复制后返回
+	out := netw.NewMsgPackage(msg.GetMsgID(), append([]byte(nil), msg.GetData()...))
+	out.SetSeq(msg.GetSeq())
+	out.SetReqID(msg.GetReqID())
+	out.SetChannel(msg.GetChannel())
+	return out, nil
+}
+
+// Expect 断言1秒内收到的下一条消息的MsgID为msgID
+func (c *Client) Expect(t testing.TB, msgID uint32) iface.Message {
+	t.Helper()
+	msg, err := c.Recv(time.Second)
+	if err != nil {
+		t.Fatalf("expect msgID = %d: %v", msgID, err)
+	}
+	if msg.GetMsgID() != msgID {
+		t.Fatalf("expect msgID = %d, got %d", msgID, msg.GetMsgID())
+	}
+	return msg
+}
+
+// ExpectObj 断言下一条消息的MsgID为msgID，并使用Codec解码到v
+func (c *Client) ExpectObj(t testing.TB, msgID uint32, v interface{}) {
+	t.Helper()
+	msg := c.Expect(t, msgID)
+	if err := c.Codec.Unmarshal(msg.GetData(), v); err != nil {
+		t.Fatalf("unmarshal msgID = %d: %v", msgID, err)
+	}
+}
+
+// Close 关闭客户端连接
+func (c *Client) Close() error {
+	return c.Conn.Close()
+}
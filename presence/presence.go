@@ -0,0 +1,251 @@
+package presence
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// Subject 集群内同步在线状态变化的消息总线主题
+	Subject = "game:presence"
+
+	ErrBadEvent = errors.New("presence: bad event")
+)
+
+// Status 玩家在线状态
+type Status uint8
+
+const (
+	StatusOffline Status = iota // 离线
+	StatusOnline                // 在线
+	StatusAway                  // 离开，连接仍在线
+)
+
+// Service 玩家在线状态服务，状态变化时向订阅者推送 | 状态 1B | uid |；
+// 设置消息总线时各节点上的状态经总线同步到集群内全部节点，uid的状态取其在各节点上的最高状态，
+// 在任一节点在线即为在线，由各节点通知本节点上的订阅者
+type Service struct {
+	server iface.Server
+	bus    iface.MessageBus
+	nodeID string
+	msgID  uint32
+	// uid -> 节点ID -> 在该节点上的状态
+	states map[string]map[string]Status
+	// 被订阅uid -> 订阅者uid
+	watchers map[string]map[string]struct{}
+	// 订阅者uid -> 被订阅uid，订阅者离线时清理其订阅
+	watching map[string]map[string]struct{}
+	lock     sync.RWMutex
+}
+
+// NewService 创建在线状态服务并挂载连接生命周期Hook函数，msgID为推送状态变化的MsgID；
+// nodeID在集群内需唯一且不超过255字节，bus为nil时只在当前节点内生效
+func NewService(s iface.Server, bus iface.MessageBus, nodeID string, msgID uint32) (*Service, error) {
+	p := &Service{
+		server:   s,
+		bus:      bus,
+		nodeID:   nodeID,
+		msgID:    msgID,
+		states:   make(map[string]map[string]Status),
+		watchers: make(map[string]map[string]struct{}),
+		watching: make(map[string]map[string]struct{}),
+	}
+	if bus != nil {
+		if err := bus.Subscribe(Subject, p.receive); err != nil {
+			return nil, err
+		}
+	}
+	s.AddOnConnStart(func(conn iface.Connection) error {
+		// 握手阶段已鉴权的连接
+		if conn.IsAuthenticated() {
+			p.Online(conn)
+		}
+		return nil
+	})
+	s.AddOnConnStop(p.connStop)
+	return p, nil
+}
+
+// Online 标记连接绑定的uid在线，消息鉴权的连接需在鉴权成功后调用
+func (p *Service) Online(conn iface.Connection) {
+	if uid := conn.GetUID(); uid != "" {
+		p.SetStatus(uid, StatusOnline)
+	}
+}
+
+// SetStatus 设置uid在本节点上的在线状态，uid的状态因此变化时通知订阅者
+func (p *Service) SetStatus(uid string, status Status) {
+	if p.bus == nil {
+		p.apply(p.nodeID, uid, status)
+		return
+	}
+	if err := p.bus.Publish(Subject, encodeEvent(p.nodeID, uid, status)); err != nil {
+		zap.S().Warn("presence publish error ", err)
+		// 总线不可用时至少通知本节点的订阅者
+		p.apply(p.nodeID, uid, status)
+	}
+}
+
+// Status 获取uid的在线状态，即uid在各节点上的最高状态
+func (p *Service) Status(uid string) Status {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.status(uid)
+}
+
+// status uid在各节点上的最高状态，在线高于离开，调用方需持有锁
+func (p *Service) status(uid string) Status {
+	var status Status
+	for _, s := range p.states[uid] {
+		if s == StatusOnline {
+			return s
+		}
+		if s > status {
+			status = s
+		}
+	}
+	return status
+}
+
+// Subscribe watcherUID订阅uid的状态变化，订阅者全部连接断开后订阅自动取消
+func (p *Service) Subscribe(uid, watcherUID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	add(p.watchers, uid, watcherUID)
+	add(p.watching, watcherUID, uid)
+}
+
+// Unsubscribe 取消watcherUID对uid的订阅
+func (p *Service) Unsubscribe(uid, watcherUID string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	remove(p.watchers, uid, watcherUID)
+	remove(p.watching, watcherUID, uid)
+}
+
+// Watchers 订阅了uid的本节点订阅者
+func (p *Service) Watchers(uid string) []string {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	watchers := make([]string, 0, len(p.watchers[uid]))
+	for watcher := range p.watchers[uid] {
+		watchers = append(watchers, watcher)
+	}
+	return watchers
+}
+
+// connStop uid在本节点上的最后一个连接断开时标记其在本节点离线并清理其订阅，在其它节点上的状态不变
+func (p *Service) connStop(conn iface.Connection) {
+	uid := conn.GetUID()
+	if uid == "" {
+		return
+	}
+	for _, other := range p.server.GetConnMgr().GetByUID(uid) {
+		if other.GetConnID() != conn.GetConnID() {
+			return
+		}
+	}
+	p.lock.Lock()
+	for target := range p.watching[uid] {
+		remove(p.watchers, target, uid)
+	}
+	delete(p.watching, uid)
+	p.lock.Unlock()
+	p.SetStatus(uid, StatusOffline)
+}
+
+// receive 处理总线同步的状态变化
+func (p *Service) receive(data []byte) {
+	nodeID, uid, status, err := decodeEvent(data)
+	if err != nil {
+		zap.S().Warn("presence bad event ", err)
+		return
+	}
+	p.apply(nodeID, uid, status)
+}
+
+// apply 更新uid在nodeID上的状态，uid的状态因此变化时通知本节点上的订阅者
+func (p *Service) apply(nodeID, uid string, status Status) {
+	p.lock.Lock()
+	prev := p.status(uid)
+	nodes := p.states[uid]
+	if status == StatusOffline {
+		delete(nodes, nodeID)
+		if len(nodes) == 0 {
+			delete(p.states, uid)
+		}
+	} else {
+		if nodes == nil {
+			nodes = make(map[string]Status)
+			p.states[uid] = nodes
+		}
+		nodes[nodeID] = status
+	}
+	status = p.status(uid)
+	if status == prev {
+		p.lock.Unlock()
+		return
+	}
+	watchers := make([]string, 0, len(p.watchers[uid]))
+	for watcher := range p.watchers[uid] {
+		watchers = append(watchers, watcher)
+	}
+	p.lock.Unlock()
+	if len(watchers) == 0 {
+		return
+	}
+	payload := encode(uid, status)
+	connMgr := p.server.GetConnMgr()
+	for _, watcher := range watchers {
+		for _, conn := range connMgr.GetByUID(watcher) {
+			_ = conn.SendBuffMsg(p.msgID, payload)
+		}
+	}
+}
+
+func encode(uid string, status Status) []byte {
+	data := make([]byte, 1+len(uid))
+	data[0] = byte(status)
+	copy(data[1:], uid)
+	return data
+}
+
+// encodeEvent 总线同步的状态变化 | 状态 1B | 节点ID长度 1B | 节点ID | uid |
+func encodeEvent(nodeID, uid string, status Status) []byte {
+	data := make([]byte, 2+len(nodeID)+len(uid))
+	data[0] = byte(status)
+	data[1] = byte(len(nodeID))
+	copy(data[2:], nodeID)
+	copy(data[2+len(nodeID):], uid)
+	return data
+}
+
+func decodeEvent(data []byte) (string, string, Status, error) {
+	if len(data) < 2 || Status(data[0]) > StatusAway || len(data) < 2+int(data[1]) {
+		return "", "", 0, ErrBadEvent
+	}
+	n := 2 + int(data[1])
+	return string(data[2:n]), string(data[n:]), Status(data[0]), nil
+}
+
+func add(m map[string]map[string]struct{}, key, value string) {
+	set := m[key]
+	if set == nil {
+		set = make(map[string]struct{})
+		m[key] = set
+	}
+	set[value] = struct{}{}
+}
+
+func remove(m map[string]map[string]struct{}, key, value string) {
+	if set := m[key]; set != nil {
+		delete(set, value)
+		if len(set) == 0 {
+			delete(m, key)
+		}
+	}
+}
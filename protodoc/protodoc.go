@@ -0,0 +1,140 @@
+package protodoc
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/xiaomingping/game/iface"
+)
+
+// WriteJSON 以JSON写出协议描述，可直接提交到客户端仓库用于生成协议绑定
+func WriteJSON(w io.Writer, p iface.Protocol) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(p)
+}
+
+// WriteProto 以.proto写出MsgID枚举，枚举值的注释为说明与请求、响应的消息类型，
+// 并import消息类型所在的.proto文件，客户端可与消息定义一起用protoc生成代码；pkg为proto包名
+func WriteProto(w io.Writer, p iface.Protocol, pkg string) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "// Code generated by protodoc. DO NOT EDIT.")
+	fmt.Fprintln(bw)
+	fmt.Fprintln(bw, `syntax = "proto3";`)
+	fmt.Fprintln(bw)
+	if pkg != "" {
+		fmt.Fprintf(bw, "package %s;\n\n", pkg)
+	}
+	if imports := protoFiles(p); len(imports) > 0 {
+		for _, file := range imports {
+			fmt.Fprintf(bw, "import %q;\n", file)
+		}
+		fmt.Fprintln(bw)
+	}
+	if p.MinVersion != 0 || p.MaxVersion != 0 {
+		fmt.Fprintf(bw, "// protocol version [%d, %d]\n", p.MinVersion, p.MaxVersion)
+	}
+	for _, r := range p.Ranges {
+		fmt.Fprintf(bw, "// range [%d, %d] %s\n", r.Start, r.End, r.Name)
+	}
+	fmt.Fprintln(bw, "enum MsgID {")
+	msgs := uniqueMsgs(p.Messages)
+	if len(msgs) == 0 || msgs[0].MsgID != 0 {
+		fmt.Fprintln(bw, "  MSG_ID_UNSPECIFIED = 0;")
+	}
+	names := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		name := EnumName(msg.Name)
+		if names[name] {
+			name = fmt.Sprintf("%s_%d", name, msg.MsgID)
+		}
+		names[name] = true
+		if msg.Doc != "" {
+			for _, line := range strings.Split(msg.Doc, "\n") {
+				fmt.Fprintf(bw, "  // %s\n", line)
+			}
+		}
+		if comment := typeComment(msg); comment != "" {
+			fmt.Fprintf(bw, "  // %s\n", comment)
+		}
+		fmt.Fprintf(bw, "  %s = %d;\n", name, msg.MsgID)
+	}
+	fmt.Fprintln(bw, "}")
+	return bw.Flush()
+}
+
+// uniqueMsgs 同一MsgID只保留第一条，不同命名空间与协议版本共用一个枚举值
+func uniqueMsgs(msgs []iface.ProtocolMsg) []iface.ProtocolMsg {
+	out := make([]iface.ProtocolMsg, 0, len(msgs))
+	seen := make(map[uint32]bool, len(msgs))
+	for _, msg := range msgs {
+		if seen[msg.MsgID] {
+			continue
+		}
+		seen[msg.MsgID] = true
+		out = append(out, msg)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].MsgID < out[j].MsgID })
+	return out
+}
+
+// protoFiles 消息类型所在的.proto文件
+func protoFiles(p iface.Protocol) []string {
+	set := make(map[string]bool)
+	for _, msg := range p.Messages {
+		for _, t := range []*iface.ProtocolType{msg.Request, msg.Response} {
+			if t != nil && t.File != "" {
+				set[t.File] = true
+			}
+		}
+	}
+	files := make([]string, 0, len(set))
+	for file := range set {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// typeComment 枚举值的类型注释，如 request: game.LoginReq, response(2): game.LoginResp
+func typeComment(msg iface.ProtocolMsg) string {
+	var parts []string
+	if msg.Request != nil {
+		parts = append(parts, "request: "+msg.Request.Name)
+	}
+	if msg.Response != nil {
+		parts = append(parts, fmt.Sprintf("response(%d): %s", msg.ResponseMsgID, msg.Response.Name))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EnumName 将消息名称转换为proto枚举值的命名，如 LoginReq 转换为 LOGIN_REQ
+func EnumName(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			b.WriteByte('_')
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			next := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && next) {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	out := b.String()
+	if out == "" || unicode.IsDigit(rune(out[0])) {
+		out = "MSG_" + out
+	}
+	return out
+}
@@ -0,0 +1,104 @@
+package recorder
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+/*
+	录制文件格式(小端序)：文件头 | magic "GREC" 4B | version 1B |，之后为若干条记录:
+	| 时间戳(UnixNano) 8B | connID 8B | 方向 1B | msgID 4B | reqID 8B | 数据长度 4B | 数据 |
+*/
+
+const (
+	magic   = "GREC"
+	version = 1
+	// recordHeaderLen 记录头长度
+	recordHeaderLen = 8 + 8 + 1 + 4 + 8 + 4
+)
+
+var (
+	ErrBadMagic   = errors.New("recorder: not a recording file")
+	ErrBadVersion = errors.New("recorder: unsupported recording version")
+)
+
+// Direction 消息方向
+type Direction uint8
+
+const (
+	Inbound  Direction = iota // 客户端发往服务端
+	Outbound                  // 服务端发往客户端
+)
+
+// Record 一条录制的消息
+type Record struct {
+	Time      time.Time
+	ConnID    int64
+	Direction Direction
+	MsgID     uint32
+	ReqID     uint64
+	Data      []byte
+}
+
+// encode 编码记录
+func (rec *Record) encode() []byte {
+	buf := make([]byte, recordHeaderLen+len(rec.Data))
+	binary.LittleEndian.PutUint64(buf, uint64(rec.Time.UnixNano()))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(rec.ConnID))
+	buf[16] = byte(rec.Direction)
+	binary.LittleEndian.PutUint32(buf[17:], rec.MsgID)
+	binary.LittleEndian.PutUint64(buf[21:], rec.ReqID)
+	binary.LittleEndian.PutUint32(buf[29:], uint32(len(rec.Data)))
+	copy(buf[recordHeaderLen:], rec.Data)
+	return buf
+}
+
+// Reader 录制文件读取
+type Reader struct {
+	r      *bufio.Reader
+	header bool
+}
+
+// NewReader 创建录制文件读取
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// Next 读取下一条记录，读完时返回io.EOF
+func (rd *Reader) Next() (*Record, error) {
+	if !rd.header {
+		head := make([]byte, len(magic)+1)
+		if _, err := io.ReadFull(rd.r, head); err != nil {
+			return nil, err
+		}
+		if string(head[:len(magic)]) != magic {
+			return nil, ErrBadMagic
+		}
+		if head[len(magic)] != version {
+			return nil, ErrBadVersion
+		}
+		rd.header = true
+	}
+	head := make([]byte, recordHeaderLen)
+	if _, err := io.ReadFull(rd.r, head); err != nil {
+		return nil, err
+	}
+	rec := &Record{
+		Time:      time.Unix(0, int64(binary.LittleEndian.Uint64(head))),
+		ConnID:    int64(binary.LittleEndian.Uint64(head[8:])),
+		Direction: Direction(head[16]),
+		MsgID:     binary.LittleEndian.Uint32(head[17:]),
+		ReqID:     binary.LittleEndian.Uint64(head[21:]),
+		Data:      make([]byte, binary.LittleEndian.Uint32(head[29:])),
+	}
+	if _, err := io.ReadFull(rd.r, rec.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return rec, nil
+}
@@ -0,0 +1,182 @@
+package recorder
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+// flushInterval 缓冲写入文件的间隔
+const flushInterval = time.Second
+
+// Options 录制配置
+type Options struct {
+	Dir         string // 录制文件目录
+	Prefix      string // 录制文件名前缀，默认 game
+	MaxFileSize int64  // 单个文件的最大字节数，超出后切换新文件，默认64MB
+	MaxFiles    int    // 保留的最大文件数量，超出时删除最旧的文件，0为不限制
+	Outbound    bool   // 是否录制出站消息
+}
+
+// Recorder 消息录制，写入按大小滚动的二进制文件
+type Recorder struct {
+	opts Options
+	file *os.File
+	w    *bufio.Writer
+	size int64
+	lock sync.Mutex
+	quit chan struct{}
+	once sync.Once
+}
+
+// New 创建消息录制
+func New(opts Options) (*Recorder, error) {
+	if opts.Prefix == "" {
+		opts.Prefix = "game"
+	}
+	if opts.MaxFileSize <= 0 {
+		opts.MaxFileSize = 64 << 20
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	r := &Recorder{opts: opts, quit: make(chan struct{})}
+	if err := r.rotate(); err != nil {
+		return nil, err
+	}
+	go r.flushLoop()
+	return r, nil
+}
+
+// Middleware 录制全部入站消息的中间件，如 s.Use(rec.Middleware())
+func (r *Recorder) Middleware() iface.Middleware {
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			r.write(&Record{
+				Time:      time.Now(),
+				ConnID:    request.GetConnection().GetConnID(),
+				Direction: Inbound,
+				MsgID:     request.GetMsgID(),
+				ReqID:     request.GetReqID(),
+				Data:      request.GetData(),
+			})
+			next(request)
+		}
+	}
+}
+
+// Outbound 录制一条出站消息，未开启Outbound时忽略；data在返回前已编码写入，不会被持有
+func (r *Recorder) Outbound(conn iface.Connection, msgID uint32, reqID uint64, data []byte) {
+	if !r.opts.Outbound {
+		return
+	}
+	r.write(&Record{
+		Time:      time.Now(),
+		ConnID:    conn.GetConnID(),
+		Direction: Outbound,
+		MsgID:     msgID,
+		ReqID:     reqID,
+		Data:      data,
+	})
+}
+
+// Close 写入缓冲并关闭录制文件
+func (r *Recorder) Close() error {
+	r.once.Do(func() { close(r.quit) })
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.w.Flush()
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	r.file = nil
+	return err
+}
+
+func (r *Recorder) write(rec *Record) {
+	buf := rec.encode()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.file == nil {
+		return
+	}
+	if r.size+int64(len(buf)) > r.opts.MaxFileSize {
+		if err := r.rotate(); err != nil {
+			zap.S().Error("recorder rotate error ", err)
+			return
+		}
+	}
+	n, err := r.w.Write(buf)
+	r.size += int64(n)
+	if err != nil {
+		zap.S().Error("recorder write error ", err)
+	}
+}
+
+// rotate 关闭当前文件并创建新文件，调用方需持有锁
+func (r *Recorder) rotate() error {
+	if r.file != nil {
+		_ = r.w.Flush()
+		_ = r.file.Close()
+	}
+	name := filepath.Join(r.opts.Dir, fmt.Sprintf("%s-%s.rec", r.opts.Prefix, time.Now().Format("20060102-150405.000000")))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		r.file = nil
+		return err
+	}
+	r.file = f
+	r.w = bufio.NewWriterSize(f, 64*1024)
+	n, err := r.w.Write(append([]byte(magic), version))
+	r.size = int64(n)
+	r.prune()
+	return err
+}
+
+// prune 删除超出MaxFiles的旧文件
+func (r *Recorder) prune() {
+	if r.opts.MaxFiles <= 0 {
+		return
+	}
+	files, err := filepath.Glob(filepath.Join(r.opts.Dir, r.opts.Prefix+"-*.rec"))
+	if err != nil || len(files) <= r.opts.MaxFiles {
+		return
+	}
+	// 文件名中的时间可按字典序排序
+	sort.Strings(files)
+	for _, f := range files[:len(files)-r.opts.MaxFiles] {
+		if err := os.Remove(f); err != nil {
+			zap.S().Warn("recorder remove old file error ", err)
+		}
+	}
+}
+
+func (r *Recorder) flushLoop() {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-ticker.C:
+			r.lock.Lock()
+			if r.file != nil {
+				if err := r.w.Flush(); err != nil {
+					zap.S().Error("recorder flush error ", err)
+				}
+			}
+			r.lock.Unlock()
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package room
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/timerwheel"
+)
+
+// Manager 房间管理器
+type Manager struct {
+	rooms map[string]*Room
+	tw    *timerwheel.TimerWheel
+	lock  sync.RWMutex
+}
+
+// NewManager 创建房间管理器，房间定时器使用tw，一般传入Server的TimerWheel()
+func NewManager(tw *timerwheel.TimerWheel) *Manager {
+	return &Manager{
+		rooms: make(map[string]*Room),
+		tw:    tw,
+	}
+}
+
+// Create 创建房间
+func (m *Manager) Create(id string, opts Options) (*Room, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.rooms[id]; ok {
+		return nil, ErrRoomExists
+	}
+	r := newRoom(m, id, opts)
+	m.rooms[id] = r
+	return r, nil
+}
+
+// Get 获取房间
+func (m *Manager) Get(id string) (*Room, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	r, ok := m.rooms[id]
+	return r, ok
+}
+
+// Destroy 关闭并移除房间
+func (m *Manager) Destroy(id string) error {
+	r, ok := m.Get(id)
+	if !ok {
+		return ErrRoomNotFound
+	}
+	r.Close()
+	return nil
+}
+
+// Len 房间数量
+func (m *Manager) Len() int {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	return len(m.rooms)
+}
+
+// Range 遍历全部房间，fn返回false时停止
+func (m *Manager) Range(fn func(r *Room) bool) {
+	m.lock.RLock()
+	rooms := make([]*Room, 0, len(m.rooms))
+	for _, r := range m.rooms {
+		rooms = append(rooms, r)
+	}
+	m.lock.RUnlock()
+	for _, r := range rooms {
+		if !fn(r) {
+			return
+		}
+	}
+}
+
+// RoomOf 获取连接所在的房间
+func (m *Manager) RoomOf(conn iface.Connection) (*Room, bool) {
+	id, err := conn.GetProperty(PropertyKey)
+	if err != nil {
+		return nil, false
+	}
+	roomID, _ := id.(string)
+	return m.Get(roomID)
+}
+
+// OnConnStop 连接断开时离开所在房间，在Server的OnConnStop中调用可立即触发OnLeave，
+// 未调用时房间也会在下一次tick或检查时移除已断开的成员
+func (m *Manager) OnConnStop(conn iface.Connection) {
+	if r, ok := m.RoomOf(conn); ok {
+		r.Leave(conn)
+	}
+}
+
+// OnLatency 在所在房间的goroutine中调用OnLatency，在Server的OnLatency中调用：
+//
+//	s.AddOnLatency(rooms.OnLatency)
+func (m *Manager) OnLatency(conn iface.Connection, rtt time.Duration) {
+	r, ok := m.RoomOf(conn)
+	if !ok || r.opts.OnLatency == nil {
+		return
+	}
+	r.Do(func() { r.opts.OnLatency(r, conn, rtt) })
+}
+
+// remove 移除已关闭的房间
+func (m *Manager) remove(r *Room) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.rooms[r.id] == r {
+		delete(m.rooms, r.id)
+	}
+}
@@ -0,0 +1,329 @@
+package room
+
+import (
+	"errors"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/timerwheel"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrRoomFull      = errors.New("room: full")
+	ErrRoomClosed    = errors.New("room: closed")
+	ErrInOtherRoom   = errors.New("room: connection already in another room")
+	ErrRoomExists    = errors.New("room: already exists")
+	ErrRoomNotFound  = errors.New("room: not found")
+	ErrStateNotAllow = errors.New("room: join not allowed in current state")
+)
+
+// PropertyKey 连接属性中保存所在房间ID的Key
+var PropertyKey = "room.id"
+
+// sweepInterval 未设置TickRate时检查已断开成员的间隔
+const sweepInterval = time.Second
+
+// State 房间状态
+type State int32
+
+const (
+	StateWaiting State = iota // 等待中，可加入
+	StatePlaying              // 游戏中
+	StateClosed               // 已关闭
+)
+
+// Options 房间配置，回调均在房间goroutine中依次执行，访问房间内的游戏状态无需加锁
+type Options struct {
+	Capacity      int  // 最大人数，0为不限制
+	TickRate      int  // 每秒tick次数，0为不开启tick
+	JoinWhilePlay bool // 游戏中是否允许加入
+	OnJoin        func(r *Room, conn iface.Connection)
+	OnLeave       func(r *Room, conn iface.Connection)
+	OnTick        func(r *Room, dt time.Duration)
+	OnStateChange func(r *Room, from, to State)
+	OnClose       func(r *Room)
+	OnLatency     func(r *Room, conn iface.Connection, rtt time.Duration) // 成员测量到往返延迟，由Manager.OnLatency触发
+}
+
+// Room 房间
+type Room struct {
+	id      string
+	opts    Options
+	state   int32
+	members map[int64]iface.Connection
+	lock    sync.RWMutex
+	// 待在房间goroutine中执行的事件
+	events []func()
+	signal chan struct{}
+	evLock sync.Mutex
+	quit   chan struct{}
+	timers *timerwheel.Group
+	mgr    *Manager
+}
+
+func newRoom(m *Manager, id string, opts Options) *Room {
+	r := &Room{
+		id:      id,
+		opts:    opts,
+		state:   int32(StateWaiting),
+		members: make(map[int64]iface.Connection),
+		signal:  make(chan struct{}, 1),
+		quit:    make(chan struct{}),
+		timers:  m.tw.NewGroup(),
+		mgr:     m,
+	}
+	go r.loop()
+	return r
+}
+
+// ID 房间ID
+func (r *Room) ID() string {
+	return r.id
+}
+
+// State 房间状态
+func (r *Room) State() State {
+	return State(atomic.LoadInt32(&r.state))
+}
+
+// SetState 切换房间状态，切换为StateClosed等同于Close
+func (r *Room) SetState(state State) {
+	if state == StateClosed {
+		r.Close()
+		return
+	}
+	var from State
+	for {
+		from = r.State()
+		if from == state || from == StateClosed {
+			return
+		}
+		if atomic.CompareAndSwapInt32(&r.state, int32(from), int32(state)) {
+			break
+		}
+	}
+	if r.opts.OnStateChange != nil {
+		r.Do(func() { r.opts.OnStateChange(r, from, state) })
+	}
+}
+
+// Join 加入房间
+func (r *Room) Join(conn iface.Connection) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	switch r.State() {
+	case StateClosed:
+		return ErrRoomClosed
+	case StatePlaying:
+		if !r.opts.JoinWhilePlay {
+			return ErrStateNotAllow
+		}
+	}
+	if _, ok := r.members[conn.GetConnID()]; ok {
+		return nil
+	}
+	if id, err := conn.GetProperty(PropertyKey); err == nil && id != r.id {
+		return ErrInOtherRoom
+	}
+	if r.opts.Capacity > 0 && len(r.members) >= r.opts.Capacity {
+		return ErrRoomFull
+	}
+	r.members[conn.GetConnID()] = conn
+	conn.SetProperty(PropertyKey, r.id)
+	if r.opts.OnJoin != nil {
+		r.Do(func() { r.opts.OnJoin(r, conn) })
+	}
+	return nil
+}
+
+// Leave 离开房间
+func (r *Room) Leave(conn iface.Connection) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.leave(conn)
+}
+
+// leave 移除成员，调用方需持有锁
+func (r *Room) leave(conn iface.Connection) {
+	if _, ok := r.members[conn.GetConnID()]; !ok {
+		return
+	}
+	delete(r.members, conn.GetConnID())
+	conn.RemoveProperty(PropertyKey)
+	if r.opts.OnLeave != nil {
+		r.Do(func() { r.opts.OnLeave(r, conn) })
+	}
+}
+
+// Members 房间内的全部连接
+func (r *Room) Members() []iface.Connection {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	conns := make([]iface.Connection, 0, len(r.members))
+	for _, conn := range r.members {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// Len 房间人数
+func (r *Room) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.members)
+}
+
+// MaxLatency 房间内成员往返延迟的最大值，可作为延迟补偿回溯的时间窗口
+func (r *Room) MaxLatency() time.Duration {
+	var max time.Duration
+	for _, conn := range r.Members() {
+		if rtt := conn.Latency(); rtt > max {
+			max = rtt
+		}
+	}
+	return max
+}
+
+// Broadcast 向房间内的连接广播消息，exclude中的ConnID不发送，返回发送成功的连接数量
+func (r *Room) Broadcast(msgID uint32, data []byte, exclude ...int64) int {
+	sent := 0
+	for _, conn := range r.Members() {
+		skip := false
+		for _, connID := range exclude {
+			if conn.GetConnID() == connID {
+				skip = true
+				break
+			}
+		}
+		if skip {
+			continue
+		}
+		if err := conn.SendBuffMsg(msgID, data); err == nil {
+			sent++
+		}
+	}
+	return sent
+}
+
+// Do 在房间goroutine中执行fn
+func (r *Room) Do(fn func()) {
+	r.evLock.Lock()
+	r.events = append(r.events, fn)
+	r.evLock.Unlock()
+	select {
+	case r.signal <- struct{}{}:
+	default:
+	}
+}
+
+// AfterFunc 添加房间定时器，到期后在房间goroutine中执行fn，房间关闭时取消
+func (r *Room) AfterFunc(d time.Duration, fn func()) timerwheel.TimerID {
+	return r.timers.AddTimer(d, func() { r.Do(fn) })
+}
+
+// CancelTimer 取消房间定时器
+func (r *Room) CancelTimer(id timerwheel.TimerID) bool {
+	return r.timers.CancelTimer(id)
+}
+
+// Close 关闭房间，全部成员离开，房间从管理器中移除
+func (r *Room) Close() {
+	from := State(atomic.SwapInt32(&r.state, int32(StateClosed)))
+	if from == StateClosed {
+		return
+	}
+	r.timers.CancelAll()
+	r.lock.Lock()
+	for _, conn := range r.members {
+		r.leave(conn)
+	}
+	r.lock.Unlock()
+	r.mgr.remove(r)
+	if r.opts.OnStateChange != nil {
+		r.Do(func() { r.opts.OnStateChange(r, from, StateClosed) })
+	}
+	r.Do(func() {
+		if r.opts.OnClose != nil {
+			r.opts.OnClose(r)
+		}
+		close(r.quit)
+	})
+}
+
+// loop 房间goroutine，依次执行事件与tick
+func (r *Room) loop() {
+	interval := sweepInterval
+	if r.opts.TickRate > 0 {
+		interval = time.Second / time.Duration(r.opts.TickRate)
+	}
+	// 与房间定时器使用同一个时钟
+	ticker := r.mgr.tw.Clock().NewTicker(interval)
+	defer ticker.Stop()
+	last := r.mgr.tw.Clock().Now()
+	for {
+		select {
+		case <-r.quit:
+			return
+		case <-r.signal:
+			r.runEvents()
+		case now := <-ticker.C():
+			r.sweep()
+			r.runEvents()
+			if r.opts.TickRate > 0 && r.opts.OnTick != nil && r.State() != StateClosed {
+				r.call(func() { r.opts.OnTick(r, now.Sub(last)) })
+			}
+			last = now
+		}
+	}
+}
+
+// runEvents 执行排队中的事件
+func (r *Room) runEvents() {
+	for {
+		r.evLock.Lock()
+		events := r.events
+		r.events = nil
+		r.evLock.Unlock()
+		if len(events) == 0 {
+			return
+		}
+		for _, fn := range events {
+			r.call(fn)
+			select {
+			case <-r.quit:
+				return
+			default:
+			}
+		}
+	}
+}
+
+// call 执行回调，panic不会终止房间goroutine
+func (r *Room) call(fn func()) {
+	defer func() {
+		if err := recover(); err != nil {
+			zap.S().Errorw("room callback panic",
+				"room", r.id,
+				"err", err,
+				"stack", string(debug.Stack()),
+			)
+		}
+	}()
+	fn()
+}
+
+// sweep 移除已断开的成员
+func (r *Room) sweep() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, conn := range r.members {
+		if ctx := conn.Context(); ctx != nil && ctx.Err() != nil {
+			r.leave(conn)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// ErrCiphertextTooShort 密文长度小于nonce长度
+var ErrCiphertextTooShort = errors.New("secure: ciphertext too short")
+
+// AEAD 基于AEAD算法的加密器，密文格式为 nonce | ciphertext
+type AEAD struct {
+	aead cipher.AEAD
+}
+
+var _ iface.AEADCipher = (*AEAD)(nil)
+
+// NewAESGCM 创建AES-GCM加密器，key长度为16、24或32字节
+func NewAESGCM(key []byte) (iface.Cipher, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &AEAD{aead: aead}, nil
+}
+
+// NewChaCha20 创建ChaCha20-Poly1305加密器，key长度为32字节
+func NewChaCha20(key []byte) (iface.Cipher, error) {
+	aead, err := chacha20poly1305.New(key)
+	if err != nil {
+		return nil, err
+	}
+	return &AEAD{aead: aead}, nil
+}
+
+// Encrypt 加密，每条消息使用随机nonce
+func (a *AEAD) Encrypt(plain []byte) ([]byte, error) {
+	return a.Seal(plain, nil)
+}
+
+// Decrypt 解密
+func (a *AEAD) Decrypt(data []byte) ([]byte, error) {
+	return a.Open(data, nil)
+}
+
+// Seal 加密并认证附加数据aad，每条消息使用随机nonce
+func (a *AEAD) Seal(plain, aad []byte) ([]byte, error) {
+	nonce := make([]byte, a.aead.NonceSize(), a.aead.NonceSize()+len(plain)+a.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return a.aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+// Open 解密并校验附加数据aad
+func (a *AEAD) Open(data, aad []byte) ([]byte, error) {
+	size := a.aead.NonceSize()
+	if len(data) < size {
+		return nil, ErrCiphertextTooShort
+	}
+	return a.aead.Open(nil, data[:size], data[size:], aad)
+}
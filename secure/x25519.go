@@ -0,0 +1,41 @@
+package secure
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/xiaomingping/game/iface"
+	"golang.org/x/crypto/curve25519"
+)
+
+// ErrBadPublicKey 客户端公钥长度错误
+var ErrBadPublicKey = errors.New("secure: bad x25519 public key")
+
+// X25519KeyExchange 基于X25519(ECDH)的密钥交换：
+// 客户端发送32字节公钥，服务端回复32字节公钥，双方以 sha256(共享密钥) 作为对称密钥
+func X25519KeyExchange(newCipher func(key []byte) (iface.Cipher, error)) iface.KeyExchange {
+	return func(conn iface.Connection, data []byte) (iface.Cipher, []byte, error) {
+		if len(data) != curve25519.PointSize {
+			return nil, nil, ErrBadPublicKey
+		}
+		private := make([]byte, curve25519.ScalarSize)
+		if _, err := rand.Read(private); err != nil {
+			return nil, nil, err
+		}
+		public, err := curve25519.X25519(private, curve25519.Basepoint)
+		if err != nil {
+			return nil, nil, err
+		}
+		shared, err := curve25519.X25519(private, data)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := sha256.Sum256(shared)
+		c, err := newCipher(key[:])
+		if err != nil {
+			return nil, nil, err
+		}
+		return c, public, nil
+	}
+}
@@ -0,0 +1,454 @@
+package sse
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+var (
+	// IDQueryKey 桥接连接ID的URL参数名
+	IDQueryKey = "id"
+
+	ErrBridgeNotFound = errors.New("sse: bridge not found")
+	ErrBridgeClosed   = errors.New("sse: bridge closed")
+)
+
+// Options HTTP回退传输的参数
+type Options struct {
+	Tag          string        // 桥接连接的入口标签，默认"sse"
+	UpgradeURL   string        // 建立连接后通知客户端可尝试的websocket地址，客户端升级成功后应调用close结束回退连接
+	IdleTimeout  time.Duration // 没有SSE流或轮询请求时保留连接的时间，默认30s
+	KeepAlive    time.Duration // SSE流的注释心跳间隔，用于防止代理断开空闲连接，默认15s
+	PollTimeout  time.Duration // 长轮询等待下行消息的最长时间，默认25s
+	MaxPollBatch int           // 一次长轮询最多返回的消息数量，默认64
+	QueueSize    int           // 每个连接等待下发的消息数量上限，写满后阻塞Server的写goroutine，默认256
+	MaxBodySize  int64         // 上行请求体的最大字节数，默认1MB
+}
+
+func (o *Options) withDefaults() {
+	if o.Tag == "" {
+		o.Tag = "sse"
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = 30 * time.Second
+	}
+	if o.KeepAlive <= 0 {
+		o.KeepAlive = 15 * time.Second
+	}
+	if o.PollTimeout <= 0 {
+		o.PollTimeout = 25 * time.Second
+	}
+	if o.MaxPollBatch <= 0 {
+		o.MaxPollBatch = 64
+	}
+	if o.QueueSize <= 0 {
+		o.QueueSize = 256
+	}
+	if o.MaxBodySize <= 0 {
+		o.MaxBodySize = 1 << 20
+	}
+}
+
+// Frame 下发的一个websocket消息帧，Data为封包后的完整数据
+type Frame struct {
+	Type int    `json:"type"` // websocket帧类型，1为文本，2为二进制
+	Data []byte `json:"data"` // JSON中以base64编码
+}
+
+// bridge 一个回退连接，在内存中以websocket连接到Server，对Server而言与普通连接相同
+type bridge struct {
+	id       string
+	ws       *websocket.Conn
+	frames   chan Frame
+	seq      uint64
+	lastSeen int64 // 最后一次有请求的时间(UnixNano)
+	attached int32 // 正在使用的SSE流与长轮询数量
+	detach   chan struct{}
+	lock     sync.Mutex // 保护detach
+	wlock    sync.Mutex // 保护websocket写
+	closed   chan struct{}
+	once     sync.Once
+}
+
+// Transport HTTP回退传输，供屏蔽了WebSocket的代理之后的客户端使用，下行为SSE或长轮询，上行为POST：
+//
+//	POST {base}/open          建立连接，返回 {"id": "...", "upgrade": "ws://..."}，请求参数与请求头按websocket握手转发
+//	GET  {base}/stream?id=xxx SSE下行，event为message(data为base64的二进制帧)或text(文本帧)，连接关闭时发送close事件；
+//	                          不带id时建立新连接并先发送data为连接ID的open事件
+//	GET  {base}/poll?id=xxx   长轮询下行，返回 {"frames": [...], "closed": false}
+//	POST {base}/send?id=xxx   上行一个封包，Content-Type为application/octet-stream时以二进制帧发送，否则以文本帧发送
+//	POST {base}/close?id=xxx  关闭连接，客户端升级到websocket后调用
+//
+// 每个回退连接在Server上是一个普通的Connection，中间件、会话与鉴权都相同；
+// 开启会话重连时客户端可携带会话token连接到UpgradeURL，恢复会话后关闭回退连接，实现透明升级
+type Transport struct {
+	opts     Options
+	loopback *netw.Loopback
+	bridges  map[string]*bridge
+	lock     sync.RWMutex
+	quit     chan struct{}
+	stopOnce sync.Once
+}
+
+// New 创建HTTP回退传输，桥接连接以Options.Tag为入口标签交给s
+func New(s iface.Server, opts Options) *Transport {
+	opts.withDefaults()
+	t := &Transport{
+		opts:     opts,
+		loopback: netw.NewLoopback(s, opts.Tag),
+		bridges:  make(map[string]*bridge),
+		quit:     make(chan struct{}),
+	}
+	go t.reap()
+	return t
+}
+
+// Register 在路由上注册回退传输的接口，如 t.Register(g.Group("/fallback"))
+func (t *Transport) Register(r gin.IRoutes) {
+	r.POST("/open", t.handleOpen)
+	r.GET("/stream", t.handleStream)
+	r.GET("/poll", t.handlePoll)
+	r.POST("/send", t.handleSend)
+	r.POST("/close", t.handleClose)
+}
+
+// Len 当前回退连接数量
+func (t *Transport) Len() int {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	return len(t.bridges)
+}
+
+// Close 关闭全部回退连接，关闭时Server上对应的连接随之断开
+func (t *Transport) Close() error {
+	t.stopOnce.Do(func() { close(t.quit) })
+	t.lock.Lock()
+	bridges := t.bridges
+	t.bridges = make(map[string]*bridge)
+	t.lock.Unlock()
+	for _, b := range bridges {
+		b.close()
+	}
+	return t.loopback.Close()
+}
+
+// open 以原始请求的参数与请求头在内存中建立到Server的websocket连接，握手被拒绝时返回Server的状态码
+func (t *Transport) open(r *http.Request) (*bridge, int, error) {
+	ws, status, err := t.loopback.Dial(r)
+	if err != nil {
+		return nil, status, err
+	}
+	b := &bridge{
+		id:       newBridgeID(),
+		ws:       ws,
+		frames:   make(chan Frame, t.opts.QueueSize),
+		lastSeen: time.Now().UnixNano(),
+		closed:   make(chan struct{}),
+	}
+	t.lock.Lock()
+	t.bridges[b.id] = b
+	t.lock.Unlock()
+	go t.readLoop(b)
+	return b, http.StatusOK, nil
+}
+
+// readLoop 读取Server下发的消息帧放入队列，队列写满时阻塞，Server按其慢速连接策略处理
+func (t *Transport) readLoop(b *bridge) {
+	defer t.remove(b)
+	for {
+		messageType, data, err := b.ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		select {
+		case b.frames <- Frame{Type: messageType, Data: data}:
+		case <-b.closed:
+			return
+		}
+	}
+}
+
+// reap 关闭超过IdleTimeout没有请求的回退连接
+func (t *Transport) reap() {
+	ticker := time.NewTicker(t.opts.IdleTimeout / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-t.quit:
+			return
+		}
+		deadline := time.Now().Add(-t.opts.IdleTimeout).UnixNano()
+		t.lock.RLock()
+		var idle []*bridge
+		for _, b := range t.bridges {
+			if atomic.LoadInt32(&b.attached) == 0 && atomic.LoadInt64(&b.lastSeen) < deadline {
+				idle = append(idle, b)
+			}
+		}
+		t.lock.RUnlock()
+		for _, b := range idle {
+			zap.S().Debug("sse bridge idle timeout ", b.id)
+			t.remove(b)
+		}
+	}
+}
+
+func (t *Transport) get(id string) (*bridge, bool) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	b, ok := t.bridges[id]
+	if ok {
+		atomic.StoreInt64(&b.lastSeen, time.Now().UnixNano())
+	}
+	return b, ok
+}
+
+func (t *Transport) remove(b *bridge) {
+	t.lock.Lock()
+	if t.bridges[b.id] == b {
+		delete(t.bridges, b.id)
+	}
+	t.lock.Unlock()
+	b.close()
+}
+
+// lookup 按请求参数查找回退连接，不存在时回复404
+func (t *Transport) lookup(c *gin.Context) (*bridge, bool) {
+	b, ok := t.get(c.Query(IDQueryKey))
+	if !ok {
+		c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": ErrBridgeNotFound.Error()})
+	}
+	return b, ok
+}
+
+func (t *Transport) handleOpen(c *gin.Context) {
+	b, status, err := t.open(c.Request)
+	if err != nil {
+		zap.S().Info("sse open rejected ", c.ClientIP(), " err = ", err)
+		c.AbortWithStatus(status)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"id": b.id, "upgrade": t.opts.UpgradeURL})
+}
+
+func (t *Transport) handleStream(c *gin.Context) {
+	var b *bridge
+	opened := false
+	if c.Query(IDQueryKey) == "" {
+		var (
+			status int
+			err    error
+		)
+		if b, status, err = t.open(c.Request); err != nil {
+			zap.S().Info("sse open rejected ", c.ClientIP(), " err = ", err)
+			c.AbortWithStatus(status)
+			return
+		}
+		opened = true
+	} else {
+		var ok bool
+		if b, ok = t.lookup(c); !ok {
+			return
+		}
+	}
+	detach := b.attach()
+	defer b.release()
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// 关闭nginx等反向代理的响应缓冲
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if opened {
+		writeEvent(w, "", "open", b.id)
+	}
+	if t.opts.UpgradeURL != "" {
+		writeEvent(w, "", "upgrade", t.opts.UpgradeURL)
+	}
+	w.Flush()
+	keepAlive := time.NewTicker(t.opts.KeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case f := <-b.frames:
+			b.writeFrame(w, f)
+			w.Flush()
+		case <-keepAlive.C:
+			_, _ = io.WriteString(w, ": ping\n\n")
+			w.Flush()
+		case <-b.closed:
+			// 下发关闭前已到达的消息，如踢出原因
+			for _, f := range b.remaining(0) {
+				b.writeFrame(w, f)
+			}
+			writeEvent(w, "", "close", "")
+			w.Flush()
+			return
+		case <-detach:
+			return
+		case <-c.Request.Context().Done():
+			return
+		}
+	}
+}
+
+func (t *Transport) handlePoll(c *gin.Context) {
+	b, ok := t.lookup(c)
+	if !ok {
+		return
+	}
+	detach := b.attach()
+	defer b.release()
+	frames := make([]Frame, 0, 1)
+	timer := time.NewTimer(t.opts.PollTimeout)
+	defer timer.Stop()
+	closed := false
+	select {
+	case f := <-b.frames:
+		frames = append(frames, f)
+	case <-b.closed:
+		closed = true
+	case <-timer.C:
+	case <-detach:
+	case <-c.Request.Context().Done():
+		return
+	}
+	// 取出已到达的其余消息，一次返回
+	if len(frames) > 0 || closed {
+		frames = append(frames, b.remaining(t.opts.MaxPollBatch-len(frames))...)
+	}
+	c.JSON(http.StatusOK, gin.H{"frames": frames, "closed": closed})
+}
+
+func (t *Transport) handleSend(c *gin.Context) {
+	b, ok := t.lookup(c)
+	if !ok {
+		return
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(c.Request.Body, t.opts.MaxBodySize+1))
+	if err != nil {
+		c.AbortWithStatus(http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > t.opts.MaxBodySize {
+		c.AbortWithStatus(http.StatusRequestEntityTooLarge)
+		return
+	}
+	messageType := websocket.TextMessage
+	if c.ContentType() == "application/octet-stream" {
+		messageType = websocket.BinaryMessage
+	}
+	if err := b.write(messageType, data); err != nil {
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"error": err.Error()})
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (t *Transport) handleClose(c *gin.Context) {
+	b, ok := t.lookup(c)
+	if !ok {
+		return
+	}
+	t.remove(b)
+	c.Status(http.StatusNoContent)
+}
+
+// attach 开始一个SSE流或长轮询，同一连接同时只有一个下行请求，之前的请求被结束
+func (b *bridge) attach() chan struct{} {
+	atomic.AddInt32(&b.attached, 1)
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if b.detach != nil {
+		close(b.detach)
+	}
+	b.detach = make(chan struct{})
+	return b.detach
+}
+
+// remaining 不阻塞地取出队列中的消息，max<=0时全部取出
+func (b *bridge) remaining(max int) []Frame {
+	var frames []Frame
+	for max <= 0 || len(frames) < max {
+		select {
+		case f := <-b.frames:
+			frames = append(frames, f)
+		default:
+			return frames
+		}
+	}
+	return frames
+}
+
+// writeFrame 以SSE事件写出一个消息帧，事件ID为连接内递增的序号
+func (b *bridge) writeFrame(w io.Writer, f Frame) {
+	id := strconv.FormatUint(atomic.AddUint64(&b.seq, 1), 10)
+	if f.Type == websocket.TextMessage {
+		writeEvent(w, id, "text", string(f.Data))
+		return
+	}
+	writeEvent(w, id, "message", base64.StdEncoding.EncodeToString(f.Data))
+}
+
+func (b *bridge) release() {
+	atomic.AddInt32(&b.attached, -1)
+	atomic.StoreInt64(&b.lastSeen, time.Now().UnixNano())
+}
+
+// write 将上行消息写入桥接的websocket连接
+func (b *bridge) write(messageType int, data []byte) error {
+	select {
+	case <-b.closed:
+		return ErrBridgeClosed
+	default:
+	}
+	b.wlock.Lock()
+	defer b.wlock.Unlock()
+	return b.ws.WriteMessage(messageType, data)
+}
+
+func (b *bridge) close() {
+	b.once.Do(func() {
+		close(b.closed)
+		_ = b.ws.Close()
+	})
+}
+
+// writeEvent 写出一个SSE事件，多行数据按行拆分为多个data字段
+func writeEvent(w io.Writer, id, event, data string) {
+	var sb strings.Builder
+	if id != "" {
+		sb.WriteString("id: " + id + "\n")
+	}
+	sb.WriteString("event: " + event + "\n")
+	for _, line := range strings.Split(data, "\n") {
+		sb.WriteString("data: " + line + "\n")
+	}
+	sb.WriteString("\n")
+	_, _ = io.WriteString(w, sb.String())
+}
+
+func newBridgeID() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,163 @@
+package statesync
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/room"
+)
+
+/*
+	状态同步，快照与增量使用相同的数据包格式(小端序):
+	| tick 4B | 实体数量 4B | [entityID 8B | 状态长度 4B | 状态] ... | 移除数量 4B | [entityID 8B] ... |
+	快照包含客户端可见的全部实体，移除数量为0；增量只包含状态变化的实体与离开视野的实体
+*/
+
+// Provider 实体状态提供者，返回实体ID到序列化状态的映射；
+// 返回的状态切片会被保留作为对比基准，之后不可再修改
+type Provider interface {
+	States() map[uint64][]byte
+}
+
+// ProviderFunc 函数形式的Provider
+type ProviderFunc func() map[uint64][]byte
+
+func (f ProviderFunc) States() map[uint64][]byte {
+	return f()
+}
+
+// Options 状态同步配置
+type Options struct {
+	SnapshotMsgID    uint32 // 下发全量快照的MsgID
+	DeltaMsgID       uint32 // 下发增量的MsgID
+	SnapshotInterval int    // 每隔多少tick下发一次全量快照，0为只在首次同步时下发
+	// Interest 兴趣管理，返回连接是否关注该实体，为nil时房间内全部连接关注全部实体
+	Interest func(conn iface.Connection, entityID uint64) bool
+}
+
+// Syncer 房间的状态同步器，需在房间的OnTick中调用Tick
+type Syncer struct {
+	room      *room.Room
+	opts      Options
+	providers []Provider
+	tick      uint32
+	// 每个连接已下发的实体状态，作为计算增量的基准
+	baselines map[int64]map[uint64][]byte
+	lock      sync.Mutex
+}
+
+// NewSyncer 创建状态同步器
+func NewSyncer(r *room.Room, opts Options) *Syncer {
+	return &Syncer{
+		room:      r,
+		opts:      opts,
+		baselines: make(map[int64]map[uint64][]byte),
+	}
+}
+
+// Register 注册实体状态提供者，多个提供者的实体ID不可重复
+func (s *Syncer) Register(p Provider) {
+	s.lock.Lock()
+	s.providers = append(s.providers, p)
+	s.lock.Unlock()
+}
+
+// Resync 下一次Tick时向连接下发全量快照，如客户端检测到状态不一致时请求
+func (s *Syncer) Resync(conn iface.Connection) {
+	s.lock.Lock()
+	delete(s.baselines, conn.GetConnID())
+	s.lock.Unlock()
+}
+
+// Tick 采集全部实体状态，向房间成员下发快照或增量
+func (s *Syncer) Tick() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.tick++
+	states := make(map[uint64][]byte)
+	for _, p := range s.providers {
+		for id, state := range p.States() {
+			states[id] = state
+		}
+	}
+	snapshot := s.opts.SnapshotInterval > 0 && s.tick%uint32(s.opts.SnapshotInterval) == 0
+
+	members := s.room.Members()
+	alive := make(map[int64]struct{}, len(members))
+	for _, conn := range members {
+		connID := conn.GetConnID()
+		alive[connID] = struct{}{}
+		visible := s.visible(conn, states)
+		baseline, ok := s.baselines[connID]
+		if snapshot || !ok {
+			_ = conn.SendBuffMsg(s.opts.SnapshotMsgID, encode(s.tick, visible, nil))
+		} else if changed, removed := diff(baseline, visible); len(changed) > 0 || len(removed) > 0 {
+			_ = conn.SendBuffMsg(s.opts.DeltaMsgID, encode(s.tick, changed, removed))
+		}
+		s.baselines[connID] = visible
+	}
+	// 清理已离开房间的连接
+	for connID := range s.baselines {
+		if _, ok := alive[connID]; !ok {
+			delete(s.baselines, connID)
+		}
+	}
+}
+
+// visible 连接可见的实体状态
+func (s *Syncer) visible(conn iface.Connection, states map[uint64][]byte) map[uint64][]byte {
+	if s.opts.Interest == nil {
+		return states
+	}
+	visible := make(map[uint64][]byte)
+	for id, state := range states {
+		if s.opts.Interest(conn, id) {
+			visible[id] = state
+		}
+	}
+	return visible
+}
+
+// diff 对比基准计算状态变化与移除的实体
+func diff(baseline, current map[uint64][]byte) (map[uint64][]byte, []uint64) {
+	changed := make(map[uint64][]byte)
+	for id, state := range current {
+		if old, ok := baseline[id]; !ok || !bytes.Equal(old, state) {
+			changed[id] = state
+		}
+	}
+	var removed []uint64
+	for id := range baseline {
+		if _, ok := current[id]; !ok {
+			removed = append(removed, id)
+		}
+	}
+	return changed, removed
+}
+
+// encode 编码快照或增量数据包
+func encode(tick uint32, states map[uint64][]byte, removed []uint64) []byte {
+	size := 12 + len(removed)*8
+	for _, state := range states {
+		size += 12 + len(state)
+	}
+	packet := make([]byte, size)
+	binary.LittleEndian.PutUint32(packet, tick)
+	binary.LittleEndian.PutUint32(packet[4:], uint32(len(states)))
+	offset := 8
+	for id, state := range states {
+		binary.LittleEndian.PutUint64(packet[offset:], id)
+		binary.LittleEndian.PutUint32(packet[offset+8:], uint32(len(state)))
+		offset += 12
+		offset += copy(packet[offset:], state)
+	}
+	binary.LittleEndian.PutUint32(packet[offset:], uint32(len(removed)))
+	offset += 4
+	for _, id := range removed {
+		binary.LittleEndian.PutUint64(packet[offset:], id)
+		offset += 8
+	}
+	return packet
+}
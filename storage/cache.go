@@ -0,0 +1,285 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownKind = errors.New("storage: unknown entity kind")
+	ErrNotFound    = errors.New("storage: entity not found")
+)
+
+// Loader 从数据库读取实体，不存在时返回ErrNotFound
+type Loader func(ctx context.Context, key string) (interface{}, error)
+
+// Saver 将实体写回数据库
+type Saver func(ctx context.Context, key string, value interface{}) error
+
+// entry 缓存中的一个实体，读写实体需持有lock
+type entry struct {
+	lock    sync.Mutex
+	value   interface{}
+	loaded  bool
+	dirty   bool
+	evicted bool // 已写回并移出缓存，等待锁的读写方需重新获取实体
+}
+
+// repository 一类实体的读写方法与缓存
+type repository struct {
+	loader  Loader
+	saver   Saver
+	entries map[string]*entry
+	lock    sync.Mutex
+}
+
+// Cache 玩家数据写回缓存：读取时按需加载，修改后标记为脏数据，由定时任务或连接断开时批量写回，
+// 处理消息时不再同步读写数据库
+type Cache struct {
+	repos map[string]*repository
+	lock  sync.RWMutex
+}
+
+// NewCache 创建写回缓存
+func NewCache() *Cache {
+	return &Cache{repos: make(map[string]*repository)}
+}
+
+// Register 注册一类实体的读写方法，如 Register("player", loadPlayer, savePlayer)
+func (c *Cache) Register(kind string, loader Loader, saver Saver) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.repos[kind] = &repository{
+		loader:  loader,
+		saver:   saver,
+		entries: make(map[string]*entry),
+	}
+}
+
+func (c *Cache) repo(kind string) (*repository, error) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	repo, ok := c.repos[kind]
+	if !ok {
+		return nil, ErrUnknownKind
+	}
+	return repo, nil
+}
+
+// lockEntry 获取或创建key对应的实体并加锁，实体在等待锁期间被移出缓存时重新获取
+func (repo *repository) lockEntry(key string) *entry {
+	for {
+		repo.lock.Lock()
+		e, ok := repo.entries[key]
+		if !ok {
+			e = &entry{}
+			repo.entries[key] = e
+		}
+		repo.lock.Unlock()
+		e.lock.Lock()
+		if !e.evicted {
+			return e
+		}
+		e.lock.Unlock()
+	}
+}
+
+// acquire 获取已加载并加锁的实体，调用方需解锁
+func (c *Cache) acquire(ctx context.Context, kind, key string) (*repository, *entry, error) {
+	repo, err := c.repo(kind)
+	if err != nil {
+		return nil, nil, err
+	}
+	e := repo.lockEntry(key)
+	// 同一实体的并发读取只加载一次
+	if !e.loaded {
+		value, err := repo.loader(ctx, key)
+		if err != nil {
+			repo.lock.Lock()
+			if repo.entries[key] == e {
+				delete(repo.entries, key)
+			}
+			repo.lock.Unlock()
+			e.evicted = true
+			e.lock.Unlock()
+			return nil, nil, err
+		}
+		e.value, e.loaded = value, true
+	}
+	return repo, e, nil
+}
+
+// Get 读取实体，返回值在View或Update之外使用时不能修改
+func (c *Cache) Get(ctx context.Context, kind, key string) (interface{}, error) {
+	_, e, err := c.acquire(ctx, kind, key)
+	if err != nil {
+		return nil, err
+	}
+	defer e.lock.Unlock()
+	return e.value, nil
+}
+
+// View 持有实体锁只读访问实体
+func (c *Cache) View(ctx context.Context, kind, key string, fn func(value interface{}) error) error {
+	_, e, err := c.acquire(ctx, kind, key)
+	if err != nil {
+		return err
+	}
+	defer e.lock.Unlock()
+	return fn(e.value)
+}
+
+// Update 持有实体锁修改实体，fn返回nil时标记为脏数据等待写回
+func (c *Cache) Update(ctx context.Context, kind, key string, fn func(value interface{}) error) error {
+	_, e, err := c.acquire(ctx, kind, key)
+	if err != nil {
+		return err
+	}
+	defer e.lock.Unlock()
+	if err := fn(e.value); err != nil {
+		return err
+	}
+	e.dirty = true
+	return nil
+}
+
+// Put 替换实体并标记为脏数据，可用于创建新实体
+func (c *Cache) Put(kind, key string, value interface{}) error {
+	repo, err := c.repo(kind)
+	if err != nil {
+		return err
+	}
+	e := repo.lockEntry(key)
+	e.value, e.loaded, e.dirty = value, true, true
+	e.lock.Unlock()
+	return nil
+}
+
+// Flush 写回一个实体，未修改时不写
+func (c *Cache) Flush(ctx context.Context, kind, key string) error {
+	repo, err := c.repo(kind)
+	if err != nil {
+		return err
+	}
+	repo.lock.Lock()
+	e, ok := repo.entries[key]
+	repo.lock.Unlock()
+	if !ok {
+		return nil
+	}
+	return flushEntry(ctx, repo, key, e)
+}
+
+// flushEntry 持有实体锁写回，写回期间的修改会等待写回完成
+func flushEntry(ctx context.Context, repo *repository, key string, e *entry) error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	return flushLocked(ctx, repo, key, e)
+}
+
+// flushLocked 写回实体，调用方需持有实体锁
+func flushLocked(ctx context.Context, repo *repository, key string, e *entry) error {
+	if !e.dirty {
+		return nil
+	}
+	if err := repo.saver(ctx, key, e.value); err != nil {
+		return err
+	}
+	e.dirty = false
+	return nil
+}
+
+// FlushAll 写回全部脏数据，写回失败的实体保持为脏数据，下次重试，返回第一个错误
+func (c *Cache) FlushAll(ctx context.Context) error {
+	c.lock.RLock()
+	repos := make([]*repository, 0, len(c.repos))
+	for _, repo := range c.repos {
+		repos = append(repos, repo)
+	}
+	c.lock.RUnlock()
+	var first error
+	for _, repo := range repos {
+		repo.lock.Lock()
+		entries := make(map[string]*entry, len(repo.entries))
+		for key, e := range repo.entries {
+			entries[key] = e
+		}
+		repo.lock.Unlock()
+		for key, e := range entries {
+			if err := flushEntry(ctx, repo, key, e); err != nil {
+				zap.S().Warn("flush entity error key = ", key, " err = ", err)
+				if first == nil {
+					first = err
+				}
+			}
+		}
+	}
+	return first
+}
+
+// Evict 写回key在全部实体类型中的数据后移出缓存，写回失败的实体保留在缓存中；
+// 写回与移出期间持有实体锁，期间的修改在移出后重新加载，不会丢失
+func (c *Cache) Evict(ctx context.Context, key string) error {
+	c.lock.RLock()
+	repos := make([]*repository, 0, len(c.repos))
+	for _, repo := range c.repos {
+		repos = append(repos, repo)
+	}
+	c.lock.RUnlock()
+	var first error
+	for _, repo := range repos {
+		repo.lock.Lock()
+		e, ok := repo.entries[key]
+		repo.lock.Unlock()
+		if !ok {
+			continue
+		}
+		e.lock.Lock()
+		if err := flushLocked(ctx, repo, key, e); err != nil {
+			e.lock.Unlock()
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		repo.lock.Lock()
+		if repo.entries[key] == e {
+			delete(repo.entries, key)
+		}
+		repo.lock.Unlock()
+		e.evicted = true
+		e.lock.Unlock()
+	}
+	return first
+}
+
+// Attach 挂载到Server：每隔interval写回全部脏数据，连接断开时写回并移出该连接uid的数据；
+// Server.Stop断开全部连接时随之写回
+func (c *Cache) Attach(s iface.Server, interval time.Duration) {
+	if interval > 0 {
+		s.Schedule(interval, func() {
+			_ = c.FlushAll(context.Background())
+		})
+	}
+	s.AddOnConnStop(func(conn iface.Connection) {
+		uid := conn.GetUID()
+		if uid == "" {
+			return
+		}
+		// 同一uid还有其它在线连接时保留缓存
+		for _, other := range s.GetConnMgr().GetByUID(uid) {
+			if other.GetConnID() != conn.GetConnID() {
+				return
+			}
+		}
+		if err := c.Evict(context.Background(), uid); err != nil {
+			zap.S().Warn("evict entity error uid = ", uid, " err = ", err)
+		}
+	})
+}
@@ -0,0 +1,272 @@
+package timerwheel
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+
+	"go.uber.org/zap"
+)
+
+// levels 时间轮层数，第i层每格跨度为 tick*slots^i
+const levels = 4
+
+// TimerID 定时器ID，0为无效ID
+type TimerID uint64
+
+// timer 定时器
+type timer struct {
+	id     TimerID
+	expire uint64 // 到期的tick
+	fn     func()
+	slot   *list.List // 所在的格子
+	elem   *list.Element
+	group  *Group
+}
+
+// TimerWheel 分层时间轮，添加与取消定时器均为O(1)，适用于大量buff、技能冷却等游戏定时器。
+// 回调在时间轮goroutine中依次执行，耗时的逻辑需自行开启goroutine
+type TimerWheel struct {
+	tick   time.Duration
+	slots  int
+	wheels [levels][]*list.List
+	spans  [levels + 1]uint64 // 第i层每格跨度的tick数
+	now    uint64             // 已推进的tick数
+	start  time.Time
+	clock  clock.Clock
+	idGen  TimerID
+	timers map[TimerID]*timer
+	lock   sync.Mutex
+	quit   chan struct{}
+	once   sync.Once
+}
+
+// New 创建并启动时间轮，tick为最小精度，slots为每层格数
+func New(tick time.Duration, slots int) *TimerWheel {
+	return NewWithClock(clock.Real, tick, slots)
+}
+
+// NewWithClock 创建按clk推进的时间轮，测试中传入clock.Fake
+func NewWithClock(clk clock.Clock, tick time.Duration, slots int) *TimerWheel {
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+	if slots <= 1 {
+		slots = 256
+	}
+	tw := &TimerWheel{
+		tick:   tick,
+		slots:  slots,
+		start:  clk.Now(),
+		clock:  clk,
+		timers: make(map[TimerID]*timer),
+		quit:   make(chan struct{}),
+	}
+	tw.spans[0] = 1
+	for i := 0; i < levels; i++ {
+		tw.wheels[i] = make([]*list.List, slots)
+		for j := range tw.wheels[i] {
+			tw.wheels[i][j] = list.New()
+		}
+		tw.spans[i+1] = tw.spans[i] * uint64(slots)
+	}
+	go tw.run()
+	return tw
+}
+
+// AddTimer 添加d之后执行fn的定时器
+func (tw *TimerWheel) AddTimer(d time.Duration, fn func()) TimerID {
+	return tw.addTimer(d, fn, nil)
+}
+
+func (tw *TimerWheel) addTimer(d time.Duration, fn func(), group *Group) TimerID {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	tw.idGen++
+	// 向上取整，至少为下一个tick
+	ticks := uint64((d + tw.tick - 1) / tw.tick)
+	if ticks == 0 {
+		ticks = 1
+	}
+	t := &timer{id: tw.idGen, expire: tw.now + ticks, fn: fn, group: group}
+	tw.timers[t.id] = t
+	tw.place(t)
+	return t.id
+}
+
+// place 按到期时间将定时器放入对应层的格子，调用方需持有锁
+func (tw *TimerWheel) place(t *timer) {
+	expire := t.expire
+	if expire < tw.now {
+		expire = tw.now
+	}
+	delta := expire - tw.now
+	level := 0
+	for level < levels-1 && delta >= tw.spans[level+1] {
+		level++
+	}
+	// 超出最高层范围时放在最远的格子，降级时重新计算
+	if max := tw.now + tw.spans[levels] - 1; expire > max {
+		expire = max
+	}
+	t.slot = tw.wheels[level][(expire/tw.spans[level])%uint64(tw.slots)]
+	t.elem = t.slot.PushBack(t)
+}
+
+// CancelTimer 取消定时器，返回定时器是否存在且尚未触发
+func (tw *TimerWheel) CancelTimer(id TimerID) bool {
+	tw.lock.Lock()
+	t, ok := tw.timers[id]
+	if ok {
+		t.slot.Remove(t.elem)
+		delete(tw.timers, id)
+	}
+	tw.lock.Unlock()
+	if ok && t.group != nil {
+		t.group.forget(id)
+	}
+	return ok
+}
+
+// Len 等待触发的定时器数量
+func (tw *TimerWheel) Len() int {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	return len(tw.timers)
+}
+
+// Stop 停止时间轮，未触发的定时器不再执行
+func (tw *TimerWheel) Stop() {
+	tw.once.Do(func() {
+		close(tw.quit)
+	})
+}
+
+// Clock 时间轮使用的时钟
+func (tw *TimerWheel) Clock() clock.Clock {
+	return tw.clock
+}
+
+// NewGroup 创建定时器分组，如房间内的全部定时器，房间销毁时一次性取消
+func (tw *TimerWheel) NewGroup() *Group {
+	return &Group{tw: tw, ids: make(map[TimerID]struct{})}
+}
+
+// run 按墙上时间推进时间轮，避免ticker误差累积
+func (tw *TimerWheel) run() {
+	ticker := tw.clock.NewTicker(tw.tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-tw.quit:
+			return
+		case <-ticker.C():
+			target := uint64(tw.clock.Since(tw.start) / tw.tick)
+			for {
+				tw.lock.Lock()
+				if tw.now >= target {
+					tw.lock.Unlock()
+					break
+				}
+				expired := tw.advance()
+				tw.lock.Unlock()
+				tw.fire(expired)
+			}
+		}
+	}
+}
+
+// advance 推进一个tick，高层格子降级后取出第0层到期的定时器，调用方需持有锁
+func (tw *TimerWheel) advance() []*timer {
+	tw.now++
+	for level := levels - 1; level > 0; level-- {
+		if tw.now%tw.spans[level] != 0 {
+			continue
+		}
+		slot := (tw.now / tw.spans[level]) % uint64(tw.slots)
+		l := tw.wheels[level][slot]
+		for e := l.Front(); e != nil; {
+			next := e.Next()
+			t := l.Remove(e).(*timer)
+			tw.place(t)
+			e = next
+		}
+	}
+	l := tw.wheels[0][tw.now%uint64(tw.slots)]
+	var expired []*timer
+	for e := l.Front(); e != nil; {
+		next := e.Next()
+		t := e.Value.(*timer)
+		if t.expire <= tw.now {
+			l.Remove(e)
+			delete(tw.timers, t.id)
+			expired = append(expired, t)
+		}
+		e = next
+	}
+	return expired
+}
+
+// fire 在锁外执行到期的定时器
+func (tw *TimerWheel) fire(expired []*timer) {
+	for _, t := range expired {
+		if t.group != nil {
+			t.group.forget(t.id)
+		}
+		func() {
+			defer func() {
+				if err := recover(); err != nil {
+					zap.S().Error("timer callback panic: ", err)
+				}
+			}()
+			t.fn()
+		}()
+	}
+}
+
+// Group 定时器分组
+type Group struct {
+	tw   *TimerWheel
+	ids  map[TimerID]struct{}
+	lock sync.Mutex
+}
+
+// AddTimer 在分组内添加定时器
+func (g *Group) AddTimer(d time.Duration, fn func()) TimerID {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	id := g.tw.addTimer(d, fn, g)
+	g.ids[id] = struct{}{}
+	return id
+}
+
+// CancelTimer 取消分组内的定时器
+func (g *Group) CancelTimer(id TimerID) bool {
+	return g.tw.CancelTimer(id)
+}
+
+// CancelAll 取消分组内全部未触发的定时器
+func (g *Group) CancelAll() {
+	g.lock.Lock()
+	ids := g.ids
+	g.ids = make(map[TimerID]struct{})
+	g.lock.Unlock()
+	for id := range ids {
+		g.tw.CancelTimer(id)
+	}
+}
+
+// Len 分组内等待触发的定时器数量
+func (g *Group) Len() int {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return len(g.ids)
+}
+
+func (g *Group) forget(id TimerID) {
+	g.lock.Lock()
+	delete(g.ids, id)
+	g.lock.Unlock()
+}
@@ -0,0 +1,123 @@
+package timerwheel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xiaomingping/game/clock"
+)
+
+// newFakeWheel 创建按clock.Fake推进的时间轮，每格1ms、每层4格，第i层每格跨度为4^i个tick
+func newFakeWheel(t *testing.T) (*TimerWheel, *clock.Fake) {
+	fake := clock.NewFake(time.Time{})
+	tw := NewWithClock(fake, time.Millisecond, 4)
+	t.Cleanup(tw.Stop)
+	// 等待时间轮goroutine创建ticker，之后的Advance才会推进时间轮
+	fake.BlockUntil(1)
+	return tw, fake
+}
+
+// current 时间轮已推进的tick数，在回调中读取即为定时器触发时的tick
+func (tw *TimerWheel) current() uint64 {
+	tw.lock.Lock()
+	defer tw.lock.Unlock()
+	return tw.now
+}
+
+// collect 接收n次触发记录，超时失败
+func collect(t *testing.T, fired <-chan [2]uint64, n int) map[uint64]uint64 {
+	t.Helper()
+	got := make(map[uint64]uint64, n)
+	for i := 0; i < n; i++ {
+		select {
+		case f := <-fired:
+			got[f[0]] = f[1]
+		case <-time.After(time.Second):
+			t.Fatalf("fired %d of %d timers", len(got), n)
+		}
+	}
+	return got
+}
+
+func TestCascade(t *testing.T) {
+	tw, fake := newFakeWheel(t)
+	// 覆盖第0层、逐层降级与超出最高层范围(256个tick)后重新放置的定时器
+	delays := []uint64{1, 3, 4, 5, 15, 16, 17, 63, 64, 65, 200, 255, 256, 300, 1000}
+	fired := make(chan [2]uint64, len(delays))
+	for _, d := range delays {
+		d := d
+		tw.AddTimer(time.Duration(d)*time.Millisecond, func() {
+			fired <- [2]uint64{d, tw.current()}
+		})
+	}
+	fake.Advance(1100 * time.Millisecond)
+	got := collect(t, fired, len(delays))
+	for _, d := range delays {
+		if got[d] != d {
+			t.Errorf("delay %d fired at tick %d", d, got[d])
+		}
+	}
+	if n := tw.Len(); n != 0 {
+		t.Fatalf("Len = %d after all fired", n)
+	}
+}
+
+func TestAdvanceInSteps(t *testing.T) {
+	tw, fake := newFakeWheel(t)
+	fired := make(chan [2]uint64, 1)
+	tw.AddTimer(70*time.Millisecond, func() {
+		fired <- [2]uint64{70, tw.current()}
+	})
+	// 每次推进不足一格，定时器随时间轮逐层降级
+	for i := 0; i < 69; i++ {
+		fake.Advance(time.Millisecond)
+	}
+	select {
+	case <-fired:
+		t.Fatal("fired before expire")
+	case <-time.After(20 * time.Millisecond):
+	}
+	fake.Advance(time.Millisecond)
+	if got := collect(t, fired, 1); got[70] != 70 {
+		t.Fatalf("fired at tick %d", got[70])
+	}
+}
+
+func TestCancel(t *testing.T) {
+	tw, fake := newFakeWheel(t)
+	fired := make(chan [2]uint64, 4)
+	record := func(d uint64) func() {
+		return func() { fired <- [2]uint64{d, tw.current()} }
+	}
+	keep := tw.AddTimer(10*time.Millisecond, record(10))
+	cancelled := tw.AddTimer(10*time.Millisecond, record(11))
+	far := tw.AddTimer(500*time.Millisecond, record(500))
+	g := tw.NewGroup()
+	g.AddTimer(20*time.Millisecond, record(20))
+	g.AddTimer(300*time.Millisecond, record(300))
+	if !tw.CancelTimer(cancelled) || !tw.CancelTimer(far) {
+		t.Fatal("cancel pending timer returned false")
+	}
+	if tw.CancelTimer(cancelled) {
+		t.Fatal("cancel twice returned true")
+	}
+	g.CancelAll()
+	if n := g.Len(); n != 0 {
+		t.Fatalf("group Len = %d after CancelAll", n)
+	}
+	fake.Advance(time.Second)
+	if got := collect(t, fired, 1); got[10] != 10 {
+		t.Fatalf("fired = %v", got)
+	}
+	select {
+	case f := <-fired:
+		t.Fatalf("cancelled timer %d fired", f[0])
+	case <-time.After(20 * time.Millisecond):
+	}
+	if tw.CancelTimer(keep) {
+		t.Fatal("cancel fired timer returned true")
+	}
+	if n := tw.Len(); n != 0 {
+		t.Fatalf("Len = %d", n)
+	}
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/xiaomingping/game/iface"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdkresource "go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// TracerName 框架创建span使用的Tracer名称
+const TracerName = "github.com/xiaomingping/game"
+
+// Attribute 消息span的属性键
+var (
+	AttrMsgID  = attribute.Key("game.msg_id")
+	AttrConnID = attribute.Key("game.conn_id")
+	AttrUID    = attribute.Key("game.uid")
+)
+
+// NewTracerProvider 创建按比例采样的TracerProvider并设置为全局，ratio为采样比例(0~1)，
+// 上游已采样的链路始终采样；Server停止时需调用Shutdown刷新未导出的span
+func NewTracerProvider(serviceName string, ratio float64, exporter sdktrace.SpanExporter) *sdktrace.TracerProvider {
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(sdkresource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp
+}
+
+// Middleware 为每条消息创建一个span，span的上下文通过Request.Context传递给处理方法，
+// 需通过 s.Use(tracing.Middleware()) 添加
+func Middleware() iface.Middleware {
+	tracer := otel.Tracer(TracerName)
+	return func(next iface.HandlerFunc) iface.HandlerFunc {
+		return func(request iface.Request) {
+			conn := request.GetConnection()
+			ctx, span := tracer.Start(request.Context(), "msg "+strconv.FormatUint(uint64(request.GetMsgID()), 10),
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					AttrMsgID.Int64(int64(request.GetMsgID())),
+					AttrConnID.Int64(conn.GetConnID()),
+					AttrUID.String(conn.GetUID()),
+				),
+			)
+			defer span.End()
+			defer func() {
+				// 记录panic后继续抛出，交给框架的panic处理
+				if err := recover(); err != nil {
+					span.SetStatus(codes.Error, fmt.Sprint(err))
+					panic(err)
+				}
+			}()
+			request.SetContext(ctx)
+			next(request)
+		}
+	}
+}
+
+// InjectHTTP 将ctx中的链路信息写入下游HTTP请求头
+func InjectHTTP(ctx context.Context, req *http.Request) {
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+}
+
+// UnaryClientInterceptor 将链路信息写入下游gRPC请求的metadata，
+// 如 grpc.Dial(addr, grpc.WithUnaryInterceptor(tracing.UnaryClientInterceptor()))
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		md, ok := metadata.FromOutgoingContext(ctx)
+		if ok {
+			md = md.Copy()
+		} else {
+			md = metadata.MD{}
+		}
+		otel.GetTextMapPropagator().Inject(ctx, metadataCarrier(md))
+		return invoker(metadata.NewOutgoingContext(ctx, md), method, req, reply, cc, opts...)
+	}
+}
+
+// metadataCarrier gRPC metadata实现的TextMapCarrier
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if v := metadata.MD(c).Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
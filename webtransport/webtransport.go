@@ -0,0 +1,291 @@
+package webtransport
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/xiaomingping/game/iface"
+	"github.com/xiaomingping/game/netw"
+
+	"go.uber.org/zap"
+)
+
+var (
+	ErrFrameTooLarge = errors.New("webtransport: frame too large")
+	ErrNoStream      = errors.New("webtransport: control stream not opened")
+)
+
+// frameHeaderLen 流上每个封包之前的长度字段，4字节小端序，与封包格式的字节序一致
+const frameHeaderLen = 4
+
+// Session WebTransport会话，由HTTP/3实现适配，如 github.com/quic-go/webtransport-go：
+//
+//	type session struct{ *webtransport.Session }
+//
+//	func (s session) AcceptStream(ctx context.Context) (wt.Stream, error) { return s.Session.AcceptStream(ctx) }
+//	func (s session) AcceptUniStream(ctx context.Context) (io.Reader, error) { return s.Session.AcceptUniStream(ctx) }
+//	func (s session) CloseWithError(code uint32, msg string) error {
+//		return s.Session.CloseWithError(webtransport.SessionErrorCode(code), msg)
+//	}
+//
+// QUIC协议栈不包含在框架中，避免提高框架要求的Go版本
+type Session interface {
+	AcceptStream(ctx context.Context) (Stream, error)       // 接受客户端打开的双向流
+	AcceptUniStream(ctx context.Context) (io.Reader, error) // 接受客户端打开的单向流
+	ReceiveDatagram(ctx context.Context) ([]byte, error)    // 接收一个datagram
+	SendDatagram(data []byte) error                         // 发送一个datagram，超过路径MTU时返回错误
+	CloseWithError(code uint32, msg string) error           // 关闭会话
+	Context() context.Context                               // 会话关闭时取消
+}
+
+// Stream WebTransport双向流
+type Stream interface {
+	io.ReadWriteCloser
+}
+
+// Options WebTransport入口的参数
+type Options struct {
+	Tag             string        // 连接的入口标签，默认"webtransport"
+	DatagramMsgIDs  []uint32      // 以datagram下发的MsgID，适合可丢弃的高频状态同步，超过MaxDatagramSize或封包格式没有固定包头时改由控制流下发
+	MaxDatagramSize int           // datagram的最大字节数，默认1200
+	MaxFrameSize    int           // 流上单个封包的最大字节数，默认1MB
+	StreamTimeout   time.Duration // 会话建立后等待客户端打开控制流的时间，默认10s
+}
+
+func (o *Options) withDefaults() {
+	if o.Tag == "" {
+		o.Tag = "webtransport"
+	}
+	if o.MaxDatagramSize <= 0 {
+		o.MaxDatagramSize = 1200
+	}
+	if o.MaxFrameSize <= 0 {
+		o.MaxFrameSize = 1 << 20
+	}
+	if o.StreamTimeout <= 0 {
+		o.StreamTimeout = 10 * time.Second
+	}
+}
+
+// Listener WebTransport入口，每个会话在内存中以websocket连接到Server，对Server而言是一个普通的Connection：
+//
+//   - 客户端打开的第一个双向流为控制流，Server下发的消息默认写入控制流
+//   - 流上每个封包之前带4字节小端序长度，封包格式与websocket消息相同，由Server的Packet拆包
+//   - 客户端打开的其它双向流与单向流只用于上行，不同的流之间互不阻塞，消息顺序只在同一个流内保证
+//   - datagram为一个完整的封包，上行直接交给Server，下行只用于DatagramMsgIDs中的消息
+type Listener struct {
+	server    iface.Server
+	opts      Options
+	loopback  *netw.Loopback
+	datagrams map[uint32]struct{}
+	sessions  int64
+}
+
+// NewListener 创建WebTransport入口，只适配已建立的Session，不监听端口；
+// HTTP/3服务由应用自行启动，在其升级处理中调用Serve
+func NewListener(s iface.Server, opts Options) *Listener {
+	opts.withDefaults()
+	l := &Listener{
+		server:    s,
+		opts:      opts,
+		loopback:  netw.NewLoopback(s, opts.Tag),
+		datagrams: make(map[uint32]struct{}, len(opts.DatagramMsgIDs)),
+	}
+	for _, msgID := range opts.DatagramMsgIDs {
+		l.datagrams[msgID] = struct{}{}
+	}
+	return l
+}
+
+// Len 当前会话数量
+func (l *Listener) Len() int {
+	return int(atomic.LoadInt64(&l.sessions))
+}
+
+// Close 关闭入口，不再接受新会话
+func (l *Listener) Close() error {
+	return l.loopback.Close()
+}
+
+// Serve 处理一个已升级的WebTransport会话，r为升级请求，其参数与请求头按websocket握手交给Server；
+// 阻塞到会话或连接关闭，握手被拒绝时以Server回复的HTTP状态码为错误码关闭会话
+func (l *Listener) Serve(r *http.Request, sess Session) error {
+	ws, status, err := l.loopback.Dial(r)
+	if err != nil {
+		_ = sess.CloseWithError(uint32(status), http.StatusText(status))
+		return err
+	}
+	atomic.AddInt64(&l.sessions, 1)
+	defer atomic.AddInt64(&l.sessions, -1)
+	c := &conn{
+		l:       l,
+		sess:    sess,
+		ws:      ws,
+		control: make(chan Stream, 1),
+	}
+	c.ctx, c.cancel = context.WithCancel(sess.Context())
+	defer c.cancel()
+	go c.acceptStreams()
+	go c.acceptUniStreams()
+	go c.receiveDatagrams()
+	go func() {
+		<-c.ctx.Done()
+		_ = ws.Close()
+	}()
+	err = c.downstream()
+	_ = sess.CloseWithError(0, "")
+	return err
+}
+
+// conn 一个WebTransport会话与其进程内websocket连接
+type conn struct {
+	l       *Listener
+	sess    Session
+	ws      *websocket.Conn
+	wlock   sync.Mutex // 保护websocket写
+	control chan Stream
+	ctx     context.Context
+	cancel  context.CancelFunc
+}
+
+// upstream 将上行封包写入websocket连接
+func (c *conn) upstream(packet []byte) error {
+	c.wlock.Lock()
+	defer c.wlock.Unlock()
+	return c.ws.WriteMessage(websocket.BinaryMessage, packet)
+}
+
+// acceptStreams 接受双向流，第一个为控制流，控制流关闭时结束会话
+func (c *conn) acceptStreams() {
+	first := true
+	for {
+		stream, err := c.sess.AcceptStream(c.ctx)
+		if err != nil {
+			return
+		}
+		if first {
+			first = false
+			c.control <- stream
+			go func() {
+				c.readFrames(stream)
+				c.cancel()
+			}()
+			continue
+		}
+		go c.readFrames(stream)
+	}
+}
+
+func (c *conn) acceptUniStreams() {
+	for {
+		stream, err := c.sess.AcceptUniStream(c.ctx)
+		if err != nil {
+			return
+		}
+		go c.readFrames(stream)
+	}
+}
+
+func (c *conn) receiveDatagrams() {
+	for {
+		data, err := c.sess.ReceiveDatagram(c.ctx)
+		if err != nil {
+			return
+		}
+		if err := c.upstream(data); err != nil {
+			c.cancel()
+			return
+		}
+	}
+}
+
+// readFrames 读取流上的封包交给Server，流结束或封包超长时返回
+func (c *conn) readFrames(r io.Reader) {
+	for {
+		packet, err := ReadFrame(r, c.l.opts.MaxFrameSize)
+		if err != nil {
+			if err != io.EOF {
+				zap.S().Debug("webtransport read stream error ", err)
+			}
+			return
+		}
+		if err := c.upstream(packet); err != nil {
+			c.cancel()
+			return
+		}
+	}
+}
+
+// downstream 将Server下发的消息写入datagram或控制流，连接关闭时返回
+func (c *conn) downstream() error {
+	var control Stream
+	select {
+	case control = <-c.control:
+	case <-time.After(c.l.opts.StreamTimeout):
+		return ErrNoStream
+	case <-c.ctx.Done():
+		return c.ctx.Err()
+	}
+	for {
+		_, packet, err := c.ws.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		if c.isDatagram(packet) && c.sess.SendDatagram(packet) == nil {
+			continue
+		}
+		if err := WriteFrame(control, packet); err != nil {
+			return err
+		}
+	}
+}
+
+// isDatagram 封包是否以datagram下发
+func (c *conn) isDatagram(packet []byte) bool {
+	if len(c.l.datagrams) == 0 || len(packet) > c.l.opts.MaxDatagramSize {
+		return false
+	}
+	msgID, ok := netw.PeekMsgID(c.l.server.Packet(), packet)
+	if !ok {
+		return false
+	}
+	_, ok = c.l.datagrams[msgID]
+	return ok
+}
+
+// ReadFrame 从流中读取一个带长度前缀的封包，max<=0时不限制长度
+func ReadFrame(r io.Reader, max int) ([]byte, error) {
+	var head [frameHeaderLen]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return nil, err
+	}
+	n := binary.LittleEndian.Uint32(head[:])
+	if max > 0 && int64(n) > int64(max) {
+		return nil, fmt.Errorf("%w: %d > %d", ErrFrameTooLarge, n, max)
+	}
+	packet := make([]byte, n)
+	if _, err := io.ReadFull(r, packet); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return packet, nil
+}
+
+// WriteFrame 向流中写入一个带长度前缀的封包
+func WriteFrame(w io.Writer, packet []byte) error {
+	buf := make([]byte, frameHeaderLen+len(packet))
+	binary.LittleEndian.PutUint32(buf, uint32(len(packet)))
+	copy(buf[frameHeaderLen:], packet)
+	_, err := w.Write(buf)
+	return err
+}